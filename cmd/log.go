@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+
+	"github.com/realdatadriven/etlx"
+)
+
+// dotEnvErr is the error loading the .env, logged once the logger is set up
+var dotEnvErr error
+
+// logFlags adds -log-level and -log-format to fs, defaulting to ETLX_LOG_LEVEL
+// and ETLX_LOG_FORMAT
+func logFlags(fs *flag.FlagSet) (level *string, format *string) {
+	level = fs.String("log-level", envOr("ETLX_LOG_LEVEL", "info"), "Log level: debug, info, warn or error")
+	format = fs.String("log-format", envOr("ETLX_LOG_FORMAT", "text"), "Log format: text or json")
+	return level, format
+}
+
+// setupLogger sends the logs of the runs to stderr, stdout is left to the
+// output of the command (plan, validation, ...)
+func setupLogger(level string, format string) *slog.Logger {
+	logger, err := etlx.NewLogger(os.Stderr, level, format)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	etlx.SetLogger(logger)
+	if dotEnvErr != nil {
+		logger.Warn(dotEnvErr.Error())
+	}
+	return logger
+}
+
+func envOr(key string, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -1,18 +1,22 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/realdatadriven/etlx"
 )
 
 func main() {
-	etlx.LoadDotEnv()
+	dotEnvErr = etlx.LoadDotEnv()
 	dir, _err := os.Getwd()
 	if _err != nil {
 		dir = ""
@@ -20,6 +24,14 @@ func main() {
 	//fmt.Println("CWD", dir)
 	os.Setenv("CWD", dir)
 	os.Setenv("TMP", os.TempDir())
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		runValidate(os.Args[2:])
+		return
+	}
 	// Config file path
 	filePath := flag.String("config", "config.md", "Config File")
 	// date of reference
@@ -38,22 +50,63 @@ func main() {
 	drop := flag.Bool("drop", false, "To drop the table (execute drop_sql on every item, conditioned by only and skip)")
 	// To get number of rows in the table (execute rows_sql on every item, conditioned by only and skip)
 	rows := flag.Bool("rows", false, "To get number of rows in the table (execute rows_sql on every item, conditioned by only and skip)")
+	// Run state store, to be able to resume a failed run
+	stateFile := flag.String("state", "", "Run state file, to be able to resume the run, none by default, -resume defaults it to <config>.state.db next to the config")
+	// Resume a previous run
+	resume := flag.String("resume", "", "Run id of a previous run to resume, only the failed and not yet run steps are executed")
+	// Backfill a date range
+	from := flag.String("from", "", "Backfill start date YYYY-MM-DD, runs every date reference from -from to -to")
+	to := flag.String("to", "", "Backfill end date YYYY-MM-DD, defaults to -date")
+	granularity := flag.String("granularity", "day", "Backfill granularity: day, week or month")
+	parallel := flag.Int("parallel", 1, "Max date references of the backfill running at the same time")
+	// Plan mode, nothing is executed
+	dryRun := flag.Bool("dry-run", false, "Print the plan (every key/item/step with its connection and final SQL) without opening any connection")
+	planFormat := flag.String("plan-format", "md", "Format of the dry run plan: md or json")
+	pushgateway := flag.String("pushgateway", "", "Pushgateway URL the metrics of the run are pushed to when it ends, defaults to the prometheus pushgateway of the frontmatter or ETLX_PUSHGATEWAY_URL")
+	report := flag.String("report", "", "Write a report of every key/item/step of the run to this file")
+	reportFormat := flag.String("report-format", "", "Format of the report: md, json or junit, defaults to the extension of -report (.md, .xml) or json")
+	failOn := flag.String("fail-on", "any", "Exit with 1 when any key fails (any) or only when a key with critical: true does (critical)")
+	readParams := paramFlags(flag.CommandLine)
+	logLevel, logFormat := logFlags(flag.CommandLine)
 	flag.Parse()
+	logger := setupLogger(*logLevel, *logFormat)
+	if *failOn != "any" && *failOn != "critical" {
+		log.Fatalf("Error: invalid -fail-on %q (any or critical)", *failOn)
+	}
+	if *report != "" && *reportFormat == "" {
+		*reportFormat = etlx.ReportFormat(*report)
+	}
+	if *reportFormat != "" && *reportFormat != "md" && *reportFormat != "json" && *reportFormat != "junit" {
+		log.Fatalf("Error: invalid -report-format %q (md, json or junit)", *reportFormat)
+	}
+	// THE EXIT CODE IS SET LAST, AFTER THE DEFERRED CLEANUP (RUN STATE, SIGNALS)
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
 	config := make(map[string]any)
 	// Parse the file content
 	etlxlib := &etlx.ETLX{Config: config, Params: map[string]any{}, TimeZone: time.Local}
 	etlxlib.MetadataOrder = true
+	etlxlib.DryRun = *dryRun
+	etlxlib.Pushgateway = *pushgateway
 	err := etlxlib.ConfigFromFile(*filePath)
 	if err != nil {
 		log.Fatalf("Error parsing Markdown: %v", err)
 	}
+	etlxlib.Params, err = readParams()
+	if err != nil {
+		log.Fatalf("Error reading the params: %v", err)
+	}
+	if err := etlxlib.ResolveParams(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 	if _, ok := etlxlib.Config["REQUIRES"]; ok {
-		_logs, err := etlxlib.LoadREQUIRES(nil)
+		_, err := etlxlib.LoadREQUIRES(nil)
 		if err != nil {
-			fmt.Printf("REQUIRES ERR: %v\n", err)
-		}
-		for _, _log := range _logs {
-			fmt.Println(_log["start_at"], _log["end_at"], _log["duration"], _log["name"], _log["success"], _log["msg"], _log["rows"])
+			logger.Error("loading the requirements failed", "key", "REQUIRES", "err", err)
 		}
 	}
 	// Print the parsed configuration
@@ -69,9 +122,63 @@ func main() {
 			fmt.Printf("Entering: %s\n", keyPath)
 		}
 	})*/
+	// RUN STATE
+	if *stateFile == "" && *resume != "" {
+		*stateFile = etlx.DefaultRunStatePath(*filePath)
+	}
+	if *stateFile != "" && !*dryRun {
+		err := etlxlib.OpenRunState(*stateFile)
+		if err != nil {
+			logger.Error("opening the run state failed", "state", *stateFile, "err", err)
+		} else {
+			defer etlxlib.State.Close()
+		}
+	}
+	dateRefs := []string{*date_ref}
+	if *resume != "" {
+		_dateRefs, err := etlxlib.ResumeRun(*resume)
+		if err != nil {
+			log.Fatalf("Error resuming: %v", err)
+		}
+		dateSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "date" {
+				dateSet = true
+			}
+		})
+		if !dateSet {
+			dateRefs = _dateRefs
+		}
+	}
+	if etlxlib.RunID != "" {
+		logger.Info("run started", "run_id", etlxlib.RunID)
+	}
+	if *from != "" {
+		if *to == "" {
+			*to = *date_ref
+		}
+		_from, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			log.Fatalf("Error parsing -from: %v", err)
+		}
+		_to, err := time.Parse("2006-01-02", *to)
+		if err != nil {
+			log.Fatalf("Error parsing -to: %v", err)
+		}
+		_dates, err := etlx.DateRange(_from, _to, *granularity)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		dateRefs = []string{}
+		for _, _dt := range _dates {
+			dateRefs = append(dateRefs, _dt.Format("2006-01-02"))
+		}
+	}
 	var dateRef []time.Time
-	_dt, _ := time.Parse("2006-01-02", *date_ref)
-	dateRef = append(dateRef, _dt)
+	for _, _dateRef := range dateRefs {
+		_dt, _ := time.Parse("2006-01-02", _dateRef)
+		dateRef = append(dateRef, _dt)
+	}
 	// fmt.Println("date_ref:", *date_ref, dateRef)
 	extraConf := map[string]any{
 		"clean": *clean,
@@ -89,41 +196,81 @@ func main() {
 		extraConf["steps"] = strings.Split(*steps, ",")
 	}
 	etlxlib.RemoteSkiped = false
-	// logs, err :=
-	etlxlib.RunETLX(extraConf, dateRef)
-	// GENERATE GRAPH NODES AND EDGES MERMAID FLOWCHART
-	// fmt.Println("Generating Graph Nodes and Edges | Mermaid flowchart...")
-	// fmt.Println(etlxlib.MD)
-	mdData, err := etlxlib.QueryETLXMD("")
-	if err != nil {
-		// fmt.Println("QueryETLXMD: ", err)
-		return
-	}
-	nodes, ok := mdData["nodes"]
-	if !ok {
-		// fmt.Println("No nodes data found")
+	if *dryRun {
+		plans := []*etlx.Plan{}
+		for _, _dateRef := range dateRef {
+			plan, err := etlxlib.Plan(extraConf, []time.Time{_dateRef})
+			if err != nil {
+				log.Fatalf("Error planning: %v", err)
+			}
+			plans = append(plans, plan)
+		}
+		if *planFormat == "json" {
+			var out any = plans
+			if len(plans) == 1 {
+				out = plans[0]
+			}
+			_json, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			fmt.Println(string(_json))
+		} else {
+			for _, plan := range plans {
+				fmt.Print(plan.Markdown())
+			}
+		}
 		return
 	}
-	edges, ok := mdData["edges"]
-	if !ok {
-		// fmt.Println("No edges data found")
-		return
+	// SIGINT / SIGTERM CANCEL THE RUNNING QUERIES, THE after_sql CLEANUP STILL RUNS
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// A SECOND SIGNAL KILLS THE PROCESS RIGHT AWAY
+		stop()
+	}()
+	etlxlib.SetContext(ctx)
+	reports := []*etlx.RunReport{}
+	if len(dateRef) == 1 {
+		start := time.Now()
+		logs, data, err := etlxlib.RunETLX(extraConf, dateRef)
+		if err != nil {
+			logger.Error("run failed", "run_id", etlxlib.RunID, "err", err)
+		}
+		reports = append(reports, etlxlib.NewRunReport(dateRef, start, time.Now(), logs, data, err))
+		fmt.Fprint(os.Stderr, reports[0].Summary())
+	} else {
+		results := etlxlib.RunBackfill(extraConf, dateRef, *parallel)
+		fmt.Fprint(os.Stderr, etlx.BackfillSummary(results))
+		for _, res := range results {
+			reports = append(reports, etlxlib.NewRunReport([]time.Time{res.DateRef}, res.StartAt, res.StartAt.Add(res.Duration), res.Logs, res.Data, res.Err))
+		}
 	}
-	if len(nodes) == 0 {
-		nodes, ok = mdData["nodes_est"]
-		if !ok {
-			// fmt.Println("No nodes data found")
-			return
+	if *report != "" {
+		if err := writeReport(*report, reports, *reportFormat); err != nil {
+			logger.Error("writing the report failed", "report", *report, "err", err)
+			exitCode = 1
 		}
 	}
-	if len(edges) == 0 {
-		edges, ok = mdData["edges_est"]
-		if !ok {
-			// fmt.Println("No edges data found")
-			return
+	for _, r := range reports {
+		if r.Failed(*failOn) {
+			exitCode = 1
 		}
 	}
-	flow := etlxlib.GenerateMermaidFlowchart(nodes, edges)
+	if ctx.Err() != nil {
+		// INTERRUPTED, AS A SHELL REPORTS A SIGINT
+		exitCode = 130
+		return
+	}
+	// GENERATE GRAPH NODES AND EDGES MERMAID FLOWCHART
+	// fmt.Println("Generating Graph Nodes and Edges | Mermaid flowchart...")
+	// fmt.Println(etlxlib.MD)
+	flow, err := etlxlib.MermaidFlowchart("")
+	if err != nil {
+		// fmt.Println("MermaidFlowchart: ", err)
+		return
+	}
 	etlxlib.TempFIle("", flow, "flowchart.*.mmd")
 	//if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
 	//fmt.Println("Mermaid Flowchart:\n", f)
@@ -131,3 +278,16 @@ func main() {
 
 	// fmt.Println("GenerateMermaidFlowchart: ", flow)
 }
+
+// writeReport writes the reports of the run to path
+func writeReport(path string, reports []*etlx.RunReport, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := etlx.WriteReport(f, reports, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/realdatadriven/etlx"
+)
+
+// paramList is the repeatable -param key=value
+type paramList []string
+
+func (p *paramList) String() string {
+	return strings.Join(*p, ", ")
+}
+
+func (p *paramList) Set(s string) error {
+	if _, _, err := etlx.ParseParam(s); err != nil {
+		return err
+	}
+	*p = append(*p, s)
+	return nil
+}
+
+// paramFlags adds -param and -params-file to fs, the returned func reads the
+// params once fs is parsed, the -param ones overriding the file
+func paramFlags(fs *flag.FlagSet) func() (map[string]any, error) {
+	params := &paramList{}
+	fs.Var(params, "param", "Run param key=value, repeatable, available as @PARAM.key in the queries, paths and templates")
+	file := fs.String("params-file", "", "YAML or JSON file with the run params")
+	return func() (map[string]any, error) {
+		values := map[string]any{}
+		if *file != "" {
+			_values, err := etlx.LoadParamsFile(*file)
+			if err != nil {
+				return nil, err
+			}
+			values = _values
+		}
+		for _, p := range *params {
+			name, value, _ := etlx.ParseParam(p)
+			values[name] = value
+		}
+		return values, nil
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/realdatadriven/etlx"
+)
+
+// runServe is the `etlx serve` daemon, it runs the Level 1 keys that have a
+// `schedule` (cron) in their metadata until it gets SIGINT / SIGTERM, with
+// -addr it also serves the HTTP API to trigger and inspect runs
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	filePath := fs.String("config", "config.md", "Config File")
+	stateFile := fs.String("state", "", "Run state file, to be able to resume the runs, disabled when empty")
+	poll := fs.Duration("poll", 5*time.Second, "How often the config file is checked for changes")
+	addr := fs.String("addr", "", "Address of the HTTP API, e.g. :8080 (localhost) or 0.0.0.0:8080 (every interface), disabled when empty")
+	configDir := fs.String("config-dir", "", "Directory the configs requested through the HTTP API must be in, defaults to the working directory")
+	token := fs.String("token", os.Getenv("ETLX_API_TOKEN"), "Bearer token required by the HTTP API, defaults to ETLX_API_TOKEN")
+	allowInline := fs.Bool("allow-inline", false, "Accept inline configs (md) in POST /runs of the HTTP API, they run any SQL / script sent")
+	maxRuns := fs.Int("max-runs", etlx.DefaultAPIMaxRuns, "Finished runs the HTTP API keeps in memory with their logs, the oldest are dropped first")
+	metricsAddr := fs.String("metrics-addr", "", "Address of the Prometheus /metrics endpoint, e.g. :9090, also served by the HTTP API (-addr)")
+	logLevel, logFormat := logFlags(fs)
+	fs.Parse(args)
+	logger := setupLogger(*logLevel, *logFormat)
+	scheduler := etlx.NewScheduler(*filePath, nil)
+	scheduler.PollInterval = *poll
+	// THE SCHEDULED AND THE API RUNS SHARE THE METRICS
+	metrics := etlx.NewRunMetrics()
+	scheduler.Metrics = metrics
+	if *stateFile != "" {
+		stateStore := &etlx.ETLX{TimeZone: time.Local}
+		err := stateStore.OpenRunState(*stateFile)
+		if err != nil {
+			logger.Error("opening the run state failed", "state", *stateFile, "err", err)
+		} else {
+			defer stateStore.State.Close()
+			scheduler.State = stateStore.State
+		}
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *addr != "" {
+		api := etlx.NewAPIServer(*filePath)
+		api.ConfigDir = *configDir
+		api.Token = *token
+		api.AllowInline = *allowInline
+		api.MaxRuns = *maxRuns
+		api.State = scheduler.State
+		api.Metrics = metrics
+		apiAddr := localAddr(*addr)
+		if !isLoopback(apiAddr) && *token == "" {
+			logger.Warn("the API is reachable from other hosts without a token (-token / ETLX_API_TOKEN)", "addr", apiAddr)
+		}
+		srv := &http.Server{Addr: apiAddr, Handler: api.Handler()}
+		go func() {
+			logger.Info("API listening", "addr", apiAddr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error: %v", err)
+			}
+		}()
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			srv.Shutdown(shutdownCtx)
+			if err := api.Shutdown(shutdownCtx); err != nil {
+				logger.Warn("API runs still running at shutdown", "err", err)
+			}
+		}()
+	}
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics)
+		srv := &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			logger.Info("metrics listening", "addr", *metricsAddr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Error: %v", err)
+			}
+		}()
+		defer srv.Close()
+	}
+	logger.Info("serving", "config", *filePath)
+	if err := scheduler.Run(ctx); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+// localAddr binds an address without host (:8080) to localhost, an explicit
+// host (0.0.0.0:8080) is kept
+func localAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// isLoopback tells if addr only listens on localhost
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
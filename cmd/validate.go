@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/realdatadriven/etlx"
+)
+
+// runValidate is `etlx validate`, it checks the config against the schema of
+// each runs_as without running anything and exits with 1 when it has errors
+func runValidate(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	filePath := fs.String("config", "config.md", "Config File")
+	format := fs.String("format", "text", "Output format: text or json")
+	strict := fs.Bool("strict", false, "Warnings (e.g. unknown fields) also fail the validation")
+	logLevel, logFormat := logFlags(fs)
+	fs.Parse(args)
+	setupLogger(*logLevel, *logFormat)
+	etlxlib := &etlx.ETLX{Config: map[string]any{}, Params: map[string]any{}, TimeZone: time.Local}
+	etlxlib.MetadataOrder = true
+	err := etlxlib.ConfigFromFile(*filePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *filePath, err)
+		os.Exit(1)
+	}
+	errs := etlxlib.Validate()
+	failed := false
+	for _, err := range errs {
+		if err.Level == "error" || *strict {
+			failed = true
+		}
+	}
+	if *format == "json" {
+		jsonData, err := json.MarshalIndent(errs, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(jsonData))
+	} else {
+		for _, err := range errs {
+			line := err.Line
+			err.Line = 0
+			fmt.Printf("%s:%d: %s: %s\n", *filePath, line, err.Level, err.Error())
+		}
+		if len(errs) == 0 {
+			fmt.Printf("%s: ok\n", *filePath)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
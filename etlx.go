@@ -1,11 +1,17 @@
 package etlx
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/realdatadriven/etlx/internal/db"
 	etlxlib "github.com/realdatadriven/etlx/internal/etlx"
+	"github.com/realdatadriven/etlx/internal/secrets"
 )
 
 // Expose the library functions
@@ -15,6 +21,10 @@ type DBInterface = db.DBInterface
 
 type DB = db.DB
 
+type CSVOptions = db.CSVOptions
+
+type ArrowOptions = db.ArrowOptions
+
 func New(driverName string, dsn string) (*db.DB, error) {
 	return db.New(driverName, dsn)
 }
@@ -25,11 +35,11 @@ func NewDuckDB(dsn string) (*db.DuckDB, error) {
 	return db.NewDuckDB(dsn)
 }
 
-/*type ODBC = db.ODBC
+type ODBC = db.ODBC
 
 func NewODBC(dsn string) (*db.ODBC, error) {
 	return db.NewODBC(dsn)
-}*/
+}
 
 func ReplaceDBName(dsn, dbname string) (string, error) {
 	return db.ReplaceDBName(dsn, dbname)
@@ -52,9 +62,119 @@ func GetDB(conn string) (DBInterface, error) {
 	return etlxlib.GetDB(conn)
 }
 
-func LoadDotEnv() {
+// LoadDotEnv loads the .env file of the working directory into the
+// environment, a missing .env is not an error
+func LoadDotEnv() error {
 	_err := godotenv.Load()
-	if _err != nil {
-		fmt.Printf("Error loading .env file: %s!", _err.Error())
+	if _err != nil && !errors.Is(_err, fs.ErrNotExist) {
+		return fmt.Errorf("loading the .env file: %w", _err)
 	}
+	return nil
+}
+
+// SetLogger sets the logger of the runs without a Logger of their own,
+// nothing is logged until it is set (or ETLX_LOG_LEVEL is)
+func SetLogger(l *slog.Logger) {
+	etlxlib.SetLogger(l)
+}
+
+// NewLogger returns a logger writing to w from level (debug, info, warn or
+// error) on, as text or json lines, with the secrets masked
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	return etlxlib.NewLogger(w, level, format)
+}
+
+type RunState = etlxlib.RunState
+
+func DefaultRunStatePath(configPath string) string {
+	return etlxlib.DefaultRunStatePath(configPath)
+}
+
+func NewRunID() string {
+	return etlxlib.NewRunID()
+}
+
+type BackfillResult = etlxlib.BackfillResult
+
+func DateRange(from time.Time, to time.Time, granularity string) ([]time.Time, error) {
+	return etlxlib.DateRange(from, to, granularity)
+}
+
+func BackfillSummary(results []etlxlib.BackfillResult) string {
+	return etlxlib.BackfillSummary(results)
+}
+
+type Scheduler = etlxlib.Scheduler
+
+type CronSchedule = etlxlib.CronSchedule
+
+func NewScheduler(configPath string, extraConf map[string]any) *etlxlib.Scheduler {
+	return etlxlib.NewScheduler(configPath, extraConf)
+}
+
+func ParseCron(expr string) (*etlxlib.CronSchedule, error) {
+	return etlxlib.ParseCron(expr)
+}
+
+type APIServer = etlxlib.APIServer
+
+type APIRunRequest = etlxlib.APIRunRequest
+
+func NewAPIServer(config string) *etlxlib.APIServer {
+	return etlxlib.NewAPIServer(config)
+}
+
+const DefaultAPIMaxRuns = etlxlib.DefaultAPIMaxRuns
+
+type Plan = etlxlib.Plan
+
+type ValidationError = etlxlib.ValidationError
+
+type ConnectionDef = etlxlib.ConnectionDef
+
+type SecretResolver = secrets.Resolver
+
+// MaskSecrets replaces the secret values resolved so far in s
+func MaskSecrets(s string) string {
+	return secrets.Mask(s)
+}
+
+type TelemetryConfig = etlxlib.TelemetryConfig
+
+type RunMetrics = etlxlib.RunMetrics
+
+type PushConfig = etlxlib.PushConfig
+
+func NewRunMetrics() *etlxlib.RunMetrics {
+	return etlxlib.NewRunMetrics()
+}
+
+type ParamSpec = etlxlib.ParamSpec
+
+type RunError = etlxlib.RunError
+
+type RunReport = etlxlib.RunReport
+
+func ReportFormat(path string) string {
+	return etlxlib.ReportFormat(path)
+}
+
+func WriteReport(w io.Writer, reports []*etlxlib.RunReport, format string) error {
+	return etlxlib.WriteReport(w, reports, format)
+}
+
+func ParseParam(s string) (string, string, error) {
+	return etlxlib.ParseParam(s)
+}
+
+func LoadParamsFile(path string) (map[string]any, error) {
+	return etlxlib.LoadParamsFile(path)
+}
+
+type FieldSpec = etlxlib.FieldSpec
+
+type KindSchema = etlxlib.KindSchema
+
+func SchemaFor(runsAs string) (etlxlib.KindSchema, bool) {
+	return etlxlib.SchemaFor(runsAs)
 }
@@ -0,0 +1,377 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/duckdb/duckdb-go/v2"
+	"github.com/lib/pq"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// maxBatchParams is the most bind parameters a single statement takes on each driver
+func maxBatchParams(driverName string) int {
+	switch driverName {
+	case "mssql", "sqlserver", "odbc":
+		return 2000 // 2100 on sql server (also the usual odbc target), some are kept for the driver
+	case "sqlite3", "sqlite":
+		return 32766
+	default:
+		return 65535
+	}
+}
+
+func placeholder(driverName string, n int) string {
+	switch driverName {
+	case "postgres", "postgresql", "pgx":
+		return fmt.Sprintf("$%d", n)
+	case "mssql", "sqlserver":
+		return fmt.Sprintf("@p%d", n)
+	default:
+		return "?"
+	}
+}
+
+// BatchInsertSQL completes insertSQL (INSERT INTO t (a, b) VALUES) with nRows
+// groups of nCols bind parameters in the driver placeholder syntax
+func BatchInsertSQL(driverName string, insertSQL string, nCols int, nRows int) string {
+	var sb strings.Builder
+	sb.WriteString(strings.TrimRight(strings.TrimSpace(insertSQL), ";"))
+	sb.WriteString(" ")
+	n := 0
+	for r := 0; r < nRows; r++ {
+		if r > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(")
+		for c := 0; c < nCols; c++ {
+			if c > 0 {
+				sb.WriteString(", ")
+			}
+			n++
+			sb.WriteString(placeholder(driverName, n))
+		}
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// QuoteIdentifier quotes a table or column name the way the driver expects
+func QuoteIdentifier(driverName string, name string) string {
+	switch driverName {
+	case "mssql", "sqlserver":
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	case "mysql":
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	default:
+		return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+	}
+}
+
+// SplitIdentifier splits a possibly qualified and quoted table name
+// (catalog.schema.table, "s"."t", [s].[t], `s`.`t`) into its unquoted parts
+func SplitIdentifier(name string) []string {
+	var parts []string
+	var cur strings.Builder
+	var closing rune
+	runes := []rune(strings.TrimSpace(name))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case closing != 0 && r == closing:
+			// a doubled closing quote is an escaped one
+			if i+1 < len(runes) && runes[i+1] == closing {
+				cur.WriteRune(r)
+				i++
+			} else {
+				closing = 0
+			}
+		case closing != 0:
+			cur.WriteRune(r)
+		case r == '"' || r == '`':
+			closing = r
+		case r == '[':
+			closing = ']'
+		case r == '.':
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// insertBatch inserts rows with insertSQL in multi-row parameterized
+// statements, sized to the driver bind parameters limit, in one transaction
+func insertBatch(ctx context.Context, conn *sql.DB, driverName string, insertSQL string, nCols int, rows [][]any) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if nCols <= 0 {
+		return 0, fmt.Errorf("no columns to insert")
+	}
+	perStmt := max(1, maxBatchParams(driverName)/nCols)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	var total int64
+	var stmt *sql.Stmt
+	stmtRows := 0
+	for start := 0; start < len(rows); start += perStmt {
+		chunk := rows[start:min(start+perStmt, len(rows))]
+		if stmt == nil || stmtRows != len(chunk) {
+			if stmt != nil {
+				stmt.Close()
+			}
+			stmt, err = tx.PrepareContext(ctx, BatchInsertSQL(driverName, insertSQL, nCols, len(chunk)))
+			if err != nil {
+				return total, err
+			}
+			stmtRows = len(chunk)
+		}
+		args := make([]any, 0, len(chunk)*nCols)
+		for _, row := range chunk {
+			if len(row) != nCols {
+				stmt.Close()
+				return total, fmt.Errorf("row has %d values, expected %d", len(row), nCols)
+			}
+			args = append(args, row...)
+		}
+		res, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			stmt.Close()
+			return total, err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			total += n
+		}
+	}
+	stmt.Close()
+	return total, tx.Commit()
+}
+
+// copyIn streams rows through a statement prepared in a transaction, used by
+// the COPY of postgres and the bulk copy of sql server
+func copyIn(ctx context.Context, conn *sql.DB, query string, rows [][]any) (int64, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, err
+		}
+	}
+	// the last exec without values flushes the rows
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		n = int64(len(rows))
+	}
+	return n, tx.Commit()
+}
+
+// executeInTx runs queries as written (no placeholder rewriting) in one transaction
+func executeInTx(ctx context.Context, conn *sql.DB, queries []string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ExecuteInTx runs queries in one transaction, bound to ctx only
+func (db *DB) ExecuteInTx(ctx context.Context, queries ...string) error {
+	return executeInTx(ctx, db.DB.DB, queries)
+}
+
+// InsertBatch inserts rows with insertSQL (INSERT INTO t (a, b) VALUES) in
+// parameterized multi-row statements within a transaction
+func (db *DB) InsertBatch(ctx context.Context, insertSQL string, nCols int, rows [][]any) (int64, error) {
+	return insertBatch(ctx, db.DB.DB, db.DriverName(), insertSQL, nCols, rows)
+}
+
+// BulkInsert writes rows into table through the driver bulk path: COPY on
+// postgres, bulk copy on sql server and parameterized batches in a
+// transaction on the others
+func (db *DB) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	switch db.DriverName() {
+	case "postgres", "postgresql":
+		quoted := make([]string, len(columns))
+		for i, col := range columns {
+			quoted[i] = pq.QuoteIdentifier(col)
+		}
+		query := fmt.Sprintf("COPY %s (%s) FROM STDIN", table, strings.Join(quoted, ", "))
+		return copyIn(ctx, db.DB.DB, query, rows)
+	case "mssql", "sqlserver":
+		return copyIn(ctx, db.DB.DB, mssql.CopyIn(table, mssql.BulkOptions{}, columns...), rows)
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdentifier(db.DriverName(), col)
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES", table, strings.Join(quoted, ", "))
+	return db.InsertBatch(ctx, insertSQL, len(columns), rows)
+}
+
+// ExecuteInTx runs queries in one transaction, bound to ctx only
+func (db *DuckDB) ExecuteInTx(ctx context.Context, queries ...string) error {
+	return executeInTx(ctx, db.DB, queries)
+}
+
+// InsertBatch inserts rows with insertSQL (INSERT INTO t (a, b) VALUES) in
+// parameterized multi-row statements within a transaction
+func (db *DuckDB) InsertBatch(ctx context.Context, insertSQL string, nCols int, rows [][]any) (int64, error) {
+	return insertBatch(ctx, db.DB, "duckdb", insertSQL, nCols, rows)
+}
+
+// BulkInsert writes rows into table with the duckdb appender, falling back
+// to parameterized batches when a value does not fit the appender types
+func (db *DuckDB) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	var catalog, schema, name string
+	parts := SplitIdentifier(table)
+	switch len(parts) {
+	case 1:
+		name = parts[0]
+	case 2:
+		schema, name = parts[0], parts[1]
+	case 3:
+		catalog, schema, name = parts[0], parts[1], parts[2]
+	default:
+		return 0, fmt.Errorf("invalid table name %s", table)
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdentifier("duckdb", col)
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES", table, strings.Join(quoted, ", "))
+	// the appender takes decimals unscaled, they are scaled here
+	scales := make([]int, len(columns))
+	types, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s LIMIT 0", strings.Join(quoted, ", "), table))
+	if err != nil {
+		return 0, err
+	}
+	colTypes, err := types.ColumnTypes()
+	types.Close()
+	if err != nil {
+		return 0, err
+	}
+	for i, t := range colTypes {
+		scales[i] = -1
+		var width, scale int
+		if n, _ := fmt.Sscanf(t.DatabaseTypeName(), "DECIMAL(%d,%d)", &width, &scale); n == 2 {
+			scales[i] = scale
+		}
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "BEGIN TRANSACTION"); err != nil {
+		return 0, err
+	}
+	err = conn.Raw(func(driverConn any) error {
+		appender, err := duckdb.NewAppenderWithColumns(driverConn.(driver.Conn), catalog, schema, name, columns)
+		if err != nil {
+			return err
+		}
+		values := make([]driver.Value, len(columns))
+		for _, row := range rows {
+			if len(row) != len(columns) {
+				appender.Close()
+				return fmt.Errorf("row has %d values, expected %d", len(row), len(columns))
+			}
+			for i, v := range row {
+				values[i] = v
+				if scales[i] >= 0 && v != nil {
+					if values[i], err = toDecimal(v, scales[i]); err != nil {
+						appender.Close()
+						return err
+					}
+				}
+			}
+			if err := appender.AppendRow(values...); err != nil {
+				appender.Close()
+				return err
+			}
+		}
+		return appender.CloseWithCancel(ctx)
+	})
+	if err != nil {
+		conn.ExecContext(context.WithoutCancel(ctx), "ROLLBACK")
+		if ctx.Err() != nil {
+			return 0, err
+		}
+		return insertBatch(ctx, db.DB, "duckdb", insertSQL, len(columns), rows)
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
+}
+
+// toDecimal scales a number (or its text) to a duckdb decimal with scale digits
+func toDecimal(v any, scale int) (any, error) {
+	r := new(big.Rat)
+	switch val := v.(type) {
+	case duckdb.Decimal:
+		return val, nil
+	case float64:
+		r.SetString(strconv.FormatFloat(val, 'f', -1, 64))
+	case float32:
+		r.SetString(strconv.FormatFloat(float64(val), 'f', -1, 32))
+	case int64:
+		r.SetInt64(val)
+	case int:
+		r.SetInt64(int64(val))
+	case int32:
+		r.SetInt64(int64(val))
+	case string:
+		if _, ok := r.SetString(strings.TrimSpace(val)); !ok {
+			return nil, fmt.Errorf("invalid decimal %q", val)
+		}
+	case []byte:
+		if _, ok := r.SetString(strings.TrimSpace(string(val))); !ok {
+			return nil, fmt.Errorf("invalid decimal %q", val)
+		}
+	default:
+		return v, nil
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	// round half away from zero
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(m), big.NewInt(2)).Cmp(r.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Num().Sign())))
+	}
+	return duckdb.Decimal{Width: 38, Scale: uint8(scale), Value: q}, nil
+}
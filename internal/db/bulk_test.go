@@ -0,0 +1,126 @@
+package db
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/duckdb/duckdb-go/v2"
+)
+
+func TestBatchInsertSQL(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"postgres", "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4)"},
+		{"pgx", "INSERT INTO t (a, b) VALUES ($1, $2), ($3, $4)"},
+		{"sqlserver", "INSERT INTO t (a, b) VALUES (@p1, @p2), (@p3, @p4)"},
+		{"mssql", "INSERT INTO t (a, b) VALUES (@p1, @p2), (@p3, @p4)"},
+		{"mysql", "INSERT INTO t (a, b) VALUES (?, ?), (?, ?)"},
+		{"sqlite3", "INSERT INTO t (a, b) VALUES (?, ?), (?, ?)"},
+		{"duckdb", "INSERT INTO t (a, b) VALUES (?, ?), (?, ?)"},
+	}
+	for _, tt := range tests {
+		if got := BatchInsertSQL(tt.driver, " INSERT INTO t (a, b) VALUES; ", 2, 2); got != tt.want {
+			t.Errorf("BatchInsertSQL(%s) = %q, want %q", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestMaxBatchParams(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   int
+	}{
+		{"sqlserver", 2000},
+		{"odbc", 2000},
+		{"sqlite3", 32766},
+		{"postgres", 65535},
+	}
+	for _, tt := range tests {
+		if got := maxBatchParams(tt.driver); got != tt.want {
+			t.Errorf("maxBatchParams(%s) = %d, want %d", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		driver string
+		name   string
+		want   string
+	}{
+		{"sqlserver", "order]s", "[order]]s]"},
+		{"mysql", "order`s", "`order``s`"},
+		{"postgres", `order"s`, `"order""s"`},
+		{"duckdb", "orders", `"orders"`},
+	}
+	for _, tt := range tests {
+		if got := QuoteIdentifier(tt.driver, tt.name); got != tt.want {
+			t.Errorf("QuoteIdentifier(%s, %q) = %q, want %q", tt.driver, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"orders", []string{"orders"}},
+		{"sales.orders", []string{"sales", "orders"}},
+		{"lake.sales.orders", []string{"lake", "sales", "orders"}},
+		{` "my schema"."my.table" `, []string{"my schema", "my.table"}},
+		{"[dbo].[order]]s]", []string{"dbo", "order]s"}},
+		{"`db`.`t`", []string{"db", "t"}},
+		{`"a""b"`, []string{`a"b`}},
+	}
+	for _, tt := range tests {
+		if got := SplitIdentifier(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitIdentifier(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestToDecimal(t *testing.T) {
+	tests := []struct {
+		value any
+		scale int
+		want  int64
+	}{
+		{12.345, 2, 1235},
+		{-12.345, 2, -1235},
+		{12.344, 2, 1234},
+		{float32(1.5), 0, 2},
+		{int64(7), 3, 7000},
+		{42, 1, 420},
+		{int32(-3), 2, -300},
+		{" 0.125 ", 2, 13},
+		{"-0.125", 2, -13},
+		{[]byte("99.995"), 2, 10000},
+		{0.1, 1, 1},
+	}
+	for _, tt := range tests {
+		got, err := toDecimal(tt.value, tt.scale)
+		if err != nil {
+			t.Errorf("toDecimal(%v, %d): %v", tt.value, tt.scale, err)
+			continue
+		}
+		dec, ok := got.(duckdb.Decimal)
+		if !ok || dec.Value.Cmp(big.NewInt(tt.want)) != 0 || int(dec.Scale) != tt.scale || dec.Width != 38 {
+			t.Errorf("toDecimal(%v, %d) = %v, want %d (scale %d)", tt.value, tt.scale, got, tt.want, tt.scale)
+		}
+	}
+	if _, err := toDecimal("12,5", 2); err == nil {
+		t.Error("toDecimal(12,5) did not fail")
+	}
+	// ALREADY A DECIMAL OR NOT A NUMBER, AS IT IS
+	dec := duckdb.Decimal{Width: 10, Scale: 2, Value: big.NewInt(5)}
+	if got, _ := toDecimal(dec, 4); !reflect.DeepEqual(got, dec) {
+		t.Errorf("toDecimal(decimal) = %v", got)
+	}
+	if got, _ := toDecimal(true, 2); got != true {
+		t.Errorf("toDecimal(true) = %v", got)
+	}
+}
@@ -0,0 +1,383 @@
+package db
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// CSVOptions is how Query2CSVOptions writes the results, the zero value
+// writes a comma separated UTF-8 file with a header
+type CSVOptions struct {
+	Delimiter        rune   // default ,
+	Quote            rune   // default "
+	Escape           rune   // escapes the quote inside quoted fields, default the quote itself (doubled)
+	NoHeader         bool   // do not write the column names
+	Null             string // written for NULL values, default empty
+	DateFormat       string // go layout for DATE columns, default 2006-01-02
+	DatetimeFormat   string // go layout for the other times, default 2006-01-02 15:04:05.999999999Z07:00
+	DecimalFormat    string // fmt verb for floats (e.g. %.2f), default the shortest exact value
+	DecimalSeparator string // replaces the . of floats and decimals
+	Encoding         string // encoding of the file (e.g. windows-1252), default utf-8
+	SourceEncoding   string // encoding of the text returned by the driver, default utf-8 or iso-8859-1 when not valid utf-8
+	Compression      string // gzip or zstd, default from the file extension (.gz, .zst)
+	MaxRows          int64  // rows per file, the file is split in parts when set
+	MaxBytes         int64  // bytes (uncompressed) per file, the file is split in parts when set
+}
+
+// compression is the compression set or the one of the path extension
+func (o CSVOptions) compression(path string) string {
+	if o.Compression != "" {
+		return strings.ToLower(o.Compression)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz", ".gzip":
+		return "gzip"
+	case ".zst", ".zstd":
+		return "zstd"
+	}
+	return ""
+}
+
+func (o CSVOptions) split() bool {
+	return o.MaxRows > 0 || o.MaxBytes > 0
+}
+
+// CSVFileName is the name of the files written to path with opts: the
+// compression extension is added when missing and, when the output is split,
+// the * before the extension(s) is where the part number goes (so the name is
+// also a glob matching all the parts)
+func CSVFileName(path string, opts CSVOptions) string {
+	ext := map[string]string{"gzip": ".gz", "zstd": ".zst"}[strings.ToLower(opts.Compression)]
+	if ext != "" && !strings.HasSuffix(strings.ToLower(path), ext) {
+		path += ext
+	}
+	if !opts.split() || strings.Contains(filepath.Base(path), "*") {
+		return path
+	}
+	dir, base := filepath.Split(path)
+	name, exts := base, ""
+	if i := strings.Index(base, "."); i > 0 {
+		name, exts = base[:i], base[i:]
+	}
+	return dir + name + "_*" + exts
+}
+
+// lookupEncoding finds an encoding by its IANA or WHATWG name, nil for utf-8
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		enc, err = htmlindex.Get(name)
+	}
+	if err != nil || enc == nil {
+		return nil, fmt.Errorf("unsupported encoding %s", name)
+	}
+	return enc, nil
+}
+
+// csvPart is one output file with its writers chain:
+// records -> encoding -> byte count -> compression -> buffer -> file
+type csvPart struct {
+	file  *os.File
+	buf   *bufio.Writer
+	comp  io.WriteCloser
+	enc   io.WriteCloser
+	w     io.Writer
+	bytes int64
+	rows  int64
+}
+
+func (p *csvPart) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.bytes += int64(n)
+	return n, err
+}
+
+func (p *csvPart) Close() error {
+	var errs []error
+	if p.enc != nil {
+		errs = append(errs, p.enc.Close())
+	}
+	if p.comp != nil {
+		errs = append(errs, p.comp.Close())
+	}
+	errs = append(errs, p.buf.Flush(), p.file.Close())
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type csvWriter struct {
+	opts     CSVOptions
+	path     string
+	enc      encoding.Encoding
+	srcEnc   encoding.Encoding
+	comp     string
+	header   []string
+	files    []string
+	part     *csvPart
+	dates    []bool
+	decimals []bool
+}
+
+func (w *csvWriter) open() error {
+	name := w.path
+	if w.opts.split() {
+		name = strings.Replace(w.path, "*", fmt.Sprintf("%04d", len(w.files)+1), 1)
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("error creating CSV file: %w", err)
+	}
+	p := &csvPart{file: file, buf: bufio.NewWriter(file)}
+	var out io.Writer = p.buf
+	switch w.comp {
+	case "":
+	case "gzip":
+		p.comp = gzip.NewWriter(out)
+	case "zstd":
+		if p.comp, err = zstd.NewWriter(out); err != nil {
+			file.Close()
+			return err
+		}
+	default:
+		file.Close()
+		return fmt.Errorf("unsupported compression %s (gzip | zstd)", w.comp)
+	}
+	if p.comp != nil {
+		out = p.comp
+	}
+	p.w = out
+	if w.enc != nil {
+		p.enc = transform.NewWriter(p, encoding.ReplaceUnsupported(w.enc.NewEncoder()))
+	}
+	w.part = p
+	w.files = append(w.files, name)
+	if !w.opts.NoHeader {
+		return w.write(w.header, nil)
+	}
+	return nil
+}
+
+// write writes a record, nulls flags the fields holding the null literal,
+// never quoted
+func (w *csvWriter) write(fields []string, nulls []bool) error {
+	var sb strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			sb.WriteRune(w.opts.Delimiter)
+		}
+		if nulls != nil && nulls[i] {
+			sb.WriteString(field)
+			continue
+		}
+		sb.WriteString(w.quote(field))
+	}
+	sb.WriteString("\n")
+	var err error
+	if w.part.enc != nil {
+		_, err = io.WriteString(w.part.enc, sb.String())
+	} else {
+		_, err = io.WriteString(w.part, sb.String())
+	}
+	w.part.rows++
+	return err
+}
+
+func (w *csvWriter) quote(field string) string {
+	q, esc := w.opts.Quote, w.opts.Escape
+	if !strings.ContainsRune(field, w.opts.Delimiter) && !strings.ContainsRune(field, q) &&
+		!strings.ContainsAny(field, "\r\n") && (esc == q || !strings.ContainsRune(field, esc)) &&
+		(field == "" || field != w.opts.Null) {
+		return field
+	}
+	var sb strings.Builder
+	sb.WriteRune(q)
+	for _, r := range field {
+		if r == q || (r == esc && esc != q) {
+			sb.WriteRune(esc)
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteRune(q)
+	return sb.String()
+}
+
+// text decodes the text of the driver into utf-8
+func (w *csvWriter) text(s string) string {
+	if w.srcEnc != nil {
+		if d, err := w.srcEnc.NewDecoder().String(s); err == nil {
+			return d
+		}
+	}
+	if utf8.ValidString(s) {
+		return s
+	}
+	d, err := convertToUTF8(s)
+	if err != nil {
+		return s
+	}
+	return d
+}
+
+func (w *csvWriter) format(v any, i int) (string, bool) {
+	switch val := v.(type) {
+	case nil:
+		return w.opts.Null, true
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", val), false
+	case float32:
+		return w.separator(w.float(float64(val), 32)), false
+	case float64:
+		return w.separator(w.float(val, 64)), false
+	case bool:
+		return strconv.FormatBool(val), false
+	case time.Time:
+		if w.dates[i] {
+			return val.Format(w.opts.DateFormat), false
+		}
+		return val.Format(w.opts.DatetimeFormat), false
+	case []byte:
+		s := strings.TrimSpace(w.text(string(val)))
+		if w.decimals[i] {
+			return w.separator(s), false
+		}
+		return s, false
+	case string:
+		s := w.text(val)
+		if w.decimals[i] {
+			return w.separator(s), false
+		}
+		return s, false
+	default:
+		s := fmt.Sprintf("%v", val)
+		if w.decimals[i] {
+			return w.separator(s), false
+		}
+		return s, false
+	}
+}
+
+func (w *csvWriter) float(f float64, bits int) string {
+	if w.opts.DecimalFormat != "" {
+		return fmt.Sprintf(w.opts.DecimalFormat, f)
+	}
+	return strconv.FormatFloat(f, 'f', -1, bits)
+}
+
+func (w *csvWriter) separator(s string) string {
+	if w.opts.DecimalSeparator == "" {
+		return s
+	}
+	return strings.Replace(s, ".", w.opts.DecimalSeparator, 1)
+}
+
+// WriteCSV streams rows into path with opts, returning the files written
+// (more than one when split)
+func WriteCSV(ctx context.Context, rows *sql.Rows, path string, opts CSVOptions) ([]string, error) {
+	if opts.Delimiter == 0 {
+		opts.Delimiter = ','
+	}
+	if opts.Quote == 0 {
+		opts.Quote = '"'
+	}
+	if opts.Escape == 0 {
+		opts.Escape = opts.Quote
+	}
+	if opts.DateFormat == "" {
+		opts.DateFormat = "2006-01-02"
+	}
+	if opts.DatetimeFormat == "" {
+		opts.DatetimeFormat = "2006-01-02 15:04:05.999999999Z07:00"
+	}
+	w := &csvWriter{opts: opts, path: CSVFileName(path, opts), comp: opts.compression(path)}
+	var err error
+	if w.enc, err = lookupEncoding(opts.Encoding); err != nil {
+		return nil, err
+	}
+	if w.srcEnc, err = lookupEncoding(opts.SourceEncoding); err != nil {
+		return nil, err
+	}
+	if w.header, err = rows.Columns(); err != nil {
+		return nil, fmt.Errorf("error getting column names: %w", err)
+	}
+	w.dates = make([]bool, len(w.header))
+	w.decimals = make([]bool, len(w.header))
+	if types, err := rows.ColumnTypes(); err == nil {
+		for i, t := range types {
+			name := strings.ToUpper(t.DatabaseTypeName())
+			w.dates[i] = name == "DATE"
+			w.decimals[i] = strings.HasPrefix(name, "DECIMAL") || strings.HasPrefix(name, "NUMERIC") || strings.HasSuffix(name, "MONEY")
+		}
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if w.part != nil {
+			w.part.Close()
+		}
+	}()
+	values := make([]any, len(w.header))
+	pointers := make([]any, len(w.header))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	fields := make([]string, len(w.header))
+	nulls := make([]bool, len(w.header))
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return w.files, err
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return w.files, fmt.Errorf("failed to scan row: %w", err)
+		}
+		header := 0
+		if !opts.NoHeader {
+			header = 1
+		}
+		if (opts.MaxRows > 0 && w.part.rows-int64(header) >= opts.MaxRows) || (opts.MaxBytes > 0 && w.part.bytes >= opts.MaxBytes) {
+			if err := w.part.Close(); err != nil {
+				return w.files, err
+			}
+			w.part = nil
+			if err := w.open(); err != nil {
+				return w.files, err
+			}
+		}
+		for i, v := range values {
+			fields[i], nulls[i] = w.format(v, i)
+		}
+		if err := w.write(fields, nulls); err != nil {
+			return w.files, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return w.files, fmt.Errorf("error iterating rows: %w", err)
+	}
+	err = w.part.Close()
+	w.part = nil
+	return w.files, err
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCSVFileName(t *testing.T) {
+	tests := []struct {
+		path string
+		opts CSVOptions
+		want string
+	}{
+		{"out/orders.csv", CSVOptions{}, "out/orders.csv"},
+		{"out/orders.csv", CSVOptions{Compression: "gzip"}, "out/orders.csv.gz"},
+		{"out/orders.csv.gz", CSVOptions{Compression: "GZIP"}, "out/orders.csv.gz"},
+		{"out/orders.csv", CSVOptions{Compression: "zstd"}, "out/orders.csv.zst"},
+		{"out/orders.csv", CSVOptions{MaxRows: 10}, "out/orders_*.csv"},
+		{"out/orders.csv", CSVOptions{MaxBytes: 1 << 20, Compression: "gzip"}, "out/orders_*.csv.gz"},
+		{"out/orders_*_part.csv", CSVOptions{MaxRows: 10}, "out/orders_*_part.csv"},
+		{"orders", CSVOptions{MaxRows: 10}, "orders_*"},
+	}
+	for _, tt := range tests {
+		if got := CSVFileName(tt.path, tt.opts); got != tt.want {
+			t.Errorf("CSVFileName(%q, %+v) = %q, want %q", tt.path, tt.opts, got, tt.want)
+		}
+	}
+}
+
+func TestCSVQuote(t *testing.T) {
+	tests := []struct {
+		opts  CSVOptions
+		field string
+		want  string
+	}{
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"'}, "plain", "plain"},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"'}, "", ""},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"'}, "a,b", `"a,b"`},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"'}, `say "hi"`, `"say ""hi"""`},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"'}, "a\nb", "\"a\nb\""},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"'}, "a\rb", "\"a\rb\""},
+		{CSVOptions{Delimiter: ';', Quote: '"', Escape: '"'}, "a,b", "a,b"},
+		{CSVOptions{Delimiter: ';', Quote: '"', Escape: '"'}, "a;b", `"a;b"`},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '\\'}, `say "hi"`, `"say \"hi\""`},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '\\'}, `c:\tmp`, `"c:\\tmp"`},
+		{CSVOptions{Delimiter: ',', Quote: '\'', Escape: '\''}, "it's", "'it''s'"},
+		// THE TEXT OF THE NULL LITERAL IS QUOTED TO TELL IT FROM A NULL
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"', Null: "NULL"}, "NULL", `"NULL"`},
+		{CSVOptions{Delimiter: ',', Quote: '"', Escape: '"', Null: "NULL"}, "", ""},
+	}
+	for _, tt := range tests {
+		w := &csvWriter{opts: tt.opts}
+		if got := w.quote(tt.field); got != tt.want {
+			t.Errorf("quote(%q) with %q/%q/%q = %q, want %q", tt.field, tt.opts.Delimiter, tt.opts.Quote, tt.opts.Escape, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	conn, err := NewDuckDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	query := `SELECT * FROM (VALUES
+		(1, 'a,b', NULL),
+		(2, 'say "hi"', 'NULL'),
+		(3, 'x' || chr(10) || 'y', ''),
+		(4, 'plain', 'z')
+	) t(id, name, note) ORDER BY id`
+	tests := []struct {
+		name string
+		opts CSVOptions
+		want map[string]string
+	}{
+		{"single", CSVOptions{Null: "NULL"}, map[string]string{
+			"orders.csv": "id,name,note\n1,\"a,b\",NULL\n2,\"say \"\"hi\"\"\",\"NULL\"\n3,\"x\ny\",\n4,plain,z\n",
+		}},
+		{"max_rows", CSVOptions{MaxRows: 3, Delimiter: ';'}, map[string]string{
+			"orders_0001.csv": "id;name;note\n1;a,b;\n2;\"say \"\"hi\"\"\";NULL\n3;\"x\ny\";\n",
+			"orders_0002.csv": "id;name;note\n4;plain;z\n",
+		}},
+		{"max_rows no_header", CSVOptions{MaxRows: 2, NoHeader: true}, map[string]string{
+			"orders_0001.csv": "1,\"a,b\",\n2,\"say \"\"hi\"\"\",NULL\n",
+			"orders_0002.csv": "3,\"x\ny\",\n4,plain,z\n",
+		}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		rows, err := conn.DB.QueryContext(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := WriteCSV(context.Background(), rows, filepath.Join(dir, "orders.csv"), tt.opts)
+		rows.Close()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := map[string]string{}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got[filepath.Base(file)] = string(data)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
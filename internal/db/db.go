@@ -3,14 +3,12 @@ package db
 import (
 	"context"
 	"database/sql"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"path/filepath"
-	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -57,7 +55,7 @@ func New(driverName string, dsn string) (*DB, error) {
 				// Create the database
 				_, err = db2.ExecContext(ctx, fmt.Sprintf(`CREATE DATABASE "%s"`, newDBName))
 				if err != nil {
-					fmt.Println("CREATE DATABASE failed:", driverName, err)
+					log().Error("CREATE DATABASE failed", "driver", driverName, "database", newDBName, "err", err)
 					return nil, err
 				} else {
 					db, err = sqlx.ConnectContext(ctx, driverName, dsn)
@@ -72,17 +70,17 @@ func New(driverName string, dsn string) (*DB, error) {
 		} else if strings.Contains(err.Error(), "Cannot open database") && strings.Contains(err.Error(), "mssql:") {
 			re := regexp.MustCompile(`Cannot open database "([^"]+)" that was requested by the login`)
 			matches := re.FindStringSubmatch(err.Error())
-			fmt.Println(err, matches)
+			log().Debug("database does not exist", "driver", driverName, "err", err)
 			if len(matches) > 1 {
 				newDBName := matches[1]
 				// replace dsn newDBName with postgres and create the new db
 				newDSN, err := ReplaceDBNameV2(dsn, "master")
 				db2, err := sqlx.ConnectContext(ctx, driverName, newDSN)
-				fmt.Printf("%s CREATE DATABASE %s\n", newDSN, newDBName)
+				log().Info("CREATE DATABASE", "driver", driverName, "database", newDBName)
 				// Create the database
 				_, err = db2.ExecContext(ctx, fmt.Sprintf(`CREATE DATABASE "%s"`, newDBName))
 				if err != nil {
-					fmt.Println("CREATE DATABASE failed:", driverName, err)
+					log().Error("CREATE DATABASE failed", "driver", driverName, "database", newDBName, "err", err)
 					return nil, err
 				} else {
 					db, err = sqlx.ConnectContext(ctx, driverName, dsn)
@@ -286,7 +284,7 @@ func (db *DB) FromParams(params map[string]any, extra_conf map[string]any) (*DB,
 		} else if contains(_not_embed_dbs, _driver) {
 			new_dsn, err := ReplaceDBName(extra_conf["dsn"].(string), _dsn)
 			if err != nil {
-				fmt.Println("Errr getting the DSN for ", _dsn)
+				log().Error("getting the DSN", "database", _dsn, "err", err)
 			}
 			//fmt.Println("NEW DSN", new_dsn)
 			_dsn = setStrEnv(new_dsn)
@@ -350,7 +348,7 @@ func (db *DB) FromParams(params map[string]any, extra_conf map[string]any) (*DB,
 		} else if contains(_not_embed_dbs, _driver) {
 			new_dsn, err := ReplaceDBName(extra_conf["dsn"].(string), _dsn)
 			if err != nil {
-				fmt.Println("Errr getting the DSN for ", _dsn)
+				log().Error("getting the DSN", "database", _dsn, "err", err)
 			}
 			//fmt.Println("NEW DSN", new_dsn)
 			_dsn = setStrEnv(new_dsn)
@@ -615,7 +613,11 @@ func (db *DB) TableSchema(params map[string]any, table string, dbName string, ex
 }
 
 func (db *DB) ExecuteQuery(query string, data ...any) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	return db.ExecuteQueryContext(context.Background(), query, data...)
+}
+
+func (db *DB) ExecuteQueryContext(ctx context.Context, query string, data ...any) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 	query = adjustQuery(db.DriverName(), query)
 	result, err := db.ExecContext(ctx, query, data...)
@@ -654,7 +656,11 @@ func (db *DB) ExecuteQueryPGInsertWithLastInsertId(query string, data ...any) (i
 }
 
 func (db *DB) ExecuteQueryRowsAffected(query string, data ...any) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuckDB)
+	return db.ExecuteQueryRowsAffectedContext(context.Background(), query, data...)
+}
+
+func (db *DB) ExecuteQueryRowsAffectedContext(ctx context.Context, query string, data ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutDuckDB)
 	defer cancel()
 	query = adjustQuery(db.DriverName(), query)
 	result, err := db.ExecContext(ctx, query, data...)
@@ -688,7 +694,11 @@ func (db *DB) ExecuteNamedQuery(query string, data map[string]any) (int, error)
 }
 
 func (db *DB) QueryMultiRows(query string, params ...any) (*[]map[string]any, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	return db.QueryMultiRowsContext(context.Background(), query, params...)
+}
+
+func (db *DB) QueryMultiRowsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 	var result []map[string]any
 	query = adjustQuery(db.DriverName(), query)
@@ -725,7 +735,11 @@ func (db *DB) QueryRows(ctx context.Context, query string, params ...any) (*sql.
 }
 
 func (db *DB) QueryMultiRowsWithCols(query string, params ...any) (*[]map[string]any, []string, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	return db.QueryMultiRowsWithColsContext(context.Background(), query, params...)
+}
+
+func (db *DB) QueryMultiRowsWithColsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, []string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 	var result []map[string]any
 	query = adjustQuery(db.DriverName(), query)
@@ -736,7 +750,7 @@ func (db *DB) QueryMultiRowsWithCols(query string, params ...any) (*[]map[string
 	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
-		fmt.Printf("failed to get columns: %s", err)
+		log().Error("failed to get columns", "err", err)
 	}
 	for rows.Next() {
 		row := map[string]any{}
@@ -755,7 +769,11 @@ func (db *DB) QueryMultiRowsWithCols(query string, params ...any) (*[]map[string
 }
 
 func (db *DB) QuerySingleRow(query string, params ...any) (*map[string]any, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	return db.QuerySingleRowContext(context.Background(), query, params...)
+}
+
+func (db *DB) QuerySingleRowContext(ctx context.Context, query string, params ...any) (*map[string]any, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 	result := map[string]any{}
 	query = adjustQuery(db.DriverName(), query)
@@ -814,7 +832,7 @@ func (db *DB) GetUserByNameOrEmail(email string) (map[string]any, bool, error) {
 	if rows.Next() {
 		errr := rows.MapScan(user)
 		if errr != nil {
-			fmt.Print(errr)
+			log().Error("scanning the row", "err", errr)
 		}
 		for key, val := range user {
 			switch v := val.(type) {
@@ -886,76 +904,54 @@ func ParsePostgresConnString(connStr string) (map[string]string, error) {
 }
 
 func (db *DB) Query2CSV(query string, csv_path string, params ...any) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
+	return db.Query2CSVContext(context.Background(), query, csv_path, params...)
+}
+
+func (db *DB) Query2CSVContext(ctx context.Context, query string, csv_path string, params ...any) (bool, error) {
+	_, err := db.Query2CSVOptions(ctx, query, csv_path, CSVOptions{}, params...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Query2CSVOptions streams the results of query into csv_path as opts says,
+// returning the files written
+func (db *DB) Query2CSVOptions(ctx context.Context, query string, csv_path string, opts CSVOptions, params ...any) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutODBC)
 	defer cancel()
 	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		//fmt.Println(1, err)
-		return false, err
+		return nil, err
 	}
 	defer rows.Close()
-	csvFile, err := os.Create(csv_path)
+	return WriteCSV(ctx, rows, csv_path, opts)
+}
+
+// Query2Parquet streams the results of query into the parquet file path,
+// typed from the column types, returning the rows written
+func (db *DB) Query2Parquet(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutODBC)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		return false, fmt.Errorf("error creating CSV file: %w", err)
+		return 0, err
 	}
-	defer csvFile.Close()
-	// CSV
-	csvWriter := csv.NewWriter(csvFile)
-	defer csvWriter.Flush()
-	// Get column names
-	columns, err := rows.Columns()
+	defer rows.Close()
+	return WriteParquet(ctx, rows, path, opts)
+}
+
+// Query2Arrow streams the results of query into the Arrow IPC file path,
+// typed from the column types, returning the rows written
+func (db *DB) Query2Arrow(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutODBC)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		return false, fmt.Errorf("error getting column names: %w", err)
-	}
-	// Write column names to CSV header
-	csvWriter.Write(columns)
-	for rows.Next() {
-		row, err := ScanRowToMap(rows)
-		if err != nil {
-			return false, fmt.Errorf("failed to scan row to map: %w", err)
-		}
-		var rowData []string
-		//for _, value := range row {
-		for _, col := range columns {
-			value := row[col]
-			//rowData = append(rowData, fmt.Sprintf("%v", value))
-			switch v := value.(type) {
-			case nil:
-				// Format integer types
-				rowData = append(rowData, "")
-			case int, int8, int16, int32, int64:
-				// Format integer types
-				rowData = append(rowData, fmt.Sprintf("%d", v))
-			case float64, float32:
-				//fmt.Println(col, v)
-				// Format large numbers without scientific notation
-				hasDec, err := hasDecimalPlace(v)
-				if err != nil {
-					//fmt.Println(err)
-					rowData = append(rowData, fmt.Sprintf("%v", value))
-				} else if hasDec {
-					rowData = append(rowData, fmt.Sprintf("%f", v))
-				} else {
-					rowData = append(rowData, fmt.Sprintf("%.f", v))
-				}
-			case []byte:
-				// Convert byte slice (UTF-8 data) to a string
-				utf8Str, err := convertToUTF8(string(v))
-				if err != nil {
-					fmt.Println("Failed to convert to UTF-8:", v, err)
-				}
-				rowData = append(rowData, strings.TrimSpace(string(utf8Str)))
-			default:
-				// Default formatting for other types
-				rowData = append(rowData, fmt.Sprintf("%v", value))
-			}
-		}
-		csvWriter.Write(rowData)
-	}
-	if err := rows.Err(); err != nil {
-		return false, fmt.Errorf("error iterating rows: %w", err)
+		return 0, err
 	}
-	return true, nil
+	defer rows.Close()
+	return WriteArrow(ctx, rows, path, opts)
 }
 
 func contains(slice []any, element any) bool {
@@ -984,20 +980,6 @@ func convertToUTF8(isoStr string) (string, error) {
 	return string(utf8Bytes), nil
 }
 
-func hasDecimalPlace(v any) (bool, error) {
-	// Try to cast v to float64
-	floatVal, ok := v.(float64)
-	if !ok {
-		return false, fmt.Errorf("value is not a float64, it is %v", reflect.TypeOf(v))
-	}
-
-	// Check if the float has a decimal part
-	if floatVal != float64(int(floatVal)) {
-		return true, nil
-	}
-	return false, nil
-}
-
 // ReplaceDBName replaces the database name in a DSN for multiple drivers.
 // Supports: sqlite, postgres, mysql, mssql
 func ReplaceDBNameV2(dsn, newDBName string) (string, error) {
@@ -7,15 +7,29 @@ import (
 	"github.com/jmoiron/sqlx"
 )
 
+// DBInterface is implemented by every driver, the *Context methods are bound
+// to ctx (e.g. cancelled with the run) on top of the driver default timeout
 type DBInterface interface {
 	BeginT() (*sqlx.Tx, error)
 	ExecuteQuery(query string, data ...any) (int, error)
+	ExecuteQueryContext(ctx context.Context, query string, data ...any) (int, error)
 	Query2CSV(query string, csv_path string, params ...any) (bool, error)
+	Query2CSVContext(ctx context.Context, query string, csv_path string, params ...any) (bool, error)
+	Query2CSVOptions(ctx context.Context, query string, csv_path string, opts CSVOptions, params ...any) ([]string, error)
+	Query2Parquet(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error)
+	Query2Arrow(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error)
 	QueryMultiRows(query string, params ...any) (*[]map[string]any, bool, error)
+	QueryMultiRowsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, bool, error)
 	ExecuteQueryRowsAffected(query string, data ...any) (int64, error)
+	ExecuteQueryRowsAffectedContext(ctx context.Context, query string, data ...any) (int64, error)
 	QuerySingleRow(query string, params ...any) (*map[string]any, bool, error)
+	QuerySingleRowContext(ctx context.Context, query string, params ...any) (*map[string]any, bool, error)
 	QueryRows(ctx context.Context, query string, params ...any) (*sql.Rows, error)
+	InsertBatch(ctx context.Context, insertSQL string, nCols int, rows [][]any) (int64, error)
+	BulkInsert(ctx context.Context, table string, columns []string, rows [][]any) (int64, error)
+	ExecuteInTx(ctx context.Context, queries ...string) error
 	QueryMultiRowsWithCols(query string, params ...any) (*[]map[string]any, []string, bool, error)
+	QueryMultiRowsWithColsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, []string, bool, error)
 	AllTables(params map[string]any, extra_conf map[string]any) (*[]map[string]any, bool, error)
 	TableSchema(params map[string]any, table string, dbName string, extra_conf map[string]any) (*[]map[string]any, bool, error)
 	ExecuteNamedQuery(query string, data map[string]any) (int, error)
@@ -7,10 +7,12 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/realdatadriven/etlx/internal/env"
+	"github.com/realdatadriven/etlx/internal/secrets"
 
 	"github.com/duckdb/duckdb-go/v2"
 	_ "github.com/duckdb/duckdb-go/v2"
@@ -46,7 +48,7 @@ func EnvExpand(s string) string {
 	return reEnvVar.ReplaceAllStringFunc(s, func(match string) string {
 		// fmt.Println(match, match[1:])
 		name := match[1:] // strip leading "$"
-		if value, exists := os.LookupEnv(name); exists {
+		if value, exists := secrets.Default().Lookup(name); exists {
 			return value
 		}
 		return match // leave as-is if not set
@@ -92,7 +94,7 @@ func NewDuckDB(dsn string) (*DuckDB, error) {
 				// fmt.Println(EnvExpand(query))
 				_, err := execer.ExecContext(context.Background(), EnvExpand(query), nil)
 				if err != nil {
-					fmt.Println("ERROR:", EnvExpand(query), err)
+					log().Error("duckdb boot query failed", "query", EnvExpand(query), "err", err)
 					return err
 				}
 			}
@@ -100,14 +102,14 @@ func NewDuckDB(dsn string) (*DuckDB, error) {
 		})
 		// fmt.Println(3, "ETLX SECURY ENV:", dsn)
 		if err != nil {
-			fmt.Println("duckdb.NewConnector Err:", err)
+			log().Error("duckdb.NewConnector failed", "err", err)
 			return nil, err
 		}
 		defer c.Close()
 		db = sql.OpenDB(c)
 		err = db.Ping()
 		if err != nil {
-			fmt.Println("TEST PING ERR:", err)
+			log().Error("duckdb ping failed", "err", err)
 		}
 		/*_, err = db.ExecContext(context.TODO(), "INSTALL SQLITE;")
 		if err != nil {
@@ -150,7 +152,11 @@ func (db *DuckDB) BeginT() (*sqlx.Tx, error) {
 }
 
 func (db *DuckDB) ExecuteQuery(query string, data ...any) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuckDB)
+	return db.ExecuteQueryContext(context.Background(), query, data...)
+}
+
+func (db *DuckDB) ExecuteQueryContext(ctx context.Context, query string, data ...any) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutDuckDB)
 	defer cancel()
 	result, err := db.ExecContext(ctx, query, data...)
 	if err != nil {
@@ -164,7 +170,11 @@ func (db *DuckDB) ExecuteQuery(query string, data ...any) (int, error) {
 }
 
 func (db *DuckDB) ExecuteQueryRowsAffected(query string, data ...any) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuckDB)
+	return db.ExecuteQueryRowsAffectedContext(context.Background(), query, data...)
+}
+
+func (db *DuckDB) ExecuteQueryRowsAffectedContext(ctx context.Context, query string, data ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutDuckDB)
 	defer cancel()
 	result, err := db.ExecContext(ctx, query, data...)
 	if err != nil {
@@ -298,7 +308,11 @@ func (db *DuckDB) TableSchema(params map[string]any, table string, dbName string
 }
 
 func (db *DuckDB) QueryMultiRowsWithCols(query string, params ...any) (*[]map[string]any, []string, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuckDB)
+	return db.QueryMultiRowsWithColsContext(context.Background(), query, params...)
+}
+
+func (db *DuckDB) QueryMultiRowsWithColsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, []string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutDuckDB)
 	defer cancel()
 	var result []map[string]any
 	rows, err := db.QueryContext(ctx, query, params...)
@@ -308,7 +322,7 @@ func (db *DuckDB) QueryMultiRowsWithCols(query string, params ...any) (*[]map[st
 	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
-		fmt.Printf("failed to get columns: %s", err)
+		log().Error("failed to get columns", "err", err)
 	}
 	for rows.Next() {
 		row, err := ScanRowToMap(rows)
@@ -321,7 +335,11 @@ func (db *DuckDB) QueryMultiRowsWithCols(query string, params ...any) (*[]map[st
 }
 
 func (db *DuckDB) QueryMultiRows(query string, params ...any) (*[]map[string]any, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuckDB)
+	return db.QueryMultiRowsContext(context.Background(), query, params...)
+}
+
+func (db *DuckDB) QueryMultiRowsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutDuckDB)
 	defer cancel()
 	var result []map[string]any
 	rows, err := db.QueryContext(ctx, query, params...)
@@ -352,7 +370,11 @@ func (db *DuckDB) QueryRows(ctx context.Context, query string, params ...any) (*
 }
 
 func (db *DuckDB) QuerySingleRow(query string, params ...any) (*map[string]any, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutDuckDB)
+	return db.QuerySingleRowContext(context.Background(), query, params...)
+}
+
+func (db *DuckDB) QuerySingleRowContext(ctx context.Context, query string, params ...any) (*map[string]any, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeoutDuckDB)
 	defer cancel()
 	result := map[string]any{}
 	rows, err := db.QueryContext(ctx, query, params...)
@@ -436,7 +458,69 @@ func (db *DuckDB) GetUserByNameOrEmail(email string) (map[string]any, bool, erro
 }
 
 func (db *DuckDB) Query2CSV(query string, csv_path string, params ...any) (bool, error) {
-	return false, fmt.Errorf("not implemented yet %s", "_")
+	return db.Query2CSVContext(context.Background(), query, csv_path, params...)
+}
+
+func (db *DuckDB) Query2CSVContext(ctx context.Context, query string, csv_path string, params ...any) (bool, error) {
+	_, err := db.Query2CSVOptions(ctx, query, csv_path, CSVOptions{}, params...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Query2CSVOptions streams the results of query into csv_path as opts says,
+// returning the files written (COPY ... TO is the faster way on duckdb)
+func (db *DuckDB) Query2CSVOptions(ctx context.Context, query string, csv_path string, opts CSVOptions, params ...any) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return WriteCSV(ctx, rows, csv_path, opts)
+}
+
+// Query2Parquet writes the results of query into the parquet file path, with
+// COPY ... TO unless the query has params
+func (db *DuckDB) Query2Parquet(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error) {
+	if len(params) > 0 {
+		rows, err := db.QueryContext(ctx, query, params...)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		return WriteParquet(ctx, rows, path, opts)
+	}
+	copyOpts := []string{"FORMAT PARQUET"}
+	if opts.Compression != "" {
+		if _, err := parquetCompression(opts.Compression); err != nil {
+			return 0, err
+		}
+		codec := strings.ToUpper(opts.Compression)
+		if codec == "NONE" {
+			codec = "UNCOMPRESSED"
+		}
+		copyOpts = append(copyOpts, fmt.Sprintf("COMPRESSION %s", codec))
+	}
+	if opts.BatchSize > 0 {
+		copyOpts = append(copyOpts, fmt.Sprintf("ROW_GROUP_SIZE %d", opts.BatchSize))
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	res, err := db.ExecContext(ctx, fmt.Sprintf("COPY (%s) TO '%s' (%s)", query, strings.ReplaceAll(path, "'", "''"), strings.Join(copyOpts, ", ")))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Query2Arrow streams the results of query into the Arrow IPC file path
+func (db *DuckDB) Query2Arrow(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error) {
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	return WriteArrow(ctx, rows, path, opts)
 }
 
 func (db *DuckDB) IsEmpty(value any) bool {
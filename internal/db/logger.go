@@ -0,0 +1,25 @@
+package db
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/realdatadriven/etlx/internal/secrets"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger of the connections, nil discards the logs
+func SetLogger(l *slog.Logger) {
+	if l != nil {
+		l = slog.New(secrets.NewMaskHandler(l.Handler()))
+	}
+	logger.Store(l)
+}
+
+func log() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.New(slog.DiscardHandler)
+}
@@ -1,103 +1,105 @@
+//go:build odbc
+
 package db
 
-/*import (
+import (
 	"context"
 	"database/sql"
-	"encoding/csv"
 	"fmt"
-	"io"
-	"os"
-	"reflect"
 	"strings"
 	"time"
-	"unicode/utf8"
 
-	"github.com/realdatadriven/etlx/internal/env"
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
+	"github.com/jmoiron/sqlx"
 
 	_ "github.com/alexbrainman/odbc"
 )
 
+// ODBC is a connection through the ODBC driver manager (unixODBC on linux and
+// macos, odbc32.dll on windows), built with the odbc tag
 type ODBC struct {
 	*sql.DB
+	dsn  string
+	opts ODBCOptions
 }
 
+// NewODBC opens an odbc connection string, the etlx options in it
+// (query_timeout, connect_timeout) are taken out before it goes to the driver
 func NewODBC(dsn string) (*ODBC, error) {
-	//fmt.Printf("DSN: %s\n", dsn)
+	dsn, opts, err := ParseODBCConnString(dsn)
+	if err != nil {
+		return nil, err
+	}
 	db, err := sql.Open("odbc", dsn)
 	if err != nil {
 		return nil, err
 	}
-
-	defaultTimeoutODBC = time.Duration(env.GetInt("ODBC_DFLT_TIMEOUT", 15)) * time.Minute
-	//fmt.Println(driverName, dsn)
 	db.SetMaxOpenConns(25)
 	db.SetMaxIdleConns(25)
-	db.SetConnMaxIdleTime(defaultTimeoutODBC)
+	db.SetConnMaxIdleTime(opts.QueryTimeout)
 	db.SetConnMaxLifetime(2 * time.Hour)
-	return &ODBC{db}, nil
-}
-
-func (db *ODBC) New(dsn string) (*ODBC, error) {
-	//fmt.Printf("DSN: %s\n", dsn)
-	_db, err := sql.Open("odbc", dsn)
+	// the driver connects without a context, the ping is left behind on timeout
+	ping := make(chan error, 1)
+	go func() { ping <- db.Ping() }()
+	select {
+	case err = <-ping:
+	case <-time.After(opts.ConnectTimeout):
+		err = fmt.Errorf("connect timeout after %s", opts.ConnectTimeout)
+	}
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	//fmt.Println(driverName, dsn)
-	_db.SetMaxOpenConns(25)
-	_db.SetMaxIdleConns(25)
-	_db.SetConnMaxIdleTime(5 * time.Minute)
-	_db.SetConnMaxLifetime(2 * time.Hour)
-	return &ODBC{_db}, nil
+	return &ODBC{DB: db, dsn: dsn, opts: opts}, nil
+}
+
+func (db *ODBC) New(dsn string) (*ODBC, error) {
+	return NewODBC(dsn)
+}
+
+func (db *ODBC) BeginT() (*sqlx.Tx, error) {
+	return nil, fmt.Errorf("Not suported for %s", "ODBC")
 }
 
 func (db *ODBC) ExecuteQuery(query string, data ...any) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
+	return db.ExecuteQueryContext(context.Background(), query, data...)
+}
+
+func (db *ODBC) ExecuteQueryContext(ctx context.Context, query string, data ...any) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
 	defer cancel()
 	result, err := db.ExecContext(ctx, query, data...)
 	if err != nil {
 		return 0, err
 	}
+	// most drivers have no last insert id
 	id, err := result.LastInsertId()
 	if err != nil {
-		id = 0
+		return 0, nil
 	}
-	return int(id), err
+	return int(id), nil
 }
 
 func (db *ODBC) ExecuteQueryRowsAffected(query string, data ...any) (int64, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
+	return db.ExecuteQueryRowsAffectedContext(context.Background(), query, data...)
+}
+
+func (db *ODBC) ExecuteQueryRowsAffectedContext(ctx context.Context, query string, data ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
 	defer cancel()
 	result, err := db.ExecContext(ctx, query, data...)
 	if err != nil {
 		return 0, err
 	}
-	id, err := result.RowsAffected()
-	if err != nil {
-		return 0, err
-	}
-	return id, err
+	return result.RowsAffected()
 }
 
 func (db *ODBC) QueryMultiRows(query string, params ...any) (*[]map[string]any, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
-	defer cancel()
-	var result []map[string]any
-	rows, err := db.QueryContext(ctx, query, params...)
-	if err != nil {
-		return nil, false, err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		row, err := ScanRowToMap(rows)
-		if err != nil {
-			return nil, false, fmt.Errorf("failed to scan row to map: %w", err)
-		}
-		result = append(result, row)
-	}
-	return &result, true, err
+	return db.QueryMultiRowsContext(context.Background(), query, params...)
+}
+
+func (db *ODBC) QueryMultiRowsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, bool, error) {
+	result, _, ok, err := db.QueryMultiRowsWithColsContext(ctx, query, params...)
+	return result, ok, err
 }
 
 func (db *ODBC) QueryRows(ctx context.Context, query string, params ...any) (*sql.Rows, error) {
@@ -105,7 +107,11 @@ func (db *ODBC) QueryRows(ctx context.Context, query string, params ...any) (*sq
 }
 
 func (db *ODBC) QueryMultiRowsWithCols(query string, params ...any) (*[]map[string]any, []string, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
+	return db.QueryMultiRowsWithColsContext(context.Background(), query, params...)
+}
+
+func (db *ODBC) QueryMultiRowsWithColsContext(ctx context.Context, query string, params ...any) (*[]map[string]any, []string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
 	defer cancel()
 	var result []map[string]any
 	rows, err := db.QueryContext(ctx, query, params...)
@@ -115,7 +121,7 @@ func (db *ODBC) QueryMultiRowsWithCols(query string, params ...any) (*[]map[stri
 	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
-		fmt.Printf("failed to get columns: %s", err)
+		return nil, nil, false, fmt.Errorf("failed to get columns: %w", err)
 	}
 	for rows.Next() {
 		row, err := ScanRowToMap(rows)
@@ -124,20 +130,129 @@ func (db *ODBC) QueryMultiRowsWithCols(query string, params ...any) (*[]map[stri
 		}
 		result = append(result, row)
 	}
-	return &result, columns, true, err
+	return &result, columns, true, rows.Err()
 }
 
+func (db *ODBC) QuerySingleRow(query string, params ...any) (*map[string]any, bool, error) {
+	return db.QuerySingleRowContext(context.Background(), query, params...)
+}
+
+func (db *ODBC) QuerySingleRowContext(ctx context.Context, query string, params ...any) (*map[string]any, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
+	defer cancel()
+	result := map[string]any{}
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result, err = ScanRowToMap(rows)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to scan row to map: %w", err)
+		}
+	}
+	return &result, true, rows.Err()
+}
+
+// AllTables lists the tables and views of the connection with SQLTables
 func (db *ODBC) AllTables(params map[string]any, extra_conf map[string]any) (*[]map[string]any, bool, error) {
-	// Logic to get all tables for DuckDB
-	return nil, false, nil
+	catalog, err := openODBCCatalog(db.dsn, db.opts.ConnectTimeout)
+	if err != nil {
+		return nil, false, err
+	}
+	defer catalog.close()
+	schema, _ := extra_conf["schema"].(string)
+	rows, err := catalog.query("SQLTables", nil, odbcArg(schema), nil, odbcArg("TABLE,VIEW"))
+	if err != nil {
+		return nil, false, err
+	}
+	result := []map[string]any{}
+	for _, row := range rows {
+		// TABLE_CAT, TABLE_SCHEM, TABLE_NAME, TABLE_TYPE, REMARKS
+		result = append(result, map[string]any{
+			"name":    odbcValue(row, 2),
+			"catalog": odbcValue(row, 0),
+			"schema":  odbcValue(row, 1),
+			"type":    odbcValue(row, 3),
+			"comment": odbcValue(row, 4),
+		})
+	}
+	return &result, true, nil
 }
 
+// TableSchema describes the columns of table with SQLColumns, SQLPrimaryKeys
+// and SQLForeignKeys, table may be qualified by its schema
 func (db *ODBC) TableSchema(params map[string]any, table string, dbName string, extra_conf map[string]any) (*[]map[string]any, bool, error) {
-	return nil, false, nil
+	user_id := 0
+	if user, ok := params["user"].(map[string]any); ok {
+		if id, ok := user["user_id"].(float64); ok {
+			user_id = int(id)
+		}
+	}
+	var schema *string
+	name := table
+	if parts := SplitIdentifier(table); len(parts) > 1 {
+		schema, name = odbcArg(parts[len(parts)-2]), parts[len(parts)-1]
+	}
+	catalog, err := openODBCCatalog(db.dsn, db.opts.ConnectTimeout)
+	if err != nil {
+		return nil, false, err
+	}
+	defer catalog.close()
+	columns, err := catalog.query("SQLColumns", nil, schema, odbcArg(name), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	pks := map[string]bool{}
+	if rows, err := catalog.query("SQLPrimaryKeys", nil, schema, odbcArg(name)); err == nil {
+		for _, row := range rows {
+			// TABLE_CAT, TABLE_SCHEM, TABLE_NAME, COLUMN_NAME, KEY_SEQ, PK_NAME
+			pks[odbcValue(row, 3)] = true
+		}
+	}
+	fks := map[string][2]string{}
+	if rows, err := catalog.query("SQLForeignKeys", nil, nil, nil, nil, schema, odbcArg(name)); err == nil {
+		for _, row := range rows {
+			// PKTABLE_CAT, PKTABLE_SCHEM, PKTABLE_NAME, PKCOLUMN_NAME, FKTABLE_CAT, FKTABLE_SCHEM, FKTABLE_NAME, FKCOLUMN_NAME, ...
+			fks[odbcValue(row, 7)] = [2]string{odbcValue(row, 2), odbcValue(row, 3)}
+		}
+	}
+	result := []map[string]any{}
+	for _, row := range columns {
+		// TABLE_CAT, TABLE_SCHEM, TABLE_NAME, COLUMN_NAME, DATA_TYPE, TYPE_NAME, COLUMN_SIZE, BUFFER_LENGTH,
+		// DECIMAL_DIGITS, NUM_PREC_RADIX, NULLABLE, REMARKS, COLUMN_DEF, ..., IS_NULLABLE
+		field := odbcValue(row, 3)
+		fk, isFK := fks[field]
+		result = append(result, map[string]any{
+			"db":              dbName,
+			"table":           table,
+			"field":           field,
+			"type":            odbcValue(row, 5),
+			"comment":         odbcNullable(row, 11),
+			"pk":              pks[field],
+			"autoincrement":   nil,
+			"nullable":        odbcValue(row, 10) != "0",
+			"computed":        nil,
+			"default":         odbcNullable(row, 12),
+			"fk":              isFK,
+			"referred_table":  fk[0],
+			"referred_column": fk[1],
+			"user_id":         user_id,
+			"created_at":      time.Now(),
+			"updated_at":      time.Now(),
+			"excluded":        false,
+		})
+	}
+	return &result, true, nil
 }
 
 func (db *ODBC) ExecuteNamedQuery(query string, data map[string]any) (int, error) {
-	return 0, fmt.Errorf("not suported yet %s", "_")
+	_positionalQuery, args, err := NamedToPositional(query, data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert named query to positional: %w", err)
+	}
+	return db.ExecuteQuery(_positionalQuery, args...)
 }
 
 func (db *ODBC) ExecuteQueryPGInsertWithLastInsertId(query string, data ...any) (int, error) {
@@ -145,94 +260,79 @@ func (db *ODBC) ExecuteQueryPGInsertWithLastInsertId(query string, data ...any)
 }
 
 func (db *ODBC) Query2CSV(query string, csv_path string, params ...any) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
-	defer cancel()
-	rows, err := db.QueryContext(ctx, query, params...)
+	return db.Query2CSVContext(context.Background(), query, csv_path, params...)
+}
+
+func (db *ODBC) Query2CSVContext(ctx context.Context, query string, csv_path string, params ...any) (bool, error) {
+	_, err := db.Query2CSVOptions(ctx, query, csv_path, CSVOptions{}, params...)
 	if err != nil {
-		//fmt.Println(1, err)
 		return false, err
 	}
-	defer rows.Close()
-	csvFile, err := os.Create(csv_path)
+	return true, nil
+}
+
+// Query2CSVOptions streams the results of query into csv_path as opts says,
+// returning the files written
+func (db *ODBC) Query2CSVOptions(ctx context.Context, query string, csv_path string, opts CSVOptions, params ...any) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		return false, fmt.Errorf("error creating CSV file: %w", err)
+		return nil, err
 	}
-	defer csvFile.Close()
-	// CSV
-	csvWriter := csv.NewWriter(csvFile)
-	defer csvWriter.Flush()
-	// Get column names
-	columns, err := rows.Columns()
+	defer rows.Close()
+	return WriteCSV(ctx, rows, csv_path, opts)
+}
+
+// Query2Parquet streams the results of query into the parquet file path,
+// typed from the column types, returning the rows written
+func (db *ODBC) Query2Parquet(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
+	defer cancel()
+	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		return false, fmt.Errorf("error getting column names: %w", err)
-	}
-	// Write column names to CSV header
-	csvWriter.Write(columns)
-	for rows.Next() {
-		row, err := ScanRowToMap(rows)
-		if err != nil {
-			return false, fmt.Errorf("failed to scan row to map: %w", err)
-		}
-		var rowData []string
-		//for _, value := range row {
-		for _, col := range columns {
-			value := row[col]
-			//rowData = append(rowData, fmt.Sprintf("%v", value))
-			switch v := value.(type) {
-			case nil:
-				// Format integer types
-				rowData = append(rowData, "")
-			case int, int8, int16, int32, int64:
-				// Format integer types
-				rowData = append(rowData, fmt.Sprintf("%d", v))
-			case float64, float32:
-				//fmt.Println(col, v)
-				// Format large numbers without scientific notation
-				hasDec, err := hasDecimalPlace(v)
-				if err != nil {
-					fmt.Println(err)
-					rowData = append(rowData, fmt.Sprintf("%v", value))
-				} else if hasDec {
-					rowData = append(rowData, fmt.Sprintf("%f", v))
-				} else {
-					rowData = append(rowData, fmt.Sprintf("%.f", v))
-				}
-			case []byte:
-				// Convert byte slice (UTF-8 data) to a string
-				utf8Str, err := convertToUTF8(string(v))
-				if err != nil {
-					fmt.Println("Failed to convert to UTF-8:", v, err)
-				}
-				rowData = append(rowData, strings.TrimSpace(string(utf8Str)))
-			default:
-				// Default formatting for other types
-				rowData = append(rowData, fmt.Sprintf("%v", value))
-			}
-		}
-		csvWriter.Write(rowData)
-	}
-	if err := rows.Err(); err != nil {
-		return false, fmt.Errorf("error iterating rows: %w", err)
+		return 0, err
 	}
-	return true, nil
+	defer rows.Close()
+	return WriteParquet(ctx, rows, path, opts)
 }
 
-func (db *ODBC) QuerySingleRow(query string, params ...any) (*map[string]any, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeoutODBC)
+// Query2Arrow streams the results of query into the Arrow IPC file path,
+// typed from the column types, returning the rows written
+func (db *ODBC) Query2Arrow(ctx context.Context, query string, path string, opts ArrowOptions, params ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
 	defer cancel()
-	result := map[string]any{}
 	rows, err := db.QueryContext(ctx, query, params...)
 	if err != nil {
-		return nil, false, err
+		return 0, err
 	}
 	defer rows.Close()
-	if rows.Next() {
-		result, err = ScanRowToMap(rows)
-		if err != nil {
-			return nil, false, fmt.Errorf("failed to scan row to map: %w", err)
-		}
+	return WriteArrow(ctx, rows, path, opts)
+}
+
+// ExecuteInTx runs queries in one transaction, bound to ctx only
+func (db *ODBC) ExecuteInTx(ctx context.Context, queries ...string) error {
+	return executeInTx(ctx, db.DB, queries)
+}
+
+// InsertBatch inserts rows with insertSQL (INSERT INTO t (a, b) VALUES) in
+// parameterized multi-row statements within a transaction
+func (db *ODBC) InsertBatch(ctx context.Context, insertSQL string, nCols int, rows [][]any) (int64, error) {
+	return insertBatch(ctx, db.DB, "odbc", insertSQL, nCols, rows)
+}
+
+// BulkInsert writes rows into table in parameterized batches, ODBC has no
+// bulk path of its own
+func (db *ODBC) BulkInsert(ctx context.Context, table string, columns []string, rows [][]any) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = QuoteIdentifier("odbc", col)
 	}
-	return &result, true, err
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES", table, strings.Join(quoted, ", "))
+	return db.InsertBatch(ctx, insertSQL, len(columns), rows)
 }
 
 func (db *ODBC) FromParams(params map[string]any, extra_conf map[string]any) (*DB, string, string, error) {
@@ -261,4 +361,3 @@ func (db *ODBC) IsEmpty(value any) bool {
 		return false
 	}
 }
-*/
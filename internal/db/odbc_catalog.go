@@ -0,0 +1,138 @@
+//go:build odbc
+
+package db
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"github.com/alexbrainman/odbc"
+	"github.com/alexbrainman/odbc/api"
+)
+
+// sqlAttrLoginTimeout is SQL_ATTR_LOGIN_TIMEOUT, not exported by the api
+const sqlAttrLoginTimeout = 103
+
+// odbcCatalog runs the ODBC catalog functions (SQLTables, SQLColumns,
+// SQLPrimaryKeys, SQLForeignKeys) on a connection of its own, they are not
+// reachable through database/sql
+type odbcCatalog struct {
+	env api.SQLHENV
+	dbc api.SQLHDBC
+}
+
+func openODBCCatalog(dsn string, timeout time.Duration) (*odbcCatalog, error) {
+	c := &odbcCatalog{}
+	var null, out api.SQLHANDLE // null: the zero value is SQL_NULL_HANDLE on every platform
+	if ret := api.SQLAllocHandle(api.SQL_HANDLE_ENV, null, &out); odbc.IsError(ret) {
+		return nil, fmt.Errorf("SQLAllocHandle: failed to allocate the environment handle (%d)", ret)
+	}
+	c.env = api.SQLHENV(out)
+	if ret := api.SQLSetEnvUIntPtrAttr(c.env, api.SQL_ATTR_ODBC_VERSION, api.SQL_OV_ODBC3, 0); odbc.IsError(ret) {
+		defer c.close()
+		return nil, odbc.NewError("SQLSetEnvUIntPtrAttr", c.env)
+	}
+	if ret := api.SQLAllocHandle(api.SQL_HANDLE_DBC, api.SQLHANDLE(c.env), &out); odbc.IsError(ret) {
+		defer c.close()
+		return nil, odbc.NewError("SQLAllocHandle", c.env)
+	}
+	c.dbc = api.SQLHDBC(out)
+	if timeout > 0 {
+		api.SQLSetConnectUIntPtrAttr(c.dbc, sqlAttrLoginTimeout, uintptr(timeout/time.Second), api.SQL_IS_UINTEGER)
+	}
+	b := api.StringToUTF16(dsn)
+	ret := api.SQLDriverConnect(c.dbc, 0, (*api.SQLWCHAR)(unsafe.Pointer(&b[0])), api.SQL_NTS, nil, 0, nil, api.SQL_DRIVER_NOPROMPT)
+	if odbc.IsError(ret) {
+		err := odbc.NewError("SQLDriverConnect", c.dbc)
+		api.SQLFreeHandle(api.SQL_HANDLE_DBC, api.SQLHANDLE(c.dbc))
+		c.dbc = api.SQLHDBC(null)
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *odbcCatalog) close() {
+	var null api.SQLHANDLE
+	if c.dbc != api.SQLHDBC(null) {
+		api.SQLDisconnect(c.dbc)
+		api.SQLFreeHandle(api.SQL_HANDLE_DBC, api.SQLHANDLE(c.dbc))
+	}
+	if c.env != api.SQLHENV(null) {
+		api.SQLFreeHandle(api.SQL_HANDLE_ENV, api.SQLHANDLE(c.env))
+	}
+}
+
+// query calls the catalog function fn with args (nil for NULL) and returns
+// its rows, the values as text and nil for NULL
+func (c *odbcCatalog) query(fn string, args ...*string) ([][]*string, error) {
+	var out api.SQLHANDLE
+	if ret := api.SQLAllocHandle(api.SQL_HANDLE_STMT, api.SQLHANDLE(c.dbc), &out); odbc.IsError(ret) {
+		return nil, odbc.NewError("SQLAllocHandle", c.dbc)
+	}
+	stmt := api.SQLHSTMT(out)
+	defer api.SQLFreeHandle(api.SQL_HANDLE_STMT, out)
+	wargs := make([]*uint16, len(args))
+	for i, arg := range args {
+		if arg != nil {
+			wargs[i] = &api.StringToUTF16(*arg)[0]
+		}
+	}
+	if ret := odbcCatalogCall(fn, stmt, wargs); odbc.IsError(ret) {
+		return nil, odbc.NewError(fn, stmt)
+	}
+	var ncols api.SQLSMALLINT
+	if ret := api.SQLNumResultCols(stmt, &ncols); odbc.IsError(ret) {
+		return nil, odbc.NewError("SQLNumResultCols", stmt)
+	}
+	var rows [][]*string
+	buf := make([]uint16, 1024)
+	for {
+		ret := api.SQLFetch(stmt)
+		if ret == api.SQL_NO_DATA {
+			break
+		}
+		if odbc.IsError(ret) {
+			return nil, odbc.NewError("SQLFetch", stmt)
+		}
+		row := make([]*string, ncols)
+		for i := range row {
+			var ind api.SQLLEN
+			ret := api.SQLGetData(stmt, api.SQLUSMALLINT(i+1), api.SQL_C_WCHAR, api.SQLPOINTER(unsafe.Pointer(&buf[0])), api.SQLLEN(len(buf)*2), &ind)
+			if odbc.IsError(ret) {
+				return nil, odbc.NewError("SQLGetData", stmt)
+			}
+			if ind != api.SQL_NULL_DATA {
+				s := api.UTF16ToString(buf)
+				row[i] = &s
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// odbcArg is a catalog function argument, nil (NULL) when empty
+func odbcArg(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// odbcValue is the text of the column i of a catalog row, empty for NULL
+func odbcValue(row []*string, i int) string {
+	if i >= len(row) || row[i] == nil {
+		return ""
+	}
+	return *row[i]
+}
+
+// odbcNullable is the column i of a catalog row, nil for NULL
+func odbcNullable(row []*string, i int) any {
+	if i >= len(row) || row[i] == nil {
+		return nil
+	}
+	return *row[i]
+}
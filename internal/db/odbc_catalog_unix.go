@@ -0,0 +1,42 @@
+//go:build odbc && !windows
+
+package db
+
+// #cgo darwin LDFLAGS: -L /usr/local/opt/unixodbc/lib -lodbc
+// #cgo darwin CFLAGS: -I /usr/local/opt/unixodbc/include
+// #cgo linux LDFLAGS: -lodbc
+// #cgo freebsd LDFLAGS: -L /usr/local/lib -lodbc
+// #cgo freebsd CFLAGS: -I/usr/local/include
+// #include <sql.h>
+// #include <sqlext.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/alexbrainman/odbc/api"
+)
+
+// odbcCatalogCall calls the wide version of the catalog function fn, a nil
+// arg is passed as NULL
+func odbcCatalogCall(fn string, stmt api.SQLHSTMT, args []*uint16) api.SQLRETURN {
+	h := C.SQLHSTMT(unsafe.Pointer(stmt))
+	str := make([]*C.SQLWCHAR, len(args))
+	size := make([]C.SQLSMALLINT, len(args))
+	for i, arg := range args {
+		if arg != nil {
+			str[i], size[i] = (*C.SQLWCHAR)(unsafe.Pointer(arg)), C.SQL_NTS
+		}
+	}
+	switch fn {
+	case "SQLTables":
+		return api.SQLRETURN(C.SQLTablesW(h, str[0], size[0], str[1], size[1], str[2], size[2], str[3], size[3]))
+	case "SQLColumns":
+		return api.SQLRETURN(C.SQLColumnsW(h, str[0], size[0], str[1], size[1], str[2], size[2], str[3], size[3]))
+	case "SQLPrimaryKeys":
+		return api.SQLRETURN(C.SQLPrimaryKeysW(h, str[0], size[0], str[1], size[1], str[2], size[2]))
+	case "SQLForeignKeys":
+		return api.SQLRETURN(C.SQLForeignKeysW(h, str[0], size[0], str[1], size[1], str[2], size[2], str[3], size[3], str[4], size[4], str[5], size[5]))
+	}
+	return api.SQL_INVALID_HANDLE
+}
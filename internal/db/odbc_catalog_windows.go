@@ -0,0 +1,31 @@
+//go:build odbc && windows
+
+package db
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/alexbrainman/odbc/api"
+)
+
+var odbc32 = syscall.NewLazyDLL("odbc32.dll")
+
+// odbcCatalogCall calls the wide version of the catalog function fn, a nil
+// arg is passed as NULL
+func odbcCatalogCall(fn string, stmt api.SQLHSTMT, args []*uint16) api.SQLRETURN {
+	proc := odbc32.NewProc(fn + "W")
+	if err := proc.Find(); err != nil {
+		return api.SQL_INVALID_HANDLE
+	}
+	call := []uintptr{uintptr(stmt)}
+	for _, arg := range args {
+		if arg == nil {
+			call = append(call, 0, 0)
+		} else {
+			call = append(call, uintptr(unsafe.Pointer(arg)), uintptr(api.SQL_NTS&0xffff))
+		}
+	}
+	r, _, _ := proc.Call(call...)
+	return api.SQLRETURN(r)
+}
@@ -0,0 +1,18 @@
+//go:build !odbc
+
+package db
+
+import "errors"
+
+// ODBC is not available in this build, etlx has to be built with the odbc
+// tag (go build -tags odbc), which needs the unixODBC headers on linux / macos
+type ODBC struct {
+	*DB
+}
+
+// ErrODBCDisabled is returned by NewODBC when etlx is built without the odbc tag
+var ErrODBCDisabled = errors.New("etlx was built without ODBC support, rebuild it with -tags odbc")
+
+func NewODBC(dsn string) (*ODBC, error) {
+	return nil, ErrODBCDisabled
+}
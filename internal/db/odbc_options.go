@@ -0,0 +1,91 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/env"
+)
+
+// ODBCOptions are the etlx options of an odbc connection string, taken out
+// of it before it goes to the driver manager:
+//
+//	odbc:DSN=warehouse;UID=user;PWD=pass;query_timeout=30m;connect_timeout=20s
+type ODBCOptions struct {
+	QueryTimeout   time.Duration // query_timeout, default ODBC_DFLT_TIMEOUT minutes (15)
+	ConnectTimeout time.Duration // connect_timeout, default 3 minutes
+}
+
+// odbcDuration parses a go duration (30s, 15m) or a number of seconds
+func odbcDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.Atoi(value); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// splitODBCConnString splits a connection string on the ; outside of braces
+// (values like PWD={a;b} keep their ;)
+func splitODBCConnString(dsn string) []string {
+	var parts []string
+	var sb strings.Builder
+	braces := false
+	for i := 0; i < len(dsn); i++ {
+		c := dsn[i]
+		switch {
+		case c == ';' && !braces:
+			parts = append(parts, sb.String())
+			sb.Reset()
+			continue
+		case c == '{' && !braces:
+			braces = true
+		case c == '}' && braces:
+			if i+1 < len(dsn) && dsn[i+1] == '}' {
+				// }} is an escaped } inside braces
+				sb.WriteByte(c)
+				i++
+			} else {
+				braces = false
+			}
+		}
+		sb.WriteByte(c)
+	}
+	if sb.Len() > 0 {
+		parts = append(parts, sb.String())
+	}
+	return parts
+}
+
+// ParseODBCConnString takes the etlx options out of an odbc connection
+// string, returning what is left for the driver manager
+func ParseODBCConnString(dsn string) (string, ODBCOptions, error) {
+	opts := ODBCOptions{
+		QueryTimeout:   time.Duration(env.GetInt("ODBC_DFLT_TIMEOUT", 15)) * time.Minute,
+		ConnectTimeout: defaultTimeout,
+	}
+	var keep []string
+	for _, part := range splitODBCConnString(dsn) {
+		key, value, _ := strings.Cut(part, "=")
+		var target *time.Duration
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "query_timeout":
+			target = &opts.QueryTimeout
+		case "connect_timeout":
+			target = &opts.ConnectTimeout
+		default:
+			if strings.TrimSpace(part) != "" {
+				keep = append(keep, part)
+			}
+			continue
+		}
+		d, err := odbcDuration(value)
+		if err != nil {
+			return "", opts, fmt.Errorf("odbc %s: %w", strings.TrimSpace(key), err)
+		}
+		*target = d
+	}
+	return strings.Join(keep, ";"), opts, nil
+}
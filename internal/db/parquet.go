@@ -0,0 +1,515 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// DefaultArrowBatchSize is the rows per record batch (and parquet row group)
+const DefaultArrowBatchSize = 122880
+
+// ArrowOptions is how Query2Parquet and Query2Arrow write the results
+type ArrowOptions struct {
+	Compression string // parquet: snappy (default), zstd, gzip, brotli, lz4_raw, none; arrow: zstd, lz4, none (default)
+	BatchSize   int    // rows per record batch, a row group in parquet, default DefaultArrowBatchSize
+}
+
+// recordWriter is the file format the record batches are written to
+type recordWriter interface {
+	Write(rec arrow.RecordBatch) error
+	Close() error
+}
+
+// arrowColumn is a result column with the arrow type it is written as
+type arrowColumn struct {
+	name   string
+	dbType string
+	typ    arrow.DataType
+	uuid   bool // mssql UNIQUEIDENTIFIER, scanned as its mixed endian bytes
+}
+
+// arrowType maps the database type name of a column to an arrow type, nil
+// when the name says nothing (e.g. computed columns in sqlite)
+func arrowType(col *sql.ColumnType) arrow.DataType {
+	name := strings.ToUpper(strings.TrimSpace(col.DatabaseTypeName()))
+	unsigned := strings.Contains(name, "UNSIGNED")
+	name = strings.TrimSpace(strings.ReplaceAll(name, "UNSIGNED", ""))
+	base := name
+	if i := strings.Index(base, "("); i >= 0 {
+		base = strings.TrimSpace(base[:i])
+	}
+	switch base {
+	case "":
+		return nil
+	case "INT", "INTEGER", "BIGINT", "SMALLINT", "TINYINT", "MEDIUMINT", "INT2", "INT4", "INT8",
+		"UTINYINT", "USMALLINT", "UINTEGER":
+		if unsigned && base == "BIGINT" {
+			return arrow.PrimitiveTypes.Uint64
+		}
+		return arrow.PrimitiveTypes.Int64
+	case "UBIGINT":
+		return arrow.PrimitiveTypes.Uint64
+	case "REAL", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "DOUBLE PRECISION":
+		return arrow.PrimitiveTypes.Float64
+	case "DECIMAL", "NUMERIC":
+		var p, s int64
+		if n, _ := fmt.Sscanf(name[len(base):], "(%d,%d)", &p, &s); n == 0 {
+			if dp, ds, ok := col.DecimalSize(); ok {
+				p, s = dp, ds
+			}
+		}
+		if p > 0 && p <= 38 && s >= 0 && s <= p {
+			return &arrow.Decimal128Type{Precision: int32(p), Scale: int32(s)}
+		}
+		return arrow.BinaryTypes.String
+	case "MONEY", "SMALLMONEY":
+		return &arrow.Decimal128Type{Precision: 19, Scale: 4}
+	case "BOOL", "BOOLEAN", "BIT":
+		return arrow.FixedWidthTypes.Boolean
+	case "DATE":
+		return arrow.FixedWidthTypes.Date32
+	case "TIMESTAMP", "DATETIME", "DATETIME2", "SMALLDATETIME", "TIMESTAMP_S", "TIMESTAMP_MS", "TIMESTAMP_NS":
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	case "TIMESTAMPTZ", "TIMESTAMP WITH TIME ZONE", "DATETIMEOFFSET":
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	case "BLOB", "BYTEA", "BINARY", "VARBINARY", "IMAGE", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB":
+		return arrow.BinaryTypes.Binary
+	}
+	return arrow.BinaryTypes.String
+}
+
+// valueArrowType is the arrow type of a Go value returned by the driver
+func valueArrowType(v any) arrow.DataType {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return arrow.PrimitiveTypes.Int64
+	case uint, uint64:
+		return arrow.PrimitiveTypes.Uint64
+	case float32, float64:
+		return arrow.PrimitiveTypes.Float64
+	case bool:
+		return arrow.FixedWidthTypes.Boolean
+	case time.Time:
+		return &arrow.TimestampType{Unit: arrow.Microsecond}
+	}
+	return arrow.BinaryTypes.String
+}
+
+// arrowColumns maps the result columns to arrow, the columns whose type
+// name says nothing take the type of their first non null value in batch
+func arrowColumns(types []*sql.ColumnType, batch [][]any) ([]arrowColumn, *arrow.Schema) {
+	cols := make([]arrowColumn, len(types))
+	fields := make([]arrow.Field, len(types))
+	for i, t := range types {
+		cols[i] = arrowColumn{name: t.Name(), dbType: strings.ToUpper(t.DatabaseTypeName()), typ: arrowType(t)}
+		cols[i].uuid = cols[i].dbType == "UNIQUEIDENTIFIER"
+		if cols[i].typ == nil {
+			cols[i].typ = arrow.BinaryTypes.String
+			for _, row := range batch {
+				if row[i] != nil {
+					cols[i].typ = valueArrowType(row[i])
+					break
+				}
+			}
+		}
+		fields[i] = arrow.Field{Name: t.Name(), Type: cols[i].typ, Nullable: true}
+	}
+	return cols, arrow.NewSchema(fields, nil)
+}
+
+func toInt64(v any) (int64, error) {
+	switch val := v.(type) {
+	case int:
+		return int64(val), nil
+	case int8:
+		return int64(val), nil
+	case int16:
+		return int64(val), nil
+	case int32:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case uint8:
+		return int64(val), nil
+	case uint16:
+		return int64(val), nil
+	case uint32:
+		return int64(val), nil
+	case uint:
+		return int64(val), nil
+	case uint64:
+		if val > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", val)
+		}
+		return int64(val), nil
+	case float32:
+		return int64(val), nil
+	case float64:
+		if val != math.Trunc(val) {
+			return 0, fmt.Errorf("%v is not an integer", val)
+		}
+		return int64(val), nil
+	case bool:
+		if val {
+			return 1, nil
+		}
+		return 0, nil
+	case []byte:
+		return strconv.ParseInt(strings.TrimSpace(string(val)), 10, 64)
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(val), 10, 64)
+	}
+	return strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64)
+}
+
+func toFloat64(v any) (float64, error) {
+	switch val := v.(type) {
+	case float32:
+		return float64(val), nil
+	case float64:
+		return val, nil
+	case []byte:
+		return strconv.ParseFloat(strings.TrimSpace(string(val)), 64)
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(val), 64)
+	}
+	if n, err := toInt64(v); err == nil {
+		return float64(n), nil
+	}
+	return strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+}
+
+var moneyReplacer = strings.NewReplacer("$", "", ",", "", " ", "")
+
+func toDecimal128(v any, dt *arrow.Decimal128Type) (decimal128.Num, error) {
+	switch val := v.(type) {
+	case float32:
+		return decimal128.FromFloat64(float64(val), dt.Precision, dt.Scale)
+	case float64:
+		return decimal128.FromFloat64(val, dt.Precision, dt.Scale)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return decimal128.FromString(fmt.Sprintf("%d", val), dt.Precision, dt.Scale)
+	case []byte:
+		return decimal128.FromString(moneyReplacer.Replace(string(val)), dt.Precision, dt.Scale)
+	case string:
+		return decimal128.FromString(moneyReplacer.Replace(val), dt.Precision, dt.Scale)
+	}
+	return decimal128.FromString(fmt.Sprintf("%v", v), dt.Precision, dt.Scale)
+}
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999 -07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+func toTime(v any) (time.Time, error) {
+	var s string
+	switch val := v.(type) {
+	case time.Time:
+		return val, nil
+	case []byte:
+		s = string(val)
+	case string:
+		s = val
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse %q as a time", s)
+}
+
+func (c arrowColumn) text(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case []byte:
+		if c.uuid && len(val) == 16 {
+			var u mssql.UniqueIdentifier
+			if err := u.Scan(val); err == nil {
+				return u.String()
+			}
+		}
+		if c.dbType == "UUID" && len(val) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", val[0:4], val[4:6], val[6:8], val[8:10], val[10:])
+		}
+		s, err := convertToUTF8(string(val))
+		if err != nil {
+			return string(val)
+		}
+		return s
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return val.String()
+	}
+	// e.g. duckdb.UUID, a String method on the pointer only
+	rv := reflect.ValueOf(v)
+	if ptr := reflect.New(rv.Type()); ptr.Type().Implements(reflect.TypeOf((*fmt.Stringer)(nil)).Elem()) {
+		ptr.Elem().Set(rv)
+		return ptr.Interface().(fmt.Stringer).String()
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// append adds v (nil is null) to the builder of the column
+func (c arrowColumn) append(b array.Builder, v any) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch bld := b.(type) {
+	case *array.Int64Builder:
+		n, err := toInt64(v)
+		if err != nil {
+			return err
+		}
+		bld.Append(n)
+	case *array.Uint64Builder:
+		n, err := strconv.ParseUint(fmt.Sprintf("%v", v), 10, 64)
+		if err != nil {
+			return err
+		}
+		bld.Append(n)
+	case *array.Float64Builder:
+		f, err := toFloat64(v)
+		if err != nil {
+			return err
+		}
+		bld.Append(f)
+	case *array.Decimal128Builder:
+		n, err := toDecimal128(v, bld.Type().(*arrow.Decimal128Type))
+		if err != nil {
+			return err
+		}
+		bld.Append(n)
+	case *array.BooleanBuilder:
+		switch val := v.(type) {
+		case bool:
+			bld.Append(val)
+		default:
+			s := strings.TrimSpace(c.text(v))
+			ok, err := strconv.ParseBool(s)
+			if err != nil {
+				return err
+			}
+			bld.Append(ok)
+		}
+	case *array.Date32Builder:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		bld.Append(arrow.Date32FromTime(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)))
+	case *array.TimestampBuilder:
+		t, err := toTime(v)
+		if err != nil {
+			return err
+		}
+		if bld.Type().(*arrow.TimestampType).TimeZone == "" {
+			// no time zone, the wall clock is kept as is
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		}
+		bld.Append(arrow.Timestamp(t.UnixMicro()))
+	case *array.BinaryBuilder:
+		switch val := v.(type) {
+		case []byte:
+			bld.Append(val)
+		default:
+			bld.AppendString(c.text(v))
+		}
+	case *array.StringBuilder:
+		bld.Append(c.text(v))
+	default:
+		return fmt.Errorf("unsupported arrow type %s", b.Type())
+	}
+	return nil
+}
+
+// writeRecords streams rows into the record batches of the writer open
+// returns once the schema is known, returning the rows written
+func writeRecords(ctx context.Context, rows *sql.Rows, batchSize int, open func(schema *arrow.Schema) (recordWriter, error)) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultArrowBatchSize
+	}
+	// the column types are gone once the rows are exhausted
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, fmt.Errorf("error getting column types: %w", err)
+	}
+	var (
+		cols  []arrowColumn
+		w     recordWriter
+		bld   *array.RecordBuilder
+		total int64
+	)
+	defer func() {
+		if bld != nil {
+			bld.Release()
+		}
+		if w != nil {
+			w.Close()
+		}
+	}()
+	flush := func(batch [][]any) error {
+		if w == nil {
+			var schema *arrow.Schema
+			cols, schema = arrowColumns(types, batch)
+			if w, err = open(schema); err != nil {
+				return err
+			}
+			bld = array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for _, row := range batch {
+			for i, v := range row {
+				if err := cols[i].append(bld.Field(i), v); err != nil {
+					return fmt.Errorf("column %s (%s) row %d: %w", cols[i].name, cols[i].dbType, total+1, err)
+				}
+			}
+			total++
+		}
+		rec := bld.NewRecordBatch()
+		defer rec.Release()
+		return w.Write(rec)
+	}
+	batch := make([][]any, 0, batchSize)
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		values := make([]any, len(types))
+		pointers := make([]any, len(types))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return total, fmt.Errorf("failed to scan row: %w", err)
+		}
+		batch = append(batch, values)
+		if len(batch) == batchSize {
+			if err := flush(batch); err != nil {
+				return total, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return total, fmt.Errorf("error iterating rows: %w", err)
+	}
+	if err := flush(batch); err != nil {
+		return total, err
+	}
+	err = w.Close()
+	w = nil
+	return total, err
+}
+
+func parquetCompression(name string) (compress.Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "snappy":
+		return compress.Codecs.Snappy, nil
+	case "zstd":
+		return compress.Codecs.Zstd, nil
+	case "gzip":
+		return compress.Codecs.Gzip, nil
+	case "brotli":
+		return compress.Codecs.Brotli, nil
+	case "lz4", "lz4_raw":
+		return compress.Codecs.Lz4Raw, nil
+	case "none", "uncompressed":
+		return compress.Codecs.Uncompressed, nil
+	}
+	return compress.Codecs.Uncompressed, fmt.Errorf("unsupported parquet compression %s (snappy | zstd | gzip | brotli | lz4_raw | none)", name)
+}
+
+// WriteParquet streams rows into the parquet file path, the columns typed
+// from the database types, returning the rows written
+func WriteParquet(ctx context.Context, rows *sql.Rows, path string, opts ArrowOptions) (int64, error) {
+	codec, err := parquetCompression(opts.Compression)
+	if err != nil {
+		return 0, err
+	}
+	return writeRecords(ctx, rows, opts.BatchSize, func(schema *arrow.Schema) (recordWriter, error) {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("error creating parquet file: %w", err)
+		}
+		props := parquet.NewWriterProperties(parquet.WithCompression(codec), parquet.WithMaxRowGroupLength(math.MaxInt64))
+		// closing the parquet writer closes the file
+		fw, err := pqarrow.NewFileWriter(schema, file, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return fw, nil
+	})
+}
+
+// arrowFile closes the file once the IPC footer is written
+type arrowFile struct {
+	*ipc.FileWriter
+	file *os.File
+}
+
+func (f arrowFile) Close() error {
+	err := f.FileWriter.Close()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteArrow streams rows into the Arrow IPC (feather v2) file path, the
+// columns typed from the database types, returning the rows written
+func WriteArrow(ctx context.Context, rows *sql.Rows, path string, opts ArrowOptions) (int64, error) {
+	var codec []ipc.Option
+	switch strings.ToLower(opts.Compression) {
+	case "", "none", "uncompressed":
+	case "zstd":
+		codec = append(codec, ipc.WithZstd())
+	case "lz4", "lz4_frame":
+		codec = append(codec, ipc.WithLZ4())
+	default:
+		return 0, fmt.Errorf("unsupported arrow compression %s (zstd | lz4 | none)", opts.Compression)
+	}
+	return writeRecords(ctx, rows, opts.BatchSize, func(schema *arrow.Schema) (recordWriter, error) {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("error creating arrow file: %w", err)
+		}
+		fw, err := ipc.NewFileWriter(file, append(codec, ipc.WithSchema(schema))...)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return arrowFile{fw, file}, nil
+	})
+}
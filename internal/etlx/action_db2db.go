@@ -3,14 +3,17 @@ package etlxlib
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/realdatadriven/etlx/internal/db"
+	"github.com/realdatadriven/etlx/internal/secrets"
 )
 
 func ScanRowToMap(rows *sql.Rows) (map[string]any, error) {
@@ -51,7 +54,11 @@ func (etlx *ETLX) DB2DB(params map[string]any, item map[string]any, dateRef []ti
 	}
 	target_sql, ok := target["sql"].(string)
 	if !ok {
-		return fmt.Errorf("no target conn string detected %s", target_sql)
+		table, _ := target["table"].(string)
+		if table == "" {
+			return fmt.Errorf("no target sql or table detected")
+		}
+		target_sql = fmt.Sprintf("INSERT INTO %s (:columns) VALUES", table)
 	}
 	dbSourceConn, err := etlx.GetDB(source_conn)
 	if err != nil {
@@ -96,7 +103,32 @@ func (etlx *ETLX) DB2DB(params map[string]any, item map[string]any, dateRef []ti
 		}
 	}
 	sql = etlx.SetQueryPlaceholders(sql, "", "", dateRef)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
+	load, err := newDB2DBLoad(dbTargetConn, target, sql_target)
+	if err != nil {
+		return err
+	}
+	// INCREMENTAL, THE MAX OF THE WATERMARK COLUMN IS KEPT FOR THE NEXT RUN
+	watermarkColumn, _ := source["watermark_column"].(string)
+	watermarkTable, _ := target["watermark_table"].(string)
+	if watermarkTable == "" {
+		watermarkTable = DefaultWatermarkTable
+	}
+	// ONE WATERMARK PER watermark_key, <KEY>.<ITEM> WHEN RUN AS AN ACTION
+	watermarkItem, _ := source["watermark_key"].(string)
+	if watermarkColumn != "" {
+		if watermarkItem == "" {
+			return fmt.Errorf("watermark_column %s without a watermark_key", watermarkColumn)
+		}
+		watermark, err := loadWatermark(etlx.Context(), dbTargetConn, watermarkTable, watermarkItem)
+		if err != nil {
+			return err
+		}
+		if watermark == "" {
+			watermark = SQLLiteral(source["watermark_initial"])
+		}
+		sql = watermarkRe.ReplaceAllLiteralString(sql, watermark)
+	}
+	ctx, cancel := context.WithTimeout(etlx.Context(), time.Duration(timeout)*time.Second)
 	defer cancel()
 	rows, err := dbSourceConn.QueryRows(ctx, sql, []any{}...)
 	if err != nil {
@@ -115,36 +147,80 @@ func (etlx *ETLX) DB2DB(params map[string]any, item map[string]any, dateRef []ti
 			return fmt.Errorf("error executing target preparation queries: %s", err)
 		}
 	}
-	i := 0
-	var result []map[string]any
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %w", err)
+	}
+	binary := binaryColumns(rows)
+	watermarkIdx := -1
+	var watermarkMax any
+	if watermarkColumn != "" {
+		for i, col := range columns {
+			if strings.EqualFold(col, watermarkColumn) {
+				watermarkIdx = i
+			}
+		}
+		if watermarkIdx < 0 {
+			return fmt.Errorf("watermark column %s is not in the source columns", watermarkColumn)
+		}
+	}
+	var write func(rows [][]any) (int64, error)
+	if load.staged() {
+		if err := load.checkColumns(columns); err != nil {
+			return err
+		}
+		if err := load.begin(etlx.Context()); err != nil {
+			return fmt.Errorf("failed to create the staging table: %w", err)
+		}
+		defer func() {
+			cleanupCtx, cancel := etlx.cleanupContext()
+			defer cancel()
+			_ = load.end(cleanupCtx)
+		}()
+		bulk, ok := target["bulk"].(bool)
+		write = etlx.tableWriter(dbTargetConn, load.stage, columns, bulk || !ok)
+	} else {
+		write, err = etlx.targetWriter(dbTargetConn, sql_target, columns, target)
+		if err != nil {
+			return err
+		}
+	}
+	result := make([][]any, 0, chunk_size)
 	for rows.Next() {
-		i += 1
-		row, err := ScanRowToMap(rows)
+		row, err := ScanRowToSlice(rows, binary)
 		if err != nil {
-			return fmt.Errorf("failed to scan row to map: %w", err)
+			return fmt.Errorf("failed to scan row: %w", err)
 		}
 		result = append(result, row)
+		if watermarkIdx >= 0 && watermarkAfter(row[watermarkIdx], watermarkMax) {
+			watermarkMax = row[watermarkIdx]
+		}
 		// send to target
-		if i >= chunk_size {
-			i = 0
-			_, err = etlx.UpdateTarget(dbTargetConn, sql_target, result)
-			if err != nil {
-				// fmt.Printf("failed update the target: %s", err)
+		if len(result) >= chunk_size {
+			if _, err = write(result); err != nil {
 				return fmt.Errorf("main target query faild: %w", err)
 			}
-			result = []map[string]any{} //result[:0]
+			result = result[:0]
 		}
 	}
 	if err := rows.Err(); err != nil {
-		fmt.Printf("row iteration error: %s", err)
 		return fmt.Errorf("row iteration error: %w", err)
 	}
 	if len(result) > 0 {
-		_, err = etlx.UpdateTarget(dbTargetConn, sql_target, result)
-		if err != nil {
+		if _, err = write(result); err != nil {
 			return fmt.Errorf("main target query faild: %w", err)
 		}
 	}
+	if load.staged() {
+		if err := load.apply(etlx.Context(), columns); err != nil {
+			return fmt.Errorf("%s into %s failed: %w", load.mode, load.table, err)
+		}
+	}
+	if watermarkMax != nil {
+		if err := saveWatermark(etlx.Context(), dbTargetConn, watermarkTable, watermarkItem, SQLLiteral(watermarkMax)); err != nil {
+			return fmt.Errorf("failed to save the watermark: %w", err)
+		}
+	}
 	// END / CLOSING QUERIES
 	after_source, ok := source["after"]
 	if ok {
@@ -163,48 +239,103 @@ func (etlx *ETLX) DB2DB(params map[string]any, item map[string]any, dateRef []ti
 	return nil
 }
 
-func (etlx *ETLX) BuildInsertSQL(sql_header string, data []map[string]any) (string, error) {
-	if len(data) == 0 {
-		return "", fmt.Errorf("no data to insert")
+// ScanRowToSlice scans a row in the column order of the query, the []byte
+// of the columns not flagged in binary are returned as strings and the driver
+// specific types as the values they bind as
+func ScanRowToSlice(rows *sql.Rows, binary []bool) ([]any, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
-	// Use keys from the first map as column names
-	columns := make([]string, 0, len(data[0]))
-	for k := range data[0] {
-		columns = append(columns, k)
+	values := make([]any, len(columns))
+	valuePointers := make([]any, len(columns))
+	for i := range values {
+		valuePointers[i] = &values[i]
 	}
-	var valueRows []string
-	for _, row := range data {
-		var values []string
-		for _, col := range columns {
-			val := row[col]
-			values = append(values, formatValue(val))
+	if err := rows.Scan(valuePointers...); err != nil {
+		return nil, fmt.Errorf("failed to scan row: %w", err)
+	}
+	for i, v := range values {
+		switch val := v.(type) {
+		case nil, int64, float64, bool, string, time.Time:
+		case []byte:
+			if i >= len(binary) || !binary[i] {
+				values[i] = string(val)
+			}
+		case driver.Valuer:
+			if dv, err := val.Value(); err == nil {
+				values[i] = dv
+			}
+		case fmt.Stringer:
+			values[i] = val.String()
 		}
-		valueRows = append(valueRows, "("+strings.Join(values, ", ")+")")
 	}
-	sql, err := ReplaceColumnsWithDetectedIdentifier(sql_header, columns)
-	if err == nil {
-		sql = fmt.Sprintf("%s %s;", sql, strings.Join(valueRows, ",\n"))
-	} else {
-		//fmt.Println(err)
-		// Escape column names (basic, you might need to adapt for SQL Server specifics)
-		colList := strings.Join(columns, ", ")
-		/*sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;",
-			table,
-			colList,
-			strings.Join(valueRows, ",\n"),
-		)*/
-		re := regexp.MustCompile(`:columns\b`)
-		sql_header = re.ReplaceAllString(sql_header, colList)
-		sql = fmt.Sprintf("%s %s;", sql_header, strings.Join(valueRows, ",\n"))
+	return values, nil
+}
+
+// binaryColumns flags the columns whose database type holds bytes, not text
+func binaryColumns(rows *sql.Rows) []bool {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil
+	}
+	binary := make([]bool, len(types))
+	for i, t := range types {
+		name := strings.ToUpper(t.DatabaseTypeName())
+		binary[i] = strings.Contains(name, "BLOB") || strings.Contains(name, "BINARY") || name == "BYTEA" || name == "IMAGE"
+	}
+	return binary
+}
+
+// the target sql DB2DB can hand to the driver bulk path
+var insertColumnsRe = regexp.MustCompile("(?is)^\\s*INSERT\\s+INTO\\s+(.+?)\\s*\\(\\s*[[\"`]?:columns[]\"`]?\\s*\\)\\s*VALUES\\s*;?\\s*$")
+
+// targetWriter returns the func writing the chunks into the target: the
+// driver bulk path (COPY, bulk copy, appender) when the target sql is a plain
+// INSERT INTO table (:columns) VALUES and bulk is not false, parameterized
+// multi-row inserts otherwise
+func (etlx *ETLX) targetWriter(conn db.DBInterface, sqlTarget string, columns []string, target map[string]any) (func(rows [][]any) (int64, error), error) {
+	ctx := etlx.Context()
+	bulk, ok := target["bulk"].(bool)
+	if !ok {
+		bulk = true
+	}
+	if match := insertColumnsRe.FindStringSubmatch(sqlTarget); bulk && match != nil {
+		return etlx.tableWriter(conn, match[1], columns, true), nil
+	}
+	insertSQL, err := ReplaceColumnsWithDetectedIdentifier(sqlTarget, columns)
+	if err != nil {
+		return nil, err
 	}
 	if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-		_file, err := etlx.TempFIle("", sql, fmt.Sprintf("query.%s.*.sql", "db2db"))
+		_file, err := etlx.TempFIle("", secrets.Mask(db.BatchInsertSQL(conn.GetDriverName(), insertSQL, len(columns), 1)), fmt.Sprintf("query.%s.*.sql", "db2db"))
 		if err != nil {
-			fmt.Println(err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 		}
-		fmt.Println(_file)
+		etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
+	}
+	return func(rows [][]any) (int64, error) {
+		return conn.InsertBatch(ctx, insertSQL, len(columns), rows)
+	}, nil
+}
+
+// tableWriter returns the func writing the chunks into table, through the
+// driver bulk path or parameterized multi-row inserts
+func (etlx *ETLX) tableWriter(conn db.DBInterface, table string, columns []string, bulk bool) func(rows [][]any) (int64, error) {
+	ctx := etlx.Context()
+	if bulk {
+		return func(rows [][]any) (int64, error) {
+			return conn.BulkInsert(ctx, table, columns, rows)
+		}
+	}
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = db.QuoteIdentifier(conn.GetDriverName(), col)
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES", table, strings.Join(quoted, ", "))
+	return func(rows [][]any) (int64, error) {
+		return conn.InsertBatch(ctx, insertSQL, len(columns), rows)
 	}
-	return sql, nil
 }
 
 // Detects the quote character around :columns and replaces it with the appropriate formatted column list.
@@ -246,35 +377,28 @@ func ReplaceColumnsWithDetectedIdentifier(query string, columns []string) (strin
 	return finalQuery, nil
 }
 
-func formatValue(v any) string {
-	switch val := v.(type) {
-	case nil:
-		return "NULL"
-	case int, int32, int64:
-		return fmt.Sprintf("%d", val)
-	case float32, float64:
-		return fmt.Sprintf("%f", val)
-	case bool:
-		if val {
-			return "1"
+// UpdateTarget inserts data with the sql_target header, the columns in name
+// order since maps have none
+func (etlx *ETLX) UpdateTarget(dbTargetConn db.DBInterface, sql_target string, data []map[string]any) (int, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("no data to insert")
+	}
+	columns := make([]string, 0, len(data[0]))
+	for k := range data[0] {
+		columns = append(columns, k)
+	}
+	sort.Strings(columns)
+	rows := make([][]any, len(data))
+	for i, row := range data {
+		rows[i] = make([]any, len(columns))
+		for j, col := range columns {
+			rows[i][j] = row[col]
 		}
-		return "0"
-	case time.Time:
-		return "'" + val.Format("2006-01-02 15:04:05") + "'"
-	case []byte:
-		return "'" + strings.ReplaceAll(string(val), "'", "''") + "'"
-	case string:
-		return "'" + strings.ReplaceAll(val, "'", "''") + "'"
-	default:
-		return "'" + strings.ReplaceAll(fmt.Sprintf("%v", val), "'", "''") + "'"
 	}
-}
-
-func (etlx *ETLX) UpdateTarget(dbTargetConn db.DBInterface, sql_target string, data []map[string]any) (int, error) {
-	sql, err := etlx.BuildInsertSQL(sql_target, data)
+	write, err := etlx.targetWriter(dbTargetConn, sql_target, columns, map[string]any{})
 	if err != nil {
 		return 0, err
 	}
-	//fmt.Println(sql)
-	return dbTargetConn.ExecuteQuery(sql, []any{}...)
+	n, err := write(rows)
+	return int(n), err
 }
@@ -0,0 +1,296 @@
+package etlxlib
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// DB2DB modes, what is done in the target with the rows read from the source
+const (
+	DB2DBAppend         = "append"
+	DB2DBTruncateInsert = "truncate_insert"
+	DB2DBUpsert         = "upsert"
+	DB2DBMerge          = "merge"
+)
+
+// DefaultWatermarkTable is the target table the DB2DB watermarks are kept in
+const DefaultWatermarkTable = "etlx_watermarks"
+
+var watermarkRe = regexp.MustCompile(`<watermark>|{watermark}`)
+
+// db2dbLoad writes the chunks of a DB2DB straight into the target table
+// (append) or into a staging table that is applied to it in one transaction
+// once the whole source was read
+type db2dbLoad struct {
+	conn          db.DBInterface
+	driver        string
+	mode          string
+	table         string
+	stage         string
+	keys          []string
+	deleteMissing bool
+}
+
+func newDB2DBLoad(conn db.DBInterface, target map[string]any, sqlTarget string) (*db2dbLoad, error) {
+	mode, _ := target["mode"].(string)
+	if mode == "" {
+		mode = DB2DBAppend
+	}
+	l := &db2dbLoad{conn: conn, driver: conn.GetDriverName(), mode: strings.ToLower(mode)}
+	l.table, _ = target["table"].(string)
+	if l.table == "" {
+		if match := insertColumnsRe.FindStringSubmatch(sqlTarget); match != nil {
+			l.table = match[1]
+		}
+	}
+	switch l.mode {
+	case DB2DBAppend:
+		return l, nil
+	case DB2DBTruncateInsert, DB2DBUpsert, DB2DBMerge:
+	default:
+		return nil, fmt.Errorf("unknown mode %s (append | truncate_insert | upsert | merge)", mode)
+	}
+	if l.table == "" {
+		return nil, fmt.Errorf("mode %s needs the target table", l.mode)
+	}
+	switch keys := target["key_columns"].(type) {
+	case string:
+		l.keys = []string{keys}
+	case []string:
+		l.keys = keys
+	case []any:
+		for _, k := range keys {
+			l.keys = append(l.keys, fmt.Sprintf("%v", k))
+		}
+	}
+	if l.mode != DB2DBTruncateInsert && len(l.keys) == 0 {
+		return nil, fmt.Errorf("mode %s needs key_columns", l.mode)
+	}
+	l.deleteMissing, _ = target["delete_missing"].(bool)
+	parts := db.SplitIdentifier(l.table)
+	parts[len(parts)-1] = "etlx_stage_" + parts[len(parts)-1]
+	for i, part := range parts {
+		parts[i] = l.quote(part)
+	}
+	l.stage = strings.Join(parts, ".")
+	return l, nil
+}
+
+func (l *db2dbLoad) quote(name string) string {
+	return db.QuoteIdentifier(l.driver, name)
+}
+
+func (l *db2dbLoad) staged() bool {
+	return l.mode != DB2DBAppend
+}
+
+// checkColumns makes sure the key columns are among the source columns
+func (l *db2dbLoad) checkColumns(columns []string) error {
+	for _, key := range l.keys {
+		found := false
+		for _, col := range columns {
+			if strings.EqualFold(col, key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("key column %s is not in the source columns", key)
+		}
+	}
+	return nil
+}
+
+// begin (re)creates the staging table empty, with the columns of the target
+func (l *db2dbLoad) begin(ctx context.Context) error {
+	create := fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 1 = 0", l.stage, l.table)
+	switch l.driver {
+	case "mssql", "sqlserver":
+		// the UNION keeps SELECT INTO from copying the IDENTITY columns
+		create = fmt.Sprintf("SELECT * INTO %s FROM %s WHERE 1 = 0 UNION ALL SELECT * FROM %s WHERE 1 = 0", l.stage, l.table, l.table)
+	}
+	return l.conn.ExecuteInTx(ctx, l.dropStageSQL(), create)
+}
+
+func (l *db2dbLoad) dropStageSQL() string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", l.stage)
+}
+
+// end drops the staging table
+func (l *db2dbLoad) end(ctx context.Context) error {
+	return l.conn.ExecuteInTx(ctx, l.dropStageSQL())
+}
+
+// match is the join condition on the key columns between the tables a and b
+func (l *db2dbLoad) match(a string, b string) string {
+	conds := make([]string, len(l.keys))
+	for i, key := range l.keys {
+		conds[i] = fmt.Sprintf("%s.%s = %s.%s", a, l.quote(key), b, l.quote(key))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// applySQL is the statements moving the staged rows into the target
+func (l *db2dbLoad) applySQL(columns []string) []string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = l.quote(col)
+	}
+	cols := strings.Join(quoted, ", ")
+	insert := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", l.table, cols, cols, l.stage)
+	switch l.mode {
+	case DB2DBTruncateInsert:
+		return []string{fmt.Sprintf("DELETE FROM %s", l.table), insert}
+	case DB2DBUpsert:
+		return []string{
+			fmt.Sprintf("DELETE FROM %s WHERE EXISTS (SELECT 1 FROM %s WHERE %s)", l.table, l.stage, l.match(l.stage, l.table)),
+			insert,
+		}
+	}
+	var queries []string
+	if l.deleteMissing {
+		queries = append(queries, fmt.Sprintf("DELETE FROM %s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s)", l.table, l.stage, l.match(l.stage, l.table)))
+	}
+	var updates []string
+	for _, col := range columns {
+		isKey := false
+		for _, key := range l.keys {
+			isKey = isKey || strings.EqualFold(col, key)
+		}
+		if !isKey {
+			updates = append(updates, col)
+		}
+	}
+	if len(updates) > 0 {
+		queries = append(queries, l.updateSQL(updates))
+	}
+	return append(queries, fmt.Sprintf("%s WHERE NOT EXISTS (SELECT 1 FROM %s WHERE %s)", insert, l.table, l.match(l.table, l.stage)))
+}
+
+// updateSQL updates the columns of the target rows matched by the staged ones
+func (l *db2dbLoad) updateSQL(columns []string) string {
+	set := make([]string, len(columns))
+	switch l.driver {
+	case "postgres", "postgresql", "sqlite3", "sqlite", "duckdb":
+		for i, col := range columns {
+			set[i] = fmt.Sprintf("%s = %s.%s", l.quote(col), l.stage, l.quote(col))
+		}
+		return fmt.Sprintf("UPDATE %s SET %s FROM %s WHERE %s", l.table, strings.Join(set, ", "), l.stage, l.match(l.stage, l.table))
+	case "mssql", "sqlserver":
+		for i, col := range columns {
+			set[i] = fmt.Sprintf("%s = %s.%s", l.quote(col), l.stage, l.quote(col))
+		}
+		return fmt.Sprintf("UPDATE %s SET %s FROM %s INNER JOIN %s ON %s", l.table, strings.Join(set, ", "), l.table, l.stage, l.match(l.stage, l.table))
+	case "mysql":
+		for i, col := range columns {
+			set[i] = fmt.Sprintf("%s.%s = %s.%s", l.table, l.quote(col), l.stage, l.quote(col))
+		}
+		return fmt.Sprintf("UPDATE %s INNER JOIN %s ON %s SET %s", l.table, l.stage, l.match(l.stage, l.table), strings.Join(set, ", "))
+	}
+	for i, col := range columns {
+		set[i] = fmt.Sprintf("%s = (SELECT %s.%s FROM %s WHERE %s)", l.quote(col), l.stage, l.quote(col), l.stage, l.match(l.stage, l.table))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE EXISTS (SELECT 1 FROM %s WHERE %s)", l.table, strings.Join(set, ", "), l.stage, l.match(l.stage, l.table))
+}
+
+// apply moves the staged rows into the target in one transaction
+func (l *db2dbLoad) apply(ctx context.Context, columns []string) error {
+	return l.conn.ExecuteInTx(ctx, l.applySQL(columns)...)
+}
+
+// SQLLiteral renders v as a SQL literal, used for the watermarks
+func SQLLiteral(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", val)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case time.Time:
+		return "'" + val.Format("2006-01-02 15:04:05.999999-07:00") + "'"
+	case []byte:
+		return "'" + strings.ReplaceAll(string(val), "'", "''") + "'"
+	default:
+		return "'" + strings.ReplaceAll(fmt.Sprintf("%v", val), "'", "''") + "'"
+	}
+}
+
+// watermarkAfter tells if a is past b, comparing times, numbers or their text
+func watermarkAfter(a any, b any) bool {
+	if a == nil {
+		return false
+	}
+	if b == nil {
+		return true
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.After(tb)
+		}
+	}
+	fa, errA := strconv.ParseFloat(fmt.Sprintf("%v", a), 64)
+	fb, errB := strconv.ParseFloat(fmt.Sprintf("%v", b), 64)
+	if errA == nil && errB == nil {
+		return fa > fb
+	}
+	return fmt.Sprintf("%v", a) > fmt.Sprintf("%v", b)
+}
+
+// ensureWatermarkTable creates the watermarks table in the target if missing,
+// the item is kept under the key size limits of MySQL (3072 bytes) and SQL
+// Server (900 bytes)
+func ensureWatermarkTable(ctx context.Context, conn db.DBInterface, table string) error {
+	driver := conn.GetDriverName()
+	q := func(name string) string { return db.QuoteIdentifier(driver, name) }
+	cols := fmt.Sprintf("(%s VARCHAR(700) NOT NULL PRIMARY KEY, %s VARCHAR(1000), %s VARCHAR(40))", q("item"), q("value"), q("updated_at"))
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s %s", table, cols)
+	switch driver {
+	case "mssql", "sqlserver":
+		create = fmt.Sprintf("IF OBJECT_ID(N%s, N'U') IS NULL CREATE TABLE %s %s", SQLLiteral(table), table, cols)
+	}
+	return conn.ExecuteInTx(ctx, create)
+}
+
+// loadWatermark returns the watermark stored for item, as the SQL literal
+// to put in the source query, empty when there is none yet
+func loadWatermark(ctx context.Context, conn db.DBInterface, table string, item string) (string, error) {
+	if err := ensureWatermarkTable(ctx, conn, table); err != nil {
+		return "", fmt.Errorf("watermark table: %w", err)
+	}
+	q := func(name string) string { return db.QuoteIdentifier(conn.GetDriverName(), name) }
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", q("value"), table, q("item"), SQLLiteral(item))
+	rows, err := conn.QueryRows(ctx, query)
+	if err != nil {
+		return "", fmt.Errorf("watermark: %w", err)
+	}
+	defer rows.Close()
+	var value *string
+	if rows.Next() {
+		if err := rows.Scan(&value); err != nil {
+			return "", fmt.Errorf("watermark: %w", err)
+		}
+	}
+	if value == nil {
+		return "", rows.Err()
+	}
+	return *value, rows.Err()
+}
+
+// saveWatermark stores the watermark (a SQL literal) of item
+func saveWatermark(ctx context.Context, conn db.DBInterface, table string, item string, literal string) error {
+	q := func(name string) string { return db.QuoteIdentifier(conn.GetDriverName(), name) }
+	return conn.ExecuteInTx(ctx,
+		fmt.Sprintf("DELETE FROM %s WHERE %s = %s", table, q("item"), SQLLiteral(item)),
+		fmt.Sprintf("INSERT INTO %s (%s, %s, %s) VALUES (%s, %s, %s)", table, q("item"), q("value"), q("updated_at"),
+			SQLLiteral(item), SQLLiteral(literal), SQLLiteral(time.Now().Format(time.RFC3339))),
+	)
+}
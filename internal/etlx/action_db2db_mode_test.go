@@ -0,0 +1,208 @@
+package etlxlib
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+func TestDB2DBApplySQL(t *testing.T) {
+	columns := []string{"id", "amount"}
+	tests := []struct {
+		name string
+		load *db2dbLoad
+		want []string
+	}{
+		{"truncate_insert", &db2dbLoad{driver: "postgres", mode: DB2DBTruncateInsert, table: "t", stage: "s"}, []string{
+			`DELETE FROM t`,
+			`INSERT INTO t ("id", "amount") SELECT "id", "amount" FROM s`,
+		}},
+		{"upsert", &db2dbLoad{driver: "postgres", mode: DB2DBUpsert, table: "t", stage: "s", keys: []string{"id"}}, []string{
+			`DELETE FROM t WHERE EXISTS (SELECT 1 FROM s WHERE s."id" = t."id")`,
+			`INSERT INTO t ("id", "amount") SELECT "id", "amount" FROM s`,
+		}},
+		{"merge", &db2dbLoad{driver: "postgres", mode: DB2DBMerge, table: "t", stage: "s", keys: []string{"ID"}}, []string{
+			`UPDATE t SET "amount" = s."amount" FROM s WHERE s."ID" = t."ID"`,
+			`INSERT INTO t ("id", "amount") SELECT "id", "amount" FROM s WHERE NOT EXISTS (SELECT 1 FROM t WHERE t."ID" = s."ID")`,
+		}},
+		{"merge delete_missing", &db2dbLoad{driver: "sqlserver", mode: DB2DBMerge, table: "t", stage: "s", keys: []string{"id"}, deleteMissing: true}, []string{
+			`DELETE FROM t WHERE NOT EXISTS (SELECT 1 FROM s WHERE s.[id] = t.[id])`,
+			`UPDATE t SET [amount] = s.[amount] FROM t INNER JOIN s ON s.[id] = t.[id]`,
+			`INSERT INTO t ([id], [amount]) SELECT [id], [amount] FROM s WHERE NOT EXISTS (SELECT 1 FROM t WHERE t.[id] = s.[id])`,
+		}},
+		{"merge keys only", &db2dbLoad{driver: "duckdb", mode: DB2DBMerge, table: "t", stage: "s", keys: []string{"id", "amount"}}, []string{
+			`INSERT INTO t ("id", "amount") SELECT "id", "amount" FROM s WHERE NOT EXISTS (SELECT 1 FROM t WHERE t."id" = s."id" AND t."amount" = s."amount")`,
+		}},
+	}
+	for _, tt := range tests {
+		if got := tt.load.applySQL(columns); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDB2DBUpdateSQL(t *testing.T) {
+	columns := []string{"amount", "note"}
+	tests := []struct {
+		driver string
+		want   string
+	}{
+		{"postgres", `UPDATE t SET "amount" = s."amount", "note" = s."note" FROM s WHERE s."id" = t."id" AND s."dt" = t."dt"`},
+		{"sqlite3", `UPDATE t SET "amount" = s."amount", "note" = s."note" FROM s WHERE s."id" = t."id" AND s."dt" = t."dt"`},
+		{"duckdb", `UPDATE t SET "amount" = s."amount", "note" = s."note" FROM s WHERE s."id" = t."id" AND s."dt" = t."dt"`},
+		{"sqlserver", `UPDATE t SET [amount] = s.[amount], [note] = s.[note] FROM t INNER JOIN s ON s.[id] = t.[id] AND s.[dt] = t.[dt]`},
+		{"mysql", "UPDATE t INNER JOIN s ON s.`id` = t.`id` AND s.`dt` = t.`dt` SET t.`amount` = s.`amount`, t.`note` = s.`note`"},
+		{"odbc", `UPDATE t SET "amount" = (SELECT s."amount" FROM s WHERE s."id" = t."id" AND s."dt" = t."dt"), "note" = (SELECT s."note" FROM s WHERE s."id" = t."id" AND s."dt" = t."dt") WHERE EXISTS (SELECT 1 FROM s WHERE s."id" = t."id" AND s."dt" = t."dt")`},
+	}
+	for _, tt := range tests {
+		l := &db2dbLoad{driver: tt.driver, mode: DB2DBMerge, table: "t", stage: "s", keys: []string{"id", "dt"}}
+		if got := l.updateSQL(columns); got != tt.want {
+			t.Errorf("updateSQL(%s):\n got %s\nwant %s", tt.driver, got, tt.want)
+		}
+	}
+}
+
+func TestNewDB2DBLoad(t *testing.T) {
+	conn, err := db.NewDuckDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	l, err := newDB2DBLoad(conn, map[string]any{"mode": "Merge", "key_columns": []any{"id", 2}}, "INSERT INTO lake.sales.orders (:columns) VALUES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.mode != DB2DBMerge || l.table != "lake.sales.orders" || l.stage != `"lake"."sales"."etlx_stage_orders"` || !reflect.DeepEqual(l.keys, []string{"id", "2"}) {
+		t.Errorf("newDB2DBLoad = %+v", l)
+	}
+	errs := []struct {
+		target map[string]any
+		want   string
+	}{
+		{map[string]any{"mode": "replace", "table": "t"}, "unknown mode replace"},
+		{map[string]any{"mode": "upsert"}, "needs the target table"},
+		{map[string]any{"mode": "merge", "table": "t"}, "needs key_columns"},
+	}
+	for _, tt := range errs {
+		if _, err := newDB2DBLoad(conn, tt.target, ""); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("newDB2DBLoad(%v) = %v, want an error with %q", tt.target, err, tt.want)
+		}
+	}
+	if l, err := newDB2DBLoad(conn, map[string]any{"mode": "truncate_insert", "table": "t"}, ""); err != nil || l.stage != `"etlx_stage_t"` {
+		t.Errorf("truncate_insert without keys = %+v, %v", l, err)
+	}
+	if err := l.checkColumns([]string{"ID", "amount"}); err == nil || !strings.Contains(err.Error(), "key column 2") {
+		t.Errorf("checkColumns = %v", err)
+	}
+}
+
+func TestDB2DBMergeDuckDB(t *testing.T) {
+	conn, err := db.NewDuckDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	if err := conn.ExecuteInTx(ctx, `CREATE TABLE orders (id INTEGER, amount DECIMAL(10,2))`, `INSERT INTO orders VALUES (1, 10), (2, 20), (3, 30)`); err != nil {
+		t.Fatal(err)
+	}
+	l, err := newDB2DBLoad(conn, map[string]any{"mode": "merge", "table": "orders", "key_columns": "id", "delete_missing": true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.ExecuteInTx(ctx, `INSERT INTO "etlx_stage_orders" VALUES (2, 25), (4, 40)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.apply(ctx, []string{"id", "amount"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.end(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := conn.DB.QueryRow(`SELECT string_agg(id || '=' || amount, ',' ORDER BY id) FROM orders`).Scan(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "2=25.00,4=40.00" {
+		t.Errorf("orders after the merge = %s", got)
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{nil, "NULL"},
+		{42, "42"},
+		{int64(-7), "-7"},
+		{uint8(3), "3"},
+		{1.5, "1.5"},
+		{float32(0.25), "0.25"},
+		{time.Date(2024, 1, 31, 23, 59, 59, 123456000, time.FixedZone("", -3*3600)), "'2024-01-31 23:59:59.123456-03:00'"},
+		{time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), "'2024-01-31 00:00:00+00:00'"},
+		{[]byte("o'k"), "'o''k'"},
+		{"it's", "'it''s'"},
+		{true, "'true'"},
+	}
+	for _, tt := range tests {
+		if got := SQLLiteral(tt.value); got != tt.want {
+			t.Errorf("SQLLiteral(%#v) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestWatermarkAfter(t *testing.T) {
+	jan := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		a    any
+		b    any
+		want bool
+	}{
+		{nil, 1, false},
+		{1, nil, true},
+		{jan.Add(time.Second), jan, true},
+		{jan, jan, false},
+		{10, 9, true},
+		{"10", 9.5, true},
+		{int64(2), "10", false},
+		{"b", "a", true},
+		{"2024-01-31", "2024-02-01", false},
+	}
+	for _, tt := range tests {
+		if got := watermarkAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("watermarkAfter(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestWatermarkStore(t *testing.T) {
+	conn, err := db.NewDuckDB("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	if got, err := loadWatermark(ctx, conn, DefaultWatermarkTable, "ETL.orders"); got != "" || err != nil {
+		t.Fatalf("loadWatermark without one = %q, %v", got, err)
+	}
+	for _, literal := range []string{"'2024-01-31 00:00:00+00:00'", "'2024-02-01 10:00:00+01:00'"} {
+		if err := saveWatermark(ctx, conn, DefaultWatermarkTable, "ETL.orders", literal); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := loadWatermark(ctx, conn, DefaultWatermarkTable, "ETL.orders"); got != literal || err != nil {
+			t.Errorf("loadWatermark = %q, %v, want %q", got, err, literal)
+		}
+	}
+	// KEYED BY ITEM
+	if got, _ := loadWatermark(ctx, conn, DefaultWatermarkTable, "ETL.customers"); got != "" {
+		t.Errorf("loadWatermark of another item = %q", got)
+	}
+}
@@ -0,0 +1,549 @@
+package etlxlib
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAPIMaxRuns is the number of finished runs an APIServer keeps
+const DefaultAPIMaxRuns = 100
+
+// APIRunRequest is the body of POST /runs, the options are the same as the
+// CLI flags / extraConf, md is an inline config used instead of config, only
+// accepted with APIServer.AllowInline
+type APIRunRequest struct {
+	Config string   `json:"config"`
+	MD     string   `json:"md"`
+	Date   string   `json:"date"`
+	Only   []string `json:"only"`
+	Skip   []string `json:"skip"`
+	Steps  []string `json:"steps"`
+	Clean  bool     `json:"clean"`
+	Drop   bool     `json:"drop"`
+	Rows   bool     `json:"rows"`
+	File   string   `json:"file"`
+	// Params are the run params, as the -param of the CLI
+	Params map[string]any `json:"params"`
+}
+
+// APIRun is a run triggered through the API
+type APIRun struct {
+	ID      string           `json:"run_id"`
+	Config  string           `json:"config"`
+	DateRef string           `json:"date_ref"`
+	Status  string           `json:"status"`
+	StartAt time.Time        `json:"start_at"`
+	EndAt   *time.Time       `json:"end_at,omitempty"`
+	Error   string           `json:"error,omitempty"`
+	Logs    []map[string]any `json:"logs"`
+	mu      sync.Mutex
+	subs    map[chan map[string]any]bool
+	done    chan struct{}
+}
+
+// APIServer exposes the runs over HTTP:
+//
+//	POST /runs              trigger a run (APIRunRequest), returns the run
+//	GET  /runs              list the runs
+//	GET  /runs/{id}         status and process logs of a run
+//	GET  /runs/{id}/logs    process logs of a run, ?follow=true streams them (server-sent events)
+//	GET  /graph             mermaid flowchart of a config (?config=)
+//	GET  /metrics           Prometheus metrics of the runs (see RunMetrics)
+//
+// A run executes the SQL, scripts and actions of its config, so the API is
+// meant to be reached by trusted clients only, with a Token when it is not
+// bound to localhost. The runs are kept in memory, up to MaxRuns finished ones,
+// and are cancelled by Shutdown
+type APIServer struct {
+	// Config is the config used when the request does not set one
+	Config string
+	// ConfigDir is the directory the requested configs (and their modules)
+	// must be in, defaults to the working directory
+	ConfigDir string
+	// Token, when set, is required as `Authorization: Bearer <token>` on
+	// every request
+	Token string
+	// AllowInline accepts the inline configs (md) of POST /runs, that can
+	// run anything the process can, off by default
+	AllowInline bool
+	TimeZone    *time.Location
+	State       *RunState
+	// Logger is the Logger of the runs, the one of SetLogger when nil
+	Logger *slog.Logger
+	// Metrics gets the outcome of the runs and is served on /metrics
+	Metrics *RunMetrics
+	// MaxRuns is the number of finished runs kept with their logs, the
+	// oldest are dropped first, DefaultAPIMaxRuns when 0
+	MaxRuns int
+	mu      sync.Mutex
+	runs    map[string]*APIRun
+	order   []string
+	// ctx is the context of the runs, cancelled by Shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewAPIServer creates an API server with a default config file
+func NewAPIServer(config string) *APIServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &APIServer{Config: config, TimeZone: time.Local, Metrics: NewRunMetrics(), runs: map[string]*APIRun{}, ctx: ctx, cancel: cancel}
+}
+
+// Handler returns the http.Handler of the API
+func (s *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /runs", s.handlePostRun)
+	mux.HandleFunc("GET /runs", s.handleListRuns)
+	mux.HandleFunc("GET /runs/{id}", s.handleGetRun)
+	mux.HandleFunc("GET /runs/{id}/logs", s.handleRunLogs)
+	mux.HandleFunc("GET /graph", s.handleGraph)
+	if s.Metrics != nil {
+		mux.Handle("GET /metrics", s.Metrics)
+	}
+	if s.Token == "" {
+		return mux
+	}
+	return s.authorize(mux)
+}
+
+// authorize rejects the requests without the bearer Token
+func (s *APIServer) authorize(next http.Handler) http.Handler {
+	want := []byte("Bearer " + s.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="etlx"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Shutdown cancels the runs in progress and waits for them until ctx is done,
+// the runs triggered after it are refused
+func (s *APIServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.cancel()
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// evict drops the oldest finished runs over MaxRuns
+func (s *APIServer) evict() {
+	maxRuns := s.MaxRuns
+	if maxRuns <= 0 {
+		maxRuns = DefaultAPIMaxRuns
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := 0
+	for _, id := range s.order {
+		if s.runs[id].finished() {
+			finished++
+		}
+	}
+	order := []string{}
+	for _, id := range s.order {
+		if finished > maxRuns && s.runs[id].finished() {
+			delete(s.runs, id)
+			finished--
+			continue
+		}
+		order = append(order, id)
+	}
+	s.order = order
+}
+
+// Wait blocks until the run is done
+func (s *APIServer) Wait(runID string) {
+	s.mu.Lock()
+	run, ok := s.runs[runID]
+	s.mu.Unlock()
+	if ok {
+		<-run.done
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		Logger().Error("writing the API response failed", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]any{"success": false, "msg": err.Error()})
+}
+
+// configDir is the absolute ConfigDir
+func (s *APIServer) configDir() string {
+	dir := s.ConfigDir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	dir, _ = filepath.Abs(dir)
+	return dir
+}
+
+// insideDir tells if path is dir or inside it
+func insideDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// configPath resolves the config of a request, it must be inside ConfigDir
+func (s *APIServer) configPath(config string) (string, error) {
+	if config == "" {
+		config = s.Config
+	}
+	if config == "" {
+		return "", fmt.Errorf("no config given")
+	}
+	dir := s.configDir()
+	path := config
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if !insideDir(dir, path) {
+		return "", fmt.Errorf("config %s is outside of %s", config, dir)
+	}
+	return path, nil
+}
+
+// newETLX parses the config of a request, its modules must be inside ConfigDir
+func (s *APIServer) newETLX(config string, md string) (*ETLX, error) {
+	_etlx := &ETLX{Config: map[string]any{}, Params: map[string]any{}, TimeZone: s.TimeZone, MetadataOrder: true, Logger: s.Logger, Metrics: s.Metrics, modulesDir: s.configDir()}
+	if md != "" {
+		if err := _etlx.ConfigFromMDText(addAutoLoggs(md)); err != nil {
+			return nil, err
+		}
+	} else {
+		path, err := s.configPath(config)
+		if err != nil {
+			return nil, err
+		}
+		if err := _etlx.ConfigFromFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := _etlx.Config["REQUIRES"]; ok {
+		if _, err := _etlx.LoadREQUIRES(nil); err != nil {
+			_etlx.logger("key", "REQUIRES").Error("loading the requirements failed", "err", err)
+		}
+	}
+	return _etlx, nil
+}
+
+func (s *APIServer) handlePostRun(w http.ResponseWriter, r *http.Request) {
+	req := APIRunRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %s", err))
+		return
+	}
+	dateRef := time.Now().AddDate(0, 0, -1)
+	if req.Date != "" {
+		_dt, err := time.Parse("2006-01-02", req.Date)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid date %s, expected YYYY-MM-DD", req.Date))
+			return
+		}
+		dateRef = _dt
+	} else {
+		dateRef, _ = time.Parse("2006-01-02", dateRef.Format("2006-01-02"))
+	}
+	if req.MD != "" && !s.AllowInline {
+		writeError(w, http.StatusForbidden, fmt.Errorf("inline configs (md) are not allowed by the server (-allow-inline), send the config name instead"))
+		return
+	}
+	_etlx, err := s.newETLX(req.Config, req.MD)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	for name, value := range req.Params {
+		_etlx.Params[name] = value
+	}
+	if err := _etlx.ResolveParams(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	extraConf := map[string]any{
+		"clean": req.Clean,
+		"drop":  req.Drop,
+		"rows":  req.Rows,
+		"file":  req.File,
+	}
+	if len(req.Only) > 0 {
+		extraConf["only"] = req.Only
+	}
+	if len(req.Skip) > 0 {
+		extraConf["skip"] = req.Skip
+	}
+	if len(req.Steps) > 0 {
+		extraConf["steps"] = req.Steps
+	}
+	_etlx.RunID = NewRunID()
+	if s.State != nil {
+		state := *s.State
+		_etlx.State = &state
+	}
+	run := &APIRun{
+		ID:      _etlx.RunID,
+		Config:  req.Config,
+		DateRef: dateRef.Format("2006-01-02"),
+		Status:  "running",
+		StartAt: time.Now().In(s.TimeZone),
+		Logs:    []map[string]any{},
+		subs:    map[chan map[string]any]bool{},
+		done:    make(chan struct{}),
+	}
+	if run.Config == "" && req.MD == "" {
+		run.Config = s.Config
+	}
+	_etlx.OnLog = run.publish
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("the server is shutting down"))
+		return
+	}
+	s.runs[run.ID] = run
+	s.order = append(s.order, run.ID)
+	s.wg.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.wg.Done()
+		defer s.evict()
+		defer func() {
+			// A PANIC IN A RUN MUST NOT TAKE THE SERVER DOWN
+			if r := recover(); r != nil {
+				run.finish(nil, nil, fmt.Errorf("run panicked: %v", r), s.TimeZone)
+			}
+		}()
+		logs, data, err := _etlx.RunETLXContext(s.ctx, extraConf, []time.Time{dateRef})
+		run.finish(logs, data, err, s.TimeZone)
+	}()
+	writeJSON(w, http.StatusAccepted, run.snapshot(false))
+}
+
+// publish records a live log entry and sends it to the followers
+func (run *APIRun) publish(_entry map[string]any) {
+	// COPY, THE RUNNER CAN STILL CHANGE THE ENTRY
+	entry := make(map[string]any, len(_entry))
+	for k, v := range _entry {
+		entry[k] = v
+	}
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	run.Logs = append(run.Logs, entry)
+	for ch := range run.subs {
+		select {
+		case ch <- entry:
+		default:
+			// SLOW FOLLOWER, DROP IT INSTEAD OF BLOCKING THE RUN
+			delete(run.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// finish sets the final status and logs of the run
+func (run *APIRun) finish(logs []map[string]any, data map[string]any, err error, tz *time.Location) {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	now := time.Now().In(tz)
+	run.EndAt = &now
+	run.Status = "success"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+	for key, _data := range data {
+		if _data, ok := _data.(map[string]any); ok {
+			if success, _ := _data["success"].(bool); !success {
+				run.Status = "failed"
+				if run.Error == "" {
+					run.Error = fmt.Sprintf("%s failed", key)
+				}
+			}
+		}
+	}
+	if len(logs) > 0 {
+		run.Logs = logs
+	}
+	for ch := range run.subs {
+		close(ch)
+	}
+	run.subs = map[chan map[string]any]bool{}
+	close(run.done)
+}
+
+// finished tells if the run is done
+func (run *APIRun) finished() bool {
+	select {
+	case <-run.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// snapshot copies the run to be encoded
+func (run *APIRun) snapshot(withLogs bool) map[string]any {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	res := map[string]any{
+		"run_id":   run.ID,
+		"config":   run.Config,
+		"date_ref": run.DateRef,
+		"status":   run.Status,
+		"start_at": run.StartAt,
+	}
+	if run.EndAt != nil {
+		res["end_at"] = *run.EndAt
+	}
+	if run.Error != "" {
+		res["error"] = run.Error
+	}
+	if withLogs {
+		res["logs"] = append([]map[string]any{}, run.Logs...)
+	}
+	return res
+}
+
+func (s *APIServer) getRun(w http.ResponseWriter, r *http.Request) (*APIRun, bool) {
+	s.mu.Lock()
+	run, ok := s.runs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", r.PathValue("id")))
+	}
+	return run, ok
+}
+
+func (s *APIServer) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	runs := []*APIRun{}
+	for _, id := range s.order {
+		runs = append(runs, s.runs[id])
+	}
+	s.mu.Unlock()
+	res := []map[string]any{}
+	for _, run := range runs {
+		res = append(res, run.snapshot(false))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *APIServer) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.getRun(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, run.snapshot(true))
+}
+
+func (s *APIServer) handleRunLogs(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.getRun(w, r)
+	if !ok {
+		return
+	}
+	if r.URL.Query().Get("follow") != "true" {
+		run.mu.Lock()
+		logs := append([]map[string]any{}, run.Logs...)
+		run.mu.Unlock()
+		writeJSON(w, http.StatusOK, logs)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+	// THE LOGS SO FAR, THEN THE LIVE ONES UNTIL THE RUN ENDS
+	run.mu.Lock()
+	logs := append([]map[string]any{}, run.Logs...)
+	var ch chan map[string]any
+	select {
+	case <-run.done:
+	default:
+		ch = make(chan map[string]any, 256)
+		run.subs[ch] = true
+	}
+	run.mu.Unlock()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			data, _ = json.Marshal(map[string]any{"msg": err.Error()})
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+	}
+	for _, entry := range logs {
+		send("log", entry)
+	}
+	if ch != nil {
+		for {
+			select {
+			case entry, ok := <-ch:
+				if !ok {
+					ch = nil
+				} else {
+					send("log", entry)
+				}
+			case <-r.Context().Done():
+				run.mu.Lock()
+				if run.subs[ch] {
+					delete(run.subs, ch)
+					close(ch)
+				}
+				run.mu.Unlock()
+				return
+			}
+			if ch == nil {
+				break
+			}
+		}
+	}
+	send("end", run.snapshot(false))
+}
+
+func (s *APIServer) handleGraph(w http.ResponseWriter, r *http.Request) {
+	_etlx, err := s.newETLX(r.URL.Query().Get("config"), "")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	flow, err := _etlx.MermaidFlowchart("")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, flow)
+}
@@ -0,0 +1,290 @@
+package etlxlib
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiMD is a config that runs in an in-memory DuckDB, without the AUTO_LOGS
+const apiMD = "# AUTO_LOGS\n\n" +
+	"```yaml metadata\nname: LOGS\nruns_as: LOGS\ndescription: no logs\nactive: false\n```\n\n" +
+	"# ETL\n\n" +
+	"```yaml metadata\nname: ETL\ndescription: api test\nruns_as: ETL\nconnection: \"duckdb:\"\nactive: true\n```\n\n" +
+	"## hello\n\n" +
+	"```yaml metadata\nname: hello\ndescription: says hello\nload_sql: CREATE TABLE hello AS SELECT '@PARAM.who' AS who\nactive: true\n```\n"
+
+// newTestAPI serves an API on a config dir with pipeline.md
+func newTestAPI(t *testing.T, setup func(api *APIServer)) (*APIServer, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	md := "---\nparams:\n  who:\n    default: world\n---\n\n" + apiMD
+	if err := os.WriteFile(filepath.Join(dir, "pipeline.md"), []byte(md), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	api := NewAPIServer("pipeline.md")
+	api.ConfigDir = dir
+	api.TimeZone = time.UTC
+	if setup != nil {
+		setup(api)
+	}
+	ts := httptest.NewServer(api.Handler())
+	t.Cleanup(ts.Close)
+	return api, ts
+}
+
+// do sends a request with an optional JSON body and bearer token, decoding
+// the JSON response into out when given
+func do(t *testing.T, method string, url string, body string, token string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding the response: %v", method, url, err)
+		}
+	}
+	return res.StatusCode
+}
+
+func TestAPIRun(t *testing.T) {
+	api, ts := newTestAPI(t, nil)
+	run := map[string]any{}
+	status := do(t, "POST", ts.URL+"/runs", `{"date": "2024-01-31", "params": {"who": "api"}}`, "", &run)
+	if status != http.StatusAccepted {
+		t.Fatalf("POST /runs = %d %v", status, run)
+	}
+	id, _ := run["run_id"].(string)
+	if id == "" || run["status"] != "running" || run["config"] != "pipeline.md" {
+		t.Fatalf("POST /runs = %v", run)
+	}
+	api.Wait(id)
+	got := map[string]any{}
+	if status := do(t, "GET", ts.URL+"/runs/"+id, "", "", &got); status != http.StatusOK {
+		t.Fatalf("GET /runs/%s = %d", id, status)
+	}
+	if got["status"] != "success" || got["date_ref"] != "2024-01-31" || got["end_at"] == nil {
+		t.Errorf("GET /runs/%s = %v", id, got)
+	}
+	logs, _ := got["logs"].([]any)
+	found := false
+	for _, entry := range logs {
+		if entry, ok := entry.(map[string]any); ok && entry["key"] == "ETL" && entry["item_key"] == "hello" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no log of ETL -> hello in %v", logs)
+	}
+	list := []map[string]any{}
+	if status := do(t, "GET", ts.URL+"/runs", "", "", &list); status != http.StatusOK || len(list) != 1 || list[0]["run_id"] != id {
+		t.Errorf("GET /runs = %d %v", status, list)
+	}
+	if status := do(t, "GET", ts.URL+"/runs/none", "", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET /runs/none = %d, want 404", status)
+	}
+}
+
+func TestAPIRunRejected(t *testing.T) {
+	_, ts := newTestAPI(t, nil)
+	inline, _ := json.Marshal(map[string]any{"md": apiMD})
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		msg    string
+	}{
+		{"invalid body", `{`, http.StatusBadRequest, "invalid body"},
+		{"invalid date", `{"date": "31/01/2024"}`, http.StatusBadRequest, "invalid date"},
+		{"config outside", `{"config": "../pipeline.md"}`, http.StatusBadRequest, "outside"},
+		{"missing config", `{"config": "none.md"}`, http.StatusBadRequest, "none.md"},
+		{"inline md", string(inline), http.StatusForbidden, "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := map[string]any{}
+			status := do(t, "POST", ts.URL+"/runs", tt.body, "", &res)
+			msg, _ := res["msg"].(string)
+			if status != tt.status || !strings.Contains(msg, tt.msg) {
+				t.Errorf("POST /runs = %d %q, want %d %q", status, msg, tt.status, tt.msg)
+			}
+		})
+	}
+}
+
+func TestAPIInline(t *testing.T) {
+	api, ts := newTestAPI(t, func(api *APIServer) { api.AllowInline = true })
+	body, _ := json.Marshal(map[string]any{"md": apiMD})
+	run := map[string]any{}
+	if status := do(t, "POST", ts.URL+"/runs", string(body), "", &run); status != http.StatusAccepted {
+		t.Fatalf("POST /runs inline = %d %v", status, run)
+	}
+	api.Wait(run["run_id"].(string))
+	// THE MODULES OF AN INLINE CONFIG STAY IN THE CONFIG DIR TOO
+	outside := filepath.Join(t.TempDir(), "module.md")
+	os.WriteFile(outside, []byte(apiMD), 0o644)
+	md := "# MOD\n\n```yaml metadata\nname: MOD\nuses: " + outside + "\n```\n"
+	body, _ = json.Marshal(map[string]any{"md": md})
+	res := map[string]any{}
+	status := do(t, "POST", ts.URL+"/runs", string(body), "", &res)
+	if msg, _ := res["msg"].(string); status != http.StatusBadRequest || !strings.Contains(msg, "outside") {
+		t.Errorf("POST /runs with a module outside = %d %v", status, res)
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	api, ts := newTestAPI(t, func(api *APIServer) { api.Token = "s3cret-token" })
+	for _, token := range []string{"", "wrong"} {
+		res := map[string]any{}
+		if status := do(t, "GET", ts.URL+"/runs", "", token, &res); status != http.StatusUnauthorized {
+			t.Errorf("GET /runs with token %q = %d, want 401", token, status)
+		}
+		if status := do(t, "POST", ts.URL+"/runs", `{}`, token, &res); status != http.StatusUnauthorized {
+			t.Errorf("POST /runs with token %q = %d, want 401", token, status)
+		}
+	}
+	run := map[string]any{}
+	if status := do(t, "POST", ts.URL+"/runs", `{}`, "s3cret-token", &run); status != http.StatusAccepted {
+		t.Fatalf("POST /runs with the token = %d %v", status, run)
+	}
+	api.Wait(run["run_id"].(string))
+	if status := do(t, "GET", ts.URL+"/runs", "", "s3cret-token", &[]any{}); status != http.StatusOK {
+		t.Errorf("GET /runs with the token = %d", status)
+	}
+}
+
+func TestAPILogsFollow(t *testing.T) {
+	_, ts := newTestAPI(t, nil)
+	run := map[string]any{}
+	if status := do(t, "POST", ts.URL+"/runs", `{"date": "2024-01-31"}`, "", &run); status != http.StatusAccepted {
+		t.Fatalf("POST /runs = %d %v", status, run)
+	}
+	res, err := http.Get(ts.URL + "/runs/" + run["run_id"].(string) + "/logs?follow=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	// event: <name>\ndata: <json>\n\n UNTIL THE end EVENT
+	events := map[string]int{}
+	var end map[string]any
+	event := ""
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+			events[event]++
+		case strings.HasPrefix(line, "data: "):
+			data := map[string]any{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+				t.Fatalf("event %s: %v", event, err)
+			}
+			if event == "end" {
+				end = data
+			}
+		}
+	}
+	if events["log"] == 0 {
+		t.Errorf("no log event, got %v", events)
+	}
+	if events["end"] != 1 || end["status"] != "success" {
+		t.Errorf("end event = %v (%v)", end, events)
+	}
+	if status := do(t, "GET", ts.URL+"/runs/none/logs?follow=true", "", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET /runs/none/logs = %d, want 404", status)
+	}
+}
+
+func TestAPIGraph(t *testing.T) {
+	_, ts := newTestAPI(t, nil)
+	res := map[string]any{}
+	if status := do(t, "GET", ts.URL+"/graph?config=../pipeline.md", "", "", &res); status != http.StatusBadRequest {
+		t.Errorf("GET /graph outside = %d %v, want 400", status, res)
+	}
+	r, err := http.Get(ts.URL + "/graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	body := new(strings.Builder)
+	bufio.NewReader(r.Body).WriteTo(body)
+	if r.StatusCode == http.StatusInternalServerError && strings.Contains(body.String(), "extension") {
+		// THE GRAPH IS BUILT WITH THE DUCKDB markdown EXTENSION
+		t.Skipf("the markdown extension is not available: %s", body)
+	}
+	if r.StatusCode != http.StatusOK || !strings.Contains(body.String(), "flowchart") || !strings.Contains(body.String(), "ETL") {
+		t.Errorf("GET /graph = %d %s", r.StatusCode, body)
+	}
+}
+
+func TestAPIMaxRuns(t *testing.T) {
+	api, ts := newTestAPI(t, func(api *APIServer) { api.MaxRuns = 2 })
+	ids := []string{}
+	for range 3 {
+		run := map[string]any{}
+		if status := do(t, "POST", ts.URL+"/runs", `{}`, "", &run); status != http.StatusAccepted {
+			t.Fatalf("POST /runs = %d %v", status, run)
+		}
+		id := run["run_id"].(string)
+		api.Wait(id)
+		ids = append(ids, id)
+	}
+	// THE GOROUTINE OF THE LAST RUN EVICTS AFTER IT IS DONE
+	api.Shutdown(context.Background())
+	list := []map[string]any{}
+	do(t, "GET", ts.URL+"/runs", "", "", &list)
+	if len(list) != 2 || list[0]["run_id"] != ids[1] || list[1]["run_id"] != ids[2] {
+		t.Errorf("GET /runs = %v, want the runs %v", list, ids[1:])
+	}
+	if status := do(t, "GET", ts.URL+"/runs/"+ids[0], "", "", nil); status != http.StatusNotFound {
+		t.Errorf("GET the oldest run = %d, want 404", status)
+	}
+}
+
+func TestAPIShutdown(t *testing.T) {
+	api, ts := newTestAPI(t, nil)
+	slow := strings.Replace(apiMD, "SELECT '@PARAM.who' AS who", "SELECT COUNT(*) AS n FROM range(1000000000000)", 1)
+	os.WriteFile(filepath.Join(api.ConfigDir, "slow.md"), []byte(slow), 0o644)
+	run := map[string]any{}
+	if status := do(t, "POST", ts.URL+"/runs", `{"config": "slow.md"}`, "", &run); status != http.StatusAccepted {
+		t.Fatalf("POST /runs = %d %v", status, run)
+	}
+	time.Sleep(200 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := api.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v, the run was not cancelled", err)
+	}
+	got := map[string]any{}
+	do(t, "GET", ts.URL+"/runs/"+run["run_id"].(string), "", "", &got)
+	if got["status"] != "failed" || !strings.Contains(fmt.Sprint(got["error"]), "cancel") {
+		t.Errorf("cancelled run = %v", got)
+	}
+	res := map[string]any{}
+	if status := do(t, "POST", ts.URL+"/runs", `{}`, "", &res); status != http.StatusServiceUnavailable {
+		t.Errorf("POST /runs after Shutdown = %d %v, want 503", status, res)
+	}
+}
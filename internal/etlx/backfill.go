@@ -0,0 +1,216 @@
+package etlxlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackfillResult is the outcome of RunETLX for one date reference of a backfill
+type BackfillResult struct {
+	DateRef  time.Time
+	StartAt  time.Time
+	Success  bool
+	Sections int
+	Failed   []string
+	Duration time.Duration
+	Logs     []map[string]any
+	Data     map[string]any
+	Err      error
+}
+
+// DateRange returns the date references from `from` to `to` (inclusive) by
+// day, week or month, when `from` is the last day of a month the monthly
+// references are the last day of each month
+func DateRange(from time.Time, to time.Time, granularity string) ([]time.Time, error) {
+	if to.Before(from) {
+		return nil, fmt.Errorf("invalid date range: %s is after %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+	var next func(i int) time.Time
+	switch strings.ToLower(granularity) {
+	case "", "day", "daily", "d":
+		next = func(i int) time.Time { return from.AddDate(0, 0, i) }
+	case "week", "weekly", "w":
+		next = func(i int) time.Time { return from.AddDate(0, 0, 7*i) }
+	case "month", "monthly", "m":
+		endOfMonth := from.AddDate(0, 0, 1).Day() == 1
+		firstOfMonth := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+		next = func(i int) time.Time {
+			if endOfMonth {
+				return firstOfMonth.AddDate(0, i+1, -1)
+			}
+			_dt := firstOfMonth.AddDate(0, i, 0)
+			// CLAMP THE DAY, E.G. JAN 30 -> FEB 28
+			lastDay := _dt.AddDate(0, 1, -1).Day()
+			return _dt.AddDate(0, 0, min(from.Day(), lastDay)-1)
+		}
+	default:
+		return nil, fmt.Errorf("invalid granularity %s, expected day, week or month", granularity)
+	}
+	dates := []time.Time{}
+	for i := 0; ; i++ {
+		_dt := next(i)
+		if _dt.After(to) {
+			break
+		}
+		dates = append(dates, _dt)
+	}
+	return dates, nil
+}
+
+// copyConfigValue deep copies the maps and slices of a parsed config
+func copyConfigValue(v any) any {
+	switch _v := v.(type) {
+	case map[string]any:
+		_copy := make(map[string]any, len(_v))
+		for key, value := range _v {
+			_copy[key] = copyConfigValue(value)
+		}
+		return _copy
+	case []any:
+		_copy := make([]any, len(_v))
+		for i, value := range _v {
+			_copy[i] = copyConfigValue(value)
+		}
+		return _copy
+	case []string:
+		return append([]string{}, _v...)
+	case []map[string]any:
+		_copy := make([]map[string]any, len(_v))
+		for i, value := range _v {
+			_copy[i] = copyConfigValue(value).(map[string]any)
+		}
+		return _copy
+	default:
+		return v
+	}
+}
+
+// Clone returns a copy of the ETLX with its own config, so it can run at the
+// same time as the original, the run state store is shared
+func (etlx *ETLX) Clone() *ETLX {
+	clone := &ETLX{
+		Config:           copyConfigValue(etlx.Config).(map[string]any),
+		Params:           copyConfigValue(etlx.Params).(map[string]any),
+		Models:           etlx.Models,
+		MD:               etlx.MD,
+		autoLogsDisabled: etlx.autoLogsDisabled,
+		MetadataOrder:    etlx.MetadataOrder,
+		TimeZone:         etlx.TimeZone,
+		RunID:            etlx.RunID,
+		DryRun:           etlx.DryRun,
+		OnLog:            etlx.OnLog,
+		Secrets:          etlx.Secrets,
+		Logger:           etlx.Logger,
+		TracerProvider:   etlx.TracerProvider,
+		MeterProvider:    etlx.MeterProvider,
+		Metrics:          etlx.Metrics,
+		Pushgateway:      etlx.Pushgateway,
+		ctx:              etlx.ctx,
+	}
+	if clone.Config == nil {
+		clone.Config = map[string]any{}
+	}
+	if etlx.State != nil {
+		state := *etlx.State
+		clone.State = &state
+	}
+	if etlx.forEach != nil {
+		clone.forEach = map[string]*forEachExpansion{}
+		for node, expansion := range etlx.forEach {
+			clone.forEach[node] = &forEachExpansion{
+				Template: copyConfigValue(expansion.Template).(map[string]any),
+				Index:    expansion.Index,
+				Items:    append([]string(nil), expansion.Items...),
+			}
+		}
+	}
+	return clone
+}
+
+// RunBackfill runs RunETLX for each date reference, with maxParallel > 1 up
+// to maxParallel dates run at the same time, each on its own copy of the config
+func (etlx *ETLX) RunBackfill(extraConf map[string]any, dates []time.Time, maxParallel int) []BackfillResult {
+	results := make([]BackfillResult, len(dates))
+	run := func(_etlx *ETLX, i int) {
+		start := time.Now()
+		logs, data, err := _etlx.RunETLX(extraConf, []time.Time{dates[i]})
+		res := BackfillResult{
+			DateRef:  dates[i],
+			StartAt:  start,
+			Sections: len(data),
+			Failed:   []string{},
+			Duration: time.Since(start),
+			Logs:     logs,
+			Data:     data,
+			Err:      err,
+		}
+		for _, key := range etlx.orderedKeys(data) {
+			if _data, ok := data[key].(map[string]any); ok {
+				if success, _ := _data["success"].(bool); !success {
+					res.Failed = append(res.Failed, key)
+				}
+			}
+		}
+		res.Success = err == nil && len(res.Failed) == 0
+		results[i] = res
+	}
+	if maxParallel <= 1 || len(dates) <= 1 {
+		for i := range dates {
+			run(etlx, i)
+		}
+		return results
+	}
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for i := range dates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			run(etlx.Clone(), i)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// orderedKeys returns the keys of a RunETLX data result in document order
+func (etlx *ETLX) orderedKeys(data map[string]any) []string {
+	keys := []string{}
+	order, _ := etlx.Config["__order"].([]any)
+	for _, key := range order {
+		_key, _ := key.(string)
+		if _, ok := data[_key]; ok {
+			keys = append(keys, _key)
+		}
+	}
+	return keys
+}
+
+// BackfillSummary formats the results of a backfill as a text table
+func BackfillSummary(results []BackfillResult) string {
+	var sb strings.Builder
+	ok, total := 0, time.Duration(0)
+	sb.WriteString(fmt.Sprintf("%-12s %-8s %8s %10s  %s\n", "DATE REF", "STATUS", "SECTIONS", "DURATION", "FAILED"))
+	for _, res := range results {
+		status := "OK"
+		failed := strings.Join(res.Failed, ",")
+		var runErr *RunError
+		if res.Err != nil && !errors.As(res.Err, &runErr) {
+			status = "ERROR"
+			failed = res.Err.Error()
+		} else if !res.Success {
+			status = "FAILED"
+		} else {
+			ok++
+		}
+		total += res.Duration
+		sb.WriteString(fmt.Sprintf("%-12s %-8s %8d %10s  %s\n", res.DateRef.Format("2006-01-02"), status, res.Sections, res.Duration.Round(time.Millisecond), failed))
+	}
+	sb.WriteString(fmt.Sprintf("%d/%d date refs succeeded, %d failed, total %s\n", ok, len(results), len(results)-ok, total.Round(time.Millisecond)))
+	return sb.String()
+}
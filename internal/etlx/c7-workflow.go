@@ -47,7 +47,7 @@ func (etlx *ETLX) ResolveModelStringDataFunc(_data, app map[string]any, key stri
 	var err error
 	for colName, input := range _data {
 		// switch type of _data to string or map
-		switch v := input.(type) {
+		switch input.(type) {
 		case string:
 			matches := fileContentPattern.FindStringSubmatch(strings.TrimSpace(input.(string)))
 			if len(matches) != 2 {
@@ -57,7 +57,7 @@ func (etlx *ETLX) ResolveModelStringDataFunc(_data, app map[string]any, key stri
 				if filename != "" {
 					_data[colName], err = ResolveFileContentSafe(filename, "")
 					if err != nil {
-						fmt.Printf("%s ERR: resolving file content for %s: %s %v", key, filename, err, v)
+						etlx.logger("key", key).Error("resolving the file content failed", "file", filename, "err", err)
 					}
 				}
 			}
@@ -78,7 +78,7 @@ func (etlx *ETLX) ResolveModelStringDataFunc(_data, app map[string]any, key stri
 				if filename != "" {
 					_data[colName], err = FileToBase64(filename)
 					if err != nil {
-						fmt.Printf("%s ERR: resolving file base64 for %s: %s %v", key, filename, err, v)
+						etlx.logger("key", key).Error("resolving the file base64 failed", "file", filename, "err", err)
 					}
 				}
 			}
@@ -104,7 +104,7 @@ func (etlx *ETLX) ResolveModelStringDataFunc(_data, app map[string]any, key stri
 				//fmt.Println(1, spatt, key, value, input)
 				patterm, err := regexp.Compile(spatt)
 				if err != nil {
-					fmt.Println(spatt, "ERR", err)
+					etlx.logger("key", key).Error("invalid pattern", "pattern", spatt, "err", err)
 					continue
 				}
 				matches := patterm.FindStringSubmatch(strings.TrimSpace(input.(string)))
@@ -152,6 +152,10 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "WORKFLOW"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -260,7 +264,7 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 	}
 	defer dbConn.Close()
@@ -288,7 +292,7 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to ADMIN DB %s in : %s", key, adminConn, err)
 	} else {
 		defer adminDb.Close()
@@ -351,10 +355,10 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 		}
 		workflow_id = (*workflow)["workflow_id"]
 	}
-	fmt.Printf("Workflow: %s ID: %v Generated\n", name, workflow_id)
+	etlx.logger("key", key).Info("workflow generated", "workflow", name, "workflow_id", workflow_id)
 	err = etlx.GetModelsFromSchema(adminDb, database, table)
 	if err != nil {
-		fmt.Printf("failed to get models from schema: %s \n", err.Error())
+		etlx.logger("key", key).Error("failed to get the models from the schema", "err", err)
 	}
 	// ITENS CAN BE THE STEP, DEPENDECIES, SLA, ETC
 	for _, itemKey := range order {
@@ -462,12 +466,12 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 			_log2["success"] = false
 			_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 		} else {
 			_log2["success"] = true
 			_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			if table == "workflow_step" {
 				if insert_id == any(nil) || insert_id == 0 {
 					sql := fmt.Sprintf(`SELECT * FROM %s WHERE step = ? AND excluded = false`, dialect.GetTableName(table))
@@ -489,7 +493,7 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 					}
 				}
 				if workflow_step_schema == nil || !ok {
-					fmt.Printf("%s ERR: workflow_step_schema not found for %s", key, insert_id)
+					etlx.logger("key", key).Error("workflow_step_schema not found", "id", insert_id)
 				} else {
 					table = "workflow_step_schema"
 					for order, _field := range workflow_step_schema {
@@ -588,12 +592,12 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 							_log2["success"] = false
 							_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							etlx.formatProcessLogEntry(_log2)
 						} else {
 							_log2["success"] = true
 							_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							etlx.formatProcessLogEntry(_log2)
 						}
 					}
 				}
@@ -609,7 +613,7 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 					}
 				}
 				if workflow_step_responsible == nil || !ok {
-					fmt.Printf("%s ERR: workflow_step_responsible not found for %s", key, insert_id)
+					etlx.logger("key", key).Error("workflow_step_responsible not found", "id", insert_id)
 				} else {
 					table = "workflow_step_responsible"
 					for _, responsible := range workflow_step_responsible {
@@ -675,12 +679,12 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 							_log2["success"] = false
 							_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							etlx.formatProcessLogEntry(_log2)
 						} else {
 							_log2["success"] = true
 							_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							etlx.formatProcessLogEntry(_log2)
 						}
 					}
 				}
@@ -696,7 +700,7 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 					}
 				}
 				if workflow_step_subscriber == nil || !ok {
-					fmt.Printf("%s ERR: workflow_step_subscriber not found for %s", key, insert_id)
+					etlx.logger("key", key).Error("workflow_step_subscriber not found", "id", insert_id)
 				} else {
 					table = "workflow_step_subscriber"
 					for _, subscriber := range workflow_step_subscriber {
@@ -782,12 +786,12 @@ func (etlx *ETLX) RunWORKFLOW(dateRef []time.Time, conf map[string]any, extraCon
 							_log2["success"] = false
 							_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							etlx.formatProcessLogEntry(_log2)
 						} else {
 							_log2["success"] = true
 							_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							etlx.formatProcessLogEntry(_log2)
 						}
 					}
 				}
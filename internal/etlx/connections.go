@@ -0,0 +1,359 @@
+package etlxlib
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// ConnectionDef is a named connection, an item of the CONNECTIONS section or
+// an entry of `connections` in the frontmatter:
+//
+//	---
+//	connections:
+//	  warehouse: "postgres:@PG_DSN"
+//	  lake:
+//	    connection: "duckdb:"
+//	    before_sql: "ATTACH 'ducklake:@LAKE_CATALOG' AS lake"
+//	---
+type ConnectionDef struct {
+	Name       string
+	Connection string
+	// BeforeSQL runs once, when the connection is opened
+	BeforeSQL any
+	// AfterSQL runs once, before the connection is closed at the end of the run
+	AfterSQL     any
+	MaxOpenConns int
+	MaxIdleConns int
+	// item is the section item, where the query names of before_sql / after_sql are looked up
+	item map[string]any
+}
+
+// connectionDefFrom reads a named connection from its metadata (or the bare
+// connection string of the frontmatter)
+func connectionDefFrom(name string, value any, item map[string]any) (ConnectionDef, error) {
+	def := ConnectionDef{Name: name, item: item}
+	switch v := value.(type) {
+	case string:
+		def.Connection = v
+	case map[string]any:
+		if _name, ok := v["name"].(string); ok && _name != "" {
+			def.Name = _name
+		}
+		def.Connection, _ = v["connection"].(string)
+		def.BeforeSQL = v["before_sql"]
+		def.AfterSQL = v["after_sql"]
+		for key, target := range map[string]*int{"max_open_conns": &def.MaxOpenConns, "max_idle_conns": &def.MaxIdleConns} {
+			if n, ok := v[key]; ok {
+				if _, err := fmt.Sscanf(fmt.Sprintf("%v", n), "%d", target); err != nil {
+					return def, fmt.Errorf("connection %s: %s must be an int, got %v", def.Name, key, n)
+				}
+			}
+		}
+		if item == nil {
+			def.item = map[string]any{"metadata": v}
+		}
+	default:
+		return def, fmt.Errorf("connection %s must be a connection string or a map, got %T", name, value)
+	}
+	if def.Connection == "" {
+		return def, fmt.Errorf("connection %s: missing connection", def.Name)
+	}
+	return def, nil
+}
+
+// ConnectionDefs returns the named connections of the config, the
+// CONNECTIONS section (any key with runs_as: CONNECTIONS) first and then the
+// frontmatter ones
+func (etlx *ETLX) ConnectionDefs() (map[string]ConnectionDef, error) {
+	defs := map[string]ConnectionDef{}
+	for key, value := range etlx.Config {
+		data, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		metadata, ok := data["metadata"].(map[string]any)
+		if !ok {
+			continue
+		}
+		runsAs, ok := metadata["runs_as"].(string)
+		if !ok {
+			runsAs = key
+		}
+		if strings.ToUpper(runsAs) != "CONNECTIONS" {
+			continue
+		}
+		if active, ok := metadata["active"].(bool); ok && !active {
+			continue
+		}
+		for _, itemKey := range mdKeyItems(data) {
+			item, _ := data[itemKey].(map[string]any)
+			itemMetadata, ok := item["metadata"].(map[string]any)
+			if !ok {
+				continue
+			}
+			if active, ok := itemMetadata["active"].(bool); ok && !active {
+				continue
+			}
+			def, err := connectionDefFrom(itemKey, itemMetadata, item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			defs[def.Name] = def
+		}
+	}
+	frontmatter, _ := etlx.Config["__frontmatter"].(map[string]any)
+	if conns, ok := frontmatter["connections"].(map[string]any); ok {
+		for name, value := range conns {
+			if _, exists := defs[name]; exists {
+				continue
+			}
+			def, err := connectionDefFrom(name, value, nil)
+			if err != nil {
+				return nil, fmt.Errorf("frontmatter: %w", err)
+			}
+			defs[def.Name] = def
+		}
+	}
+	return defs, nil
+}
+
+// namedConnection returns the named connection conn refers to, connection
+// strings (driver:dsn) are never names
+func (etlx *ETLX) namedConnection(conn string) (ConnectionDef, bool, error) {
+	name := strings.TrimSpace(conn)
+	if name == "" || strings.Contains(name, ":") || etlx.Config == nil {
+		return ConnectionDef{}, false, nil
+	}
+	defs, err := etlx.ConnectionDefs()
+	if err != nil {
+		return ConnectionDef{}, false, err
+	}
+	def, ok := defs[name]
+	return def, ok, nil
+}
+
+// itemConnection is the connection of an item, its own `connection` or the
+// one of its key
+func itemConnection(itemMetadata map[string]any, mainConn string) string {
+	if conn, _ := itemMetadata["connection"].(string); conn != "" {
+		return conn
+	}
+	return mainConn
+}
+
+var (
+	// sessionSQLRe are the statements that only change the session they run on
+	sessionSQLRe = regexp.MustCompile(`(?i)^(ATTACH|DETACH|USE|SET|RESET)\b`)
+	// stepSetupRe are the before / after queries of the ETL steps
+	stepSetupRe = regexp.MustCompile(`^(extract|transform|load)_(before_sql|before|start|startup|setup|after_sql|after|end|cleanup)$`)
+)
+
+// validateSessionSQL rejects the session statements (ATTACH, USE, SET ...) in
+// the before / after queries of an item on a named connection: the handle is
+// shared by all the items of the run, so they would run on any connection of
+// the pool and clash with the other items, they go in the before_sql /
+// after_sql of the connection instead
+func (etlx *ETLX) validateSessionSQL(metadata map[string]any, item map[string]any, key string, itemKey string) []ValidationError {
+	itemMetadata, _ := item["metadata"].(map[string]any)
+	mainConn, _ := metadata["connection"].(string)
+	errs := []ValidationError{}
+	for _, field := range slices.Sorted(maps.Keys(itemMetadata)) {
+		conn := itemConnection(itemMetadata, mainConn)
+		switch {
+		case field == "before_sql" || field == "after_sql":
+		case stepSetupRe.MatchString(field):
+			step, _, _ := strings.Cut(field, "_")
+			if _conn, _ := itemMetadata[step+"_conn"].(string); _conn != "" {
+				conn = _conn
+			}
+		default:
+			continue
+		}
+		def, ok, _ := etlx.namedConnection(conn)
+		if !ok {
+			continue
+		}
+		for _, stmt := range sessionStatements(itemMetadata[field], item) {
+			errs = append(errs, ValidationError{Level: "error", Key: key, Item: itemKey, Field: field, Msg: fmt.Sprintf("session statement %q on the shared named connection %s, put it in the before_sql / after_sql of the connection", stmt, def.Name)})
+		}
+	}
+	return errs
+}
+
+// sessionStatements returns the session statements of before / after queries,
+// the names of the queries of the item are resolved
+func sessionStatements(sqls any, item map[string]any) []string {
+	queries := []string{}
+	switch v := sqls.(type) {
+	case string:
+		queries = append(queries, v)
+	case []any:
+		for _, q := range v {
+			if s, ok := q.(string); ok {
+				queries = append(queries, s)
+			}
+		}
+	}
+	found := []string{}
+	for _, query := range queries {
+		if s, ok := item[query].(string); ok {
+			query = s
+		}
+		for _, stmt := range strings.Split(query, ";") {
+			lines := []string{}
+			for _, line := range strings.Split(stmt, "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "--") {
+					lines = append(lines, line)
+				}
+			}
+			if stmt = strings.Join(lines, " "); sessionSQLRe.MatchString(stmt) {
+				found = append(found, stmt)
+			}
+		}
+	}
+	return found
+}
+
+// connRegistry keeps the named connections of a run open, each one is opened
+// (and its before_sql run) the first time it is asked for and closed at the
+// end of the run
+type connRegistry struct {
+	mu      sync.Mutex
+	conns   map[string]*sharedConn
+	dateRef []time.Time
+}
+
+// sharedConn is an open named connection, refs counts the handles given out
+// and not closed yet
+type sharedConn struct {
+	db.DBInterface
+	def  ConnectionDef
+	refs int
+}
+
+// connHandle is what GetDB returns for a named connection, Close gives it
+// back to the registry instead of closing it
+type connHandle struct {
+	db.DBInterface
+	once    sync.Once
+	release func()
+}
+
+func (h *connHandle) Close() error {
+	h.once.Do(h.release)
+	return nil
+}
+
+func newConnRegistry(dateRef []time.Time) *connRegistry {
+	return &connRegistry{conns: map[string]*sharedConn{}, dateRef: dateRef}
+}
+
+// openNamedDB opens a named connection, applying its pool options and running its before_sql
+func (etlx *ETLX) openNamedDB(def ConnectionDef, dateRef []time.Time) (db.DBInterface, error) {
+	if _, isName, _ := etlx.namedConnection(def.Connection); isName {
+		return nil, fmt.Errorf("connection %s: %s is another named connection", def.Name, def.Connection)
+	}
+	dbConn, err := etlx.GetDB(def.Connection)
+	if err != nil {
+		return nil, err
+	}
+	if def.MaxOpenConns > 0 {
+		if pool, ok := dbConn.(interface{ SetMaxOpenConns(int) }); ok {
+			pool.SetMaxOpenConns(def.MaxOpenConns)
+		}
+	}
+	if def.MaxIdleConns > 0 {
+		if pool, ok := dbConn.(interface{ SetMaxIdleConns(int) }); ok {
+			pool.SetMaxIdleConns(def.MaxIdleConns)
+		}
+	}
+	if def.BeforeSQL != nil {
+		err = etlx.ExecuteQueryContext(etlx.Context(), dbConn, def.BeforeSQL, def.item, "", "", dateRef)
+		if err != nil {
+			dbConn.Close()
+			return nil, fmt.Errorf("connection %s before_sql: %w", def.Name, err)
+		}
+	}
+	return dbConn, nil
+}
+
+// closeNamedDB runs the after_sql of a named connection and closes it
+func (etlx *ETLX) closeNamedDB(def ConnectionDef, dbConn db.DBInterface, dateRef []time.Time) error {
+	var err error
+	if def.AfterSQL != nil {
+		ctx, cancel := etlx.cleanupContext()
+		err = etlx.ExecuteQueryContext(ctx, dbConn, def.AfterSQL, def.item, "", "", dateRef)
+		cancel()
+		if err != nil {
+			err = fmt.Errorf("connection %s after_sql: %w", def.Name, err)
+		}
+	}
+	if _err := dbConn.Close(); _err != nil && err == nil {
+		err = fmt.Errorf("connection %s close: %w", def.Name, _err)
+	}
+	return err
+}
+
+// get returns a handle on the named connection, opening it on first use
+func (r *connRegistry) get(etlx *ETLX, def ConnectionDef) (db.DBInterface, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	conn, ok := r.conns[def.Name]
+	if !ok {
+		dbConn, err := etlx.openNamedDB(def, r.dateRef)
+		if err != nil {
+			return nil, err
+		}
+		conn = &sharedConn{DBInterface: dbConn, def: def}
+		r.conns[def.Name] = conn
+	}
+	conn.refs++
+	return &connHandle{DBInterface: conn.DBInterface, release: func() {
+		r.mu.Lock()
+		conn.refs--
+		r.mu.Unlock()
+	}}, nil
+}
+
+// close closes every connection of the registry, the handles still not
+// closed (refs > 0) are reported
+func (r *connRegistry) close(etlx *ETLX) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	errs := []string{}
+	for name, conn := range r.conns {
+		if conn.refs > 0 {
+			errs = append(errs, fmt.Sprintf("connection %s closed with %d handles still in use", name, conn.refs))
+		}
+		if err := etlx.closeNamedDB(conn.def, conn.DBInterface, r.dateRef); err != nil {
+			errs = append(errs, err.Error())
+		}
+		delete(r.conns, name)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// getNamedDB is GetDB for a named connection: shared through the registry
+// during a run, opened just for the caller otherwise
+func (etlx *ETLX) getNamedDB(def ConnectionDef) (db.DBInterface, error) {
+	if etlx.conns != nil {
+		return etlx.conns.get(etlx, def)
+	}
+	dbConn, err := etlx.openNamedDB(def, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &connHandle{DBInterface: dbConn, release: func() {
+		etlx.closeNamedDB(def, dbConn, nil)
+	}}, nil
+}
@@ -0,0 +1,59 @@
+package etlxlib
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// CleanupTimeout bounds the after_sql queries that still run once the run
+// was cancelled or the item timed out
+var CleanupTimeout = 2 * time.Minute
+
+// Context is the context the queries of the run are bound to
+func (etlx *ETLX) Context() context.Context {
+	if etlx.ctx == nil {
+		return context.Background()
+	}
+	return etlx.ctx
+}
+
+// SetContext binds the queries of the next runs to ctx, for when the runners
+// are called directly instead of through RunETLXContext
+func (etlx *ETLX) SetContext(ctx context.Context) {
+	etlx.ctx = ctx
+}
+
+// RunETLXContext is RunETLX cancelled with ctx: the running queries are
+// cancelled, the keys and items not started yet are not run and the
+// after_sql of the items already started still runs
+func (etlx *ETLX) RunETLXContext(ctx context.Context, extraConf map[string]any, dateRef []time.Time) ([]map[string]any, map[string]any, error) {
+	parentCtx := etlx.ctx
+	etlx.ctx = ctx
+	defer func() { etlx.ctx = parentCtx }()
+	return etlx.RunETLX(extraConf, dateRef)
+}
+
+// cleanupContext is the run context without its cancellation, so the cleanup
+// queries are not cancelled with the run
+func (etlx *ETLX) cleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(etlx.Context()), CleanupTimeout)
+}
+
+// ExecuteCleanup is ExecuteQuery for the after_sql queries, they run even
+// when the run was cancelled
+func (etlx *ETLX) ExecuteCleanup(conn db.DBInterface, sqlData any, item map[string]any, fname string, step string, dateRef []time.Time) error {
+	ctx, cancel := etlx.cleanupContext()
+	defer cancel()
+	return etlx.ExecuteQueryContext(ctx, conn, sqlData, item, fname, step, dateRef)
+}
+
+// cancelled returns the error to stop with when the run was cancelled
+func (etlx *ETLX) cancelled() error {
+	if err := etlx.Context().Err(); err != nil {
+		return fmt.Errorf("run cancelled: %w", err)
+	}
+	return nil
+}
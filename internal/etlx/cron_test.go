@@ -0,0 +1,87 @@
+package etlxlib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"0 3 * * *", " */15 8-18 * * MON-FRI ", "0 0 1,15 jan-mar *", "0 0 * * 7", "5-55/10 * * * *", "@Daily", "@hourly", "@annually"} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q): %v", expr, err)
+		}
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "expected 5 fields, got 0"},
+		{"* * * *", "expected 5 fields, got 4"},
+		{"@every 5m", "expected 5 fields"},
+		{"60 * * * *", "minute value out of range"},
+		{"* 24 * * *", "hour value out of range"},
+		{"* * 0 * *", "day of month value out of range"},
+		{"* * * 13 *", "month value out of range"},
+		{"* * * FOO *", "month invalid value"},
+		{"* * * * 8", "day of week value out of range"},
+		{"*/0 * * * *", "minute invalid step"},
+		{"5-1 * * * *", "minute value out of range"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseCron(tt.expr); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseCron(%q) = %v, want an error with %q", tt.expr, err, tt.want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	// 2024-01-01 IS A MONDAY
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"0 3 * * *", "2024-01-01 10:00:00", "2024-01-02 03:00:00"},
+		{"0 * * * *", "2024-01-01 10:00:00", "2024-01-01 11:00:00"},
+		{"0 * * * *", "2024-01-01 10:00:30", "2024-01-01 11:00:00"},
+		{"*/15 8-18 * * MON-FRI", "2024-01-05 18:50:00", "2024-01-08 08:00:00"},
+		{"*/15 8-18 * * MON-FRI", "2024-01-08 08:01:00", "2024-01-08 08:15:00"},
+		{"@monthly", "2024-01-15 00:00:00", "2024-02-01 00:00:00"},
+		{"@weekly", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"0 0 * * 7", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		{"30 2 29 2 *", "2024-03-01 00:00:00", "2028-02-29 02:30:00"},
+		{"0 0 31 * *", "2024-04-01 00:00:00", "2024-05-31 00:00:00"},
+		// ONLY THE DAY OF MONTH OR ONLY THE DAY OF WEEK RESTRICTED
+		{"0 0 13 * *", "2024-01-01 00:00:00", "2024-01-13 00:00:00"},
+		{"0 0 * * FRI", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+		// BOTH RESTRICTED, EITHER ONE MATCHING
+		{"0 0 13 * FRI", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+		{"0 0 13 * FRI", "2024-01-10 00:00:00", "2024-01-12 00:00:00"},
+		{"0 0 13 * FRI", "2024-02-10 00:00:00", "2024-02-13 00:00:00"},
+		// A STEP FROM * IS NOT A RESTRICTION, BOTH MUST MATCH
+		{"0 0 */2 * FRI", "2024-01-01 00:00:00", "2024-01-05 00:00:00"},
+		{"0 0 */2 * FRI", "2024-01-06 00:00:00", "2024-01-19 00:00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.Next(at(tt.from)); !got.Equal(at(tt.want)) {
+			t.Errorf("Next(%q, %s) = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+	// NO MATCH IN THE NEXT 5 YEARS
+	c, _ := ParseCron("0 0 30 2 *")
+	if got := c.Next(at("2024-01-01 00:00:00")); !got.IsZero() {
+		t.Errorf("Next(0 0 30 2 *) = %s, want zero", got)
+	}
+}
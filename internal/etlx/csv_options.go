@@ -0,0 +1,140 @@
+package etlxlib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// CSVOptions reads the csv_options of an item metadata, how the extract of a
+// to_csv item (or a to_csv export) writes its CSV:
+//
+//	csv_options:
+//	  delimiter: ";"
+//	  quote: '"'
+//	  escape: '\'
+//	  header: true
+//	  null: NULL
+//	  date_format: YYYY-MM-DD
+//	  datetime_format: YYYY-MM-DD HH:mm:SS
+//	  decimal_format: "%.2f"
+//	  decimal_separator: ","
+//	  encoding: windows-1252
+//	  source_encoding: iso-8859-1
+//	  compression: gzip
+//	  max_rows: 1000000
+//	  max_size: 100MB
+func (etlx *ETLX) CSVOptions(options any) (db.CSVOptions, error) {
+	opts := db.CSVOptions{}
+	m, ok := options.(map[string]any)
+	if !ok {
+		if options != nil {
+			return opts, fmt.Errorf("csv_options must be a map, got %T", options)
+		}
+		return opts, nil
+	}
+	char := func(key string) (rune, error) {
+		s, ok := m[key].(string)
+		if !ok || s == "" {
+			return 0, nil
+		}
+		switch strings.ToLower(s) {
+		case "tab", `\t`:
+			return '\t', nil
+		}
+		if utf8.RuneCountInString(s) != 1 {
+			return 0, fmt.Errorf("csv_options %s must be a single character, got %q", key, s)
+		}
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, nil
+	}
+	str := func(key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+	var err error
+	if opts.Delimiter, err = char("delimiter"); err != nil {
+		return opts, err
+	}
+	if opts.Quote, err = char("quote"); err != nil {
+		return opts, err
+	}
+	if opts.Escape, err = char("escape"); err != nil {
+		return opts, err
+	}
+	if header, ok := m["header"].(bool); ok {
+		opts.NoHeader = !header
+	}
+	if null, ok := m["null"]; ok && null != nil {
+		opts.Null = fmt.Sprintf("%v", null)
+	}
+	if f := str("date_format"); f != "" {
+		opts.DateFormat = etlx.GetGODateFormat(f)
+	}
+	if f := str("datetime_format"); f != "" {
+		opts.DatetimeFormat = etlx.GetGODateFormat(f)
+	}
+	opts.DecimalFormat = str("decimal_format")
+	opts.DecimalSeparator = str("decimal_separator")
+	opts.Encoding = str("encoding")
+	opts.SourceEncoding = str("source_encoding")
+	opts.Compression = str("compression")
+	if v, ok := m["max_rows"]; ok {
+		if opts.MaxRows, err = strconv.ParseInt(fmt.Sprintf("%v", v), 10, 64); err != nil {
+			return opts, fmt.Errorf("csv_options max_rows: %w", err)
+		}
+	}
+	if v, ok := m["max_size"]; ok {
+		if opts.MaxBytes, err = parseByteSize(fmt.Sprintf("%v", v)); err != nil {
+			return opts, fmt.Errorf("csv_options max_size: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// parseByteSize parses sizes like 1048576, 512KB, 100MB or 1GB (1024 based)
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		size   int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1}}
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(n * float64(u.size)), nil
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// csvFileName is the name the CSV of an item is written to (and read from
+// by the next steps) once its csv_options are applied
+func (etlx *ETLX) csvFileName(fname string, metadata map[string]any) string {
+	if _, ok := metadata["csv_options"]; !ok {
+		return fname
+	}
+	opts, err := etlx.CSVOptions(metadata["csv_options"])
+	if err != nil {
+		return fname
+	}
+	return db.CSVFileName(fname, opts)
+}
+
+// query2CSV writes the results of query into fname with the csv_options of
+// the item
+func (etlx *ETLX) query2CSV(ctx context.Context, conn db.DBInterface, query string, fname string, metadata map[string]any) error {
+	opts, err := etlx.CSVOptions(metadata["csv_options"])
+	if err != nil {
+		return err
+	}
+	_, err = conn.Query2CSVOptions(ctx, query, fname, opts)
+	return err
+}
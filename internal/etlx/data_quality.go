@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/realdatadriven/etlx/internal/db"
+	"github.com/realdatadriven/etlx/internal/secrets"
 )
 
 func (etlx *ETLX) ExecuteQueryWithRowsAffected(conn db.DBInterface, sqlData any, item map[string]any, fname string, step string, dateRef []time.Time) (int64, error) {
@@ -30,7 +31,7 @@ func (etlx *ETLX) ExecuteQueryWithRowsAffected(conn db.DBInterface, sqlData any,
 			query = queries
 			_sql, _, _, err := etlx.QueryBuilder(nil, queries)
 			if err != nil {
-				fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", queries, err)
+				etlx.itemLogger(item).Warn("QUERY_DOC failed", "query", queries, "err", err)
 				_q, _e := etlx.Config[queries].(string)
 				//fmt.Println(queries, "IS A LOADED SQL STR QUERY?", _q, _e)
 				if _e {
@@ -44,22 +45,25 @@ func (etlx *ETLX) ExecuteQueryWithRowsAffected(conn db.DBInterface, sqlData any,
 		}
 		updatedSQL, err := etlx.ReplacePlaceholders(query, item)
 		if err != nil {
-			fmt.Println("Error trying to get the placeholder:", err)
+			etlx.itemLogger(item).Warn("replacing the [[query]] placeholders failed", "err", err)
 		} else {
 			query = updatedSQL
 		}
 		query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
 		if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-			_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s.*.sql", queries))
+			_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s.*.sql", queries))
 			if err != nil {
-				fmt.Println(err)
+				etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 			}
-			fmt.Println(_file)
+			etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 		}
+		start := time.Now()
 		rowsAffected, err := conn.ExecuteQueryRowsAffected(query)
 		if err != nil {
+			etlx.traceQuery(etlx.Context(), conn, item, queries, step, start, -1, err)
 			return 0, err
 		}
+		etlx.traceQuery(etlx.Context(), conn, item, queries, step, start, rowsAffected, nil)
 		return rowsAffected, nil
 	default:
 		return 0, fmt.Errorf("invalid SQL data type: %T", sqlData)
@@ -84,7 +88,7 @@ func (etlx *ETLX) DataQualityCheck(dbConn db.DBInterface, query any, item map[st
 		_log2["nrows"] = 0
 		return _log2
 	}
-	fmt.Println("DataQualityCheck", sql, column, *rows)
+	etlx.itemLogger(item).Debug("data quality check", "sql", sql, "column", column, "rows", len(*rows))
 	if len(*rows) > 0 {
 		okConf := false
 		if column != nil && okColumn {
@@ -130,6 +134,10 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "DATA_QUALITY"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -167,10 +175,11 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 		mainDescription = metadata["description"].(string)
 		itemMetadata, ok := item["metadata"].(map[string]any)
 		if !ok {
+			description, _ := itemMetadata["description"].(string)
 			processLogs = append(processLogs, map[string]any{
 				"process":     process,
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"].(string),
+				"description": description,
 				"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
 				"end_at":  time.Now().In(etlx.TimeZone),
 				"success": true,
@@ -178,6 +187,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 			})
 			return nil
 		}
+		retry := etlx.RetryPolicy(&processLogs, process, key, itemKey, metadata, itemMetadata)
 		// ACTIVE
 		if active, okActive := itemMetadata["active"]; okActive {
 			if !active.(bool) {
@@ -197,7 +207,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 		if only, okOnly := extraConf["only"]; okOnly {
 			//fmt.Println("ONLY", only, len(only.([]string)))
 			if len(only.([]string)) == 0 {
-			} else if !etlx.Contains(only.([]string), itemKey) {
+			} else if !etlx.matchesItem(only.([]string), itemKey, itemMetadata) {
 				processLogs = append(processLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
@@ -213,7 +223,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 		if skip, okSkip := extraConf["skip"]; okSkip {
 			//fmt.Println("SKIP", skip, len(skip.([]string)))
 			if len(skip.([]string)) == 0 {
-			} else if etlx.Contains(skip.([]string), itemKey) {
+			} else if etlx.matchesItem(skip.([]string), itemKey, itemMetadata) {
 				processLogs = append(processLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
@@ -268,11 +278,8 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 			"num_gc_start":          num_gc,
 		}
 		if okQuery && query != "" {
-			conn, okCon := itemMetadata["connection"]
-			if !okCon {
-				conn = mainConn
-			}
-			dbConn, err := etlx.GetDB(conn.(string))
+			conn := itemConnection(itemMetadata, mainConn)
+			dbConn, err := retry.GetDB(conn)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 			if err != nil {
 				_log2["success"] = false
@@ -284,7 +291,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 				return nil
 			}
 			defer dbConn.Close()
@@ -297,7 +304,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			//  QUERIES TO RUN AT BEGINING
 			if okBefore {
 				start3 := time.Now().In(etlx.TimeZone)
@@ -313,7 +320,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 					"mem_sys_start":         mem_sys,
 					"num_gc_start":          num_gc,
 				}
-				err = etlx.ExecuteQuery(dbConn, beforeSQL, item, "", "", dateRef)
+				err = retry.ExecuteQuery(dbConn, beforeSQL, item, "", "", dateRef)
 				mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 				if err != nil {
 					_log2["success"] = false
@@ -331,7 +338,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 			// CHECK CONDITION
 			condition, okCondition := itemMetadata["condition"].(string)
@@ -350,7 +357,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 					failedCondition = true
 				} else if !cond {
 					_log2["success"] = false
@@ -365,7 +372,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 						_log2["msg"] = fmt.Sprintf("%s -> %s COND: failed %s", key, itemKey, etlx.SetQueryPlaceholders(condMsg, "", "", dateRef))
 					}
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 					failedCondition = true
 				}
 			}
@@ -397,7 +404,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			} else if okFixOnly && fixOnly && okFix && !checkOnly && !failedCondition {
 				//fmt.Println("FIXES ONLY!")
 				res := etlx.DataQualityFix(dbConn, fixQuery, item, dateRef)
@@ -419,7 +426,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			} else if !failedCondition {
 				//fmt.Println("BOTH CHECK AND FIXES!")
 				res := etlx.DataQualityCheck(dbConn, query, item, dateRef)
@@ -459,7 +466,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 			//fmt.Println(_log2)
 			// QUERIES TO RUN AT THE END
@@ -477,7 +484,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 					"mem_sys_start":         mem_sys,
 					"num_gc_start":          num_gc,
 				}
-				err = etlx.ExecuteQuery(dbConn, afterSQL, item, "", "", dateRef)
+				err = retry.ExecuteCleanup(dbConn, afterSQL, item, "", "", dateRef)
 				mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 				if err != nil {
 					_log2["success"] = false
@@ -495,7 +502,7 @@ func (etlx *ETLX) RunDATA_QUALITY(dateRef []time.Time, conf map[string]any, extr
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 		}
 		return nil
@@ -2,10 +2,12 @@ package etlxlib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -13,11 +15,14 @@ import (
 
 	"github.com/BurntSushi/toml"
 	goyaml "github.com/goccy/go-yaml"
+	"github.com/realdatadriven/etlx/internal/secrets"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	goldmarkparser "github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/text"
 	"go.abhg.dev/goldmark/frontmatter" // ← important import
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/yaml.v3"
 )
 
@@ -30,6 +35,42 @@ type ETLX struct {
 	MetadataOrder    bool
 	TimeZone         *time.Location
 	RemoteSkiped     bool
+	RunID            string
+	State            *RunState
+	dag              *dagRun
+	// DryRun makes GetDB fail instead of connecting, used by the plan mode
+	DryRun bool
+	// OnLog is called with every process log entry as it happens
+	OnLog func(entry map[string]any)
+	// ctx cancels the queries of the run, see RunETLXContext
+	ctx context.Context
+	// conns are the named connections opened during the run, see RunETLX
+	conns *connRegistry
+	// Secrets resolves the @VAR / $VAR references, from the `secrets` of the
+	// frontmatter, secrets.Default() when nil
+	Secrets *secrets.Resolver
+	// Logger gets the logs of the run, with the run_id, key and item attrs,
+	// the one of SetLogger when nil
+	Logger *slog.Logger
+	// TracerProvider / MeterProvider get the spans and the metrics of the
+	// runs, the OTLP export of the `telemetry` of the frontmatter or the otel
+	// globals when nil
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+	// Metrics gets the outcome of every run, e.g. to serve them on /metrics
+	Metrics *RunMetrics
+	// Pushgateway is the URL the metrics of the run are pushed to when
+	// RunETLX returns, the `prometheus` of the frontmatter when empty
+	Pushgateway string
+	// tel traces the running RunETLX
+	tel *telemetry
+	// hook is the section whose on_success / on_failure hook is running
+	hook *hookScope
+	// forEach are the items with a for_each, by KEY.item
+	forEach map[string]*forEachExpansion
+	// modulesDir is the directory the `uses` modules must be in, any when
+	// empty, the relative ones of a config text are from it
+	modulesDir string
 }
 
 func addAutoLoggs(md string) string {
@@ -116,7 +157,15 @@ func (etlx *ETLX) ConfigFromFile(filePath string) error {
 	etlx.MD = string(data)
 	// Parse the Markdown content into an AST
 	reader := text.NewReader(data)
-	return etlx.ParseMarkdownToConfig(reader, string(data))
+	if err := etlx.ParseMarkdownToConfig(reader, string(data)); err != nil {
+		return err
+	}
+	// THE uses MODULES ARE RELATIVE TO THE CONFIG
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	return etlx.useModules(filepath.Dir(filePath), []string{abs})
 }
 
 func (etlx *ETLX) ConfigFromIpynbJSON(ipynbJSON string) error {
@@ -127,14 +176,28 @@ func (etlx *ETLX) ConfigFromIpynbJSON(ipynbJSON string) error {
 	}
 	etlx.MD = mdText
 	reader := text.NewReader([]byte(addAutoLoggs(mdText)))
-	return etlx.ParseMarkdownToConfig(reader, mdText)
+	if err := etlx.ParseMarkdownToConfig(reader, mdText); err != nil {
+		return err
+	}
+	return etlx.useModules(etlx.textModulesDir(), nil)
+}
+
+// textModulesDir is the directory of the modules of a config given as text
+func (etlx *ETLX) textModulesDir() string {
+	if etlx.modulesDir != "" {
+		return etlx.modulesDir
+	}
+	return "."
 }
 
 func (etlx *ETLX) ConfigFromMDText(mdText string) error {
 	// Parse the Markdown content into an AST
 	etlx.MD = mdText
 	reader := text.NewReader([]byte(mdText))
-	return etlx.ParseMarkdownToConfig(reader, mdText)
+	if err := etlx.ParseMarkdownToConfig(reader, mdText); err != nil {
+		return err
+	}
+	return etlx.useModules(etlx.textModulesDir(), nil)
 }
 
 // TracebackHeaders traces headers from the current node up to the top-level header.
@@ -182,7 +245,7 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 	ctx := goldmarkparser.NewContext()
 	var buf bytes.Buffer
 	if err := md.Convert([]byte(content), &buf, goldmarkparser.WithContext(ctx)); err != nil {
-		fmt.Println("Error converting the md with frontmatter:", err)
+		etlx.logger().Error("converting the md with frontmatter", "err", err)
 	}
 	var meta map[string]any
 	// Extract frontmatter as map[string]any
@@ -190,7 +253,7 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 	if data == nil {
 		// fmt.Println("No frontmatter found")
 	} else if err := data.Decode(&meta); err != nil {
-		fmt.Println("Error decoding frontmatter:", err)
+		etlx.logger().Error("decoding the frontmatter", "err", err)
 	}
 	// fmt.Println("FRONTMATTER:", meta)
 	config["__frontmatter"] = meta
@@ -246,7 +309,10 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 				}
 			case *ast.FencedCodeBlock:
 				// Extract info and content from the code block nedd to check if is a valid codblcock first
-				info := string(n.Info.Segment.Value(reader.Source()))
+				info := ""
+				if n.Info != nil {
+					info = string(n.Info.Segment.Value(reader.Source()))
+				}
 				//content := string(n.Text(reader.Source()))
 				var content bytes.Buffer
 				lines := n.Lines()
@@ -281,16 +347,18 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 							// Parse YAML
 							// err = yaml.Unmarshal([]byte(contentFinal), &metaData)
 							var doc goyaml.MapSlice
-							err := goyaml.UnmarshalWithOptions(
+							err = goyaml.UnmarshalWithOptions(
 								[]byte(contentFinal),
 								&doc,
 								goyaml.UseOrderedMap(),
 							)
-							if err != nil {
-								log.Fatal(err)
+							if err == nil {
+								// Convert recursively
+								metaData, _ = ConvertToOrderedMap(doc).(map[string]any)
+								if metaData == nil {
+									metaData = make(map[string]any)
+								}
 							}
-							// Convert recursively
-							metaData = ConvertToOrderedMap(doc).(map[string]any)
 						} else if strings.HasPrefix(info, "yaml") {
 							// Parse YAML
 							err = yaml.Unmarshal([]byte(contentFinal), &metaData)
@@ -341,7 +409,7 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 							// fmt.Println("NOT A NAMED QUERY, FIND -- name instead", key, contentFinal)
 						}
 						if key == "" {
-							fmt.Printf("missing query name for SQL block: %s", content.String())
+							etlx.logger().Warn("missing query name for SQL block, ignored", "block", content.String())
 						} else {
 							current[key] = contentFinal
 							/*/ Add to the current section's __order
@@ -354,77 +422,77 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 						key := strings.TrimSpace(strings.TrimPrefix(info, "html"))
 						//fmt.Println("HTML:", key, content.String())
 						if key == "" {
-							fmt.Printf("missing name for HTML block: %s", content.String())
+							etlx.logger().Warn("missing name for HTML block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "python") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "python"))
 						if key == "" {
-							fmt.Printf("missing query name for python block: %s", content.String())
+							etlx.logger().Warn("missing query name for python block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "py") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "py"))
 						if key == "" {
-							fmt.Printf("missing query name for python block: %s", content.String())
+							etlx.logger().Warn("missing query name for python block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "env") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "env"))
 						if key == "" {
-							fmt.Printf("missing query name for env block: %s", content.String())
+							etlx.logger().Warn("missing query name for env block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "dotenv") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "dotenv"))
 						if key == "" {
-							fmt.Printf("missing query name for dotenv block: %s", content.String())
+							etlx.logger().Warn("missing query name for dotenv block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "tf") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "tf"))
 						if key == "" {
-							fmt.Printf("missing query name for tf block: %s", content.String())
+							etlx.logger().Warn("missing query name for tf block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "latex") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "latex"))
 						if key == "" {
-							fmt.Printf("missing query name for latex block: %s", content.String())
+							etlx.logger().Warn("missing query name for latex block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "tex") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "tex"))
 						if key == "" {
-							fmt.Printf("missing query name for tex block: %s", content.String())
+							etlx.logger().Warn("missing query name for tex block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "txt") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "txt"))
 						if key == "" {
-							fmt.Printf("missing query name for txt block: %s", content.String())
+							etlx.logger().Warn("missing query name for txt block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "md") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "md"))
 						if key == "" {
-							fmt.Printf("missing query name for md block: %s", content.String())
+							etlx.logger().Warn("missing query name for md block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
 					} else if strings.HasPrefix(info, "markdown") {
 						key := strings.TrimSpace(strings.TrimPrefix(info, "markdown"))
 						if key == "" {
-							fmt.Printf("missing query name for markdown block: %s", content.String())
+							etlx.logger().Warn("missing query name for markdown block, ignored", "block", content.String())
 						} else {
 							current[key] = content.String()
 						}
@@ -450,6 +518,12 @@ func (etlx *ETLX) ParseMarkdownToConfig(reader text.Reader, content string) erro
 		return fmt.Errorf("err converting from json: %s", err)
 	}
 	etlx.Config = config
+	if frontmatter, ok := config["__frontmatter"].(map[string]any); ok && frontmatter["secrets"] != nil {
+		etlx.Secrets, err = secrets.FromConfig(frontmatter["secrets"])
+		if err != nil {
+			return err
+		}
+	}
 	//etlx.MD = content
 	//fmt.Println("MD CONTENT:", etlx.MD)
 	return nil
@@ -479,13 +553,14 @@ func (etlx *ETLX) PrintConfigAsJSON(config map[string]any) {
 	if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
 		jsonData, err := json.MarshalIndent(config, "", "  ")
 		if err != nil {
-			log.Fatalf("Error converting config to JSON: %v", err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
+			return
 		}
-		_file, err := etlx.TempFIle("", string(jsonData), "config.*.json")
+		_file, err := etlx.TempFIle("", secrets.Mask(string(jsonData)), "config.*.json")
 		if err != nil {
-			fmt.Println(err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 		}
-		fmt.Println(_file)
+		etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 		//fmt.Println(string(jsonData))
 	}
 }
@@ -563,7 +638,7 @@ func (etlx *ETLX) GetRefFromString(file string) time.Time {
 			dt, err := time.Parse(patt.fmrt, matchStr)
 			if err != nil {
 				// Handle parse error
-				fmt.Println("Error parsing date:", err)
+				etlx.logger().Debug("parsing the file date", "file", file, "err", err)
 				break
 			}
 			if patt.fmrt == "200601" || patt.fmrt == "0601" {
@@ -629,6 +704,8 @@ func (etlx *ETLX) RuntimeMemStats() (float64, float64, float64, uint32) {
 
 // setQueryDate formats the query string by inserting the given date reference in place of placeholders
 func (etlx *ETLX) ReplaceQueryStringDate(query string, dateRef any) string {
+	// PARAMS FIRST, A {...} IN THEM IS ALSO RESOLVED
+	query = etlx.ReplaceParams(query)
 	patt := regexp.MustCompile(`(["]?\w+["]?\.\w+\s?=\s?'\{.*?\}'|["]?\w+["]?\s?=\s?'\{.*?\}')`)
 	matches := patt.FindAllString(query, -1)
 	if len(matches) == 0 {
@@ -757,7 +834,7 @@ func (etlx *ETLX) ReplaceEnvVariableRec(input string, i int) string {
 	if len(matches) > 0 {
 		for _, match := range matches {
 			envVar := strings.TrimPrefix(match, "@ENV.")
-			envValue := os.Getenv(envVar)
+			envValue := etlx.secretResolver().Getenv(envVar)
 			// fmt.Println(match, envVar, envValue)
 			if envValue != "" {
 				input = strings.ReplaceAll(input, match, envValue)
@@ -776,7 +853,7 @@ func (etlx *ETLX) ReplaceEnvVariableRec(input string, i int) string {
 		if len(matches) > 0 {
 			for _, match := range matches {
 				envVar := strings.TrimPrefix(match, "@.")
-				envValue := os.Getenv(envVar)
+				envValue := etlx.secretResolver().Getenv(envVar)
 				// fmt.Println(match, envVar, envValue)
 				if envValue != "" {
 					input = strings.ReplaceAll(input, match, envValue)
@@ -795,7 +872,7 @@ func (etlx *ETLX) ReplaceEnvVariableRec(input string, i int) string {
 			if len(matches) > 0 {
 				for _, match := range matches {
 					envVar := strings.TrimPrefix(match, "@")
-					envValue := os.Getenv(envVar)
+					envValue := etlx.secretResolver().Getenv(envVar)
 					// fmt.Println(match, envVar, envValue)
 					if envValue != "" {
 						input = strings.ReplaceAll(input, match, envValue)
@@ -831,25 +908,25 @@ func (etlx *ETLX) ProcessETL(config map[string]any, runner RunnerFunc) error {
 	}
 	mainConn := metadata["connection"].(string)
 	description := metadata["description"].(string)
-	fmt.Printf("Starting ETL process: %s\n", description)
+	etlx.logger().Info("starting ETL process", "description", description)
 	start := time.Now().In(etlx.TimeZone)
 	for key, value := range etl {
 		if key == "metadata" {
 			continue
 		}
-		fmt.Printf("Processing key: %s\n", key)
+		etlx.logger("key", key).Info("processing")
 		item, ok := value.(map[string]any)
 		if !ok {
-			log.Printf("Skipping invalid item: %s\n", key)
+			etlx.logger("key", key).Warn("invalid item, skipped")
 			continue
 		}
 		err := etlx.ProcessETLSteps(key, item, mainConn, runner)
 		if err != nil {
-			log.Printf("Error processing %s: %v\n", key, err)
+			etlx.logger("key", key).Error("processing failed", "err", err)
 			continue
 		}
 	}
-	fmt.Printf("ETL process completed: %s (Duration: %v)\n", description, time.Since(start).Seconds())
+	etlx.logger().Info("ETL process completed", "description", description, "duration", time.Since(start))
 	return nil
 }
 
@@ -949,6 +1026,14 @@ func (etlx *ETLX) ProcessMDKey(key string, config map[string]any, runner RunnerF
 	// fmt.Printf("Starting %s process: %s\n", key, description)
 	// start := time.Now().In(etlx.TimeZone)
 	order, okOrder := data["__order"].([]any)
+	if dagOrder := etlx.dag.itemOrder(key); dagOrder != nil {
+		// ITEMS IN DEPENDENCY ORDER
+		order = []any{}
+		for _, itemKey := range dagOrder {
+			order = append(order, itemKey)
+		}
+		okOrder = true
+	}
 	if okOrder {
 		for _, key2 := range order {
 			if key2 == "metadata" || key2 == "__order" || key2 == "__frontmatter" || key2 == "order" {
@@ -958,7 +1043,15 @@ func (etlx *ETLX) ProcessMDKey(key string, config map[string]any, runner RunnerF
 				// fmt.Println(key2, "NOT A MAP:", value)
 				continue
 			}
+			if etlx.skipItem(key, key2.(string)) {
+				continue
+			}
+			if err := etlx.cancelled(); err != nil {
+				return err
+			}
+			endItem := etlx.traceItem(key, key2.(string), data[key2.(string)].(map[string]any))
 			err := runner(metadata, key2.(string), data[key2.(string)].(map[string]any))
+			endItem(err)
 			if err != nil {
 				return err
 			}
@@ -972,7 +1065,12 @@ func (etlx *ETLX) ProcessMDKey(key string, config map[string]any, runner RunnerF
 				// fmt.Println(key2, "NOT A MAP:", value)
 				continue
 			}
+			if err := etlx.cancelled(); err != nil {
+				return err
+			}
+			endItem := etlx.traceItem(key, key2, value.(map[string]any))
 			err := runner(metadata, key2, value.(map[string]any))
+			endItem(err)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,100 @@
+package etlxlib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// extract file formats, what the extract / export query of an item is
+// written to instead of being executed
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+	FormatArrow   = "arrow"
+)
+
+// extractFormat is the file format the item metadata asks the query results
+// to be written to, empty when the query is just executed
+func (etlx *ETLX) extractFormat(conn db.DBInterface, metadata map[string]any) string {
+	flag := func(key string) bool {
+		ok, _ := metadata[key].(bool)
+		return ok
+	}
+	switch {
+	case flag("to_parquet"):
+		return FormatParquet
+	case flag("to_arrow"):
+		return FormatArrow
+	case flag("to_csv"), flag("odbc_to_csv") && conn != nil && conn.GetDriverName() == "odbc":
+		return FormatCSV
+	}
+	return ""
+}
+
+// ArrowOptions reads the parquet_options / arrow_options of an item metadata:
+//
+//	parquet_options:
+//	  compression: zstd
+//	  row_group_size: 122880
+//
+//	arrow_options:
+//	  compression: lz4
+//	  batch_size: 65536
+func (etlx *ETLX) ArrowOptions(options any) (db.ArrowOptions, error) {
+	opts := db.ArrowOptions{}
+	m, ok := options.(map[string]any)
+	if !ok {
+		if options != nil {
+			return opts, fmt.Errorf("options must be a map, got %T", options)
+		}
+		return opts, nil
+	}
+	opts.Compression, _ = m["compression"].(string)
+	for _, key := range []string{"row_group_size", "batch_size"} {
+		if v, ok := m[key]; ok {
+			n, err := strconv.Atoi(fmt.Sprintf("%v", v))
+			if err != nil {
+				return opts, fmt.Errorf("%s: %w", key, err)
+			}
+			opts.BatchSize = n
+		}
+	}
+	return opts, nil
+}
+
+// extractFileName is the name the extract of an item is written to (and
+// read from by the next steps): the .csv of the default name becomes
+// .parquet / .arrow, or the csv_options are applied
+func (etlx *ETLX) extractFileName(fname string, metadata map[string]any) string {
+	format := etlx.extractFormat(nil, metadata)
+	switch format {
+	case FormatParquet, FormatArrow:
+		if strings.HasSuffix(strings.ToLower(fname), ".csv") {
+			return fname[:len(fname)-len(".csv")] + "." + format
+		}
+		return fname
+	}
+	return etlx.csvFileName(fname, metadata)
+}
+
+// query2File writes the results of query into fname in the format of the item
+func (etlx *ETLX) query2File(ctx context.Context, conn db.DBInterface, format string, query string, fname string, metadata map[string]any) error {
+	switch format {
+	case FormatParquet, FormatArrow:
+		opts, err := etlx.ArrowOptions(metadata[format+"_options"])
+		if err != nil {
+			return fmt.Errorf("%s_options %w", format, err)
+		}
+		if format == FormatParquet {
+			_, err = conn.Query2Parquet(ctx, query, fname, opts)
+		} else {
+			_, err = conn.Query2Arrow(ctx, query, fname, opts)
+		}
+		return err
+	}
+	return etlx.query2CSV(ctx, conn, query, fname, metadata)
+}
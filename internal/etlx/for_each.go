@@ -0,0 +1,428 @@
+package etlxlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// forEachExpansion is an item with a for_each, kept so it is expanded again
+// on the next run
+type forEachExpansion struct {
+	Template map[string]any
+	// Index is its position in the __order of the key
+	Index int
+	// Items are the items it was expanded into by the last run
+	Items []string
+}
+
+var (
+	forEachPlaceholderRe = regexp.MustCompile(`\{\{\s*\.item(?:\.(\w+))?\s*\}\}`)
+	forEachParamRe       = regexp.MustCompile(`^@PARAM\.(\w+)$`)
+	forEachLabelRe       = regexp.MustCompile(`\W+`)
+)
+
+// forEachSource reads the for_each of an item: a list (or a list param as
+// @PARAM.name) or a query, as a string or as {sql, connection}, the sql can
+// be the name of a query of the item
+func (etlx *ETLX) forEachSource(item map[string]any) ([]any, string, string, error) {
+	metadata, _ := item["metadata"].(map[string]any)
+	query, conn := "", ""
+	switch v := metadata["for_each"].(type) {
+	case []any:
+		return v, "", "", nil
+	case string:
+		if match := forEachParamRe.FindStringSubmatch(strings.TrimSpace(v)); match != nil {
+			param, ok := etlx.Params[match[1]]
+			if !ok {
+				return nil, "", "", fmt.Errorf("for_each: param %s not set", match[1])
+			}
+			list, err := ParamSpec{Type: "list"}.Coerce(param)
+			if err != nil {
+				return nil, "", "", fmt.Errorf("for_each: param %s: %w", match[1], err)
+			}
+			return list.([]any), "", "", nil
+		}
+		query = v
+	case map[string]any:
+		query, _ = v["sql"].(string)
+		if query == "" {
+			query, _ = v["query"].(string)
+		}
+		conn, _ = v["connection"].(string)
+	default:
+		return nil, "", "", fmt.Errorf("for_each must be a list or a query, got %s", typeName(v))
+	}
+	if strings.TrimSpace(query) == "" {
+		return nil, "", "", fmt.Errorf("for_each: missing the query")
+	}
+	if _query, ok := item[query].(string); ok {
+		query = _query
+	}
+	return nil, query, conn, nil
+}
+
+// forEachRows are the rows an item is expanded for, the values of a list
+// that are not maps are rows with a single value field
+func (etlx *ETLX) forEachRows(key string, itemKey string, item map[string]any, dateRef []time.Time) ([]map[string]any, error) {
+	list, query, conn, err := etlx.forEachSource(item)
+	if err != nil {
+		return nil, err
+	}
+	rows := []map[string]any{}
+	if query == "" {
+		for _, v := range list {
+			row, ok := v.(map[string]any)
+			if !ok {
+				row = map[string]any{"value": v}
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	if conn == "" {
+		metadata, _ := item["metadata"].(map[string]any)
+		conn, _ = metadata["connection"].(string)
+		if strings.Contains(conn, "{{") {
+			conn = ""
+		}
+	}
+	if conn == "" {
+		conn, _ = etlx.keyMetadata(key)["connection"].(string)
+	}
+	if conn == "" {
+		conn = "duckdb:"
+	}
+	dbConn, err := etlx.GetDB(conn)
+	if err != nil {
+		return nil, fmt.Errorf("for_each: %w", err)
+	}
+	defer dbConn.Close()
+	// CANCELLED WITH THE RUN AND BOUND BY THE timeout OF THE ITEM
+	metadata, _ := item["metadata"].(map[string]any)
+	retry := etlx.RetryPolicy(nil, "", key, itemKey, etlx.keyMetadata(key), metadata)
+	ctx, cancel := retry.Context()
+	defer cancel()
+	_rows, _, err := dbConn.QueryMultiRowsContext(ctx, etlx.SetQueryPlaceholders(query, "", "", dateRef), []any{}...)
+	if err != nil {
+		if retry.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("for_each: timeout of %s exceeded: %w", retry.Timeout, err)
+		}
+		return nil, fmt.Errorf("for_each: %w", err)
+	}
+	return append(rows, *_rows...), nil
+}
+
+// forEachLabel names a row in the name of its item: its name field, its only
+// field or its position
+func forEachLabel(row map[string]any, i int) string {
+	v, ok := row["name"]
+	if !ok && len(row) == 1 {
+		for _, _v := range row {
+			v, ok = _v, true
+		}
+	}
+	label := ""
+	if ok && v != nil {
+		label = strings.Trim(forEachLabelRe.ReplaceAllString(formatParam(v), "_"), "_")
+	}
+	if label == "" {
+		label = fmt.Sprintf("%d", i+1)
+	}
+	return label
+}
+
+// forEachReplace replaces the {{.item.field}} / {{.item}} placeholders in
+// every string of the value, the unknown fields are left as they are
+func forEachReplace(v any, row map[string]any, label string) any {
+	switch _v := v.(type) {
+	case string:
+		if !strings.Contains(_v, "{{") {
+			return _v
+		}
+		return forEachPlaceholderRe.ReplaceAllStringFunc(_v, func(match string) string {
+			field := forEachPlaceholderRe.FindStringSubmatch(match)[1]
+			if field == "" {
+				if value, ok := row["value"]; ok && len(row) == 1 {
+					return formatParam(value)
+				}
+				return label
+			}
+			value, ok := row[field]
+			if !ok || value == nil {
+				return match
+			}
+			return formatParam(value)
+		})
+	case map[string]any:
+		for k, value := range _v {
+			_v[k] = forEachReplace(value, row, label)
+		}
+	case []any:
+		for i, value := range _v {
+			_v[i] = forEachReplace(value, row, label)
+		}
+	}
+	return v
+}
+
+// forEachItems builds the items an item is expanded into, named <item>_<label>
+// or by the name of their metadata when it has placeholders
+func (etlx *ETLX) forEachItems(conf map[string]any, itemKey string, item map[string]any, rows []map[string]any) ([]string, map[string]map[string]any) {
+	names := []string{}
+	items := map[string]map[string]any{}
+	templateName, _ := item["metadata"].(map[string]any)["name"].(string)
+	for i, row := range rows {
+		label := forEachLabel(row, i)
+		_item := forEachReplace(copyConfigValue(item), row, label).(map[string]any)
+		metadata := _item["metadata"].(map[string]any)
+		delete(metadata, "for_each")
+		metadata["_for_each_of"] = itemKey
+		name := itemKey + "_" + label
+		if _name, ok := metadata["name"].(string); ok && _name != "" && _name != templateName {
+			name = _name
+		}
+		if _, exists := items[name]; exists || (conf[name] != nil && name != itemKey) {
+			name = fmt.Sprintf("%s_%d", name, i+1)
+		}
+		names = append(names, name)
+		items[name] = _item
+	}
+	return names, items
+}
+
+// expandForEach replaces the items of the key with a for_each by the items
+// they expand into, right before the key runs, and returns a log entry per
+// expansion. In a dry run the ones over a query are left as they are
+func (etlx *ETLX) expandForEach(key string, dateRef []time.Time) []map[string]any {
+	conf, ok := etlx.Config[key].(map[string]any)
+	if !ok {
+		return nil
+	}
+	runsAs, _ := etlx.keyMetadata(key)["runs_as"].(string)
+	logs := []map[string]any{}
+	for _, itemKey := range mdKeyItems(conf) {
+		item := conf[itemKey].(map[string]any)
+		metadata, _ := item["metadata"].(map[string]any)
+		if metadata["for_each"] == nil {
+			continue
+		}
+		if _, query, _, _ := etlx.forEachSource(item); query != "" && etlx.DryRun {
+			continue
+		}
+		start := time.Now().In(etlx.TimeZone)
+		description, ok := metadata["description"].(string)
+		if !ok {
+			description = itemKey
+		}
+		_log := map[string]any{
+			"process":     runsAs,
+			"name":        fmt.Sprintf("%s->%s", key, itemKey),
+			"description": description,
+			"key":         key, "item_key": itemKey, "start_at": start,
+		}
+		if etlx.forEach == nil {
+			etlx.forEach = map[string]*forEachExpansion{}
+		}
+		expansion := &forEachExpansion{Template: copyConfigValue(item).(map[string]any)}
+		etlx.forEach[key+"."+itemKey] = expansion
+		// THE ITEM ITSELF NEVER RUNS, ONLY THE ONES IT EXPANDS INTO
+		delete(conf, itemKey)
+		rows, err := etlx.forEachRows(key, itemKey, item, dateRef)
+		if err != nil {
+			expansion.Index = replaceInOrder(conf, itemKey, nil)
+			_log["success"] = false
+			_log["msg"] = err.Error()
+		} else {
+			names, items := etlx.forEachItems(conf, itemKey, item, rows)
+			for name, _item := range items {
+				conf[name] = _item
+			}
+			expansion.Index = replaceInOrder(conf, itemKey, names)
+			expansion.Items = names
+			etlx.dag.expandItem(key, itemKey, names)
+			_log["success"] = true
+			_log["msg"] = fmt.Sprintf("for_each: expanded into %d items %s", len(names), strings.Join(names, ", "))
+		}
+		_log["end_at"] = time.Now().In(etlx.TimeZone)
+		_log["duration"] = time.Since(start).Seconds()
+		logs = append(logs, _log)
+	}
+	return logs
+}
+
+// restoreForEach puts back the items with a for_each in place of the ones
+// they expanded into, so each run expands them again
+func (etlx *ETLX) restoreForEach() {
+	for node, expansion := range etlx.forEach {
+		key := nodeKey(node)
+		itemKey := strings.TrimPrefix(node, key+".")
+		conf, ok := etlx.Config[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, ok := conf[itemKey].(map[string]any); ok {
+			continue
+		}
+		for _, name := range expansion.Items {
+			delete(conf, name)
+		}
+		conf[itemKey] = copyConfigValue(expansion.Template)
+		if order, ok := conf["__order"].([]any); ok {
+			_order := []any{}
+			for _, k := range order {
+				if name, _ := k.(string); !etlx.Contains(expansion.Items, name) {
+					_order = append(_order, k)
+				}
+			}
+			index := min(expansion.Index, len(_order))
+			conf["__order"] = append(_order[:index], append([]any{itemKey}, _order[index:]...)...)
+		}
+		expansion.Items = nil
+	}
+}
+
+// replaceInOrder replaces the item in the __order of the key by names and
+// returns its position
+func replaceInOrder(conf map[string]any, itemKey string, names []string) int {
+	order, ok := conf["__order"].([]any)
+	if !ok {
+		return 0
+	}
+	index := len(order)
+	_order := []any{}
+	for i, k := range order {
+		if k != itemKey {
+			_order = append(_order, k)
+			continue
+		}
+		index = min(index, i)
+		for _, name := range names {
+			_order = append(_order, name)
+		}
+	}
+	conf["__order"] = _order
+	return index
+}
+
+// forEachNames are the items an item expands into: the ones of the last run
+// or, for a list, the ones it is going to
+func (etlx *ETLX) forEachNames(key string, itemKey string) []string {
+	if expansion, ok := etlx.forEach[key+"."+itemKey]; ok && expansion.Items != nil {
+		return expansion.Items
+	}
+	conf, _ := etlx.Config[key].(map[string]any)
+	item, ok := conf[itemKey].(map[string]any)
+	if !ok {
+		return nil
+	}
+	metadata, _ := item["metadata"].(map[string]any)
+	if metadata["for_each"] == nil {
+		return nil
+	}
+	if _, query, _, err := etlx.forEachSource(item); err != nil || query != "" {
+		return nil
+	}
+	rows, err := etlx.forEachRows(key, itemKey, item, nil)
+	if err != nil {
+		return nil
+	}
+	names, _ := etlx.forEachItems(conf, itemKey, item, rows)
+	return names
+}
+
+// forEachGraph replaces the graph nodes of the items with a for_each by the
+// ones they expand into, with the edges of the item
+func (etlx *ETLX) forEachGraph(nodes []map[string]any, edges []map[string]any) ([]map[string]any, []map[string]any) {
+	expanded := map[string][]string{}
+	_nodes := []map[string]any{}
+	for _, node := range nodes {
+		key, _ := getString_(node, "parent_title")
+		itemKey, _ := getString_(node, "title")
+		names := etlx.forEachNames(key, itemKey)
+		if len(names) == 0 {
+			_nodes = append(_nodes, node)
+			continue
+		}
+		id := fmt.Sprintf("%v_%v", node["parent_id"], node["section_id"])
+		for i, name := range names {
+			_node := make(map[string]any, len(node))
+			for k, v := range node {
+				_node[k] = v
+			}
+			_node["section_id"] = fmt.Sprintf("%v_%d", node["section_id"], i+1)
+			_node["title"] = name
+			_node["name"] = name
+			_nodes = append(_nodes, _node)
+			expanded[id] = append(expanded[id], _node["section_id"].(string))
+		}
+	}
+	if len(expanded) == 0 {
+		return nodes, edges
+	}
+	_edges := []map[string]any{}
+	for _, edge := range edges {
+		to := []any{edge["section_id"]}
+		if ids, ok := expanded[fmt.Sprintf("%v_%v", edge["parent_id"], edge["section_id"])]; ok {
+			to = []any{}
+			for _, id := range ids {
+				to = append(to, id)
+			}
+		}
+		from := []any{edge["depends_on_section_id"]}
+		if ids, ok := expanded[fmt.Sprintf("%v_%v", edge["depends_on_parent_id"], edge["depends_on_section_id"])]; ok {
+			from = []any{}
+			for _, id := range ids {
+				from = append(from, id)
+			}
+		}
+		for _, t := range to {
+			for _, f := range from {
+				_edge := make(map[string]any, len(edge))
+				for k, v := range edge {
+					_edge[k] = v
+				}
+				_edge["section_id"], _edge["depends_on_section_id"] = t, f
+				_edges = append(_edges, _edge)
+			}
+		}
+	}
+	return _nodes, _edges
+}
+
+// matchesItem tells if an -only / -skip list names the item or the item
+// with a for_each it was expanded from
+func (etlx *ETLX) matchesItem(list []string, itemKey string, itemMetadata map[string]any) bool {
+	if etlx.Contains(list, itemKey) {
+		return true
+	}
+	of, ok := itemMetadata["_for_each_of"].(string)
+	return ok && etlx.Contains(list, of)
+}
+
+// validateForEach checks the for_each of the items of a key
+func (etlx *ETLX) validateForEach(key string) []ValidationError {
+	errs := []ValidationError{}
+	conf, ok := etlx.Config[key].(map[string]any)
+	if !ok {
+		return errs
+	}
+	for _, itemKey := range mdKeyItems(conf) {
+		item := conf[itemKey].(map[string]any)
+		metadata, _ := item["metadata"].(map[string]any)
+		if metadata["for_each"] == nil {
+			continue
+		}
+		// THE PARAMS ARE ONLY KNOWN WHEN THE CONFIG RUNS
+		if ref, ok := metadata["for_each"].(string); ok && forEachParamRe.MatchString(strings.TrimSpace(ref)) {
+			continue
+		}
+		if _, _, _, err := etlx.forEachSource(item); err != nil {
+			errs = append(errs, ValidationError{Level: "error", Key: key, Item: itemKey, Field: "for_each", Msg: err.Error()})
+		}
+	}
+	return errs
+}
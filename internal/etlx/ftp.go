@@ -126,7 +126,7 @@ func (etlx *ETLX) FTPDownloadBatch(host, port, user, pass, remoteDir, pattern, l
 		if matched {
 			remotePath := path.Join(remoteDir, entry.Name)
 			localPath := filepath.Join(localDir, entry.Name)
-			fmt.Printf("Downloading: %s → %s\n", remotePath, localPath)
+			etlx.logger().Debug("ftp download", "remote", remotePath, "local", localPath)
 			// Download each matching file using the single-file method
 			err := etlx.FTPDownload(host, port, user, pass, remotePath, localPath)
 			if err != nil {
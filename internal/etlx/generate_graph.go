@@ -359,3 +359,35 @@ ORDER BY N.row ASC;`
 		"edges_est":        *edges_est,
 	}, nil
 }
+
+// MermaidFlowchart generates the mermaid flowchart of the md config (etlx.MD
+// when md is empty), falling back to the estimated nodes and edges
+func (etlx *ETLX) MermaidFlowchart(md string) (string, error) {
+	mdData, err := etlx.QueryETLXMD(md)
+	if err != nil {
+		return "", err
+	}
+	nodes, ok := mdData["nodes"]
+	if !ok {
+		return "", fmt.Errorf("no nodes data found")
+	}
+	edges, ok := mdData["edges"]
+	if !ok {
+		return "", fmt.Errorf("no edges data found")
+	}
+	if len(nodes) == 0 {
+		nodes, ok = mdData["nodes_est"]
+		if !ok {
+			return "", fmt.Errorf("no nodes data found")
+		}
+	}
+	if len(edges) == 0 {
+		edges, ok = mdData["edges_est"]
+		if !ok {
+			return "", fmt.Errorf("no edges data found")
+		}
+	}
+	// THE ITEMS WITH A for_each AS THE ONES THEY EXPAND INTO
+	nodes, edges = etlx.forEachGraph(nodes, edges)
+	return etlx.GenerateMermaidFlowchart(nodes, edges), nil
+}
@@ -0,0 +1,245 @@
+package etlxlib
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/secrets"
+)
+
+// The on_error of the metadata of a Level 1 key, what happens to the rest of
+// the run when the key fails
+const (
+	// OnErrorSkipDependents skips the keys and items depending on the failed
+	// key, the others run (default)
+	OnErrorSkipDependents = "skip_dependents"
+	// OnErrorContinue runs the dependents anyway
+	OnErrorContinue = "continue"
+	// OnErrorStop skips every key left, but the LOGS ones
+	OnErrorStop = "stop"
+)
+
+var onErrorPolicies = []string{OnErrorSkipDependents, OnErrorContinue, OnErrorStop}
+
+// keyMetadata is the metadata of a Level 1 key, nil when it has none
+func (etlx *ETLX) keyMetadata(key string) map[string]any {
+	conf, _ := etlx.Config[key].(map[string]any)
+	metadata, _ := conf["metadata"].(map[string]any)
+	return metadata
+}
+
+// onError is the on_error of a key, skip_dependents when not set
+func (etlx *ETLX) onError(key string) string {
+	policy, _ := etlx.keyMetadata(key)["on_error"].(string)
+	policy = strings.ToLower(strings.TrimSpace(policy))
+	if policy == "" {
+		return OnErrorSkipDependents
+	}
+	return policy
+}
+
+// sectionHooks are the keys of the on_success or on_failure of a key
+func (etlx *ETLX) sectionHooks(key string, field string) []string {
+	return parseDependsOn(etlx.keyMetadata(key)[field])
+}
+
+// hookKeys are the keys named in the on_success / on_failure of the others,
+// they only run as hooks
+func (etlx *ETLX) hookKeys(keys []string) map[string]bool {
+	hooks := map[string]bool{}
+	for _, key := range keys {
+		for _, field := range []string{"on_success", "on_failure"} {
+			for _, hook := range etlx.sectionHooks(key, field) {
+				hooks[hook] = true
+			}
+		}
+	}
+	return hooks
+}
+
+// hookScope is the section that triggered a hook, available to the hook as
+// @HOOK.key / @HOOK.runs_as / @HOOK.status / @HOOK.msg and as .hook in the
+// templates, with its logs
+type hookScope struct {
+	Key    string
+	RunsAs string
+	Status string
+	Msg    string
+	Logs   []map[string]any
+}
+
+var hookPlaceholderRe = regexp.MustCompile(`@HOOK\.(\w+)`)
+
+// replace resolves the @HOOK.field placeholders
+func (h *hookScope) replace(input string) string {
+	if h == nil || !strings.Contains(input, "@HOOK.") {
+		return input
+	}
+	return hookPlaceholderRe.ReplaceAllStringFunc(input, func(match string) string {
+		v, ok := h.templateData()[strings.TrimPrefix(match, "@HOOK.")].(string)
+		if !ok {
+			return match
+		}
+		return v
+	})
+}
+
+func (h *hookScope) templateData() map[string]any {
+	return map[string]any{
+		"key":     h.Key,
+		"runs_as": h.RunsAs,
+		"status":  h.Status,
+		"msg":     h.Msg,
+		"logs":    h.Logs,
+	}
+}
+
+// runHooks runs the on_success or on_failure hooks of a key once it ran,
+// their logs and data are part of the run
+func (etlx *ETLX) runHooks(key string, runsAs any, failed bool, err error, sectionLogs []map[string]any, dateRef []time.Time, extraConf map[string]any) ([]map[string]any, map[string]any) {
+	field, status := "on_success", "success"
+	if failed {
+		field, status = "on_failure", "failure"
+	}
+	hooks := etlx.sectionHooks(key, field)
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+	scope := &hookScope{Key: key, RunsAs: fmt.Sprint(runsAs), Status: status, Logs: sectionLogs}
+	if err != nil {
+		scope.Msg = err.Error()
+	} else {
+		for _, _log := range sectionLogs {
+			if success, ok := _log["success"].(bool); ok && !success {
+				scope.Msg, _ = _log["msg"].(string)
+				break
+			}
+		}
+	}
+	parentHook := etlx.hook
+	etlx.hook = scope
+	defer func() { etlx.hook = parentHook }()
+	logs := []map[string]any{}
+	data := map[string]any{}
+	for _, hook := range hooks {
+		metadata := etlx.keyMetadata(hook)
+		if metadata == nil {
+			etlx.logger("key", key).Warn(field+" hook not found", "hook", hook)
+			continue
+		}
+		hookRunsAs, ok := metadata["runs_as"]
+		if !ok {
+			hookRunsAs = strings.ToUpper(hook)
+		}
+		etlx.logger("key", hook).Info("running hook", "hook_of", key, "on", field)
+		runCtx := etlx.Context()
+		sectionCtx, endSection := etlx.tel.startSection(runCtx, hook, fmt.Sprint(hookRunsAs))
+		etlx.ctx = sectionCtx
+		// A LOGS HOOK SAVES THE LOGS OF THE SECTION
+		_logs, ok, err := etlx.runSection(hook, hookRunsAs, dateRef, extraConf, sectionLogs)
+		etlx.ctx = runCtx
+		endSection(_logs, secrets.MaskErr(err))
+		if !ok {
+			etlx.logger("key", key).Warn(field+" hook has no runner", "hook", hook, "runs_as", hookRunsAs)
+			continue
+		}
+		for _, _log := range _logs {
+			secrets.MaskValue(_log)
+		}
+		err = secrets.MaskErr(err)
+		_data := map[string]any{
+			"success": err == nil && !anyFailed(_logs),
+			"runs_as": hookRunsAs,
+			"hook_of": key,
+			"logs":    _logs,
+		}
+		if err != nil {
+			if errDeactivated(err) {
+				continue
+			}
+			etlx.logger("key", hook).Error("hook failed", "hook_of", key, "err", err)
+			_data["msg"] = err.Error()
+		}
+		if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
+			_, _ = etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
+		}
+		logs = append(logs, _logs...)
+		data[hook] = _data
+	}
+	return logs, data
+}
+
+// runSection runs a Level 1 key with the runner of its runs_as, ok is false
+// when the runs_as has none
+func (etlx *ETLX) runSection(key string, runsAs any, dateRef []time.Time, extraConf map[string]any, logs []map[string]any) ([]map[string]any, bool, error) {
+	var _logs []map[string]any
+	var err error
+	// THE ITEMS WITH A for_each ARE EXPANDED RIGHT BEFORE THE KEY RUNS
+	expanded := etlx.expandForEach(key, dateRef)
+	for _, _log := range expanded {
+		etlx.formatProcessLogEntry(_log)
+	}
+	switch runsAs {
+	case "ETL", "ELT":
+		_logs, err = etlx.RunETL(dateRef, nil, extraConf, key)
+	case "DATA_QUALITY", "DATAQUALITY", "QUALITY":
+		_logs, err = etlx.RunDATA_QUALITY(dateRef, nil, extraConf, key)
+	case "MULTI_QUERIES", "STACKED_QUERIES":
+		_logs, _, err = etlx.RunMULTI_QUERIES(dateRef, nil, extraConf, key)
+	case "EXPORTS":
+		_logs, err = etlx.RunEXPORTS(dateRef, nil, extraConf, key)
+	case "NOTIFY", "NOTIFICATION":
+		_logs, err = etlx.RunNOTIFY(dateRef, nil, extraConf, key)
+	case "ACTIONS":
+		_logs, err = etlx.RunACTIONS(dateRef, nil, extraConf, key)
+	case "SCRIPTS", "MODEL_SQL":
+		_logs, err = etlx.RunSCRIPTS(dateRef, nil, extraConf, key)
+	case "LOGS", "OBSERVABILITY":
+		_logs, err = etlx.RunLOGS(dateRef, nil, logs, key)
+	case "REQUIRES", "IMPORTS":
+		_logs, err = etlx.LoadREQUIRES(nil, key)
+	case "MODEL", "CSMODEL", "C7MODEL":
+		_logs, err = etlx.RunMODEL(dateRef, nil, extraConf, key)
+	case "MODEL_DATA", "CSDATA", "C7DATA":
+		_logs, err = etlx.RunMODEL_DATA(dateRef, nil, extraConf, key)
+	case "WORKFLOW", "C7WORKFLOW", "CSWORKFLOW":
+		_logs, err = etlx.RunWORKFLOW(dateRef, nil, extraConf, key)
+	case "C7ROLE", "CSROLE", "ROLE":
+		_logs, err = etlx.RunC7ROLE(dateRef, nil, extraConf, key)
+	case "C7ROLE_USERS", "CSROLE_USERS", "ROLE_USERS":
+		_logs, err = etlx.RunC7ROLE_USERS(dateRef, nil, extraConf, key)
+	case "REMOTE", "REMOTE_EXEC":
+		_logs, err = etlx.RunREMOTE(dateRef, nil, extraConf, key)
+	default:
+		return nil, false, nil
+	}
+	return append(expanded, _logs...), true, err
+}
+
+// validateFlow checks the on_error and the hooks of a key
+func (etlx *ETLX) validateFlow(key string) []ValidationError {
+	errs := []ValidationError{}
+	if metadata := etlx.keyMetadata(key); metadata != nil {
+		if policy, ok := metadata["on_error"].(string); ok && !slices.Contains(onErrorPolicies, etlx.onError(key)) {
+			errs = append(errs, ValidationError{Level: "error", Key: key, Field: "on_error", Msg: fmt.Sprintf("unknown on_error %q (%s)", policy, strings.Join(onErrorPolicies, ", "))})
+		}
+	}
+	for _, field := range []string{"on_success", "on_failure"} {
+		for _, hook := range etlx.sectionHooks(key, field) {
+			if hook == key {
+				errs = append(errs, ValidationError{Level: "error", Key: key, Field: field, Msg: "a key can not be its own hook"})
+			} else if etlx.keyMetadata(hook) == nil {
+				errs = append(errs, ValidationError{Level: "error", Key: key, Field: field, Msg: fmt.Sprintf("hook %s not found", hook)})
+			}
+		}
+	}
+	return errs
+}
+
+// errDeactivated tells if a runner error is the one of a key with active: false
+func errDeactivated(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "deactivated") || strings.Contains(err.Error(), "dectivated"))
+}
@@ -52,20 +52,20 @@ func (etlx *ETLX) ReadEmails(cfg map[string]any, item map[string]any, dateRef []
 	// Connect IMAP
 	c, err := client.DialTLS(fmt.Sprintf("%s:%s", host, port), nil)
 	if err != nil {
-		fmt.Println("client.DialTLS Err:", err)
+		etlx.itemLogger(item).Error("IMAP connection failed", "host", host, "port", port, "err", err)
 		return nil, err
 	}
 	defer c.Logout()
 	// Login
 	err = c.Login(username, password)
 	if err != nil {
-		fmt.Println("c.Login Err:", err)
+		etlx.itemLogger(item).Error("IMAP login failed", "host", host, "user", username, "err", err)
 		return nil, err
 	}
 	// Select mailbox
 	_, err = c.Select(folder, false)
 	if err != nil {
-		fmt.Println("c.Select(folder, false) Err:", err)
+		etlx.itemLogger(item).Error("IMAP select failed", "folder", folder, "err", err)
 		return nil, err
 	}
 	// Build search
@@ -93,7 +93,7 @@ func (etlx *ETLX) ReadEmails(cfg map[string]any, item map[string]any, dateRef []
 	}
 	ids, err := c.Search(criteria)
 	if err != nil {
-		fmt.Println("c.Search(criteria) Err:", err)
+		etlx.itemLogger(item).Error("IMAP search failed", "folder", folder, "err", err)
 		return nil, err
 	}
 	// fmt.Println("Fine Till Search Criteria OK")
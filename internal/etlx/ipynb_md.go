@@ -49,11 +49,11 @@ func (etlx *ETLX) ConvertIPYNBToMarkdown(ipynbContent []byte) (string, error) {
 		}
 	}
 	if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-		_, err := etlx.TempFIle("", mdBuilder.String(), "ipymd2md.*.md")
+		_file, err := etlx.TempFIle("", mdBuilder.String(), "ipymd2md.*.md")
 		if err != nil {
-			fmt.Println(err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 		}
-		//fmt.Println(_file)
+		etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 	}
 	return mdBuilder.String(), nil
 }
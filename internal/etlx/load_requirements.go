@@ -11,6 +11,10 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "REQUIRES"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -40,9 +44,10 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 		mainDescription = metadata["description"].(string)
 		itemMetadata, ok := item["metadata"].(map[string]any)
 		if !ok {
+			description, _ := itemMetadata["description"].(string)
 			processLogs = append(processLogs, map[string]any{
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"].(string),
+				"description": description,
 				"start_at":    time.Now().In(etlx.TimeZone),
 				"end_at":      time.Now().In(etlx.TimeZone),
 				"success":     true,
@@ -90,7 +95,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 				_log2["end_at"] = time.Now().In(etlx.TimeZone)
 				_log2["duration"] = time.Since(start3).Seconds()
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 				return nil
 			}
 			defer dbConn.Close()
@@ -99,7 +104,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 			_log2["end_at"] = time.Now().In(etlx.TimeZone)
 			_log2["duration"] = time.Since(start3).Seconds()
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			//  QUERIES TO RUN AT BEGINING
 			if okBefore {
 				start3 := time.Now().In(etlx.TimeZone)
@@ -121,7 +126,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 					_log2["duration"] = time.Since(start3).Seconds()
 				}
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 			// MAIN QUERY
 			rows, _, err := etlx.Query(dbConn, query.(string), item, "", "", nil)
@@ -132,7 +137,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 				_log2["end_at"] = time.Now().In(etlx.TimeZone)
 				_log2["duration"] = time.Since(start3).Seconds()
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 				return nil
 			}
 			if len(*rows) > 0 {
@@ -150,7 +155,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 						_log2["end_at"] = time.Now().In(etlx.TimeZone)
 						_log2["duration"] = time.Since(start3).Seconds()
 						processLogs = append(processLogs, _log2)
-						formatProcessLogEntry(_log2)
+						etlx.formatProcessLogEntry(_log2)
 						return nil
 					}
 				} else {
@@ -159,7 +164,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 					_log2["end_at"] = time.Now().In(etlx.TimeZone)
 					_log2["duration"] = time.Since(start3).Seconds()
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 					return nil
 				}
 			} else {
@@ -168,7 +173,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 				_log2["end_at"] = time.Now().In(etlx.TimeZone)
 				_log2["duration"] = time.Since(start3).Seconds()
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 				return nil
 			}
 			// QUERIES TO RUN AT THE END
@@ -192,7 +197,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 					_log2["duration"] = time.Since(start3).Seconds()
 				}
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 		} else if path != nil && okPath {
 			if ok, _ := fileExists(path.(string)); ok {
@@ -203,7 +208,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 					_log2["end_at"] = time.Now().In(etlx.TimeZone)
 					_log2["duration"] = time.Since(start3).Seconds()
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 				}
 			} else {
 				_log2["success"] = false
@@ -211,7 +216,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 				_log2["end_at"] = time.Now().In(etlx.TimeZone)
 				_log2["duration"] = time.Since(start3).Seconds()
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 				return nil
 			}
 		}
@@ -224,7 +229,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 			} else if path != nil && okPath {
 				data, err := os.ReadFile(path.(string))
 				if err != nil {
-					fmt.Printf("LOAD RAW FILE: failed to read file: %s", err)
+					etlx.logger("key", key, "item", itemKey).Error("reading the raw file failed", "path", path, "err", err)
 				} else {
 					etlx.Config[itemKey] = string(data)
 				}
@@ -237,7 +242,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 				if _, ok := etlx.Config[newConfKey]; !ok {
 					etlx.Config[newConfKey] = value
 				} else {
-					fmt.Println(newConfKey, "Already exists!")
+					etlx.logger("key", key, "item", itemKey).Warn("key already exists, not loaded", "loaded_key", newConfKey)
 				}
 			}
 		}
@@ -246,7 +251,7 @@ func (etlx *ETLX) LoadREQUIRES(conf map[string]any, keys ...string) ([]map[strin
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil
 	}
 	// Check if the input conf is nil or empty
@@ -1,49 +1,156 @@
 package etlxlib
 
 import (
-    "encoding/json"
-    "log"
-    "os"
-    "strings"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/realdatadriven/etlx/internal/db"
+	"github.com/realdatadriven/etlx/internal/secrets"
 )
 
 var DebugMode bool
 
-var stdLogger *log.Logger
+// defaultLogger is the logger of the ETLX without a Logger, it discards
+// everything unless set with SetLogger or the environment (ETLX_LOG_LEVEL,
+// ETL_DEBUG), so the library does not write to stdout on its own
+var defaultLogger atomic.Pointer[slog.Logger]
 
 func init() {
-    stdLogger = log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds)
-    rawDebug := os.Getenv("ETL_DEBUG")
-    DebugMode = strings.EqualFold(rawDebug, "true") || rawDebug == "1"
+	rawDebug := os.Getenv("ETL_DEBUG")
+	DebugMode = strings.EqualFold(rawDebug, "true") || rawDebug == "1"
+	level := os.Getenv("ETLX_LOG_LEVEL")
+	if level == "" && DebugMode {
+		level = "debug"
+	}
+	if level == "" {
+		// LEGACY, PRINTED THE PROCESS LOGS
+		level = os.Getenv("ETLX_DEBUG_LOG_LEVEL")
+	}
+	if level == "" && os.Getenv("ETLX_DEBUG_QUERY") == "true" {
+		level = "debug"
+	}
+	if level == "" {
+		SetLogger(nil)
+		return
+	}
+	l, err := NewLogger(os.Stderr, level, os.Getenv("ETLX_LOG_FORMAT"))
+	if err != nil {
+		l, _ = NewLogger(os.Stderr, "info", "text")
+		l.Warn("ETLX_LOG_LEVEL / ETLX_LOG_FORMAT ignored", "err", err)
+	}
+	SetLogger(l)
+}
+
+// ParseLogLevel parses debug, info, warn(ing) or error
+func ParseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(level)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (debug, info, warn or error)", level)
+}
+
+// NewLogger returns a logger writing to w from level on, as text (logfmt)
+// or json lines, with the secrets masked
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	_level, err := ParseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: _level}
+	var h slog.Handler
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (text or json)", format)
+	}
+	return slog.New(secrets.NewMaskHandler(h)), nil
+}
+
+// SetLogger sets the logger of the ETLX without a Logger of their own and of
+// the connections, nil discards the logs
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	} else {
+		l = slog.New(secrets.NewMaskHandler(l.Handler()))
+	}
+	defaultLogger.Store(l)
+	db.SetLogger(l)
+	secrets.SetLogger(l)
+}
+
+// Logger returns the logger set with SetLogger
+func Logger() *slog.Logger {
+	return defaultLogger.Load()
+}
+
+// logger is the logger of the run, with the run_id and the attrs given
+// (usually "key", key, "item", itemKey)
+func (etlx *ETLX) logger(attrs ...any) *slog.Logger {
+	l := Logger()
+	if etlx != nil && etlx.Logger != nil {
+		l = slog.New(secrets.NewMaskHandler(etlx.Logger.Handler()))
+	}
+	if etlx != nil && etlx.RunID != "" {
+		l = l.With("run_id", etlx.RunID)
+	}
+	if len(attrs) > 0 {
+		l = l.With(attrs...)
+	}
+	return l
 }
 
 func SetDebug(d bool) {
-    DebugMode = d
+	DebugMode = d
 }
 
 func Debugf(format string, args ...any) {
-    if DebugMode {
-        stdLogger.Printf("[DEBUG] "+format, args...)
-    }
+	Logger().Debug(fmt.Sprintf(format, args...))
 }
 
 func Infof(format string, args ...any) {
-    stdLogger.Printf("[INFO] "+format, args...)
+	Logger().Info(fmt.Sprintf(format, args...))
 }
 
 func Errorf(format string, args ...any) {
-    stdLogger.Printf("[ERROR] "+format, args...)
+	Logger().Error(fmt.Sprintf(format, args...))
 }
 
 // AppendProcessLog appends an entry to processLogs and emits a debug log
 // when DebugMode is enabled. The entry is marshaled to JSON for readability.
 func AppendProcessLog(processLogs *[]map[string]any, entry map[string]any) {
-    *processLogs = append(*processLogs, entry)
-    if DebugMode {
-        if b, err := json.Marshal(entry); err == nil {
-            stdLogger.Printf("[PROCESS_LOG] %s", string(b))
-        } else {
-            stdLogger.Printf("[PROCESS_LOG] (marshal error): %v", err)
-        }
-    }
+	*processLogs = append(*processLogs, entry)
+	if DebugMode {
+		if b, err := json.Marshal(entry); err == nil {
+			Logger().Debug("process log", "entry", string(b))
+		} else {
+			Logger().Debug("process log", "err", err)
+		}
+	}
+}
+
+// itemLogger is the logger of the run with the name of the item, for the
+// helpers that get the item but not the key
+func (etlx *ETLX) itemLogger(item map[string]any) *slog.Logger {
+	if metadata, ok := item["metadata"].(map[string]any); ok {
+		if name, ok := metadata["name"].(string); ok && name != "" {
+			return etlx.logger("item", name)
+		}
+	}
+	return etlx.logger()
 }
@@ -40,7 +40,8 @@ func (etlx *ETLX) RenderTemplate(tmplStr string, data map[string]any) (string, e
 	// fmt.Println(tmplStr)
 	// Create a FuncMap with some common functions
 	// funcMap := sprig.FuncMap()
-	tmpl, err := template.New("tmpl").Funcs(sprig.FuncMap()).Parse(tmplStr)
+	data = etlx.templateData(data)
+	tmpl, err := template.New("tmpl").Funcs(sprig.FuncMap()).Parse(etlx.ReplaceParams(tmplStr))
 	//tmpl, err := template.New("email").Funcs(funcMap).Parse(tmplStr)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %v", err)
@@ -58,7 +59,8 @@ func (etlx *ETLX) RenderTextTemplate(tmplStr string, data map[string]any) (strin
 	// fmt.Println(tmplStr)
 	// Create a FuncMap with some common functions
 	// funcMap := sprig.FuncMap()
-	tmpl, err := texttemplate.New("tmpl").Funcs(sprig.FuncMap()).Parse(tmplStr)
+	data = etlx.templateData(data)
+	tmpl, err := texttemplate.New("tmpl").Funcs(sprig.FuncMap()).Parse(etlx.ReplaceParams(tmplStr))
 	//tmpl, err := template.New("email").Funcs(funcMap).Parse(tmplStr)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %v", err)
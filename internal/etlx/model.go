@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"sort"
 	"strconv"
 	"strings"
@@ -438,7 +437,7 @@ func (d *DuckDBDialect) GetColumnType(field map[string]any, dbCon db.DBInterface
 			if dbCon != nil {
 				_, err := dbCon.ExecuteQuery(create_seq, []any{}...)
 				if err != nil {
-					fmt.Println("Err creating SEQUENCE:", err)
+					Logger().Error("creating the SEQUENCE failed", "sql", create_seq, "err", err)
 				}
 				return fmt.Sprintf(`INTEGER DEFAULT NEXTVAL('%s')`, seqName)
 			}
@@ -1221,10 +1220,10 @@ func (etlx *ETLX) InsertData(dbCon db.DBInterface, tableName string, columns map
 	}()*/
 	if dbCon.GetDriverName() == "sqlserver" || dbCon.GetDriverName() == "mssql" {
 		sql := fmt.Sprintf("SET IDENTITY_INSERT [%s] ON;", tableName)
-		fmt.Printf("Executing SQL to enable IDENTITY_INSERT for MSSQL: %s\n", sql)
+		etlx.logger().Debug("enabling IDENTITY_INSERT", "table", tableName)
 		_, err := dbCon.ExecuteQuery(sql, []any{}...) //tx.ExecContext(context.Background(), sql) //
 		if err != nil {
-			fmt.Printf("failed to set IDENTITY_INSERT ON for table %s (%s): %v", tableName, sql, err)
+			etlx.logger().Warn("failed to set IDENTITY_INSERT ON", "table", tableName, "err", err)
 			// return fmt.Errorf("failed to set IDENTITY_INSERT ON for table %s (%s): %w", tableName, sql, err)
 		}
 	}
@@ -1610,7 +1609,7 @@ func (etlx *ETLX) generateCustomDataV2(parsedTables map[string]any, tables_order
 					referredColumn = parts[1]
 					if referredTable == tableName {
 						//isRefToSameTable = true
-						fmt.Println("SAME REF", referredTable)
+						etlx.logger().Debug("foreign key to the same table", "table", referredTable)
 						fkAdded = append(fkAdded, referredColumn, tableName)
 					}
 					// fmt.Println(1, "FK:", tableName, referredTable, referredColumn)
@@ -1737,7 +1736,7 @@ func (etlx *ETLX) generateCustomDataV2(parsedTables map[string]any, tables_order
 		marshalValue := func(v any) string {
 			b, err := json.Marshal(v)
 			if err != nil {
-				log.Printf("json marshal error: %v", err)
+				etlx.logger().Warn("json marshal error", "err", err)
 				return "null"
 			}
 			return string(b)
@@ -1894,10 +1893,10 @@ func (etlx *ETLX) UpsertSeedDataNamed(dbCon db.DBInterface, seed SeedData, targe
 	for _, tableName := range targetTables {
 		rows, ok := seed[tableName].([]map[string]any)
 		if !ok || len(rows) == 0 {
-			log.Printf("No seed data for %q → skipping", tableName)
+			etlx.logger().Debug("no seed data, skipped", "table", tableName)
 			continue
 		}
-		fmt.Printf("\n→ Processing %q (%d rows)\n", tableName, len(rows))
+		etlx.logger().Debug("upserting", "table", tableName, "rows", len(rows))
 		for _, row := range rows {
 			if _, ok := row["excluded"]; !ok {
 				row["excluded"] = false
@@ -1943,7 +1942,6 @@ func (etlx *ETLX) UpsertSeedDataNamed(dbCon db.DBInterface, seed SeedData, targe
 			// fmt.Println("checkQuery:", checkQuery, _chk_params)
 			res, _, err := dbCon.QueryMultiRows(checkQuery, _chk_params...)
 			if err != nil && err != sql.ErrNoRows {
-				fmt.Println("Existence check failed:", checkQuery, _chk_params)
 				return fmt.Errorf("existence check failed %s (%s): %w", tableName, logKey, err)
 			} else if len(*res) > 0 {
 				exists = true
@@ -2048,7 +2046,7 @@ func (etlx *ETLX) UpsertSeedDataNamed(dbCon db.DBInterface, seed SeedData, targe
 			//fmt.Printf("  cleanup %s -> %s -> %s: %d row(s) deleted\n", targetDBName, "table_schema", tableName, affectedRows)
 		}
 	}
-	fmt.Println("\nSeed data load completed successfully.")
+	etlx.logger().Info("seed data load completed")
 	return nil
 }
 
@@ -2072,10 +2070,10 @@ func (etlx *ETLX) UpsertCustomFT(dbCon db.DBInterface, seed SeedData, targetDBNa
 	for _, tableName := range targetTables {
 		rows, ok := seed[tableName].([]map[string]any)
 		if !ok || len(rows) == 0 {
-			log.Printf("\nNo custom data for %q → skipping", tableName)
+			etlx.logger().Debug("no custom data, skipped", "table", tableName)
 			continue
 		}
-		fmt.Printf("\n→ Processing %q (%d rows)\n", tableName, len(rows))
+		etlx.logger().Debug("upserting", "table", tableName, "rows", len(rows))
 		for _, row := range rows {
 			if _, ok := row["excluded"]; !ok {
 				row["excluded"] = false
@@ -2186,7 +2184,7 @@ func (etlx *ETLX) UpsertCustomFT(dbCon db.DBInterface, seed SeedData, targetDBNa
 		}
 	}
 
-	fmt.Println("\nSeed data load completed successfully.")
+	etlx.logger().Info("custom data load completed")
 	return nil
 }
 
@@ -2361,9 +2359,9 @@ func (etlx *ETLX) LoadOrSyncMenusFromConfig(
 			} else {
 				menu["menu_id"] = int(lastID)
 			}
-			fmt.Printf("Created menu %q → ID %d\n", menuName, menu["menu_id"])
+			etlx.logger().Info("menu created", "menu", menuName, "menu_id", menu["menu_id"])
 		} else {
-			fmt.Printf("Menu %q already exists → ID %d\n", menuName, menu["menu_id"])
+			etlx.logger().Debug("menu already exists", "menu", menuName, "menu_id", menu["menu_id"])
 			// update existing menu if needed (e.g., active status, icon, order, config)
 			updateParts := []string{}
 			updateParams := map[string]any{
@@ -2393,9 +2391,9 @@ func (etlx *ETLX) LoadOrSyncMenusFromConfig(
 				`, strings.Join(updateParts, ", "))
 				_, err := dbCon.ExecuteNamedQuery(updateQuery, updateParams)
 				if err != nil {
-					fmt.Printf("update menu %s: %v", menuName, err)
+					etlx.logger().Error("updating the menu failed", "menu", menuName, "err", err)
 				} else {
-					fmt.Printf("Updated menu %s (ID %d)\n", menuName, menu["menu_id"])
+					etlx.logger().Info("menu updated", "menu", menuName, "menu_id", menu["menu_id"])
 				}
 			}
 		}
@@ -2433,7 +2431,7 @@ func (etlx *ETLX) LoadOrSyncMenusFromConfig(
 				return fmt.Errorf("find table %q: %w", tblName, err)
 			}
 			if len(*_tblMeta) == 0 {
-				fmt.Printf("Warning: table %q not found in metadata → skipping link\n", tblName)
+				etlx.logger().Warn("table not found in the metadata, link skipped", "menu", menuName, "table", tblName)
 				continue
 			}
 			tblMeta = (*_tblMeta)
@@ -2487,9 +2485,9 @@ func (etlx *ETLX) LoadOrSyncMenusFromConfig(
 						return fmt.Errorf("insert menu_table %q → %q: %w", menuName, tblName, err)
 					}
 				}
-				fmt.Printf("  Linked table %q (active=%v, rla=%v)\n", tblName, linkActive, requiresRLA)
+				etlx.logger().Info("table linked", "menu", menuName, "table", tblName, "active", linkActive, "rla", requiresRLA)
 			} else {
-				fmt.Printf("  Link already exists for table %q\n", tblName)
+				etlx.logger().Debug("link already exists", "menu", menuName, "table", tblName)
 				// Optionally update link if active status or requires_rla has changed
 				updateParts := []string{}
 				updateParams := map[string]any{
@@ -2515,9 +2513,9 @@ func (etlx *ETLX) LoadOrSyncMenusFromConfig(
 					`, strings.Join(updateParts, ", "))
 					_, err := dbCon.ExecuteNamedQuery(updateQuery, updateParams)
 					if err != nil {
-						fmt.Printf("update menu_table link %s → %s: %v", menuName, tblName, err)
+						etlx.logger().Error("updating the menu_table link failed", "menu", menuName, "table", tblName, "err", err)
 					} else {
-						fmt.Printf("  Updated link for table %q (active=%v, rla=%v)\n", tblName, linkActive, requiresRLA)
+						etlx.logger().Info("link updated", "menu", menuName, "table", tblName, "active", linkActive, "rla", requiresRLA)
 					}
 				}
 			}
@@ -2628,6 +2626,10 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "MODEL"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -2737,7 +2739,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 	}
 	defer dbConn.Close()
@@ -2797,7 +2799,6 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 			_, err = dbConn.ExecuteQuery(dropTableSQL)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 			if err != nil {
-				fmt.Printf("%s ERR: dropping table %s: %s\n", key, table, err)
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s ERR: dropping table %s: %s", key, table, err)
 			} else {
@@ -2812,7 +2813,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 		}
 	} else {
 		for _, itemKey := range order {
@@ -2869,7 +2870,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 			}
 			schemaAtual, err := etlx.GetTableSchema(dbConn, database, table)
 			if err != nil {
-				fmt.Println("etlx.GetTableSchema(dbConn, database, table):", database, table, err)
+				etlx.logger("key", key, "item", itemKey).Error("getting the table schema failed", "database", database, "table", table, "err", err)
 				return nil, err
 			}
 			tableSql := generateCreateTableSQL(driver, table, comment, create_all, columns, dbConn)
@@ -2879,10 +2880,10 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 					alterQueries, err := getAlterSchema(dbConn, table, schemaAtual, columns)
 					if err == nil && len(alterQueries) > 0 {
 						for _, q := range alterQueries {
-							fmt.Printf("Alter failed for %s.%s\n", table, q)
+							etlx.logger("key", key, "item", itemKey).Debug("altering the table", "table", table, "sql", q)
 							_, err = dbConn.ExecuteQuery(q)
 							if err != nil {
-								fmt.Printf("Alter failed for %s.%s: %v\n", table, q, err)
+								etlx.logger("key", key, "item", itemKey).Error("altering the table failed", "table", table, "sql", q, "err", err)
 							}
 						}
 					}
@@ -2901,15 +2902,15 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s ERR: creating table %s: %s", key, table, err)
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 				//fmt.Println(tableSql, _log2["msg"])
 			} else {
 				_log2["success"] = true
 				_log2["msg"] = fmt.Sprintf("%s: table %s created or already exists", key, table)
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			dataRows, okData := itemMetadata.(map[string]any)["data"].([]any)
 			if okData {
 				start3 = time.Now().In(etlx.TimeZone)
@@ -2932,8 +2933,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 					_log2["success"] = false
 					_log2["msg"] = fmt.Sprintf("%s ERR: inserting data into %s: %s", key, table, err)
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
-					fmt.Println(_log2["msg"])
+					etlx.formatProcessLogEntry(_log2)
 				} else {
 					_log2["success"] = true
 					_log2["msg"] = fmt.Sprintf("%s: data inserted into %s", key, table)
@@ -2946,7 +2946,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 		}
 	}
@@ -2979,7 +2979,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 			_log2["end_at"] = time.Now().In(etlx.TimeZone)
 			_log2["duration"] = time.Since(start3).Seconds()
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			return nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 		} else {
 			defer adminDb.Close()
@@ -3012,7 +3012,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 			_log2["end_at"] = time.Now().In(etlx.TimeZone)
 			_log2["duration"] = time.Since(start3).Seconds()
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			return nil, fmt.Errorf("%s ERR: connecting to ADMIN DB %s in : %s", key, adminConn, err)
 		} else {
 			defer adminDb.Close()
@@ -3040,11 +3040,9 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 		_data, dt_iu := etlx.generateSeedData(_tables, tables_order, database)
 		err = etlx.UpsertSeedDataNamed(adminDb, _data, database, tables_order, dt_iu)
 		if err != nil {
-			fmt.Printf("%s ERR: upserting seed data: %s\n", key, err)
 			_log2["success"] = false
 			_log2["msg"] = fmt.Sprintf("%s ERR: upserting seed data: %s", key, err)
 		} else {
-			fmt.Printf("%s: seed data upserted successfully\n", key)
 			_log2["success"] = true
 			_log2["msg"] = fmt.Sprintf("%s: seed data upserted successfully", key)
 		}
@@ -3056,7 +3054,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	}
 	cs_app, ok := metadata["cs_app"].(map[string]any)
 	if drop_all == "" && ok && updateTableMetadataSQL {
@@ -3096,7 +3094,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	}
 	// CUSTOM DATA
 	if drop_all == "" && updateTableMetadataSQL {
@@ -3119,11 +3117,9 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 		_data := etlx.generateCustomDataV2(_tables, tables_order, database)
 		err = etlx.UpsertCustomFT(adminDb, _data, database)
 		if err != nil {
-			fmt.Printf("%s ERR: upserting custom data: %s\n", key, err)
 			_log2["success"] = false
 			_log2["msg"] = fmt.Sprintf("%s ERR: upserting custom data: %s", key, err)
 		} else {
-			fmt.Printf("%s: custom data upserted successfully\n", key)
 			_log2["success"] = true
 			_log2["msg"] = fmt.Sprintf("%s: custom data upserted successfully", key)
 		}
@@ -3135,7 +3131,7 @@ func (etlx *ETLX) RunMODEL(dateRef []time.Time, conf map[string]any, extraConf m
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	}
 	mem_alloc2, mem_total_alloc2, mem_sys2, num_gc2 := etlx.RuntimeMemStats()
 	processLogs[0] = map[string]any{
@@ -15,7 +15,7 @@ func (etlx *ETLX) NamedQuerySingleRow(conn db.DBInterface, sql string, data map[
 	}
 	_res, _, err := conn.QuerySingleRow(query, args...)
 	if err != nil {
-		fmt.Println(query, args, err)
+		etlx.logger().Debug("query failed", "sql", query, "err", err)
 		return nil, err
 	}
 	return (*_res), nil
@@ -44,6 +44,10 @@ func (etlx *ETLX) RunC7ROLE(dateRef []time.Time, conf map[string]any, extraConf
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "ROLE"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -150,7 +154,7 @@ func (etlx *ETLX) RunC7ROLE(dateRef []time.Time, conf map[string]any, extraConf
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 	}
 	defer dbConn.Close()
@@ -178,7 +182,7 @@ func (etlx *ETLX) RunC7ROLE(dateRef []time.Time, conf map[string]any, extraConf
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to ADMIN DB %s in : %s", key, adminConn, err)
 	} else {
 		defer adminDb.Close()
@@ -560,6 +564,10 @@ func (etlx *ETLX) RunC7ROLE_USERS(dateRef []time.Time, conf map[string]any, extr
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "ROLE_USERS"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -666,7 +674,7 @@ func (etlx *ETLX) RunC7ROLE_USERS(dateRef []time.Time, conf map[string]any, extr
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 	}
 	defer dbConn.Close()
@@ -694,7 +702,7 @@ func (etlx *ETLX) RunC7ROLE_USERS(dateRef []time.Time, conf map[string]any, extr
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to ADMIN DB %s in : %s", key, adminConn, err)
 	} else {
 		defer adminDb.Close()
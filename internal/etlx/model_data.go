@@ -1,9 +1,11 @@
 package etlxlib
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -110,7 +112,7 @@ func (etlx *ETLX) GetModelsFromSchema(adminCon db.DBInterface, db, table string)
 	sql := `select * from table_schema where db = ? and "table" = ?`
 	res, _, err := adminCon.QueryMultiRows(sql, db, table)
 	if err != nil {
-		fmt.Printf("GetModelsFromSchema error: %s\n", err)
+		etlx.logger().Error("reading table_schema failed", "db", db, "table", table, "err", err)
 		return nil
 	}
 	aux_model := map[string]any{}
@@ -213,7 +215,7 @@ func (etlx *ETLX) LoadModelData(dbConn db.DBInterface, adminCon db.DBInterface,
 						}
 					}
 				} else {
-					formatProcessLogEntry(map[string]any{
+					etlx.formatProcessLogEntry(map[string]any{
 						"start_at": time.Now().In(etlx.TimeZone),
 						"key":      key,
 						"msg":      fmt.Sprintf("UNABLE TO HANDLE CHILDREN DATA: %T", val),
@@ -257,7 +259,7 @@ func (etlx *ETLX) LoadModelData(dbConn db.DBInterface, adminCon db.DBInterface,
 							}
 						}
 					} else {
-						formatProcessLogEntry(map[string]any{
+						etlx.formatProcessLogEntry(map[string]any{
 							"start_at": time.Now().In(etlx.TimeZone),
 							"key":      key,
 							"msg":      fmt.Sprintf("UNABLE TO HANDLE CHILDREN DATA: %T", val),
@@ -307,7 +309,7 @@ func (etlx *ETLX) LoadModelData(dbConn db.DBInterface, adminCon db.DBInterface,
 							}
 						}
 					} else {
-						formatProcessLogEntry(map[string]any{
+						etlx.formatProcessLogEntry(map[string]any{
 							"start_at": time.Now().In(etlx.TimeZone),
 							"key":      key,
 							"msg":      fmt.Sprintf("UNABLE TO HANDLE CHILDREN DATA: %T", val),
@@ -358,51 +360,43 @@ func (etlx *ETLX) NamedToPositional(sql string, data map[string]any) (string, []
 	return result, args, nil
 }
 
-func formatProcessLogEntry(entry map[string]any) {
-	if os.Getenv("ETLX_DEBUG_QUERY") == "true" || os.Getenv("ETLX_DEBUG_LOG_LEVEL") != "" {
-		startAt := time.Time{}
-		if v, ok := entry["start_at"].(time.Time); ok {
-			startAt = v
-		}
-		duration := 0.0
-		switch v := entry["duration"].(type) {
-		case float64:
-			duration = v
-		case float32:
-			duration = float64(v)
-		case int:
-			duration = float64(v)
-		case int64:
-			duration = float64(v)
-		case int32:
-			duration = float64(v)
-		}
-		key := ""
-		if v, ok := entry["key"].(string); ok {
-			key = v
-		}
-		itemKey := ""
-		if v, ok := entry["item_key"].(string); ok {
-			itemKey = "/" + v
-		}
-		msg := ""
-		if v, ok := entry["msg"].(string); ok {
-			msg = v
-		}
-		printLogs := true
-		if strings.ToLower(os.Getenv("ETLX_DEBUG_LOG_LEVEL")) == "error" {
-			if v, ok := entry["success"].(bool); ok && v {
-				printLogs = false
-			}
-		}
-		success := ""
-		if v, ok := entry["success"].(bool); ok {
-			success = fmt.Sprintf("success:%t ", v)
-		}
-		if printLogs {
-			fmt.Printf("%s %.3fs %s%s %s%s\n", startAt.Format(time.RFC3339), duration, key, itemKey, success, CleanWhitespace(msg))
-		}
-	}
+// logProcessEntry logs a process log entry, at error level when it failed
+// and warn when skipped, with the key, item, duration and rows of the step
+func logProcessEntry(l *slog.Logger, entry map[string]any) {
+	level := slog.LevelInfo
+	success, hasSuccess := entry["success"].(bool)
+	if hasSuccess && !success {
+		level = slog.LevelError
+	} else if skipped, _ := entry["skipped"].(bool); skipped {
+		level = slog.LevelWarn
+	}
+	if !l.Enabled(context.Background(), level) {
+		return
+	}
+	attrs := []any{}
+	if v, ok := entry["key"].(string); ok && v != "" {
+		attrs = append(attrs, "key", v)
+	}
+	if v, ok := entry["item_key"].(string); ok && v != "" {
+		attrs = append(attrs, "item", v)
+	}
+	if hasSuccess {
+		attrs = append(attrs, "success", success)
+	}
+	switch v := entry["duration"].(type) {
+	case float64:
+		attrs = append(attrs, "duration", time.Duration(v*float64(time.Second)))
+	case time.Duration:
+		attrs = append(attrs, "duration", v)
+	}
+	if v, ok := entry["rows"]; ok && v != nil {
+		attrs = append(attrs, "rows", v)
+	}
+	msg, _ := entry["msg"].(string)
+	if msg == "" {
+		msg, _ = entry["name"].(string)
+	}
+	l.Log(context.Background(), level, CleanWhitespace(msg), attrs...)
 }
 
 func CleanWhitespace(s string) string {
@@ -415,6 +409,10 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "MODEL_DATA"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -456,7 +454,7 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 				"msg":         "Deactivated",
 			}
 			processLogs = append(processLogs, log2)
-			formatProcessLogEntry(log2)
+			etlx.formatProcessLogEntry(log2)
 			return nil, fmt.Errorf("%s deactivated", key)
 		}
 	}
@@ -523,7 +521,7 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 	}
 	defer dbConn.Close()
@@ -551,7 +549,7 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, fmt.Errorf("%s ERR: connecting to ADMIN DB %s in : %s", key, adminConn, err)
 	} else {
 		defer adminDb.Close()
@@ -602,7 +600,7 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 		}
 		err := etlx.GetModelsFromSchema(adminDb, database, table)
 		if err != nil {
-			fmt.Printf("failed to get models from schema: %s \n", err.Error())
+			etlx.logger("key", key).Error("failed to get the models from the schema", "err", err)
 		}
 		switch val := data.(type) {
 		case map[string]any:
@@ -636,14 +634,14 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			} else {
 				_log2["success"] = true
 				_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 		case []any:
 			for _, val := range data.([]any) {
 				start3 = time.Now().In(etlx.TimeZone)
@@ -665,7 +663,7 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 					_log2["success"] = false
 					_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: data is not a map[string]any", key, table)
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 					continue
 				}
 				//createTableSQL := generateCreateTableSQL(driver, table, comment, create_all, columns)
@@ -683,14 +681,14 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 					_log2["success"] = false
 					_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 				} else {
 					_log2["success"] = true
 					_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 				}
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 		case []map[string]any:
 			for _, val := range data.([]map[string]any) {
@@ -724,14 +722,14 @@ func (etlx *ETLX) RunMODEL_DATA(dateRef []time.Time, conf map[string]any, extraC
 					_log2["success"] = false
 					_log2["msg"] = fmt.Sprintf("%s ERR: insert/update table %s: %s", key, table, err)
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 				} else {
 					_log2["success"] = true
 					_log2["msg"] = fmt.Sprintf("%s: table %s %s", key, table, desc)
 					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					etlx.formatProcessLogEntry(_log2)
 				}
-				formatProcessLogEntry(_log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 		default:
 			// pass
@@ -0,0 +1,239 @@
+package etlxlib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/text"
+)
+
+// useModules replaces the Level 1 keys with a `uses` by the keys of the
+// module they name, as <KEY>/<MODULE KEY>, with the `with` as the params of
+// the module:
+//
+//	name: SALES
+//	uses: ./modules/load_table.md
+//	with:
+//	  source: sales.orders
+//	  target: orders
+//
+// relative paths are from dir, stack are the modules being loaded
+func (etlx *ETLX) useModules(dir string, stack []string) error {
+	order, ok := etlx.Config["__order"].([]any)
+	if !ok {
+		return nil
+	}
+	_order := []any{}
+	instances := map[string][]string{}
+	for _, k := range order {
+		key, _ := k.(string)
+		metadata := etlx.keyMetadata(key)
+		if uses, _ := metadata["uses"].(string); uses == "" {
+			_order = append(_order, k)
+			continue
+		}
+		keys, err := etlx.useModule(key, metadata, dir, stack)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		delete(etlx.Config, key)
+		instances[key] = keys
+		for _, _key := range keys {
+			_order = append(_order, _key)
+		}
+	}
+	if len(instances) == 0 {
+		return nil
+	}
+	etlx.Config["__order"] = _order
+	// A depends_on ON THE KEY WITH THE uses IS ON EVERY KEY OF THE MODULE
+	for _, k := range _order {
+		key, _ := k.(string)
+		conf, _ := etlx.Config[key].(map[string]any)
+		if metadata, ok := conf["metadata"].(map[string]any); ok {
+			expandDeps(metadata, instances)
+		}
+		for _, itemKey := range mdKeyItems(conf) {
+			if itemMetadata, ok := conf[itemKey].(map[string]any)["metadata"].(map[string]any); ok {
+				expandDeps(itemMetadata, instances)
+			}
+		}
+	}
+	return nil
+}
+
+// useModule loads the module of a key with a `uses` and adds its keys to the
+// config, namespaced by the key
+func (etlx *ETLX) useModule(namespace string, metadata map[string]any, dir string, stack []string) ([]string, error) {
+	uses := metadata["uses"].(string)
+	path := uses
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if etlx.modulesDir != "" && !insideDir(etlx.modulesDir, abs) {
+		return nil, fmt.Errorf("module %s is outside of %s", uses, etlx.modulesDir)
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("module cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %w", uses, err)
+	}
+	mod := &ETLX{TimeZone: etlx.TimeZone, MetadataOrder: etlx.MetadataOrder, Logger: etlx.Logger, autoLogsDisabled: true, modulesDir: etlx.modulesDir}
+	if err := mod.ParseMarkdownToConfig(text.NewReader(content), string(content)); err != nil {
+		return nil, fmt.Errorf("module %s: %w", uses, err)
+	}
+	if err := mod.useModules(filepath.Dir(path), append(stack, abs)); err != nil {
+		return nil, fmt.Errorf("module %s: %w", uses, err)
+	}
+	// THE with ARE THE PARAMS OF THE MODULE, WITH THE DEFAULTS / TYPES OF ITS FRONTMATTER
+	frontmatter, _ := mod.Config["__frontmatter"].(map[string]any)
+	specs, err := ParamSpecsFrom(frontmatter["params"])
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %w", uses, err)
+	}
+	with, ok := metadata["with"].(map[string]any)
+	if _, exists := metadata["with"]; exists && !ok {
+		return nil, fmt.Errorf("module %s: with must be a map, got %s", uses, typeName(metadata["with"]))
+	}
+	params := map[string]any{}
+	for name, v := range with {
+		params[name] = v
+	}
+	missing, errs := resolveParams(params, specs)
+	if len(missing) > 0 {
+		errs = append([]error{fmt.Errorf("missing required with: %s", strings.Join(missing, ", "))}, errs...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("module %s: %w", uses, err)
+	}
+	modKeys := []string{}
+	rename := map[string]string{}
+	if order, ok := mod.Config["__order"].([]any); ok {
+		for _, k := range order {
+			key, _ := k.(string)
+			if _, ok := mod.Config[key]; ok && !slices.Contains(modKeys, key) {
+				modKeys = append(modKeys, key)
+				rename[key] = namespace + "/" + key
+			}
+		}
+	}
+	keys := []string{}
+	for _, key := range modKeys {
+		_key := rename[key]
+		if _, exists := etlx.Config[_key]; exists {
+			return nil, fmt.Errorf("module %s: key %s already exists", uses, _key)
+		}
+		conf := moduleParams(copyConfigValue(mod.Config[key]), params)
+		if _conf, ok := conf.(map[string]any); ok {
+			if _metadata, ok := _conf["metadata"].(map[string]any); ok {
+				if _, ok := _metadata["runs_as"]; !ok {
+					_metadata["runs_as"] = strings.ToUpper(key)
+				}
+				if name, _ := _metadata["name"].(string); name == key {
+					_metadata["name"] = _key
+				}
+				renameDeps(_metadata, rename)
+				// THE depends_on / active OF THE KEY WITH THE uses APPLY TO THE WHOLE MODULE
+				if deps := parseDependsOn(metadata["depends_on"]); len(deps) > 0 {
+					_deps := []any{}
+					for _, dep := range append(parseDependsOn(_metadata["depends_on"]), deps...) {
+						_deps = append(_deps, dep)
+					}
+					_metadata["depends_on"] = _deps
+				}
+				if active, ok := metadata["active"].(bool); ok && !active {
+					_metadata["active"] = false
+				}
+			}
+			for _, itemKey := range mdKeyItems(_conf) {
+				if itemMetadata, ok := _conf[itemKey].(map[string]any)["metadata"].(map[string]any); ok {
+					renameDeps(itemMetadata, rename)
+				}
+			}
+		}
+		etlx.Config[_key] = conf
+		keys = append(keys, _key)
+	}
+	etlx.logger("key", namespace).Debug("module loaded", "uses", uses, "keys", strings.Join(keys, ", "))
+	return keys, nil
+}
+
+// moduleParams replaces the @PARAM.name placeholders of the params of a
+// module in every string of the value, the others are the params of the run
+func moduleParams(v any, params map[string]any) any {
+	switch _v := v.(type) {
+	case string:
+		if !strings.Contains(_v, "@PARAM.") {
+			return _v
+		}
+		return paramPlaceholderRe.ReplaceAllStringFunc(_v, func(match string) string {
+			value, ok := params[strings.TrimPrefix(match, "@PARAM.")]
+			if !ok || value == nil {
+				return match
+			}
+			return formatParam(value)
+		})
+	case map[string]any:
+		for k, value := range _v {
+			_v[k] = moduleParams(value, params)
+		}
+	case []any:
+		for i, value := range _v {
+			_v[i] = moduleParams(value, params)
+		}
+	}
+	return v
+}
+
+// renameDeps points the depends_on / on_success / on_failure of a module to
+// its namespaced keys
+func renameDeps(metadata map[string]any, rename map[string]string) {
+	for _, field := range []string{"depends_on", "on_success", "on_failure"} {
+		if metadata[field] == nil {
+			continue
+		}
+		deps := []any{}
+		for _, dep := range parseDependsOn(metadata[field]) {
+			key, item, _ := strings.Cut(dep, ".")
+			if _key, ok := rename[key]; ok {
+				dep = _key
+				if item != "" {
+					dep += "." + item
+				}
+			}
+			deps = append(deps, dep)
+		}
+		metadata[field] = deps
+	}
+}
+
+// expandDeps replaces a depends_on on a key with a uses by its module keys
+func expandDeps(metadata map[string]any, instances map[string][]string) {
+	deps := parseDependsOn(metadata["depends_on"])
+	expanded := false
+	_deps := []any{}
+	for _, dep := range deps {
+		keys, ok := instances[dep]
+		if !ok {
+			_deps = append(_deps, dep)
+			continue
+		}
+		expanded = true
+		for _, key := range keys {
+			_deps = append(_deps, key)
+		}
+	}
+	if expanded {
+		metadata["depends_on"] = _deps
+	}
+}
@@ -0,0 +1,305 @@
+package etlxlib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParamSpec is a run param declared in the `params` of the frontmatter:
+//
+//	---
+//	params:
+//	  region: EU
+//	  since:
+//	    type: date
+//	    required: true
+//	  batch_size:
+//	    type: int
+//	    default: 1000
+//	---
+//
+// a plain value is the default, its type taken from the value
+type ParamSpec struct {
+	Name string
+	// Type is string, int, float, bool, date or list, empty keeps the value as is
+	Type        string
+	Default     any
+	Required    bool
+	Description string
+}
+
+var paramTypes = []string{"string", "int", "float", "bool", "date", "list"}
+
+// ParamSpecsFrom reads the `params` of the frontmatter, sorted by name
+func ParamSpecsFrom(value any) ([]ParamSpec, error) {
+	if value == nil {
+		return nil, nil
+	}
+	params, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("params must be a map, got %T", value)
+	}
+	specs := []ParamSpec{}
+	for name, v := range params {
+		spec := ParamSpec{Name: name}
+		decl, ok := v.(map[string]any)
+		if ok && (decl["type"] != nil || decl["default"] != nil || decl["required"] != nil || decl["description"] != nil) {
+			spec.Type, _ = decl["type"].(string)
+			spec.Default = decl["default"]
+			spec.Description, _ = decl["description"].(string)
+			if required, ok := decl["required"]; ok {
+				_required, err := strconv.ParseBool(fmt.Sprintf("%v", required))
+				if err != nil {
+					return nil, fmt.Errorf("param %s: required must be a bool, got %v", name, required)
+				}
+				spec.Required = _required
+			}
+		} else {
+			spec.Default = v
+			spec.Type = paramTypeOf(v)
+		}
+		spec.Type = strings.ToLower(strings.TrimSpace(spec.Type))
+		if spec.Type != "" && !slices.Contains(paramTypes, spec.Type) {
+			return nil, fmt.Errorf("param %s: unknown type %q (%s)", name, spec.Type, strings.Join(paramTypes, ", "))
+		}
+		if spec.Default != nil {
+			if _, err := spec.Coerce(spec.Default); err != nil {
+				return nil, fmt.Errorf("param %s: invalid default: %w", name, err)
+			}
+		}
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs, nil
+}
+
+// paramTypeOf is the type of a default given as a plain value
+func paramTypeOf(v any) string {
+	switch _v := v.(type) {
+	case bool:
+		return "bool"
+	case int, int64:
+		return "int"
+	case float64:
+		if _v == math.Trunc(_v) {
+			return "int"
+		}
+		return "float"
+	case []any:
+		return "list"
+	case time.Time:
+		return "date"
+	case string:
+		// the unquoted YAML dates come as RFC 3339 strings after the JSON round trip
+		if t, err := time.Parse(time.RFC3339, _v); err == nil && t.Equal(t.Truncate(24*time.Hour)) {
+			return "date"
+		}
+	}
+	return ""
+}
+
+// Coerce converts the value (a string when it comes from -param) to the type
+// of the param
+func (spec ParamSpec) Coerce(v any) (any, error) {
+	s := strings.TrimSpace(fmt.Sprintf("%v", v))
+	switch spec.Type {
+	case "string":
+		return fmt.Sprintf("%v", v), nil
+	case "int":
+		if f, ok := v.(float64); ok && f == math.Trunc(f) {
+			return int64(f), nil
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an int", s)
+		}
+		return i, nil
+	case "float":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a float", s)
+		}
+		return f, nil
+	case "bool":
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", s)
+		}
+		return b, nil
+	case "date":
+		if t, ok := v.(time.Time); ok {
+			return t, nil
+		}
+		for _, layout := range []string{"2006-01-02", time.RFC3339, "2006-01-02 15:04:05", "20060102"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a date (YYYY-MM-DD)", s)
+	case "list":
+		switch _v := v.(type) {
+		case []any:
+			return _v, nil
+		case []string:
+			list := []any{}
+			for _, item := range _v {
+				list = append(list, item)
+			}
+			return list, nil
+		}
+		list := []any{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// ParseParam splits a -param key=value
+func ParseParam(s string) (string, string, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid param %q, expected key=value", s)
+	}
+	return name, value, nil
+}
+
+// LoadParamsFile reads the params from a YAML or JSON file
+func LoadParamsFile(path string) (map[string]any, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("params file: %w", err)
+	}
+	params := map[string]any{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(content, &params)
+	} else {
+		err = yaml.Unmarshal(content, &params)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("params file %s: %w", path, err)
+	}
+	return params, nil
+}
+
+// ResolveParams applies the defaults and the types declared in the frontmatter
+// to etlx.Params, a required param without a value is an error
+func (etlx *ETLX) ResolveParams() error {
+	frontmatter, _ := etlx.Config["__frontmatter"].(map[string]any)
+	specs, err := ParamSpecsFrom(frontmatter["params"])
+	if err != nil {
+		return err
+	}
+	if etlx.Params == nil {
+		etlx.Params = map[string]any{}
+	}
+	missing, errs := resolveParams(etlx.Params, specs)
+	if len(missing) > 0 {
+		errs = append([]error{fmt.Errorf("missing required params: %s (-param name=value)", strings.Join(missing, ", "))}, errs...)
+	}
+	return errors.Join(errs...)
+}
+
+// resolveParams applies the specs to params, returns the required ones
+// without a value and the invalid ones
+func resolveParams(params map[string]any, specs []ParamSpec) ([]string, []error) {
+	missing := []string{}
+	errs := []error{}
+	for _, spec := range specs {
+		v, ok := params[spec.Name]
+		if !ok || v == nil || v == "" {
+			if spec.Default == nil {
+				if spec.Required {
+					missing = append(missing, spec.Name)
+				}
+				continue
+			}
+			v = spec.Default
+		}
+		_v, err := spec.Coerce(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("param %s: %w", spec.Name, err))
+			continue
+		}
+		params[spec.Name] = _v
+	}
+	return missing, errs
+}
+
+var paramPlaceholderRe = regexp.MustCompile(`@PARAM\.(\w+)`)
+
+// ReplaceParams replaces the @PARAM.name placeholders with the value of the
+// params, the unknown ones are left as they are. In a hook the @HOOK.field
+// ones are replaced too
+func (etlx *ETLX) ReplaceParams(input string) string {
+	input = etlx.hook.replace(input)
+	if len(etlx.Params) == 0 || !strings.Contains(input, "@PARAM.") {
+		return input
+	}
+	return paramPlaceholderRe.ReplaceAllStringFunc(input, func(match string) string {
+		v, ok := etlx.Params[strings.TrimPrefix(match, "@PARAM.")]
+		if !ok || v == nil {
+			return match
+		}
+		return formatParam(v)
+	})
+}
+
+// formatParam is the text of a param in a query, a path or a template
+func formatParam(v any) string {
+	switch _v := v.(type) {
+	case time.Time:
+		if _v.Hour() == 0 && _v.Minute() == 0 && _v.Second() == 0 && _v.Nanosecond() == 0 {
+			return _v.Format("2006-01-02")
+		}
+		return _v.Format(time.RFC3339)
+	case []any:
+		items := []string{}
+		for _, item := range _v {
+			items = append(items, formatParam(item))
+		}
+		return strings.Join(items, ",")
+	case float64:
+		return strconv.FormatFloat(_v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// templateData adds the params to the data of a template, as .params, and
+// in a hook the section that triggered it, as .hook
+func (etlx *ETLX) templateData(data map[string]any) map[string]any {
+	_, hasParams := data["params"]
+	_, hasHook := data["hook"]
+	addParams := !hasParams && len(etlx.Params) > 0
+	addHook := !hasHook && etlx.hook != nil
+	if !addParams && !addHook {
+		return data
+	}
+	_data := make(map[string]any, len(data)+2)
+	for k, v := range data {
+		_data[k] = v
+	}
+	if addParams {
+		_data["params"] = etlx.Params
+	}
+	if addHook {
+		_data["hook"] = etlx.hook.templateData()
+	}
+	return _data
+}
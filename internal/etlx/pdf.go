@@ -32,7 +32,7 @@ func (etlx *ETLX) GenPDFFromHTML(html, output_path string) error {
 	}
 	temptex.Close()
 	var pdf []byte
-	fmt.Println(html)
+	etlx.logger().Debug("generating the PDF from HTML", "output", output_path, "bytes", len(html))
 	err = chromedp.Run(ctx,
 		chromedp.Navigate(fmt.Sprintf("file://%s", temptex.Name())),
 		chromedp.ActionFunc(func(ctx context.Context) error {
@@ -78,7 +78,7 @@ func (etlx *ETLX) GenPDFFromLatex(latex, output_path string) error {
 	//err = cmd.Run()
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		fmt.Println("GenPDFFromLatex Err:", string(output), err)
+		etlx.logger().Debug("pdflatex failed", "output", string(output), "err", err)
 		return fmt.Errorf("%s: %s", err.Error(), string(output))
 	}
 	return nil
@@ -0,0 +1,381 @@
+package etlxlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/secrets"
+)
+
+// PlanQuery is a query of a plan step with its final SQL
+type PlanQuery struct {
+	Role    string `json:"role"`
+	Ref     string `json:"ref"`
+	SQL     string `json:"sql"`
+	Dynamic bool   `json:"dynamic,omitempty"`
+}
+
+// PlanStep is a key / item / step that would run, with its connection (as
+// configured, env vars are not resolved) and SQL, the secrets resolved in the
+// SQL (@VAR / $VAR, the ATTACH strings ...) are masked as in the logs
+type PlanStep struct {
+	Key        string      `json:"key"`
+	Item       string      `json:"item,omitempty"`
+	Step       string      `json:"step,omitempty"`
+	RunsAs     string      `json:"runs_as"`
+	Connection string      `json:"connection,omitempty"`
+	Note       string      `json:"note,omitempty"`
+	Queries    []PlanQuery `json:"queries,omitempty"`
+}
+
+// Plan is what a run would execute, built without opening any connection
+type Plan struct {
+	DateRef string     `json:"date_ref"`
+	Steps   []PlanStep `json:"steps"`
+}
+
+var planDynQueryRe = regexp.MustCompile(`get_dyn_queries\[(.*?)\]`)
+
+// planSQLOrder puts the setup first and the error handlers and cleanup last
+func planSQLOrder(field string) int {
+	switch {
+	case field == "condition":
+		return 0
+	case field == "before_sql":
+		return 1
+	case strings.Contains(field, "on_err"):
+		return 4
+	case field == "after_sql":
+		return 3
+	default:
+		return 2
+	}
+}
+
+// planQueries resolves a query reference (a string or a list) like ExecuteQuery
+func (etlx *ETLX) planQueries(role string, sqlData any, item map[string]any, dateRef []time.Time) []PlanQuery {
+	table := ""
+	if metadata, ok := item["metadata"].(map[string]any); ok {
+		table, _ = metadata["table"].(string)
+		if table == "" {
+			table, _ = metadata["name"].(string)
+		}
+	}
+	fname := etlx.SetQueryPlaceholders(fmt.Sprintf(`%s/%s_{YYYYMMDD}.csv`, os.TempDir(), table), table, "", dateRef)
+	refs := []string{}
+	switch _sqlData := sqlData.(type) {
+	case string:
+		refs = append(refs, _sqlData)
+	case []any:
+		for _, q := range _sqlData {
+			if _q, ok := q.(string); ok {
+				refs = append(refs, _q)
+			}
+		}
+	}
+	queries := []PlanQuery{}
+	for _, ref := range refs {
+		if match := planDynQueryRe.FindStringSubmatch(ref); len(match) > 1 {
+			// THE QUERIES ARE GENERATED AT RUNTIME, ONLY THE GENERATOR IS KNOWN
+			queries = append(queries, PlanQuery{Role: role, Ref: ref, SQL: etlx.resolveQuery(match[1], item, table, fname, dateRef), Dynamic: true})
+			continue
+		}
+		queries = append(queries, PlanQuery{Role: role, Ref: ref, SQL: etlx.resolveQuery(ref, item, table, fname, dateRef)})
+	}
+	return queries
+}
+
+// planDateRef applies the `date_ref` of the metadata, as the runners do
+func planDateRef(metadata map[string]any, dateRef []time.Time) []time.Time {
+	if dtRef, ok := metadata["date_ref"].(string); ok && dtRef != "" {
+		if _dt, err := time.Parse("2006-01-02", dtRef); err == nil {
+			return []time.Time{_dt}
+		}
+	}
+	return dateRef
+}
+
+// firstOf returns the first field of the metadata that is set
+func firstOf(metadata map[string]any, fields ...string) (any, bool) {
+	for _, field := range fields {
+		if v, ok := metadata[field]; ok && v != nil {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// Plan walks the config as RunETLX would, in the depends_on order and with
+// the same only / skip / steps / clean / drop / rows options, and returns each
+// key / item / step with its connection and final SQL, nothing is executed
+func (etlx *ETLX) Plan(extraConf map[string]any, dateRef []time.Time) (*Plan, error) {
+	if err := etlx.ResolveParams(); err != nil {
+		return nil, err
+	}
+	plan := &Plan{Steps: []PlanStep{}}
+	if len(dateRef) > 0 {
+		plan.DateRef = dateRef[0].Format("2006-01-02")
+	}
+	dryRun := etlx.DryRun
+	etlx.DryRun = true
+	defer func() { etlx.DryRun = dryRun }()
+	order := []string{}
+	if _order, ok := etlx.Config["__order"].([]any); ok {
+		for _, key := range _order {
+			order = append(order, fmt.Sprintf("%v", key))
+		}
+	}
+	etlx.restoreForEach()
+	dag, err := etlx.BuildDAG(order)
+	if err != nil {
+		return nil, err
+	}
+	parentDag := etlx.dag
+	etlx.dag = dag
+	defer func() { etlx.dag = parentDag }()
+	only, _ := extraConf["only"].([]string)
+	skip, _ := extraConf["skip"].([]string)
+	steps, _ := extraConf["steps"].([]string)
+	onlyKeys, okOnlyKeys := extraConf["keys"].([]string)
+	hookOf := map[string][]string{}
+	for _, key := range dag.keys {
+		for _, field := range []string{"on_success", "on_failure"} {
+			for _, hook := range etlx.sectionHooks(key, field) {
+				hookOf[hook] = append(hookOf[hook], fmt.Sprintf("%s %s", key, field))
+			}
+		}
+	}
+	for _, key := range dag.keys {
+		data, ok := etlx.Config[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		metadata, ok := data["metadata"].(map[string]any)
+		if !ok {
+			continue
+		}
+		runsAs, ok := metadata["runs_as"].(string)
+		if !ok {
+			runsAs = strings.ToUpper(key)
+		}
+		if okOnlyKeys && !etlx.Contains(onlyKeys, key) {
+			continue
+		}
+		mainConn, _ := metadata["connection"].(string)
+		if mainConn == "" {
+			mainConn = "duckdb:"
+		}
+		if active, ok := metadata["active"].(bool); ok && !active {
+			plan.Steps = append(plan.Steps, PlanStep{Key: key, RunsAs: runsAs, Note: "Deactivated"})
+			continue
+		}
+		if len(hookOf[key]) > 0 {
+			plan.Steps = append(plan.Steps, PlanStep{Key: key, RunsAs: runsAs, Note: fmt.Sprintf("Hook, only runs on %s", strings.Join(hookOf[key], ", "))})
+		}
+		keyDateRef := planDateRef(metadata, dateRef)
+		keyStep := PlanStep{Key: key, RunsAs: runsAs, Connection: mainConn, Queries: []PlanQuery{}}
+		for _, field := range []string{"before_sql", "after_sql"} {
+			if v, ok := metadata[field]; ok && v != nil {
+				keyStep.Queries = append(keyStep.Queries, etlx.planQueries(field, v, data, keyDateRef)...)
+			}
+		}
+		switch runsAs {
+		case "ETL", "ELT", "SCRIPTS", "MODEL_SQL", "EXPORTS", "DATA_QUALITY", "DATAQUALITY", "QUALITY", "MULTI_QUERIES", "STACKED_QUERIES", "NOTIFY", "NOTIFICATION", "LOGS", "OBSERVABILITY", "ACTIONS":
+		default:
+			keyStep.Note = fmt.Sprintf("%s items are not expanded in the plan", runsAs)
+			plan.Steps = append(plan.Steps, keyStep)
+			continue
+		}
+		if len(keyStep.Queries) > 0 {
+			plan.Steps = append(plan.Steps, keyStep)
+		}
+		// THE for_each LISTS ARE EXPANDED, THE QUERIES ONLY RUN WITH THE KEY
+		for _, _log := range etlx.expandForEach(key, keyDateRef) {
+			if success, _ := _log["success"].(bool); !success {
+				itemKey, _ := _log["item_key"].(string)
+				plan.Steps = append(plan.Steps, PlanStep{Key: key, Item: itemKey, RunsAs: runsAs, Note: fmt.Sprint(_log["msg"])})
+			}
+		}
+		items := dag.itemOrder(key)
+		if items == nil {
+			items = mdKeyItems(data)
+		}
+		for _, itemKey := range items {
+			item, ok := data[itemKey].(map[string]any)
+			if !ok {
+				continue
+			}
+			itemMetadata, ok := item["metadata"].(map[string]any)
+			if !ok {
+				continue
+			}
+			if active, ok := itemMetadata["active"].(bool); ok && !active {
+				plan.Steps = append(plan.Steps, PlanStep{Key: key, Item: itemKey, RunsAs: runsAs, Note: "Deactivated"})
+				continue
+			}
+			if (len(only) > 0 && !etlx.matchesItem(only, itemKey, itemMetadata)) || (len(skip) > 0 && etlx.matchesItem(skip, itemKey, itemMetadata)) {
+				continue
+			}
+			if forEach, ok := itemMetadata["for_each"]; ok && forEach != nil {
+				plan.Steps = append(plan.Steps, PlanStep{Key: key, Item: itemKey, RunsAs: runsAs, Note: "for_each query, the items are expanded when the key runs"})
+				continue
+			}
+			itemDateRef := planDateRef(itemMetadata, keyDateRef)
+			switch runsAs {
+			case "ETL", "ELT":
+				plan.Steps = append(plan.Steps, etlx.planETLItem(key, itemKey, runsAs, mainConn, item, itemMetadata, steps, extraConf, itemDateRef)...)
+			case "ACTIONS":
+				_type, _ := itemMetadata["type"].(string)
+				plan.Steps = append(plan.Steps, PlanStep{Key: key, Item: itemKey, RunsAs: runsAs, Note: fmt.Sprintf("action %s", _type)})
+			default:
+				plan.Steps = append(plan.Steps, etlx.planItem(key, itemKey, runsAs, mainConn, item, itemMetadata, itemDateRef))
+			}
+		}
+	}
+	plan.mask()
+	return plan, nil
+}
+
+// mask hides the secrets the SQL was resolved with
+func (plan *Plan) mask() {
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		step.Connection = secrets.Mask(step.Connection)
+		step.Note = secrets.Mask(step.Note)
+		for j := range step.Queries {
+			step.Queries[j].Ref = secrets.Mask(step.Queries[j].Ref)
+			step.Queries[j].SQL = secrets.Mask(step.Queries[j].SQL)
+		}
+	}
+}
+
+// planETLItem plans the extract, transform and load steps of an ETL item
+func (etlx *ETLX) planETLItem(key string, itemKey string, runsAs string, mainConn string, item map[string]any, itemMetadata map[string]any, steps []string, extraConf map[string]any, dateRef []time.Time) []PlanStep {
+	planSteps := []PlanStep{}
+	for _, step := range []string{"extract", "transform", "load"} {
+		if len(steps) > 0 && !etlx.Contains(steps, step) {
+			continue
+		}
+		mainSQL, okMain := firstOf(itemMetadata, step+"_sql", step, step+"_query", step+"_main")
+		if !okMain {
+			continue
+		}
+		conn, _ := itemMetadata[step+"_conn"].(string)
+		if conn == "" {
+			conn = mainConn
+		}
+		planStep := PlanStep{Key: key, Item: itemKey, Step: step, RunsAs: runsAs, Connection: conn, Queries: []PlanQuery{}}
+		if before, ok := firstOf(itemMetadata, step+"_before_sql", step+"_before", step+"_start", step+"_startup", step+"_setup"); ok {
+			planStep.Queries = append(planStep.Queries, etlx.planQueries("before", before, item, dateRef)...)
+		}
+		if step == "load" {
+			if clean, _ := extraConf["clean"].(bool); clean {
+				cleanSQL, ok := itemMetadata["clean_sql"]
+				if !ok {
+					cleanSQL = `DELETE FROM "<table>"`
+				}
+				planStep.Queries = append(planStep.Queries, etlx.planQueries("clean", cleanSQL, item, dateRef)...)
+			}
+			if drop, _ := extraConf["drop"].(bool); drop {
+				dropSQL, ok := itemMetadata["drop_sql"]
+				if !ok {
+					dropSQL = `DROP TABLE "<table>"`
+				}
+				planStep.Queries = append(planStep.Queries, etlx.planQueries("drop", dropSQL, item, dateRef)...)
+			}
+			if rows, _ := extraConf["rows"].(bool); rows {
+				rowsSQL, ok := itemMetadata["rows_sql"]
+				if !ok {
+					rowsSQL = `SELECT COUNT(*) AS "nrows" FROM "<table>"`
+				}
+				planStep.Queries = append(planStep.Queries, etlx.planQueries("rows", rowsSQL, item, dateRef)...)
+			}
+		}
+		planStep.Queries = append(planStep.Queries, etlx.planQueries("main", mainSQL, item, dateRef)...)
+		if after, ok := firstOf(itemMetadata, step+"_after_sql", step+"_after", step+"_end", step+"_cleanup"); ok {
+			planStep.Queries = append(planStep.Queries, etlx.planQueries("after", after, item, dateRef)...)
+		}
+		for _, field := range []string{step + "_on_err_match_sql", step + "_before_on_err_match_sql", step + "_after_on_err_match_sql"} {
+			if v, ok := itemMetadata[field]; ok && v != nil {
+				planStep.Queries = append(planStep.Queries, etlx.planQueries(field, v, item, dateRef)...)
+			}
+		}
+		planSteps = append(planSteps, planStep)
+	}
+	return planSteps
+}
+
+// planItem plans the items of the other runners, every *_sql field (and
+// query / fix_quality_err / condition) is a query
+func (etlx *ETLX) planItem(key string, itemKey string, runsAs string, mainConn string, item map[string]any, itemMetadata map[string]any, dateRef []time.Time) PlanStep {
+	conn, _ := itemMetadata["connection"].(string)
+	if conn == "" {
+		conn = mainConn
+	}
+	planStep := PlanStep{Key: key, Item: itemKey, RunsAs: runsAs, Connection: conn, Queries: []PlanQuery{}}
+	fields := []string{}
+	for field, v := range itemMetadata {
+		if v == nil {
+			continue
+		}
+		if strings.HasSuffix(field, "_sql") || field == "query" || field == "fix_quality_err" || field == "condition" {
+			fields = append(fields, field)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		if planSQLOrder(fields[i]) != planSQLOrder(fields[j]) {
+			return planSQLOrder(fields[i]) < planSQLOrder(fields[j])
+		}
+		return fields[i] < fields[j]
+	})
+	for _, field := range fields {
+		planStep.Queries = append(planStep.Queries, etlx.planQueries(field, itemMetadata[field], item, dateRef)...)
+	}
+	return planStep
+}
+
+// JSON returns the plan as indented JSON
+func (plan *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(plan, "", "  ")
+}
+
+// Markdown returns the plan as a markdown document
+func (plan *Plan) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Plan (date ref %s)\n\n", plan.DateRef))
+	for _, step := range plan.Steps {
+		title := step.Key
+		if step.Item != "" {
+			title += " -> " + step.Item
+		}
+		if step.Step != "" {
+			title += " -> " + step.Step
+		}
+		sb.WriteString(fmt.Sprintf("## %s\n\n", title))
+		sb.WriteString(fmt.Sprintf("- runs_as: `%s`\n", step.RunsAs))
+		if step.Connection != "" {
+			sb.WriteString(fmt.Sprintf("- connection: `%s`\n", step.Connection))
+		}
+		if step.Note != "" {
+			sb.WriteString(fmt.Sprintf("- note: %s\n", step.Note))
+		}
+		sb.WriteString("\n")
+		for _, query := range step.Queries {
+			label := query.Role
+			// THE NAME OF THE QUERY, NOT INLINE SQL
+			if query.Ref != "" && !strings.ContainsAny(query.Ref, " \t\n") {
+				label += fmt.Sprintf(" (`%s`)", query.Ref)
+			}
+			if query.Dynamic {
+				label += ", generates the queries at runtime"
+			}
+			sb.WriteString(fmt.Sprintf("%s:\n\n```sql\n%s\n```\n\n", label, strings.TrimSpace(query.SQL)))
+		}
+	}
+	return sb.String()
+}
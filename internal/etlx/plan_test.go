@@ -0,0 +1,60 @@
+package etlxlib
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/secrets"
+)
+
+// planMD attaches a database with a DSN from the env and uses a token from a
+// secrets dir and a literal registered as a secret
+const planMD = "# ETL\n\n" +
+	"```yaml metadata\nname: ETL\ndescription: plan test\nruns_as: ETL\nconnection: \"duckdb:\"\nactive: true\n```\n\n" +
+	"## orders\n\n" +
+	"```yaml metadata\nname: orders\ndescription: loads the orders\ntable: orders\n" +
+	"load_before_sql: \"ATTACH '@ENV.PLAN_TEST_DSN' AS pg (TYPE postgres)\"\n" +
+	"extract_sql: extract_orders\nload_sql: \"CREATE TABLE orders AS SELECT * FROM pg.orders\"\nactive: true\n```\n\n" +
+	"```sql\n-- extract_orders\nSELECT * FROM read_json('https://api/orders?token=$PLAN_TOKEN&key=plan-registered-secret')\n```\n"
+
+func TestPlanMasksSecrets(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "PLAN_TOKEN"), []byte("plan-dir-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PLAN_TEST_DSN", "postgres://etl:plan-dsn-pass@db:5432/sales")
+	secrets.Register("plan-registered-secret")
+	etlx := &ETLX{
+		TimeZone: time.UTC,
+		Secrets:  secrets.NewResolver().Add(secrets.Env{}, false).Add(&secrets.Dir{Path: dir}, true),
+	}
+	if err := etlx.ConfigFromMDText(planMD); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := etlx.Plan(map[string]any{}, []time.Time{time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := plan.Markdown()
+	js, err := plan.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"plan-dsn-pass", "plan-dir-token", "plan-registered-secret"} {
+		if strings.Contains(md, secret) {
+			t.Errorf("the markdown plan has %q:\n%s", secret, md)
+		}
+		if strings.Contains(string(js), secret) {
+			t.Errorf("the json plan has %q", secret)
+		}
+	}
+	// RESOLVED, NOT LEFT AS REFERENCES
+	for _, want := range []string{"postgres://etl:****@db:5432/sales", "token=****&key=****"} {
+		if !strings.Contains(md, want) {
+			t.Errorf("the markdown plan has no %q:\n%s", want, md)
+		}
+	}
+}
@@ -0,0 +1,460 @@
+package etlxlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the buckets (seconds) of the duration histograms,
+// from a second to a couple of hours for batch runs
+var DefaultDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200}
+
+// RunMetrics aggregates the process logs of the runs into Prometheus metrics,
+// per run and per Level 1 key:
+//
+//	etlx_runs_total{status}                       success / failure
+//	etlx_run_duration_seconds                     histogram
+//	etlx_last_run_timestamp_seconds, etlx_last_run_success, etlx_last_success_timestamp_seconds
+//	etlx_key_runs_total{key,status}               success / failure / skipped
+//	etlx_key_duration_seconds{key}                histogram
+//	etlx_key_last_success_timestamp_seconds{key}
+//	etlx_key_rows_total{key}                      rows of the steps that report them
+//
+// it is an http.Handler serving them in the text exposition format
+type RunMetrics struct {
+	// Buckets of the duration histograms, DefaultDurationBuckets when empty
+	Buckets        []float64
+	mu             sync.Mutex
+	runs           map[string]float64
+	runDuration    *histogram
+	lastRun        time.Time
+	lastRunSuccess bool
+	lastSuccess    time.Time
+	keys           map[string]*keyMetrics
+}
+
+type keyMetrics struct {
+	runs        map[string]float64
+	duration    *histogram
+	lastSuccess time.Time
+	rows        float64
+	hasRows     bool
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewRunMetrics creates an empty set of metrics
+func NewRunMetrics() *RunMetrics {
+	return &RunMetrics{runs: map[string]float64{}, keys: map[string]*keyMetrics{}}
+}
+
+func (m *RunMetrics) newHistogram() *histogram {
+	buckets := m.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// Observe adds a run that started at start, from its process logs and the
+// data of RunETLX (the keys that failed without logs), data can be nil
+func (m *RunMetrics) Observe(logs []map[string]any, data map[string]any, start time.Time, err error) {
+	end := time.Now()
+	keys := map[string][]map[string]any{}
+	order := []string{}
+	for _, _log := range logs {
+		key, _ := _log["key"].(string)
+		if key == "" {
+			continue
+		}
+		if _, ok := keys[key]; !ok {
+			order = append(order, key)
+		}
+		keys[key] = append(keys[key], _log)
+	}
+	failed := map[string]bool{}
+	for key, _data := range data {
+		_data, _ := _data.(map[string]any)
+		success, _ := _data["success"].(bool)
+		skipped, _ := _data["skipped"].(bool)
+		if success || skipped {
+			continue
+		}
+		failed[key] = true
+		if _, ok := keys[key]; !ok {
+			keys[key] = nil
+			order = append(order, key)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.runs == nil {
+		m.runs = map[string]float64{}
+		m.keys = map[string]*keyMetrics{}
+	}
+	success := err == nil
+	for _, key := range order {
+		status, duration, endAt, rows, hasRows := keyOutcome(keys[key])
+		if failed[key] {
+			status = "failure"
+		}
+		km, ok := m.keys[key]
+		if !ok {
+			km = &keyMetrics{runs: map[string]float64{}, duration: m.newHistogram()}
+			m.keys[key] = km
+		}
+		km.runs[status]++
+		if status != "skipped" && len(keys[key]) > 0 {
+			km.duration.observe(duration)
+		}
+		if status == "success" {
+			km.lastSuccess = endAt
+		} else {
+			success = false
+		}
+		if hasRows {
+			km.rows += rows
+			km.hasRows = true
+		}
+	}
+	if m.runDuration == nil {
+		m.runDuration = m.newHistogram()
+	}
+	m.runDuration.observe(end.Sub(start).Seconds())
+	m.lastRun = end
+	m.lastRunSuccess = success
+	if success {
+		m.runs["success"]++
+		m.lastSuccess = end
+	} else {
+		m.runs["failure"]++
+	}
+}
+
+// keyOutcome is the status, duration (s), end and rows of a key from its logs
+func keyOutcome(logs []map[string]any) (string, float64, time.Time, float64, bool) {
+	status := "success"
+	var start, end time.Time
+	duration := -1.0
+	rows, hasRows := 0.0, false
+	keyRows, hasKeyRows := 0.0, false
+	for _, _log := range logs {
+		if retrying, _ := _log["retrying"].(bool); retrying {
+			continue
+		}
+		itemKey, _ := _log["item_key"].(string)
+		if skipped, _ := _log["skipped"].(bool); skipped && itemKey == "" {
+			status = "skipped"
+		} else if success, ok := _log["success"].(bool); ok && !success && status != "skipped" {
+			status = "failure"
+		}
+		if t, ok := _log["start_at"].(time.Time); ok && (start.IsZero() || t.Before(start)) {
+			start = t
+		}
+		if t, ok := _log["end_at"].(time.Time); ok && t.After(end) {
+			end = t
+		}
+		if itemKey == "" {
+			// THE KEY ENTRY HAS THE DURATION OF THE WHOLE KEY
+			if d, ok := _log["duration"].(float64); ok && d > duration {
+				duration = d
+			}
+		}
+		if v, ok := entryRows(_log["rows"]); ok {
+			if itemKey == "" {
+				keyRows, hasKeyRows = keyRows+float64(v), true
+			} else {
+				rows, hasRows = rows+float64(v), true
+			}
+		}
+	}
+	if duration < 0 {
+		duration = math.Max(end.Sub(start).Seconds(), 0)
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if !hasRows {
+		rows, hasRows = keyRows, hasKeyRows
+	}
+	return status, duration, end, rows, hasRows
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *RunMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := &bytes.Buffer{}
+	writeHeader(b, "etlx_runs_total", "counter", "Runs by status")
+	for _, status := range []string{"success", "failure"} {
+		writeSample(b, "etlx_runs_total", [][2]string{{"status", status}}, m.runs[status])
+	}
+	if m.runDuration != nil {
+		writeHeader(b, "etlx_run_duration_seconds", "histogram", "Duration of the runs")
+		writeHistogram(b, "etlx_run_duration_seconds", nil, m.runDuration)
+	}
+	if !m.lastRun.IsZero() {
+		writeHeader(b, "etlx_last_run_timestamp_seconds", "gauge", "End of the last run")
+		writeSample(b, "etlx_last_run_timestamp_seconds", nil, unixSeconds(m.lastRun))
+		writeHeader(b, "etlx_last_run_success", "gauge", "1 when the last run succeeded")
+		writeSample(b, "etlx_last_run_success", nil, boolFloat(m.lastRunSuccess))
+	}
+	if !m.lastSuccess.IsZero() {
+		writeHeader(b, "etlx_last_success_timestamp_seconds", "gauge", "End of the last successful run")
+		writeSample(b, "etlx_last_success_timestamp_seconds", nil, unixSeconds(m.lastSuccess))
+	}
+	keys := make([]string, 0, len(m.keys))
+	for key := range m.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		writeHeader(b, "etlx_key_runs_total", "counter", "Runs of the Level 1 keys by status")
+		for _, key := range keys {
+			for _, status := range []string{"success", "failure", "skipped"} {
+				if v, ok := m.keys[key].runs[status]; ok {
+					writeSample(b, "etlx_key_runs_total", [][2]string{{"key", key}, {"status", status}}, v)
+				}
+			}
+		}
+		writeHeader(b, "etlx_key_duration_seconds", "histogram", "Duration of the Level 1 keys")
+		for _, key := range keys {
+			writeHistogram(b, "etlx_key_duration_seconds", [][2]string{{"key", key}}, m.keys[key].duration)
+		}
+		header := false
+		for _, key := range keys {
+			if m.keys[key].lastSuccess.IsZero() {
+				continue
+			}
+			if !header {
+				writeHeader(b, "etlx_key_last_success_timestamp_seconds", "gauge", "End of the last successful run of the Level 1 keys")
+				header = true
+			}
+			writeSample(b, "etlx_key_last_success_timestamp_seconds", [][2]string{{"key", key}}, unixSeconds(m.keys[key].lastSuccess))
+		}
+		header = false
+		for _, key := range keys {
+			if !m.keys[key].hasRows {
+				continue
+			}
+			if !header {
+				writeHeader(b, "etlx_key_rows_total", "counter", "Rows processed by the Level 1 keys")
+				header = true
+			}
+			writeSample(b, "etlx_key_rows_total", [][2]string{{"key", key}}, m.keys[key].rows)
+		}
+	}
+	return b.WriteTo(w)
+}
+
+// ServeHTTP serves the metrics, e.g. as GET /metrics
+func (m *RunMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		Logger().Warn("writing the metrics failed", "err", err)
+	}
+}
+
+// Push sends the metrics to a Pushgateway, under the job and labels grouping
+// key. They are POSTed, so the metrics not in this push (e.g. the last success
+// of a key that failed this time) keep their previous value
+func (m *RunMetrics) Push(ctx context.Context, gateway string, job string, labels map[string]string) error {
+	if job == "" {
+		job = "etlx"
+	}
+	u, err := url.Parse(strings.TrimSuffix(gateway, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid pushgateway url %q", gateway)
+	}
+	path := u.Path
+	if !strings.Contains(path, "/metrics/job/") {
+		path += "/metrics/" + groupingPath("job", job)
+		names := make([]string, 0, len(labels))
+		for name := range labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			path += "/" + groupingPath(name, labels[name])
+		}
+	}
+	u.Path, u.RawPath = "", ""
+	body := &bytes.Buffer{}
+	if _, err := m.WriteTo(body); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String()+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushing the metrics: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("pushing the metrics: %s %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// groupingPath is a label of the grouping key, base64 encoded when the value
+// has a / or is empty
+func groupingPath(name string, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// PushConfig is the `prometheus` of the frontmatter:
+//
+//	---
+//	prometheus:
+//	  pushgateway: http://pushgateway:9091
+//	  job: nightly
+//	  labels:
+//	    env: prod
+//	---
+type PushConfig struct {
+	Pushgateway string
+	Job         string
+	Labels      map[string]string
+}
+
+// PushConfigFrom reads the `prometheus` of the frontmatter, the Pushgateway
+// defaults to ETLX_PUSHGATEWAY_URL
+func PushConfigFrom(value any) (PushConfig, error) {
+	conf := PushConfig{Pushgateway: os.Getenv("ETLX_PUSHGATEWAY_URL"), Job: "etlx", Labels: map[string]string{}}
+	switch v := value.(type) {
+	case nil:
+	case map[string]any:
+		if gateway, ok := v["pushgateway"].(string); ok && gateway != "" {
+			conf.Pushgateway = gateway
+		}
+		if job, ok := v["job"].(string); ok && job != "" {
+			conf.Job = job
+		}
+		if labels, ok := v["labels"].(map[string]any); ok {
+			for name, value := range labels {
+				conf.Labels[name] = fmt.Sprintf("%v", value)
+			}
+		}
+	default:
+		return conf, fmt.Errorf("prometheus must be a map, got %T", value)
+	}
+	return conf, nil
+}
+
+// observeRunMetrics adds the run to the Metrics of the ETLX and pushes it to
+// the Pushgateway when there is one
+func (etlx *ETLX) observeRunMetrics(logs []map[string]any, data map[string]any, start time.Time, err error) {
+	if etlx.Metrics != nil {
+		etlx.Metrics.Observe(logs, data, start, err)
+	}
+	frontmatter, _ := etlx.Config["__frontmatter"].(map[string]any)
+	conf, _err := PushConfigFrom(frontmatter["prometheus"])
+	if etlx.Pushgateway != "" {
+		conf.Pushgateway = etlx.Pushgateway
+	}
+	if _err != nil {
+		etlx.logger("key", "prometheus").Warn("metrics not pushed", "err", _err)
+		return
+	}
+	if conf.Pushgateway == "" {
+		return
+	}
+	metrics := NewRunMetrics()
+	metrics.Observe(logs, data, start, err)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(etlx.Context()), 10*time.Second)
+	defer cancel()
+	gateway := etlx.EnvExpand(conf.Pushgateway)
+	if _err := metrics.Push(ctx, gateway, conf.Job, conf.Labels); _err != nil {
+		etlx.logger("key", "prometheus").Warn("metrics not pushed", "err", _err)
+		return
+	}
+	etlx.logger("key", "prometheus").Debug("metrics pushed", "job", conf.Job)
+}
+
+func writeHeader(b *bytes.Buffer, name string, kind string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(b *bytes.Buffer, name string, labels [][2]string, v float64) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, label[0], escapeLabel(label[1]))
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(v))
+	b.WriteByte('\n')
+}
+
+func writeHistogram(b *bytes.Buffer, name string, labels [][2]string, h *histogram) {
+	for i, le := range h.buckets {
+		writeSample(b, name+"_bucket", append(append([][2]string{}, labels...), [2]string{"le", formatFloat(le)}), float64(h.counts[i]))
+	}
+	writeSample(b, name+"_bucket", append(append([][2]string{}, labels...), [2]string{"le", "+Inf"}), float64(h.count))
+	writeSample(b, name+"_sum", labels, h.sum)
+	writeSample(b, name+"_count", labels, float64(h.count))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
+
+func boolFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -62,11 +62,11 @@ func NewQueryDoc() *QueryDoc {
 // AddField adds a field to the main query parts map
 func (q *QueryDoc) AddField(f Field) {
 	if f.Name == "" {
-		fmt.Println("Field.Name is required")
+		Logger().Warn("QUERY_DOC field without name, ignored")
 		return
 	}
 	if f.Select == "" {
-		fmt.Println("Field.Select is required")
+		Logger().Warn("QUERY_DOC field without select, ignored", "field", f.Name)
 		return
 	}
 	q.QueryParts[f.Name] = f
@@ -412,7 +412,7 @@ func (q *QueryDoc) setQueryDate(query string, dateRef any) string {
 		patt2 := regexp.MustCompile(`'\{.*?\}'`)
 		for _, m := range matches {
 			if !hasPlaceholders(m) {
-				fmt.Printf(m, "Not a date format, so skip")
+				Logger().Debug("not a date placeholder, skipped", "placeholder", m)
 				continue
 			}
 			format := patt2.FindString(m)
@@ -443,7 +443,7 @@ func (q *QueryDoc) setQueryDate(query string, dateRef any) string {
 	if len(matches) > 0 {
 		for _, m := range matches {
 			if !hasPlaceholders(m) {
-				fmt.Printf(m, "Not a date format, so skip")
+				Logger().Debug("not a date placeholder, skipped", "placeholder", m)
 				continue
 			}
 			frmtFinal := getDtFmrt(m)
@@ -0,0 +1,514 @@
+package etlxlib
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RunError is the error of RunETLX when keys of the run failed, the keys
+// skipped because of a failed upstream are not listed
+type RunError struct {
+	Failed []string
+	// Critical are the keys with `critical: true` that did not succeed,
+	// skipped ones included
+	Critical []string
+}
+
+func (e *RunError) Error() string {
+	msg := fmt.Sprintf("%d key(s) failed: %s", len(e.Failed), strings.Join(e.Failed, ", "))
+	if len(e.Critical) > 0 {
+		msg += fmt.Sprintf(" (critical: %s)", strings.Join(e.Critical, ", "))
+	}
+	return msg
+}
+
+// runError is the RunError of the data of a run, nil when every key succeeded
+func (etlx *ETLX) runError(data map[string]any) error {
+	runErr := &RunError{Failed: []string{}, Critical: []string{}}
+	for _, key := range etlx.orderedKeys(data) {
+		_data, _ := data[key].(map[string]any)
+		success, _ := _data["success"].(bool)
+		if success {
+			continue
+		}
+		if skipped, _ := _data["skipped"].(bool); !skipped {
+			runErr.Failed = append(runErr.Failed, key)
+		}
+		if etlx.isCritical(key) {
+			runErr.Critical = append(runErr.Critical, key)
+		}
+	}
+	if len(runErr.Failed) == 0 && len(runErr.Critical) == 0 {
+		return nil
+	}
+	return runErr
+}
+
+// isCritical is the `critical` of the metadata of a Level 1 key
+func (etlx *ETLX) isCritical(key string) bool {
+	conf, _ := etlx.Config[key].(map[string]any)
+	metadata, _ := conf["metadata"].(map[string]any)
+	critical, _ := metadata["critical"].(bool)
+	return critical
+}
+
+// RunReport is the outcome of a run, every key with its items and steps
+type RunReport struct {
+	RunID    string      `json:"run_id,omitempty"`
+	DateRef  string      `json:"date_ref"`
+	StartAt  time.Time   `json:"start_at"`
+	EndAt    time.Time   `json:"end_at"`
+	Duration float64     `json:"duration"`
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Keys     []ReportKey `json:"keys"`
+	err      error
+}
+
+// ReportKey is a Level 1 key of a RunReport, Steps are the ones of the key
+// itself (e.g. before_sql)
+type ReportKey struct {
+	Key      string       `json:"key"`
+	RunsAs   string       `json:"runs_as,omitempty"`
+	Critical bool         `json:"critical,omitempty"`
+	Status   string       `json:"status"`
+	Duration float64      `json:"duration"`
+	Rows     *int64       `json:"rows,omitempty"`
+	Msg      string       `json:"msg,omitempty"`
+	Steps    []ReportStep `json:"steps,omitempty"`
+	Items    []ReportItem `json:"items,omitempty"`
+}
+
+// ReportItem is an item (Level 2) of a key
+type ReportItem struct {
+	Item     string       `json:"item"`
+	Status   string       `json:"status"`
+	Duration float64      `json:"duration"`
+	Rows     *int64       `json:"rows,omitempty"`
+	Msg      string       `json:"msg,omitempty"`
+	Steps    []ReportStep `json:"steps"`
+}
+
+// ReportStep is a process log entry of a key or an item
+type ReportStep struct {
+	Step     string  `json:"step"`
+	Status   string  `json:"status"`
+	Duration float64 `json:"duration"`
+	Rows     *int64  `json:"rows,omitempty"`
+	Msg      string  `json:"msg,omitempty"`
+}
+
+// NewRunReport builds the report of a run from what RunETLX returned
+func (etlx *ETLX) NewRunReport(dateRef []time.Time, start time.Time, end time.Time, logs []map[string]any, data map[string]any, err error) *RunReport {
+	report := &RunReport{
+		RunID:    etlx.RunID,
+		StartAt:  start,
+		EndAt:    end,
+		Duration: end.Sub(start).Seconds(),
+		Status:   "success",
+		Keys:     []ReportKey{},
+		err:      err,
+	}
+	if len(dateRef) > 0 {
+		report.DateRef = dateRef[0].Format("2006-01-02")
+	}
+	if err != nil {
+		report.Status = "failure"
+		report.Error = err.Error()
+	}
+	byKey := map[string][]map[string]any{}
+	order := etlx.orderedKeys(data)
+	for _, _log := range logs {
+		key, _ := _log["key"].(string)
+		if key == "" {
+			continue
+		}
+		if _, ok := byKey[key]; !ok && data[key] == nil {
+			order = append(order, key)
+		}
+		byKey[key] = append(byKey[key], _log)
+	}
+	for _, key := range order {
+		rk := reportKey(key, byKey[key])
+		rk.Critical = etlx.isCritical(key)
+		if _data, ok := data[key].(map[string]any); ok {
+			rk.RunsAs = fmt.Sprintf("%v", _data["runs_as"])
+			success, _ := _data["success"].(bool)
+			skipped, _ := _data["skipped"].(bool)
+			switch {
+			case skipped:
+				rk.Status = "skipped"
+			case !success:
+				rk.Status = "failure"
+			}
+			if msg, ok := _data["msg"].(string); ok && msg != "" {
+				rk.Msg = msg
+			}
+		}
+		if rk.Status == "failure" {
+			report.Status = "failure"
+		}
+		report.Keys = append(report.Keys, rk)
+	}
+	return report
+}
+
+// reportKey groups the logs of a key by item
+func reportKey(key string, logs []map[string]any) ReportKey {
+	rk := ReportKey{Key: key, Status: "success"}
+	items := map[string]*ReportItem{}
+	itemOrder := []string{}
+	var start, end time.Time
+	for _, _log := range logs {
+		if retrying, _ := _log["retrying"].(bool); retrying {
+			continue
+		}
+		if t, ok := _log["start_at"].(time.Time); ok && (start.IsZero() || t.Before(start)) {
+			start = t
+		}
+		if t, ok := _log["end_at"].(time.Time); ok && t.After(end) {
+			end = t
+		}
+		name, _ := _log["name"].(string)
+		itemKey, _ := _log["item_key"].(string)
+		duration, _ := _log["duration"].(float64)
+		_, hasSuccess := _log["success"].(bool)
+		skipped, _ := _log["skipped"].(bool)
+		if itemKey == "" {
+			if name == key && !hasSuccess && !skipped {
+				// THE KEY ENTRY, WITH THE DURATION OF THE WHOLE KEY
+				rk.Duration = duration
+				continue
+			}
+			step := reportStep(strings.TrimPrefix(name, key+"->"), _log)
+			if step.Status == "skipped" && name == key {
+				rk.Status = "skipped"
+				rk.Msg = step.Msg
+				continue
+			}
+			rk.Steps = append(rk.Steps, step)
+			continue
+		}
+		item, ok := items[itemKey]
+		if !ok {
+			item = &ReportItem{Item: itemKey, Status: "success", Steps: []ReportStep{}}
+			items[itemKey] = item
+			itemOrder = append(itemOrder, itemKey)
+		}
+		if !hasSuccess && !skipped {
+			// THE SUMMARY ENTRY OF THE ITEM
+			item.Duration = duration
+			continue
+		}
+		item.Steps = append(item.Steps, reportStep(strings.TrimPrefix(name, key+"->"+itemKey+"->"), _log))
+	}
+	if rk.Duration == 0 && !start.IsZero() {
+		rk.Duration = end.Sub(start).Seconds()
+	}
+	rk.Rows = sumRows(rk.Steps)
+	for _, itemKey := range itemOrder {
+		item := items[itemKey]
+		skipped := len(item.Steps) > 0
+		duration := 0.0
+		for _, step := range item.Steps {
+			switch step.Status {
+			case "failure":
+				item.Status = "failure"
+				if item.Msg == "" {
+					item.Msg = step.Msg
+				}
+			case "success":
+				skipped = false
+			}
+			duration += step.Duration
+		}
+		if item.Duration == 0 {
+			item.Duration = duration
+		}
+		if skipped && item.Status != "failure" {
+			item.Status = "skipped"
+		}
+		item.Rows = sumRows(item.Steps)
+		if item.Status == "failure" && rk.Status == "success" {
+			rk.Status = "failure"
+		}
+		if item.Rows != nil {
+			rows := *item.Rows
+			if rk.Rows != nil {
+				rows += *rk.Rows
+			}
+			rk.Rows = &rows
+		}
+		rk.Items = append(rk.Items, *item)
+	}
+	for _, step := range rk.Steps {
+		if step.Status == "failure" {
+			rk.Status = "failure"
+		}
+	}
+	return rk
+}
+
+func reportStep(name string, _log map[string]any) ReportStep {
+	step := ReportStep{Step: name, Status: "failure"}
+	step.Duration, _ = _log["duration"].(float64)
+	if skipped, _ := _log["skipped"].(bool); skipped {
+		step.Status = "skipped"
+	} else if success, _ := _log["success"].(bool); success {
+		step.Status = "success"
+	}
+	if rows, ok := entryRows(_log["rows"]); ok {
+		step.Rows = &rows
+	}
+	if step.Status != "success" {
+		step.Msg, _ = _log["msg"].(string)
+	}
+	return step
+}
+
+func sumRows(steps []ReportStep) *int64 {
+	var rows *int64
+	for _, step := range steps {
+		if step.Rows == nil {
+			continue
+		}
+		if rows == nil {
+			rows = new(int64)
+		}
+		*rows += *step.Rows
+	}
+	return rows
+}
+
+// Failed applies the exit policy to the run: any (a failed key or a run
+// error) or critical (a critical key that did not succeed, or a run error
+// that is not about the keys, e.g. a dependency cycle)
+func (r *RunReport) Failed(policy string) bool {
+	if policy != "critical" {
+		return r.Status != "success"
+	}
+	var runErr *RunError
+	if r.err != nil && !errors.As(r.err, &runErr) {
+		return true
+	}
+	for _, key := range r.Keys {
+		if key.Critical && key.Status != "success" {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary formats the keys of the run as a text table
+func (r *RunReport) Summary() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%-24s %-8s %10s %10s %7s  %s\n", "KEY", "STATUS", "DURATION", "ROWS", "ITEMS", "MSG"))
+	ok := 0
+	for _, key := range r.Keys {
+		rows := "-"
+		if key.Rows != nil {
+			rows = fmt.Sprintf("%d", *key.Rows)
+		}
+		itemsOk := 0
+		for _, item := range key.Items {
+			if item.Status == "success" {
+				itemsOk++
+			}
+		}
+		name := key.Key
+		if key.Critical {
+			name += " *"
+		}
+		if key.Status == "success" {
+			ok++
+		}
+		msg := key.Msg
+		for _, item := range key.Items {
+			if msg == "" && item.Status == "failure" {
+				msg = fmt.Sprintf("%s: %s", item.Item, item.Msg)
+			}
+		}
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg = msg[:i]
+		}
+		sb.WriteString(fmt.Sprintf("%-24s %-8s %10s %10s %7s  %s\n", name, strings.ToUpper(key.Status), formatSeconds(key.Duration), rows, fmt.Sprintf("%d/%d", itemsOk, len(key.Items)), msg))
+	}
+	sb.WriteString(fmt.Sprintf("%s %s: %d/%d keys succeeded in %s\n", r.DateRef, strings.ToUpper(r.Status), ok, len(r.Keys), formatSeconds(r.Duration)))
+	return sb.String()
+}
+
+func formatSeconds(s float64) string {
+	return time.Duration(s * float64(time.Second)).Round(time.Millisecond).String()
+}
+
+// ReportFormat is the format of a report file from its extension, json when
+// it is not .md or .xml
+func ReportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md":
+		return "md"
+	case ".xml":
+		return "junit"
+	}
+	return "json"
+}
+
+// WriteReport writes the reports of the runs (one per date reference) as
+// json, md or junit
+func WriteReport(w io.Writer, reports []*RunReport, format string) error {
+	switch format {
+	case "json":
+		var out any = reports
+		if len(reports) == 1 {
+			out = reports[0]
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "md":
+		for _, r := range reports {
+			if _, err := io.WriteString(w, r.Markdown()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "junit":
+		return writeJUnit(w, reports)
+	}
+	return fmt.Errorf("unknown report format %q (md, json or junit)", format)
+}
+
+// Markdown is the report as a md table of the steps
+func (r *RunReport) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Run %s\n\n", r.DateRef))
+	if r.RunID != "" {
+		sb.WriteString(fmt.Sprintf("- run_id: `%s`\n", r.RunID))
+	}
+	sb.WriteString(fmt.Sprintf("- status: **%s**\n- duration: %s\n", r.Status, formatSeconds(r.Duration)))
+	if r.Error != "" {
+		sb.WriteString(fmt.Sprintf("- error: %s\n", mdCell(r.Error)))
+	}
+	sb.WriteString("\n| Key | Item | Step | Status | Duration | Rows | Msg |\n|---|---|---|---|---|---|---|\n")
+	row := func(key, item, step, status string, duration float64, rows *int64, msg string) {
+		_rows := ""
+		if rows != nil {
+			_rows = fmt.Sprintf("%d", *rows)
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s | %s |\n", mdCell(key), mdCell(item), mdCell(step), status, formatSeconds(duration), _rows, mdCell(msg)))
+	}
+	for _, key := range r.Keys {
+		name := key.Key
+		if key.Critical {
+			name += " (critical)"
+		}
+		row(name, "", "", key.Status, key.Duration, key.Rows, key.Msg)
+		for _, step := range key.Steps {
+			row("", "", step.Step, step.Status, step.Duration, step.Rows, step.Msg)
+		}
+		for _, item := range key.Items {
+			row("", item.Item, "", item.Status, item.Duration, item.Rows, "")
+			for _, step := range item.Steps {
+				row("", "", step.Step, step.Status, step.Duration, step.Rows, step.Msg)
+			}
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func mdCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.Join(strings.Fields(s), " ")
+}
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Time     float64      `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// writeJUnit writes a testsuite per key (and date reference) with a testcase
+// per step, so CI tools show the failed steps
+func writeJUnit(w io.Writer, reports []*RunReport) error {
+	suites := junitSuites{}
+	for _, r := range reports {
+		for _, key := range r.Keys {
+			suite := junitSuite{Name: key.Key, Time: key.Duration, Timestamp: r.StartAt.Format(time.RFC3339)}
+			if len(reports) > 1 {
+				suite.Name = fmt.Sprintf("%s %s", r.DateRef, key.Key)
+			}
+			add := func(classname string, name string, status string, duration float64, msg string) {
+				c := junitCase{Name: name, Classname: classname, Time: duration}
+				switch status {
+				case "failure":
+					c.Failure = &junitMessage{Message: msg}
+					suite.Failures++
+				case "skipped":
+					c.Skipped = &junitMessage{Message: msg}
+					suite.Skipped++
+				}
+				suite.Cases = append(suite.Cases, c)
+				suite.Tests++
+			}
+			for _, step := range key.Steps {
+				add(key.Key, step.Step, step.Status, step.Duration, step.Msg)
+			}
+			for _, item := range key.Items {
+				for _, step := range item.Steps {
+					add(key.Key+"."+item.Item, step.Step, step.Status, step.Duration, step.Msg)
+				}
+			}
+			if suite.Tests == 0 {
+				// A KEY WITHOUT STEPS (E.G. A CONFIG ERROR) IS A CASE ITSELF
+				add(key.Key, key.Key, key.Status, key.Duration, key.Msg)
+			}
+			suites.Suites = append(suites.Suites, suite)
+			suites.Tests += suite.Tests
+			suites.Failures += suite.Failures
+			suites.Skipped += suite.Skipped
+			suites.Time += suite.Time
+		}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
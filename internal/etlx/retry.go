@@ -0,0 +1,184 @@
+package etlxlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// RetryPolicy holds the `retries`, `retry_delay`, `retry_backoff`,
+// `retry_on_err_patt` and `timeout` options of a key, overridden by the item
+// metadata, and where to log each failed attempt
+type RetryPolicy struct {
+	etlx    *ETLX
+	Retries int
+	Delay   time.Duration
+	Backoff float64
+	ErrPatt *regexp.Regexp
+	// Timeout of the whole item, counted from when the policy is built
+	Timeout  time.Duration
+	deadline time.Time
+	logs     *[]map[string]any
+	process  string
+	key      string
+	itemKey  string
+}
+
+// parseRetryDelay accepts a go duration (`500ms`, `1m`) or a number of seconds
+func parseRetryDelay(v any) (time.Duration, error) {
+	s := strings.TrimSpace(fmt.Sprintf("%v", v))
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// RetryPolicy builds the retry policy of an item, logs can be nil
+func (etlx *ETLX) RetryPolicy(logs *[]map[string]any, process string, key string, itemKey string, metadata map[string]any, itemMetadata map[string]any) *RetryPolicy {
+	r := &RetryPolicy{
+		etlx:    etlx,
+		Retries: 0,
+		Delay:   time.Second,
+		Backoff: 1,
+		logs:    logs,
+		process: process,
+		key:     key,
+		itemKey: itemKey,
+	}
+	for _, _metadata := range []map[string]any{metadata, itemMetadata} {
+		if _metadata == nil {
+			continue
+		}
+		if v, ok := _metadata["retries"]; ok {
+			if j, err := strconv.Atoi(fmt.Sprintf("%v", v)); err == nil && j >= 0 {
+				r.Retries = j
+			}
+		}
+		if v, ok := _metadata["retry_delay"]; ok {
+			if d, err := parseRetryDelay(v); err == nil {
+				r.Delay = d
+			} else {
+				etlx.logger("key", key, "item", itemKey).Warn("invalid retry_delay, ignored", "retry_delay", v, "err", err)
+			}
+		}
+		if v, ok := _metadata["retry_backoff"]; ok {
+			if f, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64); err == nil && f > 0 {
+				r.Backoff = f
+			}
+		}
+		if v, ok := _metadata["timeout"]; ok {
+			if d, err := parseRetryDelay(v); err == nil {
+				r.Timeout = d
+			} else {
+				etlx.logger("key", key, "item", itemKey).Warn("invalid timeout, ignored", "timeout", v, "err", err)
+			}
+		}
+		if v, ok := _metadata["retry_on_err_patt"].(string); ok && v != "" {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				etlx.logger("key", key, "item", itemKey).Warn("invalid retry_on_err_patt, ignored", "retry_on_err_patt", v, "err", err)
+			} else {
+				r.ErrPatt = re
+			}
+		}
+	}
+	if r.Timeout > 0 {
+		r.deadline = time.Now().Add(r.Timeout)
+	}
+	return r
+}
+
+// Context is the run context with the item timeout
+func (r *RetryPolicy) Context() (context.Context, context.CancelFunc) {
+	if r == nil {
+		return context.WithCancel(context.Background())
+	}
+	if r.deadline.IsZero() {
+		return context.WithCancel(r.etlx.Context())
+	}
+	return context.WithDeadline(r.etlx.Context(), r.deadline)
+}
+
+// Do runs fn until it succeeds, the retries are exhausted or the error does
+// not match retry_on_err_patt, waiting retry_delay * retry_backoff^n between attempts
+func (r *RetryPolicy) Do(action string, fn func() error) error {
+	if r == nil {
+		return fn()
+	}
+	ctx, cancel := r.Context()
+	defer cancel()
+	var err error
+	for attempt := 0; attempt <= r.Retries; attempt++ {
+		start := time.Now().In(r.etlx.TimeZone)
+		err = fn()
+		if err == nil || attempt == r.Retries || ctx.Err() != nil {
+			return err
+		}
+		if r.ErrPatt != nil && !r.ErrPatt.MatchString(err.Error()) {
+			return err
+		}
+		wait := time.Duration(float64(r.Delay) * math.Pow(r.Backoff, float64(attempt)))
+		_log := map[string]any{
+			"process":  r.process,
+			"name":     fmt.Sprintf("%s->%s", r.key, r.itemKey),
+			"key":      r.key,
+			"item_key": r.itemKey,
+			"start_at": start,
+			"end_at":   time.Now().In(r.etlx.TimeZone),
+			"duration": time.Since(start).Seconds(),
+			"success":  false,
+			"retrying": true,
+			"attempt":  attempt + 1,
+			"msg":      fmt.Sprintf("%s -> %s %s attempt %d/%d failed, retrying in %s: %s", r.key, r.itemKey, action, attempt+1, r.Retries+1, wait, err),
+		}
+		if r.logs != nil {
+			*r.logs = append(*r.logs, _log)
+		}
+		r.etlx.formatProcessLogEntry(_log)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+	return err
+}
+
+// GetDB is GetDB with the retry policy applied
+func (r *RetryPolicy) GetDB(conn string) (db.DBInterface, error) {
+	var dbConn db.DBInterface
+	err := r.Do("connection", func() error {
+		var err error
+		dbConn, err = r.etlx.GetDB(conn)
+		return err
+	})
+	return dbConn, err
+}
+
+// ExecuteQuery is ExecuteQuery with the retry policy and the item timeout applied
+func (r *RetryPolicy) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string]any, fname string, step string, dateRef []time.Time) error {
+	ctx, cancel := r.Context()
+	defer cancel()
+	err := r.Do(strings.TrimSpace(fmt.Sprintf("query %s", step)), func() error {
+		return r.etlx.ExecuteQueryContext(ctx, conn, sqlData, item, fname, step, dateRef)
+	})
+	if err != nil && r.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timeout of %s exceeded: %w", r.Timeout, err)
+	}
+	return err
+}
+
+// ExecuteCleanup is ExecuteCleanup with the retry policy applied, it is not
+// bound to the item timeout nor cancelled with the run
+func (r *RetryPolicy) ExecuteCleanup(conn db.DBInterface, sqlData any, item map[string]any, fname string, step string, dateRef []time.Time) error {
+	return r.Do(strings.TrimSpace(fmt.Sprintf("cleanup %s", step)), func() error {
+		return r.etlx.ExecuteCleanup(conn, sqlData, item, fname, step, dateRef)
+	})
+}
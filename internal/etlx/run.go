@@ -2,13 +2,48 @@ package etlxlib
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/realdatadriven/etlx/internal/secrets"
 )
 
+// RunETLX runs the Level 1 keys of the config, traced with the TracerProvider
+// / MeterProvider of the ETLX (or the `telemetry` of the frontmatter), the
+// outcome goes to the Metrics / Pushgateway
 func (etlx *ETLX) RunETLX(extraConf map[string]any, dateRef []time.Time) ([]map[string]any, map[string]any, error) {
+	start := time.Now()
+	// MISSING REQUIRED / INVALID PARAMS FAIL BEFORE ANYTHING RUNS
+	if err := etlx.ResolveParams(); err != nil {
+		return nil, nil, err
+	}
+	// THE TELEMETRY OF THE OUTER RUN, THE NESTED ONES (REMOTE) ARE PART OF IT
+	outer := etlx.tel == nil
+	if outer {
+		etlx.tel = etlx.newTelemetry()
+		defer func() {
+			etlx.tel.close(etlx)
+			etlx.tel = nil
+		}()
+	}
+	ctx, endRun := etlx.tel.startRun(etlx.Context(), etlx.RunID)
+	parentCtx := etlx.ctx
+	etlx.ctx = ctx
+	defer func() { etlx.ctx = parentCtx }()
+	logs, data, err := etlx.runETLX(extraConf, dateRef)
+	if err == nil {
+		// THE FAILED KEYS ARE THE ERROR OF THE RUN
+		err = etlx.runError(data)
+	}
+	endRun(logs, err)
+	if outer {
+		etlx.observeRunMetrics(logs, data, start, err)
+	}
+	return logs, data, err
+}
+
+func (etlx *ETLX) runETLX(extraConf map[string]any, dateRef []time.Time) ([]map[string]any, map[string]any, error) {
 	logs := []map[string]any{}
 	data := map[string]any{}
 	_keys := []any{"NOTIFY", "NOTIFICATION", "LOGS", "OBSERVABILITY", "SCRIPTS", "MODEL_SQL", "MULTI_QUERIES", "STACKED_QUERIES", "EXPORTS", "DATA_QUALITY", "DATAQUALITY", "QUALITY", "ETL", "ELT", "ACTIONS", "AUTO_LOGS", "REQUIRES", "IMPORTS", "MODEL", "CSMODEL", "C7MODEL", "MODEL_DATA", "CSDATA", "C7DATA", "WORKFLOW", "C7WORKFLOW", "CSWORKFLOW", "C7ROLE", "ROLE", "CSROLE", "C7ROLE_USERS", "CSROLE_USERS", "ROLE_USERS", "REMOTE", "REMOTE_EXEC"}
@@ -30,14 +65,39 @@ func (etlx *ETLX) RunETLX(extraConf map[string]any, dateRef []time.Time) ([]map[
 		}
 		//hasOrderedKeys = true
 	}
+	// NAMED CONNECTIONS ARE SHARED BY THE ITEMS OF THE RUN AND CLOSED AT THE END
+	if etlx.conns == nil {
+		etlx.conns = newConnRegistry(dateRef)
+		defer func() {
+			if err := etlx.conns.close(etlx); err != nil {
+				etlx.logger("key", "CONNECTIONS").Error("closing the connections failed", "err", err)
+			}
+			etlx.conns = nil
+		}()
+	}
 	// fmt.Println("LEVEL 1 H:", __order, len(__order))
 	if !hasOrderedKeys {
 	} else if len(__order) > 0 {
+		// THE ITEMS WITH A for_each ARE EXPANDED AGAIN IN EVERY RUN
+		etlx.restoreForEach()
+		// DEPENDENCY GRAPH FROM depends_on, CYCLES ARE REJECTED BEFORE ANYTHING RUNS
+		dag, err := etlx.BuildDAG(__order)
+		if err != nil {
+			return logs, data, err
+		}
+		parentDag := etlx.dag
+		etlx.dag = dag
+		defer func() { etlx.dag = parentDag }()
+		etlx.State.setDateRef(dateRef)
 		//fmt.Print("LEVEL 1 H:", __order)
 		ignoreNext := false
-		for _, key := range __order {
-			if key == "metadata" || key == "__order" || key == "order" {
-				continue
+		hooks := etlx.hookKeys(dag.keys)
+		// THE KEY WITH on_error: stop THAT FAILED
+		stoppedBy := ""
+		for _, key := range dag.keys {
+			// CANCELLED (E.G. SIGINT / SIGTERM), THE KEYS LEFT ARE NOT RUN
+			if err := etlx.cancelled(); err != nil {
+				return logs, data, err
 			}
 			//if !app.contains(_keys, any(key)) {
 			_key_conf, ok := etlx.Config[key].(map[string]any)
@@ -54,264 +114,126 @@ func (etlx *ETLX) RunETLX(extraConf map[string]any, dateRef []time.Time) ([]map[
 			if ignoreNext {
 				continue
 			}
-			if runs_as, ok := _key_conf_metadata["runs_as"]; ok {
-				// fmt.Printf("%s RUN AS %s:\n", key, runs_as)
-				if etlx.containsAny(_keys, runs_as) {
-					switch runs_as {
-					case "ETL", "ELT":
-						_logs, err := etlx.RunETL(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "DATA_QUALITY", "DATAQUALITY", "QUALITY":
-						_logs, err := etlx.RunDATA_QUALITY(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "MULTI_QUERIES", "STACKED_QUERIES":
-						_logs, _, err := etlx.RunMULTI_QUERIES(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "EXPORTS":
-						_logs, err := etlx.RunEXPORTS(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "NOTIFY", "NOTIFICATION":
-						_logs, err := etlx.RunNOTIFY(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "ACTIONS":
-						_logs, err := etlx.RunACTIONS(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "SCRIPTS", "MODEL_SQL":
-						_logs, err := etlx.RunSCRIPTS(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "LOGS", "OBSERVABILITY":
-						_logs, err := etlx.RunLOGS(dateRef, nil, logs, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							data[key] = map[string]any{
-								"success": true,
-								"runs_as": runs_as,
-								"logs":    _logs,
-							}
-						}
-					case "REQUIRES", "IMPORTS":
-						_logs, err := etlx.LoadREQUIRES(nil, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "MODEL", "CSMODEL", "C7MODEL":
-						_logs, err := etlx.RunMODEL(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "MODEL_DATA", "CSDATA", "C7DATA":
-						//fmt.Printf("%s AS %s START:\n", key, runs_as)
-						_logs, err := etlx.RunMODEL_DATA(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									//fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "WORKFLOW", "C7WORKFLOW", "CSWORKFLOW":
-						// fmt.Printf("%s AS %s START:\n", key, runs_as)
-						_logs, err := etlx.RunWORKFLOW(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "C7ROLE", "CSROLE", "ROLE":
-						// fmt.Printf("%s AS %s START:\n", key, runs_as)
-						_logs, err := etlx.RunC7ROLE(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "C7ROLE_USERS", "CSROLE_USERS", "ROLE_USERS":
-						// fmt.Printf("%s AS %s START:\n", key, runs_as)
-						_logs, err := etlx.RunC7ROLE_USERS(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-						}
-					case "REMOTE", "REMOTE_EXEC":
-						ignoreNext = true
-						// fmt.Printf("%s AS %s START:\n", key, runs_as)
-						_logs, err := etlx.RunREMOTE(dateRef, nil, extraConf, key)
-						if err != nil {
-							fmt.Printf("%s AS %s ERR: %v\n", key, runs_as, err)
-							if strings.Contains(err.Error(), "deactivated") {
-								ignoreNext = false
-							}
-							// break
-						} else {
-							if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
-								_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
-								if err != nil {
-									// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
-								}
-							}
-							logs = append(logs, _logs...)
-							// break
-						}
-						if etlx.RemoteSkiped {
-							ignoreNext = false
-						}
-						// fmt.Println("etlx.RemoteSkiped:", etlx.RemoteSkiped, "ignoreNext:", ignoreNext, _logs)
-					default:
-						//
+			runs_as, ok := _key_conf_metadata["runs_as"]
+			if !ok || !etlx.containsAny(_keys, runs_as) {
+				continue
+			}
+			// ONLY THE LEVEL 1 KEYS ASKED FOR (E.G. THE ONES TRIGGERED BY THE SCHEDULER)
+			onlyKeys, okOnlyKeys := extraConf["keys"].([]string)
+			if okOnlyKeys && !etlx.Contains(onlyKeys, key) {
+				continue
+			}
+			// THE KEYS NAMED IN THE on_success / on_failure OF OTHERS ONLY RUN AS
+			// HOOKS, UNLESS ASKED FOR (E.G. A HOOK WITH ITS OWN schedule)
+			if hooks[key] && !okOnlyKeys {
+				continue
+			}
+			// fmt.Printf("%s RUN AS %s:\n", key, runs_as)
+			skipMsg, upstream := "", dag.failedUpstream(key)
+			if stoppedBy != "" && runs_as != "LOGS" && runs_as != "OBSERVABILITY" {
+				skipMsg, upstream = fmt.Sprintf("Skipped: run stopped, %s failed", stoppedBy), stoppedBy
+			} else if upstream != "" {
+				skipMsg = fmt.Sprintf("Skipped: upstream %s failed", upstream)
+			}
+			if skipMsg != "" {
+				now := time.Now().In(etlx.TimeZone)
+				_log := map[string]any{
+					"process":     runs_as,
+					"name":        key,
+					"description": _key_conf_metadata["description"],
+					"key":         key, "start_at": now,
+					"end_at":   now,
+					"duration": 0.0,
+					"success":  false,
+					"skipped":  true,
+					"msg":      skipMsg,
+				}
+				dag.markFailed(key, upstream)
+				etlx.formatProcessLogEntry(_log)
+				etlx.saveRunState(dateRef, []map[string]any{_log})
+				logs = append(logs, _log)
+				data[key] = map[string]any{
+					"success": false,
+					"skipped": true,
+					"runs_as": runs_as,
+					"logs":    []map[string]any{_log},
+				}
+				continue
+			}
+			// THE SPAN OF THE KEY IS THE PARENT OF THE ONES OF ITS ITEMS
+			runCtx := etlx.Context()
+			sectionCtx, endSection := etlx.tel.startSection(runCtx, key, fmt.Sprint(runs_as))
+			etlx.ctx = sectionCtx
+			_logs, ok, err := etlx.runSection(key, runs_as, dateRef, extraConf, logs)
+			if runs_as == "REMOTE" || runs_as == "REMOTE_EXEC" {
+				ignoreNext = !errDeactivated(err) && !etlx.RemoteSkiped
+				// fmt.Println("etlx.RemoteSkiped:", etlx.RemoteSkiped, "ignoreNext:", ignoreNext, _logs)
+			}
+			etlx.ctx = runCtx
+			if !ok {
+				endSection(nil, nil)
+				continue
+			}
+			endSection(_logs, secrets.MaskErr(err))
+			// ITEMS SKIPPED BECAUSE OF A FAILED UPSTREAM
+			_logs = append(_logs, dag.drainSkipped()...)
+			// NO SECRET RESOLVED DURING THE RUN GOES TO THE LOGS / STATE / ERRORS
+			for _, _log := range _logs {
+				secrets.MaskValue(_log)
+			}
+			err = secrets.MaskErr(err)
+			if err != nil {
+				etlx.logger("key", key).Error("run failed", "runs_as", runs_as, "err", err)
+				if errDeactivated(err) {
+					continue
+				}
+				dag.markFailed(key, err.Error())
+				etlx.saveRunState(dateRef, append(_logs, map[string]any{
+					"name":     key,
+					"key":      key,
+					"start_at": time.Now().In(etlx.TimeZone),
+					"end_at":   time.Now().In(etlx.TimeZone),
+					"success":  false,
+					"msg":      err.Error(),
+				}))
+				logs = append(logs, _logs...)
+				data[key] = map[string]any{
+					"success": false,
+					"runs_as": runs_as,
+					"msg":     err.Error(),
+					"logs":    _logs,
+				}
+			} else {
+				etlx.saveRunState(dateRef, _logs)
+				for _, _log := range _logs {
+					dag.observeLog(_log)
+				}
+				if _, ok := etlx.Config["AUTO_LOGS"]; ok && len(_logs) > 0 {
+					_, err := etlx.RunLOGS(dateRef, nil, _logs, "AUTO_LOGS")
+					if err != nil {
+						// fmt.Printf("INCREMENTAL AUTOLOGS ERR: %v\n", err)
 					}
 				}
+				logs = append(logs, _logs...)
+				data[key] = map[string]any{
+					"success": !dag.hasFailed(key),
+					"runs_as": runs_as,
+					"logs":    _logs,
+				}
+			}
+			failed := dag.hasFailed(key)
+			if failed && etlx.onError(key) == OnErrorStop {
+				stoppedBy = key
+			}
+			hookLogs, hookData := etlx.runHooks(key, runs_as, failed, err, _logs, dateRef, extraConf)
+			logs = append(logs, hookLogs...)
+			for hook, _data := range hookData {
+				data[hook] = _data
 			}
 			//}
 		}
 	}
-	return logs, data, nil
+	return logs, data, etlx.cancelled()
 }
 
 func EnvExpand(s string) string {
@@ -319,7 +241,7 @@ func EnvExpand(s string) string {
 	return reEnvVar.ReplaceAllStringFunc(s, func(match string) string {
 		// fmt.Println(match, match[1:])
 		name := match[1:] // strip leading "$"
-		if value, exists := os.LookupEnv(name); exists {
+		if value, exists := secrets.Default().Lookup(name); exists {
 			return EnvExpand(value)
 		}
 		return match // leave as-is if not set
@@ -331,9 +253,17 @@ func (etlx *ETLX) EnvExpand(s string) string {
 	return reEnvVar.ReplaceAllStringFunc(s, func(match string) string {
 		// fmt.Println(match, match[1:])
 		name := match[1:] // strip leading "$"
-		if value, exists := os.LookupEnv(name); exists {
-			return EnvExpand(value)
+		if value, exists := etlx.secretResolver().Lookup(name); exists {
+			return etlx.EnvExpand(value)
 		}
 		return match // leave as-is if not set
 	})
 }
+
+// secretResolver is the resolver of the @VAR / $VAR references of the config
+func (etlx *ETLX) secretResolver() *secrets.Resolver {
+	if etlx.Secrets != nil {
+		return etlx.Secrets
+	}
+	return secrets.Default()
+}
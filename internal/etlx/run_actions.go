@@ -39,6 +39,10 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "ACTIONS"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -78,10 +82,11 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 		itemMetadata, ok := item["metadata"].(map[string]any)
 		//fmt.Println(itemMetadata, itemKey, item)
 		if !ok {
+			description, _ := itemMetadata["description"].(string)
 			processLogs = append(processLogs, map[string]any{
 				"process":     process,
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"],
+				"description": description,
 				"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
 				"end_at":  time.Now().In(etlx.TimeZone),
 				"success": true,
@@ -89,6 +94,7 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			})
 			return nil
 		}
+		retry := etlx.RetryPolicy(&processLogs, process, key, itemKey, metadata, itemMetadata)
 		// ACTIVE
 		if active, okActive := itemMetadata["active"]; okActive {
 			if !active.(bool) {
@@ -104,13 +110,14 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 				return nil
 			}
 		}
+		description, _ := itemMetadata["description"].(string)
 		_type, okType := itemMetadata["type"].(string)
 		params, okParams := itemMetadata["params"].(map[string]any)
 		if !okType {
 			processLogs = append(processLogs, map[string]any{
 				"process":     process,
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"].(string),
+				"description": description,
 				"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
 				"end_at":  time.Now().In(etlx.TimeZone),
 				"success": true,
@@ -122,7 +129,7 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			processLogs = append(processLogs, map[string]any{
 				"process":     process,
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"].(string),
+				"description": description,
 				"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
 				"end_at":  time.Now().In(etlx.TimeZone),
 				"success": true,
@@ -291,7 +298,9 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			password = etlx.ReplaceEnvVariable(password)
 			source = addMainPath(etlx.SetQueryPlaceholders(source, "", "", dateRef), mainPath)
 			target = etlx.SetQueryPlaceholders(target, "", "", dateRef)
-			err := etlx.FTPUpload(host, port, user, password, source, target)
+			err := retry.Do("ftp upload", func() error {
+				return etlx.FTPUpload(host, port, user, password, source, target)
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: FTP upload failed: %v", key, itemKey, _type, err)
@@ -324,16 +333,20 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			source = etlx.SetQueryPlaceholders(source, "", "", dateRef)
 			target = addMainPath(etlx.SetQueryPlaceholders(target, "", "", dateRef), mainPath)
 			if host == "" || source == "" || target == "" {
-				fmt.Println("ftp_download missing required params")
+				etlx.logger("key", key, "item", itemKey).Error("ftp_download missing required params (host, source, target)")
 				break
 			}
 			isGlob, remoteDir, pattern := parseSource(source)
 			var err error
 			if isGlob {
-				fmt.Printf("isGlob: %v, remoteDir: %s, pattern: %s", isGlob, remoteDir, pattern)
-				err = etlx.FTPDownloadBatch(host, port, user, password, remoteDir, pattern, target)
+				etlx.logger("key", key, "item", itemKey).Debug("ftp_download glob", "remote_dir", remoteDir, "pattern", pattern)
+				err = retry.Do("ftp download", func() error {
+					return etlx.FTPDownloadBatch(host, port, user, password, remoteDir, pattern, target)
+				})
 			} else {
-				err = etlx.FTPDownload(host, port, user, password, source, target)
+				err = retry.Do("ftp download", func() error {
+					return etlx.FTPDownload(host, port, user, password, source, target)
+				})
 			}
 			if err != nil {
 				_log2["success"] = false
@@ -352,7 +365,9 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			}
 			params["source"] = addMainPath(etlx.SetQueryPlaceholders(source, "", "", dateRef), mainPath)
 			params["target"] = etlx.SetQueryPlaceholders(target, "", "", dateRef)
-			err := etlx.SFTPActionWithFixedHostKey("upload", params)
+			err := retry.Do("sftp upload", func() error {
+				return etlx.SFTPActionWithFixedHostKey("upload", params)
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: SFTP upload failed: %v", key, itemKey, _type, err)
@@ -370,7 +385,9 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			}
 			params["source"] = addMainPath(etlx.SetQueryPlaceholders(source, "", "", dateRef), mainPath)
 			params["target"] = etlx.SetQueryPlaceholders(target, "", "", dateRef)
-			err := etlx.SFTPActionWithFixedHostKey("download", params)
+			err := retry.Do("sftp download", func() error {
+				return etlx.SFTPActionWithFixedHostKey("download", params)
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: SFTP download failed: %v", key, itemKey, _type, err)
@@ -386,7 +403,9 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 				break
 			}
 			params["source"] = addMainPath(etlx.SetQueryPlaceholders(source, "", "", dateRef), mainPath)
-			err := etlx.HTTPAction("upload", params)
+			err := retry.Do("http upload", func() error {
+				return etlx.HTTPAction("upload", params)
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: HTTP upload failed: %v", key, itemKey, _type, err)
@@ -402,7 +421,9 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 				break
 			}
 			params["target"] = addMainPath(etlx.SetQueryPlaceholders(target, "", "", dateRef), mainPath)
-			err := etlx.HTTPAction("download", params)
+			err := retry.Do("http download", func() error {
+				return etlx.HTTPAction("download", params)
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: HTTP download failed: %v", key, itemKey, _type, err)
@@ -421,7 +442,10 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			}
 			params["source"] = addMainPath(etlx.SetQueryPlaceholders(source, "", "", dateRef), mainPath)
 			params["key"] = etlx.SetQueryPlaceholders(_key, "", "", dateRef)
-			_, err := etlx.S3("upload", params)
+			err := retry.Do("s3 upload", func() error {
+				_, err := etlx.S3("upload", params)
+				return err
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: S3 upload failed: %v", key, itemKey, _type, err)
@@ -440,7 +464,10 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 			}
 			params["target"] = addMainPath(etlx.SetQueryPlaceholders(target, "", "", dateRef), mainPath)
 			params["key"] = etlx.SetQueryPlaceholders(_key, "", "", dateRef)
-			_, err := etlx.S3("download", params)
+			err := retry.Do("s3 download", func() error {
+				_, err := etlx.S3("download", params)
+				return err
+			})
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: S3 download failed: %v", key, itemKey, _type, err)
@@ -456,6 +483,9 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: DB missing required params (source | target)", key, itemKey, _type)
 				break
 			}
+			if source := params["source"].(map[string]any); source["watermark_key"] == nil {
+				source["watermark_key"] = key + "." + itemKey
+			}
 			err := etlx.DB2DB(params, item, dateRef)
 			if err != nil {
 				_log2["success"] = false
@@ -523,14 +553,14 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 							_log2["success"] = false
 							_log2["msg"] = fmt.Sprintf("%s -> %s -> %s: Save to tem JSON failed: %v", key, itemKey, _type, err)
 						} else {
-							dbConn, err := etlx.GetDB(conn)
+							dbConn, err := retry.GetDB(conn)
 							if err != nil {
 								_log2["success"] = false
 								_log2["msg"] = fmt.Sprintf("error connecting to source: %v %s", err, conn)
 							} else {
 								defer dbConn.Close()
-								fmt.Println(_file)
-								err = etlx.ExecuteQuery(dbConn, sqls, item, _file, "", dateRef)
+								etlx.logger("key", key, "item", itemKey).Debug("db_2_db source saved", "file", _file)
+								err = retry.ExecuteQuery(dbConn, sqls, item, _file, "", dateRef)
 								if err != nil {
 									_log2["success"] = false
 									_log2["msg"] = fmt.Sprintf("error executing queries: %s", err)
@@ -558,7 +588,7 @@ func (etlx *ETLX) RunACTIONS(dateRef []time.Time, conf map[string]any, extraConf
 		_log2["mem_sys_end"] = mem_sys_end
 		_log2["num_gc_end"] = num_gc_end
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil
 	}
 	// Check if the input conf is nil or empty
@@ -0,0 +1,530 @@
+package etlxlib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/secrets"
+)
+
+// dagRun holds the dependency graph built from `depends_on` for a single
+// RunETLX call, plus the outcome of every node (KEY or KEY.item) so far
+type dagRun struct {
+	mu       sync.Mutex
+	keys     []string
+	keyDeps  map[string][]string
+	items    map[string][]string
+	itemDeps map[string][]string
+	failed   map[string]string
+	skipped  []map[string]any
+	// continueOnError are the keys with on_error: continue
+	continueOnError map[string]bool
+}
+
+// parseDependsOn accepts the forms depends_on takes in the metadata:
+// a single string (optionally comma separated) or a list of strings
+func parseDependsOn(v any) []string {
+	deps := []string{}
+	switch _v := v.(type) {
+	case nil:
+	case string:
+		for _, d := range strings.Split(_v, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				deps = append(deps, d)
+			}
+		}
+	case []string:
+		for _, d := range _v {
+			deps = append(deps, parseDependsOn(d)...)
+		}
+	case []any:
+		for _, d := range _v {
+			deps = append(deps, parseDependsOn(d)...)
+		}
+	default:
+		deps = append(deps, parseDependsOn(fmt.Sprintf("%v", _v))...)
+	}
+	return deps
+}
+
+// mdKeyItems returns the items (sub sections) of a top level key in the document order
+func mdKeyItems(data map[string]any) []string {
+	items := []string{}
+	if order, ok := data["__order"].([]any); ok {
+		for _, k := range order {
+			_k, ok := k.(string)
+			if !ok || _k == "metadata" || _k == "__order" || _k == "__frontmatter" || _k == "order" {
+				continue
+			}
+			if _, isMap := data[_k].(map[string]any); isMap {
+				items = append(items, _k)
+			}
+		}
+		return items
+	}
+	for k, v := range data {
+		if k == "metadata" || k == "__order" || k == "__frontmatter" || k == "order" {
+			continue
+		}
+		if _, isMap := v.(map[string]any); isMap {
+			items = append(items, k)
+		}
+	}
+	sort.Strings(items)
+	return items
+}
+
+// resolveDep maps a depends_on entry to a DAG node (KEY or KEY.item),
+// relative entries without a section are looked up in the current section first
+func resolveDep(dep string, currentKey string, sections map[string]map[string]bool) (string, bool) {
+	if items, ok := sections[currentKey]; ok && items[dep] {
+		return currentKey + "." + dep, true
+	}
+	if _, ok := sections[dep]; ok {
+		return dep, true
+	}
+	if idx := strings.Index(dep, "."); idx > 0 {
+		_key, _item := dep[:idx], dep[idx+1:]
+		if items, ok := sections[_key]; ok {
+			if items[_item] {
+				return _key + "." + _item, true
+			}
+			if _item == "*" || _item == "" {
+				return _key, true
+			}
+		}
+	}
+	return "", false
+}
+
+// unknownDep is a depends_on entry that names no key or item
+type unknownDep struct {
+	Key       string
+	Item      string
+	DependsOn string
+}
+
+// depsNotFoundError is the error of BuildDAG for the depends_on entries that
+// name no key or item
+type depsNotFoundError struct {
+	deps []unknownDep
+}
+
+func (e *depsNotFoundError) Error() string {
+	msgs := []string{}
+	for _, dep := range e.deps {
+		node := dep.Key
+		if dep.Item != "" {
+			node += "." + dep.Item
+		}
+		msgs = append(msgs, fmt.Sprintf("%s -> %s", node, dep.DependsOn))
+	}
+	return "depends_on not found: " + strings.Join(msgs, ", ")
+}
+
+func nodeKey(node string) string {
+	if idx := strings.Index(node, "."); idx > 0 {
+		return node[:idx]
+	}
+	return node
+}
+
+// topoSort orders nodes so every node comes after its dependencies, ties are
+// broken by the original order so files without depends_on run as written
+func topoSort(nodes []string, deps map[string][]string) ([]string, error) {
+	pos := map[string]int{}
+	for i, n := range nodes {
+		pos[n] = i
+	}
+	inDegree := map[string]int{}
+	dependents := map[string][]string{}
+	for _, n := range nodes {
+		inDegree[n] += 0
+		seen := map[string]bool{}
+		for _, d := range deps[n] {
+			if _, ok := pos[d]; !ok || d == n || seen[d] {
+				continue
+			}
+			seen[d] = true
+			inDegree[n]++
+			dependents[d] = append(dependents[d], n)
+		}
+	}
+	ready := []string{}
+	for _, n := range nodes {
+		if inDegree[n] == 0 {
+			ready = append(ready, n)
+		}
+	}
+	sorted := []string{}
+	for len(ready) > 0 {
+		sort.SliceStable(ready, func(i, j int) bool { return pos[ready[i]] < pos[ready[j]] })
+		n := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, n)
+		for _, m := range dependents[n] {
+			inDegree[m]--
+			if inDegree[m] == 0 {
+				ready = append(ready, m)
+			}
+		}
+	}
+	if len(sorted) < len(nodes) {
+		return nil, fmt.Errorf("dependency cycle detected: %s", strings.Join(findCycle(nodes, deps, inDegree), " -> "))
+	}
+	return sorted, nil
+}
+
+// findCycle walks the nodes left over by topoSort until one repeats
+func findCycle(nodes []string, deps map[string][]string, inDegree map[string]int) []string {
+	for _, start := range nodes {
+		if inDegree[start] == 0 {
+			continue
+		}
+		path := []string{start}
+		seen := map[string]int{start: 0}
+		current := start
+		for {
+			next := ""
+			for _, d := range deps[current] {
+				if inDegree[d] > 0 && d != current {
+					next = d
+					break
+				}
+			}
+			if next == "" {
+				break
+			}
+			if idx, ok := seen[next]; ok {
+				return append(path[idx:], next)
+			}
+			seen[next] = len(path)
+			path = append(path, next)
+			current = next
+		}
+	}
+	return []string{"unresolved nodes"}
+}
+
+// BuildDAG reads depends_on from every top level key and item and returns the
+// execution order of the keys, failing on cycles and on depends_on entries
+// that name no key or item before anything runs
+func (etlx *ETLX) BuildDAG(order []string) (*dagRun, error) {
+	dag := &dagRun{
+		keyDeps:         map[string][]string{},
+		items:           map[string][]string{},
+		itemDeps:        map[string][]string{},
+		failed:          map[string]string{},
+		continueOnError: map[string]bool{},
+	}
+	keys := []string{}
+	sections := map[string]map[string]bool{}
+	for _, key := range order {
+		if key == "metadata" || key == "__order" || key == "order" {
+			continue
+		}
+		_key_conf, ok := etlx.Config[key].(map[string]any)
+		if !ok {
+			continue
+		}
+		if _, ok := _key_conf["metadata"].(map[string]any); !ok {
+			continue
+		}
+		keys = append(keys, key)
+		sections[key] = map[string]bool{}
+		dag.items[key] = mdKeyItems(_key_conf)
+		for _, itemKey := range dag.items[key] {
+			sections[key][itemKey] = true
+		}
+	}
+	notFound := []unknownDep{}
+	for _, key := range keys {
+		_key_conf := etlx.Config[key].(map[string]any)
+		metadata := _key_conf["metadata"].(map[string]any)
+		dag.continueOnError[key] = etlx.onError(key) == OnErrorContinue
+		for _, dep := range parseDependsOn(metadata["depends_on"]) {
+			node, ok := resolveDep(dep, "", sections)
+			if !ok {
+				notFound = append(notFound, unknownDep{Key: key, DependsOn: dep})
+				continue
+			}
+			dag.keyDeps[key] = append(dag.keyDeps[key], node)
+		}
+		for _, itemKey := range dag.items[key] {
+			itemMetadata, ok := _key_conf[itemKey].(map[string]any)["metadata"].(map[string]any)
+			if !ok {
+				continue
+			}
+			for _, dep := range parseDependsOn(itemMetadata["depends_on"]) {
+				node, ok := resolveDep(dep, key, sections)
+				if !ok {
+					notFound = append(notFound, unknownDep{Key: key, Item: itemKey, DependsOn: dep})
+					continue
+				}
+				dag.itemDeps[key+"."+itemKey] = append(dag.itemDeps[key+"."+itemKey], node)
+			}
+		}
+	}
+	// A TYPO IN A depends_on WOULD RUN THE KEY / ITEM WITH NO ORDER AT ALL
+	if len(notFound) > 0 {
+		return nil, &depsNotFoundError{deps: notFound}
+	}
+	// KEY LEVEL ORDER, ITEMS DEPENDING ON OTHER KEYS PULL THE WHOLE KEY
+	_keyDeps := map[string][]string{}
+	for key, deps := range dag.keyDeps {
+		for _, d := range deps {
+			_keyDeps[key] = append(_keyDeps[key], nodeKey(d))
+		}
+	}
+	for node, deps := range dag.itemDeps {
+		key := nodeKey(node)
+		for _, d := range deps {
+			if nodeKey(d) != key {
+				_keyDeps[key] = append(_keyDeps[key], nodeKey(d))
+			}
+		}
+	}
+	sorted, err := topoSort(keys, _keyDeps)
+	if err != nil {
+		return nil, err
+	}
+	dag.keys = sorted
+	// ITEM LEVEL ORDER INSIDE EACH KEY
+	for _, key := range keys {
+		nodes := []string{}
+		_itemDeps := map[string][]string{}
+		for _, itemKey := range dag.items[key] {
+			node := key + "." + itemKey
+			nodes = append(nodes, node)
+			for _, d := range dag.itemDeps[node] {
+				if nodeKey(d) == key && d != key {
+					_itemDeps[node] = append(_itemDeps[node], d)
+				}
+			}
+		}
+		sortedItems, err := topoSort(nodes, _itemDeps)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", key, err)
+		}
+		dag.items[key] = []string{}
+		for _, node := range sortedItems {
+			dag.items[key] = append(dag.items[key], strings.TrimPrefix(node, key+"."))
+		}
+	}
+	return dag, nil
+}
+
+// markFailed records a failed or skipped node so its dependents get skipped
+func (dag *dagRun) markFailed(node string, reason string) {
+	if dag == nil || node == "" {
+		return
+	}
+	dag.mu.Lock()
+	defer dag.mu.Unlock()
+	if _, ok := dag.failed[node]; !ok {
+		dag.failed[node] = reason
+	}
+	if key := nodeKey(node); key != node {
+		if _, ok := dag.failed[key]; !ok {
+			dag.failed[key] = reason
+		}
+	}
+}
+
+// failedUpstream returns the first dependency of the node that has failed
+func (dag *dagRun) failedUpstream(node string) string {
+	if dag == nil {
+		return ""
+	}
+	dag.mu.Lock()
+	defer dag.mu.Unlock()
+	deps := dag.keyDeps[node]
+	if nodeKey(node) != node {
+		deps = dag.itemDeps[node]
+	}
+	for _, d := range deps {
+		if _, ok := dag.failed[d]; ok {
+			// THE DEPENDENTS OF A KEY WITH on_error: continue RUN ANYWAY
+			if dag.continueOnError[nodeKey(d)] && nodeKey(d) != nodeKey(node) {
+				continue
+			}
+			return d
+		}
+	}
+	return ""
+}
+
+// hasFailed tells if the node failed or was skipped in this run
+func (dag *dagRun) hasFailed(node string) bool {
+	if dag == nil {
+		return false
+	}
+	dag.mu.Lock()
+	defer dag.mu.Unlock()
+	_, ok := dag.failed[node]
+	return ok
+}
+
+// itemOrder returns the items of a key in dependency order, or nil when not known
+func (dag *dagRun) itemOrder(key string) []string {
+	if dag == nil {
+		return nil
+	}
+	items, ok := dag.items[key]
+	if !ok {
+		return nil
+	}
+	return items
+}
+
+// expandItem replaces an item by the ones its for_each expanded into, each
+// with the dependencies of the item, and the ones depending on it depend on
+// all of them
+func (dag *dagRun) expandItem(key string, itemKey string, names []string) {
+	if dag == nil {
+		return
+	}
+	dag.mu.Lock()
+	defer dag.mu.Unlock()
+	node := key + "." + itemKey
+	nodes := []string{}
+	for _, name := range names {
+		nodes = append(nodes, key+"."+name)
+	}
+	if items, ok := dag.items[key]; ok {
+		_items := []string{}
+		for _, _item := range items {
+			if _item == itemKey {
+				_items = append(_items, names...)
+			} else {
+				_items = append(_items, _item)
+			}
+		}
+		dag.items[key] = _items
+	}
+	for _, _node := range nodes {
+		dag.itemDeps[_node] = append([]string{}, dag.itemDeps[node]...)
+	}
+	delete(dag.itemDeps, node)
+	for _node, deps := range dag.itemDeps {
+		_deps := []string{}
+		for _, d := range deps {
+			if d == node {
+				_deps = append(_deps, nodes...)
+			} else {
+				_deps = append(_deps, d)
+			}
+		}
+		dag.itemDeps[_node] = _deps
+	}
+}
+
+// itemDepsInKey returns the items of the same key the item depends on
+func (dag *dagRun) itemDepsInKey(key string, itemKey string) []string {
+	if dag == nil {
+		return nil
+	}
+	deps := []string{}
+	for _, d := range dag.itemDeps[key+"."+itemKey] {
+		if nodeKey(d) == key && d != key {
+			deps = append(deps, d[len(key)+1:])
+		}
+	}
+	return deps
+}
+
+// skipItem records and returns the log entry of an item that is not going to run
+func (dag *dagRun) skipItem(key string, itemKey string, msg string, success bool, tz *time.Location) map[string]any {
+	now := time.Now().In(tz)
+	logEntry := map[string]any{
+		"name":        fmt.Sprintf("%s->%s", key, itemKey),
+		"description": itemKey,
+		"key":         key, "item_key": itemKey, "start_at": now,
+		"end_at":   now,
+		"duration": 0.0,
+		"success":  success,
+		"skipped":  true,
+		"msg":      msg,
+	}
+	if dag == nil {
+		return logEntry
+	}
+	if !success {
+		dag.markFailed(key+"."+itemKey, msg)
+	}
+	dag.mu.Lock()
+	dag.skipped = append(dag.skipped, logEntry)
+	dag.mu.Unlock()
+	return logEntry
+}
+
+// skipItem tells if an item must not run, because an upstream failed or
+// because it already succeeded in the run being resumed
+func (etlx *ETLX) skipItem(key string, itemKey string) bool {
+	if upstream := etlx.dag.failedUpstream(key + "." + itemKey); upstream != "" {
+		etlx.formatProcessLogEntry(etlx.dag.skipItem(key, itemKey, fmt.Sprintf("Skipped: upstream %s failed", upstream), false, etlx.TimeZone))
+		return true
+	}
+	if etlx.State.resumeDone(key, itemKey, "") {
+		etlx.formatProcessLogEntry(etlx.dag.skipItem(key, itemKey, fmt.Sprintf("Skipped: already done in run %s", etlx.RunID), true, etlx.TimeZone))
+		return true
+	}
+	return false
+}
+
+// drainSkipped returns the skipped item logs recorded since the last call
+func (dag *dagRun) drainSkipped() []map[string]any {
+	if dag == nil {
+		return nil
+	}
+	dag.mu.Lock()
+	defer dag.mu.Unlock()
+	skipped := dag.skipped
+	dag.skipped = nil
+	return skipped
+}
+
+// observeLog marks the node of a failed log entry
+func (dag *dagRun) observeLog(entry map[string]any) {
+	if dag == nil {
+		return
+	}
+	if success, ok := entry["success"].(bool); !ok || success {
+		return
+	}
+	if retrying, _ := entry["retrying"].(bool); retrying {
+		return
+	}
+	key, _ := entry["key"].(string)
+	itemKey, _ := entry["item_key"].(string)
+	if key == "" {
+		name, _ := entry["name"].(string)
+		parts := strings.SplitN(name, "->", 2)
+		if len(parts) < 2 {
+			return
+		}
+		key, itemKey = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	}
+	msg, _ := entry["msg"].(string)
+	if itemKey != "" {
+		dag.markFailed(key+"."+itemKey, msg)
+	} else {
+		dag.markFailed(key, msg)
+	}
+}
+
+// formatProcessLogEntry keeps the DAG state of the running ETLX up to date
+// with every process log entry besides tracing it, logging it and passing it
+// to OnLog, the secrets in it masked
+func (etlx *ETLX) formatProcessLogEntry(entry map[string]any) {
+	secrets.MaskValue(entry)
+	etlx.dag.observeLog(entry)
+	etlx.tel.observeEntry(etlx.Context(), entry)
+	logProcessEntry(etlx.logger(), entry)
+	if etlx.OnLog != nil {
+		etlx.OnLog(entry)
+	}
+}
@@ -1,6 +1,7 @@
 package etlxlib
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/realdatadriven/etlx/internal/db"
+	"github.com/realdatadriven/etlx/internal/secrets"
 )
 
 func GetDB(conn string) (db.DBInterface, error) {
@@ -17,6 +19,15 @@ func GetDB(conn string) (db.DBInterface, error) {
 }
 
 func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
+	if etlx.DryRun {
+		return nil, fmt.Errorf("dry run: no connections are opened")
+	}
+	// NAMED CONNECTIONS (CONNECTIONS SECTION / FRONTMATTER)
+	if def, ok, err := etlx.namedConnection(conn); err != nil {
+		return nil, err
+	} else if ok {
+		return etlx.getNamedDB(def)
+	}
 	conn = etlx.ReplaceEnvVariable(conn)
 	driver, dsn, err := etlx.ParseConnection(conn)
 	if err != nil {
@@ -35,11 +46,11 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 	}
 	_dsn := etlx.ReplaceEnvVariable(dsn)
 	if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-		_file, err := etlx.TempFIle("", _dsn, fmt.Sprintf("query.%s.*.sql", "dns"))
+		_file, err := etlx.TempFIle("", secrets.Mask(_dsn), fmt.Sprintf("query.%s.*.sql", "dns"))
 		if err != nil {
-			fmt.Println(err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 		}
-		fmt.Println(_file)
+		etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 	}
 	var dbConn db.DBInterface
 	switch driver {
@@ -65,7 +76,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 		if driver2 != "" && driver2 != "duckdb" && err == nil {
 			_, err = dbConn.ExecuteQuery(fmt.Sprintf("INSTALL %s", driver2), []any{}...)
 			if err != nil {
-				fmt.Printf("INSTALL %s: %s", driver2, err)
+				etlx.logger().Warn("ducklake INSTALL failed", "driver", driver2, "err", err)
 			}
 			/*_, err = dbConn.ExecuteQuery(fmt.Sprintf("LOAD %s", driver2), []any{}...)
 			if err != nil {
@@ -92,7 +103,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 		// Handle quack driver specific logic
 		// to create expects dsn in the format quack:path/to/db.duckdb?token=value&name=value
 		filepath, params, err := etlx.ParseQuackFileDSN(_dsn)
-		fmt.Println("DSN:", conn, driver, dsn, filepath, params)
+		etlx.logger().Debug("quack connection", "path", filepath, "host", params["host"], "port", params["port"], "name", params["name"])
 		if err == nil {
 			host, ok := params["host"]
 			if !ok {
@@ -109,6 +120,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 					return nil, fmt.Errorf("%s DSN missing token parameter", driver)
 				}
 			}
+			secrets.Register(token)
 			// allow_other_hostname
 			allowOtherHostnames, ok := params["allow_other_hostnames"]
 			if !ok {
@@ -135,7 +147,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 					sql := fmt.Sprintf("DETACH %s", name)
 					_, err = dbConn.ExecuteQuery(sql, []any{}...)
 					if err != nil {
-						fmt.Printf("%s Error using QUACK: %s\n", driver, err)
+						etlx.logger().Error("quack DETACH failed", "name", name, "err", err)
 					}
 				}
 			}()
@@ -149,7 +161,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 				// fmt.Println(sql, etlx.IsPortOpen(host, port))
 				_, err = dbConn.ExecuteQuery(sql, []any{}...)
 				if err != nil {
-					fmt.Printf("1 %s Error starting QUACK server: %s\n", driver, err)
+					etlx.logger().Error("quack_serve failed", "host", host, "port", port, "err", err)
 					return nil, fmt.Errorf("%s Error setting up QUACK: %s", driver, err)
 				}
 			}
@@ -157,8 +169,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 			// fmt.Println(sql)
 			_, err = dbConn.ExecuteQuery(sql, []any{}...)
 			if err != nil {
-				fmt.Printf("2 %s Error starting QUACK server: %s\n", driver, err)
-				fmt.Println(sql)
+				etlx.logger().Error("quack ATTACH failed", "host", host, "port", port, "name", name, "err", err)
 				return nil, fmt.Errorf("%s Error setting up QUACK: %s", driver, err)
 			}
 			sql = fmt.Sprintf("USE %s", name)
@@ -216,10 +227,10 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 			}
 		}
 	case "odbc":
-		/*dbConn, err = db.NewODBC(_dsn)
+		dbConn, err = db.NewODBC(_dsn)
 		if err != nil {
 			return nil, fmt.Errorf("ODBC Conn: %s", err)
-		}*/
+		}
 	default:
 		dbConn, err = db.New(driver, _dsn)
 		if err != nil {
@@ -230,7 +241,7 @@ func (etlx *ETLX) GetDB(conn string) (db.DBInterface, error) {
 }
 
 func (etlx *ETLX) SetQueryPlaceholders(query string, table string, path string, dateRef []time.Time) string {
-	_query := etlx.ReplaceEnvVariable(query)
+	_query := etlx.ReplaceEnvVariable(etlx.ReplaceParams(query))
 	if table != "" {
 		_query = etlx.ReplaceFileTablePlaceholder("table", _query, table)
 	}
@@ -260,16 +271,19 @@ func (etlx *ETLX) Query(conn db.DBInterface, query string, item map[string]any,
 	}
 	query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
 	if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-		_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s_%s.*.sql", "valid", table))
+		_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s_%s.*.sql", "valid", table))
 		if err != nil {
-			fmt.Println(err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 		}
-		fmt.Println(_file)
+		etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 	}
-	data, cols, _, err := conn.QueryMultiRowsWithCols(query, []any{}...)
+	start := time.Now()
+	data, cols, _, err := conn.QueryMultiRowsWithColsContext(etlx.Context(), query, []any{}...)
 	if err != nil {
+		etlx.traceQuery(etlx.Context(), conn, item, "", step, start, -1, err)
 		return nil, nil, err
 	}
+	etlx.traceQuery(etlx.Context(), conn, item, "", step, start, int64(len(*data)), nil)
 	return data, cols, nil
 }
 
@@ -290,13 +304,15 @@ func (etlx *ETLX) ExecuteCondition(conn db.DBInterface, query string, item map[s
 	}
 	query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
 	if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-		_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s_%s.*.sql", "valid", table))
+		_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s_%s.*.sql", "valid", table))
 		if err != nil {
-			fmt.Println(err)
+			etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 		}
-		fmt.Println(_file)
+		etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 	}
-	data, cols, _, err := conn.QueryMultiRowsWithCols(query, []any{}...)
+	start := time.Now()
+	data, cols, _, err := conn.QueryMultiRowsWithColsContext(etlx.Context(), query, []any{}...)
+	etlx.traceQuery(etlx.Context(), conn, item, "", step, start, -1, err)
 	if err != nil {
 		return false, err
 	} else if len(cols) > 0 && len(*data) > 0 {
@@ -327,7 +343,7 @@ func (etlx *ETLX) ReplacePlaceholders(sql string, item map[string]any) (string,
 				// CHECK IF THERE IS A QUERY DOC WITH THE NAME
 				_sql, _, _, err := etlx.QueryBuilder(nil, queryName)
 				if err != nil {
-					fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", queryName, err)
+					etlx.itemLogger(item).Warn("QUERY_DOC failed", "query", queryName, "err", err)
 					_q, _e := etlx.Config[queryName].(string)
 					//fmt.Println(1, queryName, "[[]] IS A LOADED SQL STR QUERY?", _q, _e)
 					if _e {
@@ -342,7 +358,7 @@ func (etlx *ETLX) ReplacePlaceholders(sql string, item map[string]any) (string,
 		// If no replacement is found, keep the placeholder as is
 		return match
 	})
-	return updatedSQL, nil
+	return etlx.ReplaceParams(updatedSQL), nil
 }
 
 // ExtractDistinctQueryNames extracts a slice of distinct query names used in the format [[query_name]].
@@ -389,7 +405,7 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 				query = name
 				_sql, _, _, err := etlx.QueryBuilder(nil, name)
 				if err != nil {
-					fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", name, err)
+					etlx.itemLogger(item).Warn("QUERY_DOC failed", "query", name, "err", err)
 					_q, _e := etlx.Config[name].(string)
 					//fmt.Println(name, "IS A LOADED SQL STR QUERY?", _q, _e)
 					if _e {
@@ -403,17 +419,17 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 			}
 			updatedSQL, err := etlx.ReplacePlaceholders(query, item)
 			if err != nil {
-				fmt.Println("Error trying to get the placeholder:", err)
+				etlx.itemLogger(item).Warn("replacing the [[query]] placeholders failed", "err", err)
 			} else {
 				query = updatedSQL
 			}
 			query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
 			if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-				_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s.*.sql", queries))
+				_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s.*.sql", queries))
 				if err != nil {
-					fmt.Println(err)
+					etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 				}
-				fmt.Println(_file)
+				etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 			}
 			// CHECK IF DYN QUERY HAS DEPENDENCIES (before, after)
 			re := regexp.MustCompile(`\(([^,]+),([^)]+)\)`)
@@ -430,22 +446,22 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 			if before != "" {
 				err = etlx.ExecuteQuery(conn, before, item, fname, "", dateRef)
 				if err != nil {
-					fmt.Printf("getDynamicQueriesIfAny Before error: %s %s\n", before, err)
+					etlx.itemLogger(item).Warn("get_dyn_queries before query failed", "query", before, "err", err)
 				}
 			}
 			rows, _, err := etlx.Query(conn, query, item, fname, "", dateRef)
 			if after != "" {
 				err_ := etlx.ExecuteQuery(conn, after, item, fname, "", dateRef)
 				if err_ != nil {
-					fmt.Printf("getDynamicQueriesIfAny After error: %s %s\n", after, err)
+					etlx.itemLogger(item).Warn("get_dyn_queries after query failed", "query", after, "err", err)
 				}
 			}
 			if err != nil {
-				fmt.Printf("Err getting dyn_queries: %s %v", name, err)
+				etlx.itemLogger(item).Error("get_dyn_queries failed", "query", name, "err", err)
 			} else if len(*rows) > 0 {
 				_queries := []any{}
 				for _, value := range *rows {
-					fmt.Println(name, value["query"].(string))
+					etlx.itemLogger(item).Debug("get_dyn_queries", "query", name, "sql", value["query"])
 					_queries = append(_queries, value["query"])
 				}
 				return _queries, nil
@@ -460,7 +476,7 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 		for _, q := range queries {
 			queryKey, ok := q.(string)
 			if !ok {
-				fmt.Printf("invalid query key in slice")
+				etlx.itemLogger(item).Warn("invalid query key in slice", "query", q)
 				_queries = append(_queries, q)
 				continue
 			}
@@ -475,7 +491,7 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 					query = name
 					_sql, _, _, err := etlx.QueryBuilder(nil, name)
 					if err != nil {
-						fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", name, err)
+						etlx.itemLogger(item).Warn("QUERY_DOC failed", "query", name, "err", err)
 						_q, _e := etlx.Config[name].(string)
 						//fmt.Println(name, "IS A LOADED SQL STR QUERY?", _q, _e)
 						if _e {
@@ -489,17 +505,17 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 				}
 				updatedSQL, err := etlx.ReplacePlaceholders(query, item)
 				if err != nil {
-					fmt.Println("Error trying to get the placeholder:", err)
+					etlx.itemLogger(item).Warn("replacing the [[query]] placeholders failed", "err", err)
 				} else {
 					query = updatedSQL
 				}
 				query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
 				if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-					_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s.*.sql", queryKey))
+					_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s.*.sql", queryKey))
 					if err != nil {
-						fmt.Println(err)
+						etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 					}
-					fmt.Println(_file)
+					etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 				}
 				// CHECK IF DYN QUERY HAS DEPENDENCIES (before, after)
 				re := regexp.MustCompile(`\(([^,]+),([^)]+)\)`)
@@ -516,17 +532,17 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 				if before != "" {
 					err = etlx.ExecuteQuery(conn, before, item, fname, "", dateRef)
 					if err != nil {
-						fmt.Printf("getDynamicQueriesIfAny Before error:  %s %s\n", before, err)
+						etlx.itemLogger(item).Warn("get_dyn_queries before query failed", "query", before, "err", err)
 					}
 				}
 				//rows, _, err := etlx.Query(conn, query, item, fname, "", dateRef)
 				rows, _, err := etlx.Query(conn, query, item, fname, "", dateRef)
 				if err != nil {
-					fmt.Println("getDynamicQueriesIfAny:", query, name, err)
+					etlx.itemLogger(item).Error("get_dyn_queries failed", "query", name, "sql", query, "err", err)
 					// _queries = append(_queries, q)
 				} else if len(*rows) > 0 {
 					for _, value := range *rows {
-						fmt.Println(name, value["query"].(string))
+						etlx.itemLogger(item).Debug("get_dyn_queries", "query", name, "sql", value["query"])
 						_queries = append(_queries, value["query"])
 					}
 				} else {
@@ -535,7 +551,7 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 				if after != "" {
 					err = etlx.ExecuteQuery(conn, after, item, fname, "", dateRef)
 					if err != nil {
-						fmt.Printf("getDynamicQueriesIfAny After error: %s %s\n", after, err)
+						etlx.itemLogger(item).Warn("get_dyn_queries after query failed", "query", after, "err", err)
 					}
 				}
 			} else {
@@ -549,7 +565,43 @@ func (etlx *ETLX) getDynamicQueriesIfAny(conn db.DBInterface, sqlData any, item
 
 }
 
+// resolveQuery gets the final SQL of a query reference: the item field or
+// QUERY_DOC with that name (or the reference itself), with the [[query]],
+// env, table, file, tmp and date placeholders replaced
+func (etlx *ETLX) resolveQuery(queryKey string, item map[string]any, table string, fname string, dateRef []time.Time) string {
+	query, ok := item[queryKey].(string)
+	_, queryDoc := etlx.Config[queryKey]
+	if !ok && queryDoc {
+		query = queryKey
+		_sql, _, _, err := etlx.QueryBuilder(nil, queryKey)
+		if err != nil {
+			etlx.itemLogger(item).Warn("QUERY_DOC failed", "query", queryKey, "err", err)
+			_q, _e := etlx.Config[queryKey].(string)
+			//fmt.Println(queryKey, "IS A LOADED SQL STR QUERY?", _q, _e)
+			if _e {
+				query = _q
+			}
+		} else {
+			query = _sql
+		}
+	} else if !ok {
+		query = queryKey
+	}
+	updatedSQL, err := etlx.ReplacePlaceholders(query, item)
+	if err != nil {
+		etlx.itemLogger(item).Warn("replacing the [[query]] placeholders failed", "err", err)
+	} else {
+		query = updatedSQL
+	}
+	return etlx.SetQueryPlaceholders(query, table, fname, dateRef)
+}
+
 func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string]any, fname string, step string, dateRef []time.Time) error {
+	return etlx.ExecuteQueryContext(etlx.Context(), conn, sqlData, item, fname, step, dateRef)
+}
+
+// ExecuteQueryContext is ExecuteQuery with the queries bound to ctx
+func (etlx *ETLX) ExecuteQueryContext(ctx context.Context, conn db.DBInterface, sqlData any, item map[string]any, fname string, step string, dateRef []time.Time) error {
 	table := ""
 	metadata, ok := item["metadata"].(map[string]any)
 	if ok {
@@ -558,16 +610,9 @@ func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string
 			table, _ = metadata["name"].(string)
 		}
 	}
-	odbc2Csv := false
-	if _, ok := metadata["odbc_to_csv"]; ok {
-		odbc2Csv = metadata["odbc_to_csv"].(bool)
-	}
-	toCsv := false
-	if _, ok := metadata["to_csv"]; ok {
-		toCsv = metadata["to_csv"].(bool)
-	}
+	toFile := etlx.extractFormat(conn, metadata)
 	if fname == "" {
-		fname = fmt.Sprintf(`%s/%s_{YYYYMMDD}.csv`, os.TempDir(), table)
+		fname = etlx.extractFileName(fmt.Sprintf(`%s/%s_{YYYYMMDD}.csv`, os.TempDir(), table), metadata)
 	}
 	fname = etlx.SetQueryPlaceholders(fname, table, "", dateRef)
 	// CHECK FOR DYNAMIC GENERATE QUERIES
@@ -575,7 +620,7 @@ func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string
 	if err == nil {
 		sqlData = sqlDataAux
 	} else {
-		fmt.Println("getDynamicQueriesIfAny Err:", err)
+		etlx.itemLogger(item).Error("get_dyn_queries failed", "err", err)
 	}
 	switch queries := sqlData.(type) {
 	case nil:
@@ -583,41 +628,21 @@ func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string
 		return nil
 	case string:
 		// Single query reference
-		query, ok := item[queries].(string)
-		_, queryDoc := etlx.Config[queries]
-		if !ok && queryDoc {
-			query = queries
-			_sql, _, _, err := etlx.QueryBuilder(nil, queries)
+		query := etlx.resolveQuery(queries, item, table, fname, dateRef)
+		if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
+			_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s.*.sql", queries))
 			if err != nil {
-				fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", queries, err)
-				_q, _e := etlx.Config[queries].(string)
-				//fmt.Println(queries, "IS A LOADED SQL STR QUERY?", _q, _e)
-				if _e {
-					query = _q
-				}
-			} else {
-				query = _sql
+				_file, err = etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s.*.sql", ""))
 			}
-		} else if !ok {
-			query = queries
-		}
-		updatedSQL, err := etlx.ReplacePlaceholders(query, item)
-		if err != nil {
-			fmt.Println("Error trying to get the placeholder:", err)
-		} else {
-			query = updatedSQL
-		}
-		query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
-		if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-			_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s.*.sql", queries))
 			if err != nil {
-				fmt.Println(err)
-				etlx.TempFIle("", query, fmt.Sprintf("query.%s.*.sql", ""))
+				etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 			}
-			fmt.Println(_file)
+			etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 		}
-		if ((odbc2Csv && conn.GetDriverName() == "odbc") || toCsv) && step == "extract" {
-			_, err := conn.Query2CSV(query, fname)
+		start := time.Now()
+		if toFile != "" && (step == "extract" || step == "export") {
+			err := etlx.query2File(ctx, conn, toFile, query, fname, metadata)
+			etlx.traceQuery(ctx, conn, item, queries, step, start, -1, err)
 			if err != nil {
 				return err
 			}
@@ -628,9 +653,10 @@ func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string
 				_params = []any{}
 				_sql = query
 			}
-			_, err = conn.ExecuteQuery(_sql, _params)
+			_, err = conn.ExecuteQueryContext(ctx, _sql, _params)
+			etlx.traceQuery(ctx, conn, item, queries, step, start, -1, err)
 			if err != nil {
-				fmt.Println("ERRORS:", _sql, _params, err)
+				etlx.itemLogger(item).Debug("query failed", "sql", _sql, "params", fmt.Sprint(_params), "err", err)
 				return err
 			}
 		}
@@ -643,40 +669,18 @@ func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string
 				return fmt.Errorf("invalid query key in slice")
 			}
 			//fmt.Println(queryKey)
-			query, ok := item[queryKey].(string)
-			_, queryDoc := etlx.Config[queryKey]
-			if !ok && queryDoc {
-				query = queryKey
-				_sql, _, _, err := etlx.QueryBuilder(nil, queryKey)
-				if err != nil {
-					fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", queryKey, err)
-					_q, _e := etlx.Config[queryKey].(string)
-					//fmt.Println(queryKey, "IS A LOADED SQL STR QUERY?", _q, _e)
-					if _e {
-						query = _q
-					}
-				} else {
-					query = _sql
-				}
-			} else if !ok {
-				query = queryKey
-			}
-			updatedSQL, err := etlx.ReplacePlaceholders(query, item)
-			if err != nil {
-				fmt.Println("Error trying to get the placeholder:", err)
-			} else {
-				query = updatedSQL
-			}
-			query = etlx.SetQueryPlaceholders(query, table, fname, dateRef)
+			query := etlx.resolveQuery(queryKey, item, table, fname, dateRef)
 			if os.Getenv("ETLX_DEBUG_QUERY") == "true" {
-				_file, err := etlx.TempFIle("", query, fmt.Sprintf("query.%s.*.sql", queryKey))
+				_file, err := etlx.TempFIle("", secrets.Mask(query), fmt.Sprintf("query.%s.*.sql", queryKey))
 				if err != nil {
-					fmt.Println(err)
+					etlx.logger().Warn("ETLX_DEBUG_QUERY dump failed", "err", err)
 				}
-				fmt.Println(_file)
+				etlx.logger().Debug("ETLX_DEBUG_QUERY dump", "file", _file)
 			}
-			if ((odbc2Csv && conn.GetDriverName() == "odbc") || toCsv) && step == "extract" {
-				_, err := conn.Query2CSV(query, fname)
+			start := time.Now()
+			if toFile != "" && (step == "extract" || step == "export") {
+				err := etlx.query2File(ctx, conn, toFile, query, fname, metadata)
+				etlx.traceQuery(ctx, conn, item, queryKey, step, start, -1, err)
 				if err != nil {
 					return err
 				}
@@ -687,7 +691,8 @@ func (etlx *ETLX) ExecuteQuery(conn db.DBInterface, sqlData any, item map[string
 					_params = []any{}
 					_sql = query
 				}
-				_, err = conn.ExecuteQuery(_sql, _params)
+				_, err = conn.ExecuteQueryContext(ctx, _sql, _params)
+				etlx.traceQuery(ctx, conn, item, queryKey, step, start, -1, err)
 				if err != nil {
 					//fmt.Println(query, err)
 					return err
@@ -724,6 +729,10 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "ETL"); err != nil {
+		return nil, err
+	}
 	// fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -736,7 +745,9 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 	})
 	mainDescription := ""
 	// Define the runner as a simple function
-	ELTRunner := func(metadata map[string]any, itemKey string, item map[string]any) error {
+	ELTRunner := func(itemLogs *[]map[string]any, metadata map[string]any, itemKey string, item map[string]any) error {
+		// each item works on its own date ref, items may run in parallel
+		dateRef := dateRef
 		// ACTIVE
 		if active, okActive := metadata["active"]; okActive {
 			if !active.(bool) {
@@ -749,8 +760,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"success": true,
 					"msg":     "Deactivated",
 				}
-				processLogs = append(processLogs, logEntry)
-				formatProcessLogEntry(logEntry)
+				*itemLogs = append(*itemLogs, logEntry)
+				etlx.formatProcessLogEntry(logEntry)
 				return fmt.Errorf("deactivated %s", "")
 			}
 		}
@@ -771,10 +782,11 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 				"success": true,
 				"msg":     "Missing metadata in item",
 			}
-			processLogs = append(processLogs, logEntry)
-			formatProcessLogEntry(logEntry)
+			*itemLogs = append(*itemLogs, logEntry)
+			etlx.formatProcessLogEntry(logEntry)
 			return nil
 		}
+		retry := etlx.RetryPolicy(itemLogs, process, key, itemKey, metadata, itemMetadata)
 		itemDesc, ok := itemMetadata["description"].(string)
 		if !ok {
 			itemDesc = itemKey
@@ -791,8 +803,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"success": true,
 					"msg":     "Deactivated",
 				}
-				processLogs = append(processLogs, logEntry)
-				formatProcessLogEntry(logEntry)
+				*itemLogs = append(*itemLogs, logEntry)
+				etlx.formatProcessLogEntry(logEntry)
 				return nil
 			}
 		}
@@ -800,7 +812,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 		if only, okOnly := extraConf["only"]; okOnly {
 			//fmt.Println("ONLY", only, len(only.([]string)))
 			if len(only.([]string)) == 0 {
-			} else if !etlx.Contains(only.([]string), itemKey) {
+			} else if !etlx.matchesItem(only.([]string), itemKey, itemMetadata) {
 				logEntry := map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
@@ -810,15 +822,15 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"success": true,
 					"msg":     "Excluded from the process",
 				}
-				processLogs = append(processLogs, logEntry)
-				formatProcessLogEntry(logEntry)
+				*itemLogs = append(*itemLogs, logEntry)
+				etlx.formatProcessLogEntry(logEntry)
 				return nil
 			}
 		}
 		if skip, okSkip := extraConf["skip"]; okSkip {
 			//fmt.Println("SKIP", skip, len(skip.([]string)))
 			if len(skip.([]string)) == 0 {
-			} else if etlx.Contains(skip.([]string), itemKey) {
+			} else if etlx.matchesItem(skip.([]string), itemKey, itemMetadata) {
 				logEntry := map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
@@ -828,8 +840,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"success": true,
 					"msg":     "Excluded from the process",
 				}
-				processLogs = append(processLogs, logEntry)
-				formatProcessLogEntry(logEntry)
+				*itemLogs = append(*itemLogs, logEntry)
+				etlx.formatProcessLogEntry(logEntry)
 				return nil
 			}
 		}
@@ -876,7 +888,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 			if steps, ok := extraConf["steps"]; ok {
 				if len(steps.([]string)) == 0 {
 				} else if !etlx.Contains(steps.([]string), step) {
-					processLogs = append(processLogs, map[string]any{
+					*itemLogs = append(*itemLogs, map[string]any{
 						"process":     process,
 						"name":        fmt.Sprintf("%s->%s->%s", key, itemKey, step),
 						"description": itemDesc,
@@ -888,6 +900,20 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					continue
 				}
 			}
+			// ALREADY DONE IN THE RUN BEING RESUMED
+			if etlx.State.resumeDone(key, itemKey, step) {
+				*itemLogs = append(*itemLogs, map[string]any{
+					"process":     process,
+					"name":        fmt.Sprintf("%s->%s->%s", key, itemKey, step),
+					"description": itemDesc,
+					"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
+					"end_at":  time.Now().In(etlx.TimeZone),
+					"success": true,
+					"skipped": true,
+					"msg":     fmt.Sprintf("STEP %s already done in run %s", step, etlx.RunID),
+				})
+				continue
+			}
 			start3 := time.Now().In(etlx.TimeZone)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 			_log2 := map[string]any{
@@ -960,7 +986,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 			}
 			conn := itemMetadata[step+"_conn"]
 			if conn == nil {
-				conn = mainConn // Fallback to main connection
+				conn = itemConnection(itemMetadata, mainConn)
 				if conn == "" {
 					conn = "duckdb:"
 				}
@@ -975,9 +1001,6 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					dtRef = dateRef[0].Format("2006-01-02")
 				}
 			}
-			if processLogs[0]["ref"] == nil && dtRef != nil {
-				processLogs[0]["ref"] = dtRef
-			}
 			// CONNECTION
 			start4 := time.Now().In(etlx.TimeZone)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -989,7 +1012,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 				"ref":             dtRef,
 				"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 			}
-			dbConn, err := etlx.GetDB(conn.(string))
+			dbConn, err := retry.GetDB(conn.(string))
 			if err != nil {
 				mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 				_log3["success"] = false
@@ -1000,8 +1023,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 				_log3["mem_total_alloc_end"] = mem_total_alloc
 				_log3["mem_sys_end"] = mem_sys
 				_log3["num_gc_end"] = num_gc
-				processLogs = append(processLogs, _log3)
-				formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
 				//return fmt.Errorf("%s -> %s -> %s ERR: connecting to %s in : %s", key, step, itemKey, conn, err)
 				continue
 			}
@@ -1015,7 +1038,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 			_log3["mem_total_alloc_end"] = mem_total_alloc
 			_log3["mem_sys_end"] = mem_sys
 			_log3["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log3)
+			*itemLogs = append(*itemLogs, _log3)
 			// FILE
 			table, ok := itemMetadata["table"].(string)
 			if !ok {
@@ -1036,10 +1059,12 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					}
 				} else if filepath.Dir(fname) != "" {
 					// handler for wen its not a temp file and ists not a full path
-					fmt.Printf("NO handler for files thats not in trmp dir and does not have a full path %s", fname)
+					etlx.logger("key", key, "item", itemKey).Debug("file not in the tmp dir and without a full path", "file", fname)
 				}
 			} else if file != "" {
 				fname = file
+			} else {
+				fname = etlx.extractFileName(fname, itemMetadata)
 			}
 			// Process before SQL
 			if okBefore && beforeSQL != nil {
@@ -1055,7 +1080,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 				}
 				//fmt.Println(_log3)
 				//fmt.Println(beforeSQL)
-				err = etlx.ExecuteQuery(dbConn, beforeSQL, item, fname, step, dateRef)
+				err = retry.ExecuteQuery(dbConn, beforeSQL, item, fname, step, dateRef)
 				if err != nil {
 					_err_by_pass := false
 					if okBefErrPatt && onBefErrPatt != nil && okBefErrSQL && onBefErrSQL != nil {
@@ -1072,7 +1097,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 							_log3["mem_sys_end"] = mem_sys
 							_log3["num_gc_end"] = num_gc
 						} else if re.MatchString(string(err.Error())) {
-							err = etlx.ExecuteQuery(dbConn, onBefErrSQL.(string), item, fname, step, dateRef)
+							err = retry.ExecuteQuery(dbConn, onBefErrSQL.(string), item, fname, step, dateRef)
 							if err != nil {
 								mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 								_log3["success"] = false
@@ -1085,7 +1110,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 								_log3["num_gc_end"] = num_gc
 							} else {
 								_err_by_pass = true
-								err = etlx.ExecuteQuery(dbConn, beforeSQL, item, fname, step, dateRef)
+								err = retry.ExecuteQuery(dbConn, beforeSQL, item, fname, step, dateRef)
 								if err != nil {
 									_err_by_pass = false
 								}
@@ -1102,8 +1127,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 						_log3["mem_total_alloc_end"] = mem_total_alloc
 						_log3["mem_sys_end"] = mem_sys
 						_log3["num_gc_end"] = num_gc
-						processLogs = append(processLogs, _log3)
-						formatProcessLogEntry(_log3)
+						*itemLogs = append(*itemLogs, _log3)
+						etlx.formatProcessLogEntry(_log3)
 						//return fmt.Errorf("%s -> %s -> %s ERR: Before: %s", key, step, itemKey, err)
 						continue
 					}
@@ -1118,8 +1143,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
 				}
-				processLogs = append(processLogs, _log3)
-				formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
 			}
 			// check condition
 			condition, okCondition := itemMetadata[step+"_condition"].(string)
@@ -1137,8 +1162,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_total_alloc_end"] = mem_total_alloc
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log3)
-					formatProcessLogEntry(_log3)
+					*itemLogs = append(*itemLogs, _log3)
+					etlx.formatProcessLogEntry(_log3)
 					// return fmt.Errorf("%s", _log3["msg"])
 					failedCondition = true
 				} else if !cond {
@@ -1154,8 +1179,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					if okCondMsg && condMsg != "" {
 						_log3["msg"] = fmt.Sprintf("%s -> %s -> %s COND: failed %s", key, step, itemKey, etlx.SetQueryPlaceholders(condMsg, table, fname, dateRef))
 					}
-					processLogs = append(processLogs, _log3)
-					formatProcessLogEntry(_log3)
+					*itemLogs = append(*itemLogs, _log3)
+					etlx.formatProcessLogEntry(_log3)
 					//return fmt.Errorf("%s", _log3["msg"])
 					failedCondition = true
 				}
@@ -1190,8 +1215,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 								}
 							}
 							if !rule_active {
-								processLogs = append(processLogs, _log3)
-								formatProcessLogEntry(_log3)
+								*itemLogs = append(*itemLogs, _log3)
+								etlx.formatProcessLogEntry(_log3)
 								continue
 							}
 							//fmt.Println(_valid["type"].(string), _valid["sql"].(string), _valid["msg"].(string))
@@ -1203,7 +1228,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 							res, _, err := etlx.Query(dbConn, _sql, item, fname, step, dateRef)
 							if err != nil {
 								mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
-								fmt.Printf("%s -> %s -> %s ERR VALID (%s): %s\n", key, step, itemKey, _valid["sql"], err)
+								etlx.logger("key", key, "item", itemKey).Error("validation query failed", "step", step, "sql", _valid["sql"], "err", err)
 							} else {
 								msg := etlx.SetQueryPlaceholders(_valid["msg"].(string), table, fname, dateRef)
 								validErr = msg
@@ -1215,8 +1240,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 									_log3["end_at"] = time.Now().In(etlx.TimeZone)
 									_log3["duration"] = time.Since(start4).Seconds()
 									isValid = false
-									formatProcessLogEntry(_log3)
-									processLogs = append(processLogs, _log3)
+									etlx.formatProcessLogEntry(_log3)
+									*itemLogs = append(*itemLogs, _log3)
 									break
 								} else if len(*res) == 0 && _valid["type"].(string) == "trow_if_empty" {
 									_log3["success"] = false
@@ -1224,8 +1249,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 									_log3["end_at"] = time.Now().In(etlx.TimeZone)
 									_log3["duration"] = time.Since(start4).Seconds()
 									isValid = false
-									formatProcessLogEntry(_log3)
-									processLogs = append(processLogs, _log3)
+									etlx.formatProcessLogEntry(_log3)
+									*itemLogs = append(*itemLogs, _log3)
 									break
 								} else {
 									_log3["success"] = true
@@ -1238,8 +1263,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 							_log3["mem_total_alloc_end"] = mem_total_alloc
 							_log3["mem_sys_end"] = mem_sys
 							_log3["num_gc_end"] = num_gc
-							formatProcessLogEntry(_log3)
-							processLogs = append(processLogs, _log3)
+							etlx.formatProcessLogEntry(_log3)
+							*itemLogs = append(*itemLogs, _log3)
 						}
 					}
 				}
@@ -1258,14 +1283,14 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 						ext := strings.Replace(filepath.Ext(fname), ".", "", 1)
 						// fmt.Println("FROM FILE:", ext, fromFileSQL[ext])
 						if _sql, ok := fromFileSQL[ext]; ok {
-							err = etlx.ExecuteQuery(dbConn, _sql, item, fname, step, dateRef)
+							err = retry.ExecuteQuery(dbConn, _sql, item, fname, step, dateRef)
 						} else if _sql, ok := fromFileSQL["others"]; ok {
-							err = etlx.ExecuteQuery(dbConn, _sql, item, fname, step, dateRef)
+							err = retry.ExecuteQuery(dbConn, _sql, item, fname, step, dateRef)
 						} else {
-							err = etlx.ExecuteQuery(dbConn, mainSQL, item, fname, step, dateRef)
+							err = retry.ExecuteQuery(dbConn, mainSQL, item, fname, step, dateRef)
 						}
 					} else {
-						err = etlx.ExecuteQuery(dbConn, mainSQL, item, fname, step, dateRef)
+						err = retry.ExecuteQuery(dbConn, mainSQL, item, fname, step, dateRef)
 					}
 					if err != nil {
 						_err_by_pass := false
@@ -1283,7 +1308,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 								_log3["mem_sys_end"] = mem_sys
 								_log3["num_gc_end"] = num_gc
 							} else if re.MatchString(string(err.Error())) {
-								err = etlx.ExecuteQuery(dbConn, onErrSQL.(string), item, fname, step, dateRef)
+								err = retry.ExecuteQuery(dbConn, onErrSQL.(string), item, fname, step, dateRef)
 								mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 								if err != nil {
 									_log3["success"] = false
@@ -1333,8 +1358,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
 				}
-				processLogs = append(processLogs, _log3)
-				formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
 			}
 			// Process CLEAN SQL
 			if clean.(bool) && okClean {
@@ -1348,7 +1373,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"ref":             dtRef,
 					"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 				}
-				err = etlx.ExecuteQuery(dbConn, cleanSQL, item, fname, step, dateRef)
+				err = retry.ExecuteQuery(dbConn, cleanSQL, item, fname, step, dateRef)
 				if err != nil {
 					mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 					_log3["success"] = false
@@ -1371,8 +1396,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
 				}
-				processLogs = append(processLogs, _log3)
-				formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
 			}
 			// Process DROP SQL
 			if drop.(bool) && okDrop {
@@ -1386,7 +1411,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"ref":             dtRef,
 					"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 				}
-				err = etlx.ExecuteQuery(dbConn, dropSQL, item, fname, step, dateRef)
+				err = retry.ExecuteQuery(dbConn, dropSQL, item, fname, step, dateRef)
 				if err != nil {
 					mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 					_log3["success"] = false
@@ -1409,8 +1434,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
 				}
-				processLogs = append(processLogs, _log3)
-				formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
 			}
 			// Process ROWS SQL
 			if rows.(bool) && okRows {
@@ -1463,8 +1488,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
 				}
-				formatProcessLogEntry(_log3)
-				processLogs = append(processLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
 			}
 			// Process after SQL
 			if okAfter && afterSQL != nil {
@@ -1479,7 +1504,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 				}
 				//fmt.Println(afterSQL)
-				err = etlx.ExecuteQuery(dbConn, afterSQL, item, fname, step, dateRef)
+				err = retry.ExecuteCleanup(dbConn, afterSQL, item, fname, step, dateRef)
 				if err != nil {
 					_err_by_pass := false
 					if okAfterErrPatt && onAfterErrPatt != nil && okAfterErrSQL && onAfterErrSQL != nil {
@@ -1496,7 +1521,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 							_log3["mem_sys_end"] = mem_sys
 							_log3["num_gc_end"] = num_gc
 						} else if re.MatchString(string(err.Error())) {
-							err = etlx.ExecuteQuery(dbConn, onAfterErrSQL.(string), item, fname, step, dateRef)
+							err = retry.ExecuteCleanup(dbConn, onAfterErrSQL.(string), item, fname, step, dateRef)
 							if err != nil {
 								mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 								_log3["success"] = false
@@ -1509,7 +1534,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 								_log3["num_gc_end"] = num_gc
 							} else {
 								_err_by_pass = true
-								err = etlx.ExecuteQuery(dbConn, afterSQL, item, fname, step, dateRef)
+								err = retry.ExecuteCleanup(dbConn, afterSQL, item, fname, step, dateRef)
 								if err != nil {
 									_err_by_pass = false
 								}
@@ -1538,12 +1563,11 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 					_log3["mem_sys_end"] = mem_sys
 					_log3["num_gc_end"] = num_gc
 				}
-				//processLogs = append(processLogs, _log3)
+				etlx.formatProcessLogEntry(_log3)
+				*itemLogs = append(*itemLogs, _log3)
 			}
 			_log2["end_at"] = time.Now().In(etlx.TimeZone)
 			_log2["duration"] = time.Since(start3).Seconds()
-			formatProcessLogEntry(_log3)
-			processLogs = append(processLogs, _log3)
 		}
 		mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 		_log1["end_at"] = time.Now().In(etlx.TimeZone)
@@ -1552,8 +1576,8 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 		_log1["mem_total_alloc_end"] = mem_total_alloc
 		_log1["mem_sys_end"] = mem_sys
 		_log1["num_gc_end"] = num_gc
-		processLogs = append(processLogs, _log1)
-		formatProcessLogEntry(_log1)
+		*itemLogs = append(*itemLogs, _log1)
+		etlx.formatProcessLogEntry(_log1)
 		return nil
 	}
 	// Check if the input conf is nil or empty
@@ -1562,7 +1586,7 @@ func (etlx *ETLX) RunETL(dateRef []time.Time, conf map[string]any, extraConf map
 	}
 	mem_alloc, mem_total_alloc, mem_sys, num_gc := etlx.RuntimeMemStats()
 	// Process the MD KEY
-	err := etlx.ProcessMDKey(key, conf, ELTRunner)
+	err := etlx.ProcessMDKeyParallel(key, conf, &processLogs, ELTRunner)
 	if err != nil {
 		return processLogs, fmt.Errorf("%s failed: %v", key, err)
 	}
@@ -93,7 +93,7 @@ func clearEntireSheetContent(f *excelize.File, sheetName string) {
 	// Get all rows to determine the range
 	rows, err := f.GetRows(sheetName)
 	if err != nil {
-		fmt.Printf("Error getting rows: %v\n", err)
+		Logger().Error("getting the rows failed", "sheet", sheetName, "err", err)
 		return
 	}
 
@@ -228,6 +228,10 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "EXPORTS"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -239,12 +243,14 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 	})
 	mainDescription := ""
 	// Define the runner as a simple function
-	EXPORTSRunner := func(metadata map[string]any, itemKey string, item map[string]any) error {
+	EXPORTSRunner := func(itemLogs *[]map[string]any, metadata map[string]any, itemKey string, item map[string]any) error {
+		// each item works on its own date ref, items may run in parallel
+		dateRef := dateRef
 		// fmt.Println(metadata, itemKey, item)
 		// ACTIVE
 		if active, okActive := metadata["active"]; okActive {
 			if !active.(bool) {
-				processLogs = append(processLogs, map[string]any{
+				*itemLogs = append(*itemLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("KEY %s", key),
 					"description": metadata["description"].(string),
@@ -269,13 +275,13 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			}
 		}
 		mainConn, _ := metadata["connection"].(string)
-		mainDescription = metadata["description"].(string)
 		itemMetadata, ok := item["metadata"].(map[string]any)
 		if !ok {
-			processLogs = append(processLogs, map[string]any{
+			description, _ := itemMetadata["description"].(string)
+			*itemLogs = append(*itemLogs, map[string]any{
 				"process":     process,
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"].(string),
+				"description": description,
 				"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
 				"end_at":  time.Now().In(etlx.TimeZone),
 				"success": true,
@@ -283,10 +289,11 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			})
 			return nil
 		}
+		retry := etlx.RetryPolicy(itemLogs, process, key, itemKey, metadata, itemMetadata)
 		// ACTIVE
 		if active, okActive := itemMetadata["active"]; okActive {
 			if !active.(bool) {
-				processLogs = append(processLogs, map[string]any{
+				*itemLogs = append(*itemLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
 					"description": itemMetadata["description"].(string),
@@ -301,8 +308,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 		if only, okOnly := extraConf["only"]; okOnly {
 			//fmt.Println("ONLY", only, len(only.([]string)))
 			if len(only.([]string)) == 0 {
-			} else if !etlx.Contains(only.([]string), itemKey) {
-				processLogs = append(processLogs, map[string]any{
+			} else if !etlx.matchesItem(only.([]string), itemKey, itemMetadata) {
+				*itemLogs = append(*itemLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
 					"description": itemMetadata["description"].(string),
@@ -317,8 +324,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 		if skip, okSkip := extraConf["skip"]; okSkip {
 			//fmt.Println("SKIP", skip, len(skip.([]string)))
 			if len(skip.([]string)) == 0 {
-			} else if etlx.Contains(skip.([]string), itemKey) {
-				processLogs = append(processLogs, map[string]any{
+			} else if etlx.matchesItem(skip.([]string), itemKey, itemMetadata) {
+				*itemLogs = append(*itemLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
 					"description": itemMetadata["description"].(string),
@@ -342,7 +349,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 		}*/
 		mapping, okMapping := itemMetadata["mapping"]
 		tmpPrefix, okTmpPrefix := itemMetadata["tmp_prefix"]
-		conn, okCon := itemMetadata["connection"]
+		conn := itemConnection(itemMetadata, mainConn)
 		dtRef, okDtRef := itemMetadata["date_ref"]
 		if okDtRef && dtRef != "" {
 			_dt, err := time.Parse("2006-01-02", dtRef.(string))
@@ -354,9 +361,6 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				dtRef = dateRef[0].Format("2006-01-02")
 			}
 		}
-		if processLogs[0]["ref"] == nil {
-			processLogs[0]["ref"] = dtRef
-		}
 		start3 := time.Now().In(etlx.TimeZone)
 		mem_alloc, mem_total_alloc, mem_sys, num_gc := etlx.RuntimeMemStats()
 		_log2 := map[string]any{
@@ -367,10 +371,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			"ref":             dtRef,
 			"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 		}
-		if !okCon {
-			conn = mainConn
-		}
-		dbConn, err := etlx.GetDB(conn.(string))
+		dbConn, err := retry.GetDB(conn)
 		if err != nil {
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 			_log2["success"] = false
@@ -381,8 +382,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			_log2["mem_total_alloc_end"] = mem_total_alloc
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 			return nil
 		}
 		defer dbConn.Close()
@@ -390,8 +391,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 		_log2["msg"] = fmt.Sprintf("%s -> %s CONN: connection to %s successfull", key, itemKey, conn)
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
-		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		*itemLogs = append(*itemLogs, _log2)
+		etlx.formatProcessLogEntry(_log2)
 		// FILE
 		table := itemMetadata["name"].(string)
 		path, okPath := itemMetadata["path"].(string)
@@ -415,7 +416,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			fname = fmt.Sprintf(`%s/%s_{YYYYMMDD}.csv`, mainPath, table)
 		}
 		//fmt.Println(1, path, fname)
-		fname = etlx.SetQueryPlaceholders(fname, table, "", dateRef)
+		fname = etlx.extractFileName(etlx.SetQueryPlaceholders(fname, table, "", dateRef), itemMetadata)
 		//fmt.Println(2, path, fname)
 		// QUERIES TO RUN AT beginning
 		if okBefore {
@@ -429,7 +430,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				"ref":             dtRef,
 				"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 			}
-			err = etlx.ExecuteQuery(dbConn, beforeSQL, item, fname, "", dateRef)
+			err = retry.ExecuteQuery(dbConn, beforeSQL, item, fname, "", dateRef)
 			_log2["end_at"] = time.Now().In(etlx.TimeZone)
 			_log2["duration"] = time.Since(start3).Seconds()
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -444,8 +445,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["success"] = true
 				_log2["msg"] = fmt.Sprintf("%s -> %s Before ", key, itemKey)
 			}
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		}
 		// CHECK CONDITION
 		condition, okCondition := itemMetadata["condition"].(string)
@@ -468,8 +469,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["msg"] = fmt.Sprintf("%s -> %s COND: failed %s", key, itemKey, err)
 				_log2["end_at"] = time.Now().In(etlx.TimeZone)
 				_log2["duration"] = time.Since(start3).Seconds()
-				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				*itemLogs = append(*itemLogs, _log2)
+				etlx.formatProcessLogEntry(_log2)
 				//return fmt.Errorf("%s", _log2["msg"])
 				failedCondition = true
 			} else if !cond {
@@ -480,8 +481,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				if okCondMsg && condMsg != "" {
 					_log2["msg"] = fmt.Sprintf("%s -> %s COND: failed %s", key, itemKey, etlx.SetQueryPlaceholders(condMsg, table, fname, dateRef))
 				}
-				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				*itemLogs = append(*itemLogs, _log2)
+				etlx.formatProcessLogEntry(_log2)
 				// return fmt.Errorf("%s", _log2["msg"])
 				failedCondition = true
 			}
@@ -498,7 +499,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				"ref":             dtRef,
 				"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 			}
-			err = etlx.ExecuteQuery(dbConn, exportSQL, item, fname, "", dateRef)
+			err = retry.ExecuteQuery(dbConn, exportSQL, item, fname, "export", dateRef)
 			if err != nil {
 				mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 				_log2["success"] = false
@@ -531,8 +532,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 			}
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		} else if okTemplate && okMapping && !failedCondition {
 			start3 := time.Now().In(etlx.TimeZone)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -565,8 +566,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["mem_total_alloc_end"] = mem_total_alloc
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
-				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				*itemLogs = append(*itemLogs, _log2)
+				etlx.formatProcessLogEntry(_log2)
 				return nil
 			} else {
 				ext := filepath.Ext(template.(string))
@@ -580,8 +581,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					_log2["mem_total_alloc_end"] = mem_total_alloc
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					*itemLogs = append(*itemLogs, _log2)
+					etlx.formatProcessLogEntry(_log2)
 					return nil
 				}
 				// Open or create a new workbook
@@ -599,13 +600,13 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 						_log2["mem_total_alloc_end"] = mem_total_alloc
 						_log2["mem_sys_end"] = mem_sys
 						_log2["num_gc_end"] = num_gc
-						processLogs = append(processLogs, _log2)
-						formatProcessLogEntry(_log2)
+						*itemLogs = append(*itemLogs, _log2)
+						etlx.formatProcessLogEntry(_log2)
 						return nil
 					}
 					defer func() {
 						if err := file.Close(); err != nil {
-							fmt.Printf("failed to close the file: %v", err)
+							etlx.logger("key", key, "item", itemKey).Error("failed to close the file", "err", err)
 						}
 					}()
 				} else {
@@ -618,8 +619,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					_log2["mem_total_alloc_end"] = mem_total_alloc
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					*itemLogs = append(*itemLogs, _log2)
+					etlx.formatProcessLogEntry(_log2)
 					return nil
 				}
 				_mapp := []map[string]any{}
@@ -634,8 +635,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					_log2["mem_total_alloc_end"] = mem_total_alloc
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					*itemLogs = append(*itemLogs, _log2)
+					etlx.formatProcessLogEntry(_log2)
 					return nil
 				case string:
 					// Single query reference
@@ -657,8 +658,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 						_log2["mem_total_alloc_end"] = mem_total_alloc
 						_log2["mem_sys_end"] = mem_sys
 						_log2["num_gc_end"] = num_gc
-						processLogs = append(processLogs, _log2)
-						formatProcessLogEntry(_log2)
+						*itemLogs = append(*itemLogs, _log2)
+						etlx.formatProcessLogEntry(_log2)
 						return nil
 					}
 					_mapp = *rows
@@ -676,8 +677,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					_log2["mem_total_alloc_end"] = mem_total_alloc
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					*itemLogs = append(*itemLogs, _log2)
+					etlx.formatProcessLogEntry(_log2)
 					return nil
 				}
 				if len(_mapp) == 0 {
@@ -690,8 +691,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					_log2["mem_total_alloc_end"] = mem_total_alloc
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					*itemLogs = append(*itemLogs, _log2)
+					etlx.formatProcessLogEntry(_log2)
 					return nil
 				}
 				for _, detail := range _mapp {
@@ -724,7 +725,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 						if if_exists == "delete" {
 							if table != "" {
 								if err := file.DeleteTable(table); err != nil {
-									fmt.Printf("failed to delete table %s: %s\n", table, err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to delete the table", "table", table, "err", err)
 								}
 							}
 							file.DeleteSheet(sheet)
@@ -736,7 +737,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							// Clear especific range in the sheet
 							err := clearSpecificRange(file, sheet, clear_range)
 							if err != nil {
-								fmt.Printf("failed to clear range %s in sheet %s: %s\n", clear_range, sheet, err)
+								etlx.logger("key", key, "item", itemKey).Error("failed to clear the range", "sheet", sheet, "range", clear_range, "err", err)
 							}
 						}
 					}
@@ -761,14 +762,14 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							_log2["mem_total_alloc_end"] = mem_total_alloc
 							_log2["mem_sys_end"] = mem_sys
 							_log2["num_gc_end"] = num_gc
-							processLogs = append(processLogs, _log2)
-							formatProcessLogEntry(_log2)
+							*itemLogs = append(*itemLogs, _log2)
+							etlx.formatProcessLogEntry(_log2)
 							continue
 						}
 					}
 					startRow, col, err := getStartOfRange(_range)
 					if err != nil {
-						fmt.Printf("Error for '%s': %v\n", _range, err)
+						etlx.logger("key", key, "item", itemKey).Warn("invalid range, A1 used", "range", _range, "err", err)
 						startRow, col = 1, "A"
 					}
 					// Convert the start column to an integer offset
@@ -791,13 +792,13 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							for fld, rng := range rangeMap {
 								startRow, col, err := getStartOfRange(rng.(string))
 								if err != nil {
-									fmt.Printf("Error for '%s': %v\n", rng, err)
+									etlx.logger("key", key, "item", itemKey).Warn("invalid range, A1 used", "range", rng, "err", err)
 									startRow, col = 1, "A"
 								}
 								startColIndex := int(strings.ToUpper(col)[0] - 'A')
 								cell, err := excelize.JoinCellName(columnIndexToName(startColIndex), startRow)
 								if err != nil {
-									fmt.Printf("failed to set columns: %s\n", err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 								}
 								if _, ok := _val[fld]; ok {
 									file.SetCellValue(sheet, cell, _val[fld])
@@ -810,7 +811,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							// fmt.Println(columnIndexToName(startColIndex))
 							cell, err := excelize.JoinCellName(columnIndexToName(startColIndex), startRow)
 							if err != nil {
-								fmt.Printf("failed to set columns: %s\n", err)
+								etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 							}
 							if len((*rows)) > 0 {
 								_val := (*rows)[0]
@@ -827,7 +828,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					case "formula":
 						if okFormula && formula != "" {
 							if err := file.SetCellFormula(sheet, _range, formula); err != nil {
-								fmt.Printf("Failed to set formula: %v", err)
+								etlx.logger("key", key, "item", itemKey).Error("failed to set the formula", "sheet", sheet, "range", _range, "err", err)
 							}
 						}
 					default:
@@ -838,7 +839,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 								// cell, err := excelize.JoinCellName(string(rune('A'+startColIndex+colIdx)), startRow)
 								cell, err := excelize.JoinCellName(columnIndexToName(startColIndex+colIdx), startRow)
 								if err != nil {
-									fmt.Printf("failed to set columns: %s\n", err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 								}
 								file.SetCellValue(sheet, cell, colName)
 							}
@@ -852,13 +853,13 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 								//cell, err := excelize.JoinCellName(string(rune('A'+startColIndex+colIdx)), rowIdx)
 								/*cell, err := excelize.JoinCellName(columnIndexToName(startColIndex+colIdx), rowIdx)
 								if err != nil {
-									fmt.Printf("failed to set columns: %s\n", err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 								}
 								file.SetCellValue(sheet, cell, value[colName])*/
 							}
 							cell, err := excelize.JoinCellName(columnIndexToName(startColIndex), rowIdx)
 							if err != nil {
-								fmt.Printf("failed to set columns: %s\n", err)
+								etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 							}
 							file.SetSheetRow(sheet, cell, &rowValues)
 							rowIdx++
@@ -868,12 +869,12 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							//startCell, err := excelize.JoinCellName(string(rune('A'+startColIndex)), startRow)
 							startCell, err := excelize.JoinCellName(columnIndexToName(startColIndex), startRow)
 							if err != nil {
-								fmt.Printf("failed to set columns: %s\n", err)
+								etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 							}
 							//endCell, err := excelize.JoinCellName(string(rune('A'+startColIndex+len(columns)-1)), rowIdx-1)
 							endCell, err := excelize.JoinCellName(columnIndexToName(startColIndex+len(columns)-1), rowIdx-1)
 							if err != nil {
-								fmt.Printf("failed to set columns: %s\n", err)
+								etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 							}
 							tableRange := fmt.Sprintf("%s:%s", startCell, endCell)
 							//fmt.Printf("table: %s sheet: %s range: %s\n", table, sheet, tableRange)
@@ -896,7 +897,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 									ShowColumnStripes: false,
 								})
 								if err != nil {
-									fmt.Printf("failed to create table %s on sheet %s range %s: %s\n", table, sheet, tableRange, err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to create the table", "table", table, "sheet", sheet, "range", tableRange, "err", err)
 								}
 							}
 						}
@@ -920,17 +921,17 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 								//startCell, err := excelize.JoinCellName(string(rune('A'+formulaColIndex)), startRow+1)
 								startCell, err := excelize.JoinCellName(columnIndexToName(formulaColIndex), startRow+1)
 								if err != nil {
-									fmt.Printf("failed to set columns: %s\n", err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 								}
 								//endCell, err := excelize.JoinCellName(string(rune('A'+formulaColIndex)), rowIdx-1)
 								endCell, err := excelize.JoinCellName(columnIndexToName(formulaColIndex), rowIdx-1)
 								if err != nil {
-									fmt.Printf("failed to set columns: %s\n", err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to set the columns", "err", err)
 								}
 								_range := fmt.Sprintf("%s:%s", startCell, endCell)
-								fmt.Println(sheet, _range, _formula)
+								etlx.logger("key", key, "item", itemKey).Debug("setting the formula", "sheet", sheet, "range", _range, "formula", _formula)
 								if err := file.SetCellFormula(sheet, _range, _formula); err != nil {
-									fmt.Printf("Failed to set formula: %v\n", err)
+									etlx.logger("key", key, "item", itemKey).Error("failed to set the formula", "sheet", sheet, "range", _range, "err", err)
 								}
 							}
 						}
@@ -950,7 +951,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				//fmt.Println(outputFile)
 				err = file.UpdateLinkedValue()
 				if err != nil {
-					fmt.Println("UpdateLinkedValue() Error:", err)
+					etlx.logger("key", key, "item", itemKey).Error("UpdateLinkedValue failed", "err", err)
 				}
 				err = file.SaveAs(outputFile)
 				mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -980,8 +981,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 			}
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		} else if okTemplate && textTemplate && okTextTemplate && !failedCondition {
 			start3 := time.Now().In(etlx.TimeZone)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -1068,8 +1069,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 					_log2["mem_total_alloc_end"] = mem_total_alloc
 					_log2["mem_sys_end"] = mem_sys
 					_log2["num_gc_end"] = num_gc
-					processLogs = append(processLogs, _log2)
-					formatProcessLogEntry(_log2)
+					*itemLogs = append(*itemLogs, _log2)
+					etlx.formatProcessLogEntry(_log2)
 				}
 				if _, ok := itemMetadata["data"].(map[string]any); ok {
 					for key, d := range itemMetadata["data"].(map[string]any) {
@@ -1107,7 +1108,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							_log2["mem_total_alloc_end"] = mem_total_alloc
 							_log2["mem_sys_end"] = mem_sys
 							_log2["num_gc_end"] = num_gc
-							fmt.Println(0, _log2["msg"])
+							etlx.logger("key", key, "item", itemKey).Error("failed to parse the template", "err", err)
 						}
 						err = etlx.GenPDFFromLatex(parsedTmpl, fname)
 						mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -1120,7 +1121,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							_log2["mem_total_alloc_end"] = mem_total_alloc
 							_log2["mem_sys_end"] = mem_sys
 							_log2["num_gc_end"] = num_gc
-							//fmt.Println(0, _log2["msg"])
+							//etlx.logger("key", key, "item", itemKey).Error("failed to parse the template", "err", err)
 						} else {
 							_log2["success"] = true
 							_log2["msg"] = fmt.Sprintf("%s -> %s: TXT TMPL Generate!", key, itemKey)
@@ -1156,7 +1157,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							_log2["mem_total_alloc_end"] = mem_total_alloc
 							_log2["mem_sys_end"] = mem_sys
 							_log2["num_gc_end"] = num_gc
-							fmt.Println(0, _log2["msg"])
+							etlx.logger("key", key, "item", itemKey).Error("failed to parse the template", "err", err)
 						}
 						err = etlx.GenPDFFromHTML(parsedTmpl, fname)
 						mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -1169,7 +1170,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 							_log2["mem_total_alloc_end"] = mem_total_alloc
 							_log2["mem_sys_end"] = mem_sys
 							_log2["num_gc_end"] = num_gc
-							//fmt.Println(0, _log2["msg"])
+							//etlx.logger("key", key, "item", itemKey).Error("failed to parse the template", "err", err)
 						} else {
 							_log2["success"] = true
 							_log2["msg"] = fmt.Sprintf("%s -> %s: TXT TMPL Generate!", key, itemKey)
@@ -1207,7 +1208,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 						_log2["mem_total_alloc_end"] = mem_total_alloc
 						_log2["mem_sys_end"] = mem_sys
 						_log2["num_gc_end"] = num_gc
-						//fmt.Println(0, _log2["msg"])
+						//etlx.logger("key", key, "item", itemKey).Error("failed to parse the template", "err", err)
 					} else {
 						// Create the file (or truncate if it exists)
 						file, err := os.Create(fname)
@@ -1258,8 +1259,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 						}
 					}
 				}
-				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				*itemLogs = append(*itemLogs, _log2)
+				etlx.formatProcessLogEntry(_log2)
 			}
 		} else {
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -1271,8 +1272,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			_log2["mem_total_alloc_end"] = mem_total_alloc
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 			//fmt.Println(4, _log2["msg"])
 		}
 		// QUERIES TO RUN AT THE END
@@ -1286,7 +1287,7 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 				"ref":             dtRef,
 				"mem_alloc_start": mem_alloc, "mem_total_alloc_start": mem_total_alloc, "mem_sys_start": mem_sys, "num_gc_start": num_gc,
 			}
-			err = etlx.ExecuteQuery(dbConn, afterSQL, item, fname, "", dateRef)
+			err = retry.ExecuteCleanup(dbConn, afterSQL, item, fname, "", dateRef)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 			if err != nil {
 				_log2["success"] = false
@@ -1303,8 +1304,8 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 			_log2["mem_total_alloc_end"] = mem_total_alloc
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		}
 		return nil
 	}
@@ -1313,7 +1314,9 @@ func (etlx *ETLX) RunEXPORTS(dateRef []time.Time, conf map[string]any, extraConf
 		conf = etlx.Config
 	}
 	// Process the MD KEY
-	err := etlx.ProcessMDKey(key, conf, EXPORTSRunner)
+	err := etlx.ProcessMDKeyParallel(key, conf, &processLogs, EXPORTSRunner)
+	setHeadRef(processLogs)
+	mainDescription = mdKeyDescription(conf, key)
 	if err != nil {
 		return processLogs, fmt.Errorf("%s failed: %v", key, err)
 	}
@@ -13,6 +13,10 @@ func (etlx *ETLX) RunLOGS(dateRef []time.Time, conf map[string]any, logs []map[s
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "LOGS"); err != nil {
+		return nil, err
+	}
 	// fmt.Println(key, dateRef)
 	var processData []map[string]any
 	// Check if the input conf is nil or empty
@@ -94,7 +98,7 @@ func (etlx *ETLX) RunLOGS(dateRef []time.Time, conf map[string]any, logs []map[s
 	}
 	//  QUERIES TO RUN AT THE END
 	if okAfter {
-		err = etlx.ExecuteQuery(dbConn, afterSQL, data, fname, "", dateRef)
+		err = etlx.ExecuteCleanup(dbConn, afterSQL, data, fname, "", dateRef)
 		if err != nil {
 			return nil, fmt.Errorf("%s: After error: %s", key, err)
 		}
@@ -13,6 +13,10 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "MULTI_QUERIES"); err != nil {
+		return nil, nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processData []map[string]any
 	var processLogs []map[string]any
@@ -128,7 +132,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 				query = sql
 				_sql, _, _, err := etlx.QueryBuilder(nil, sql)
 				if err != nil {
-					fmt.Printf("QUERY DOC ERR ON KEY %s: %v\n", queries, err)
+					etlx.logger().Warn("QUERY_DOC failed", "query", sql, "err", err)
 					_q, _e := etlx.Config[sql].(string)
 					//fmt.Println(sql, "IS A LOADED SQL STR QUERY?", _q, _e)
 					if _e {
@@ -171,7 +175,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 		_log2["end_at"] = time.Now().In(etlx.TimeZone)
 		_log2["duration"] = time.Since(start3).Seconds()
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 		return nil, nil, fmt.Errorf("%s ERR: connecting to %s in : %s", key, conn, err)
 	}
 	defer dbConn.Close()
@@ -180,7 +184,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 	_log2["end_at"] = time.Now().In(etlx.TimeZone)
 	_log2["duration"] = time.Since(start3).Seconds()
 	processLogs = append(processLogs, _log2)
-	formatProcessLogEntry(_log2)
+	etlx.formatProcessLogEntry(_log2)
 	//  QUERIES TO RUN AT beginning
 	if okBefore {
 		start3 := time.Now().In(etlx.TimeZone)
@@ -214,7 +218,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	}
 	// MAIN QUERY
 	unionKey, ok := metadata["union_key"].(string)
@@ -253,7 +257,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 			_log2["end_at"] = time.Now().In(etlx.TimeZone)
 			_log2["duration"] = time.Since(start3).Seconds()
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			//return fmt.Errorf("%s", _log2["msg"])
 			failedCondition = true
 		} else if !cond {
@@ -265,7 +269,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 				_log2["msg"] = fmt.Sprintf("%s -> %s COND: failed %s", key, "", etlx.SetQueryPlaceholders(condMsg, "", "", dateRef))
 			}
 			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			etlx.formatProcessLogEntry(_log2)
 			// return fmt.Errorf("%s", _log2["msg"])
 			failedCondition = true
 		}
@@ -330,7 +334,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 			_log2["num_gc_end"] = num_gc
 		}
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	} else if !failedCondition {
 		rows, _, err := etlx.Query(dbConn, sql, data, "", "", dateRef)
 		mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
@@ -351,7 +355,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	}
 	//  QUERIES TO RUN AT THE END
 	if okAfter {
@@ -368,7 +372,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 			"mem_sys_start":         mem_sys,
 			"num_gc_start":          num_gc,
 		}
-		err = etlx.ExecuteQuery(dbConn, afterSQL, data, "", "", dateRef)
+		err = etlx.ExecuteCleanup(dbConn, afterSQL, data, "", "", dateRef)
 		if err != nil {
 			_log2["success"] = false
 			_log2["msg"] = fmt.Sprintf("%s After error: %s", key, err)
@@ -386,7 +390,7 @@ func (etlx *ETLX) RunMULTI_QUERIES(dateRef []time.Time, conf map[string]any, ext
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
 		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		etlx.formatProcessLogEntry(_log2)
 	}
 	return processLogs, processData, nil
 }
@@ -0,0 +1,121 @@
+package etlxlib
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// RunnerFuncKeyLogs is the item runner used by the keys that support `parallel`,
+// the logs of each item go to itemLogs so they can be merged in document order
+type RunnerFuncKeyLogs func(itemLogs *[]map[string]any, metadata map[string]any, key string, item map[string]any) error
+
+// parallelOptions reads `parallel` and `max_workers` from the key metadata
+func parallelOptions(metadata map[string]any) (bool, int) {
+	parallel := false
+	switch p := metadata["parallel"].(type) {
+	case bool:
+		parallel = p
+	case string:
+		parallel, _ = strconv.ParseBool(p)
+	}
+	maxWorkers := runtime.NumCPU()
+	if _, ok := metadata["max_workers"]; ok {
+		j, err := strconv.Atoi(fmt.Sprintf("%v", metadata["max_workers"]))
+		if err == nil && j > 0 {
+			maxWorkers = j
+		}
+	}
+	return parallel && maxWorkers > 1, maxWorkers
+}
+
+// mdKeyDescription returns the description of a top level key
+func mdKeyDescription(conf map[string]any, key string) string {
+	data, _ := conf[key].(map[string]any)
+	metadata, _ := data["metadata"].(map[string]any)
+	description, _ := metadata["description"].(string)
+	return description
+}
+
+// setHeadRef copies the first date ref found in the items logs to the key log
+func setHeadRef(processLogs []map[string]any) {
+	if len(processLogs) == 0 || processLogs[0]["ref"] != nil {
+		return
+	}
+	for _, _log := range processLogs[1:] {
+		if _log["ref"] != nil {
+			processLogs[0]["ref"] = _log["ref"]
+			return
+		}
+	}
+}
+
+// ProcessMDKeyParallel works like ProcessMDKey, but when the key metadata has
+// `parallel: true` the items run in a pool of `max_workers` goroutines. Items
+// still wait for the items they depend on, and the logs are appended to
+// processLogs in the items order once all of them are done
+func (etlx *ETLX) ProcessMDKeyParallel(key string, config map[string]any, processLogs *[]map[string]any, runner RunnerFuncKeyLogs) error {
+	data, ok := config[key].(map[string]any)
+	if !ok {
+		return fmt.Errorf("missing or invalid %s section", key)
+	}
+	metadata, ok := data["metadata"].(map[string]any)
+	if !ok {
+		return fmt.Errorf("missing metadata in %s section", key)
+	}
+	parallel, maxWorkers := parallelOptions(metadata)
+	if active, okActive := metadata["active"].(bool); okActive && !active {
+		parallel = false
+	}
+	if !parallel {
+		return etlx.ProcessMDKey(key, config, func(metadata map[string]any, itemKey string, item map[string]any) error {
+			return runner(processLogs, metadata, itemKey, item)
+		})
+	}
+	items := etlx.dag.itemOrder(key)
+	if items == nil {
+		items = mdKeyItems(data)
+	}
+	done := map[string]chan struct{}{}
+	for _, itemKey := range items {
+		done[itemKey] = make(chan struct{})
+	}
+	itemLogs := make([][]map[string]any, len(items))
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, maxWorkers)
+	var wg sync.WaitGroup
+	wg.Add(len(items))
+	for i, itemKey := range items {
+		go func() {
+			defer wg.Done()
+			defer close(done[itemKey])
+			for _, dep := range etlx.dag.itemDepsInKey(key, itemKey) {
+				if ch, ok := done[dep]; ok {
+					<-ch
+				}
+			}
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if etlx.skipItem(key, itemKey) {
+				return
+			}
+			if errs[i] = etlx.cancelled(); errs[i] != nil {
+				return
+			}
+			endItem := etlx.traceItem(key, itemKey, data[itemKey].(map[string]any))
+			errs[i] = runner(&itemLogs[i], metadata, itemKey, data[itemKey].(map[string]any))
+			endItem(errs[i])
+		}()
+	}
+	wg.Wait()
+	for i := range items {
+		*processLogs = append(*processLogs, itemLogs[i]...)
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,10 +1,13 @@
 package etlxlib
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
@@ -17,6 +20,9 @@ import (
 type Runner struct {
 	client  *ssh.Client
 	WorkDir string
+	// Logger gets the output of the commands line by line, the one of
+	// SetLogger when nil
+	Logger *slog.Logger
 }
 
 func NewSSH(host, user, keyFile, hostKey string) (*Runner, error) {
@@ -152,8 +158,8 @@ func (r *Runner) Run(ctx context.Context, cmd string) error {
 			return err
 		}
 	}
-	go io.Copy(os.Stdout, stdout)
-	go io.Copy(os.Stderr, stderr)
+	go r.logLines(stdout, slog.LevelInfo, cmd)
+	go r.logLines(stderr, slog.LevelWarn, cmd)
 	done := make(chan error, 1)
 	go func() {
 		done <- session.Wait()
@@ -167,6 +173,21 @@ func (r *Runner) Run(ctx context.Context, cmd string) error {
 	}
 }
 
+// logLines logs the output of a remote command line by line
+func (r *Runner) logLines(in io.Reader, level slog.Level, cmd string) {
+	l := r.Logger
+	if l == nil {
+		l = Logger()
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		l.Log(context.Background(), level, scanner.Text(), "command", cmd)
+	}
+	// DRAIN WHAT IS LEFT SO THE COMMAND IS NOT BLOCKED ON A LINE TOO LONG
+	io.Copy(io.Discard, in)
+}
+
 func (r *Runner) RunOutput(ctx context.Context, cmd string) (string, error) {
 	session, err := r.client.NewSession()
 	if err != nil {
@@ -233,6 +254,8 @@ type remoteExecutionJob struct {
 	key           string
 	item          map[string]any
 	md            string
+	retry         *RetryPolicy
+	logs          []map[string]any
 }
 
 func runRemoteJobs(jobs []remoteExecutionJob, fn func(remoteExecutionJob) error) error {
@@ -267,6 +290,10 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "REMOTE"); err != nil {
+		return nil, err
+	}
 	etlx.RemoteSkiped = false
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
@@ -314,7 +341,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 			}
 			etlx.RemoteSkiped = true
 			processLogs = append(processLogs, log2)
-			formatProcessLogEntry(log2)
+			etlx.formatProcessLogEntry(log2)
 			return nil, fmt.Errorf("%s deactivated", key)
 		}
 	}
@@ -370,7 +397,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 		if only, okOnly := extraConf["only"]; okOnly {
 			//fmt.Println("ONLY", only, len(only.([]string)))
 			if len(only.([]string)) == 0 {
-			} else if !etlx.Contains(only.([]string), itemKey) {
+			} else if !etlx.matchesItem(only.([]string), itemKey, itemMetadata.(map[string]any)) {
 				logEntry := map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
@@ -384,14 +411,14 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 				}
 				etlx.RemoteSkiped = true
 				processLogs = append(processLogs, logEntry)
-				formatProcessLogEntry(logEntry)
+				etlx.formatProcessLogEntry(logEntry)
 				return processLogs, nil
 			}
 		}
 		if skip, okSkip := extraConf["skip"]; okSkip {
 			//fmt.Println("SKIP", skip, len(skip.([]string)))
 			if len(skip.([]string)) == 0 {
-			} else if etlx.Contains(skip.([]string), itemKey) {
+			} else if etlx.matchesItem(skip.([]string), itemKey, itemMetadata.(map[string]any)) {
 				logEntry := map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
@@ -403,7 +430,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 				}
 				etlx.RemoteSkiped = true
 				processLogs = append(processLogs, logEntry)
-				formatProcessLogEntry(logEntry)
+				etlx.formatProcessLogEntry(logEntry)
 				return processLogs, nil
 			}
 		}
@@ -456,7 +483,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 		if !okDesc {
 			desc = fmt.Sprintf("%s->%s", key, itemKey)
 		}
-		jobs = append(jobs, remoteExecutionJob{
+		job := remoteExecutionJob{
 			name:          itemKey,
 			host:          host,
 			port:          port,
@@ -472,14 +499,28 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 			item:          item.(map[string]any),
 			md:            etlx.MD,
 			run:           run,
-		})
+		}
+		jobs = append(jobs, job)
+	}
+	for i := range jobs {
+		jobs[i].retry = etlx.RetryPolicy(&jobs[i].logs, process, key, jobs[i].name, metadata, jobs[i].item["metadata"].(map[string]any))
 	}
 	err := runRemoteJobs(jobs, func(job remoteExecutionJob) error {
-		sshInstance, err := NewSSH(fmt.Sprintf(`%s:%s`, job.host, job.port), job.user, job.keyFile, job.hostKey)
+		var sshInstance *Runner
+		err := job.retry.Do("ssh connection", func() error {
+			var err error
+			sshInstance, err = NewSSH(fmt.Sprintf(`%s:%s`, job.host, job.port), job.user, job.keyFile, job.hostKey)
+			if err == nil {
+				sshInstance.Logger = etlx.logger("key", key, "item", job.name)
+			}
+			return err
+		})
 		if err != nil {
 			return fmt.Errorf("SSH connection error in %s section %s: %s", key, job.name, err.Error())
 		}
 		defer sshInstance.Close()
+		ctx, cancel := job.retry.Context()
+		defer cancel()
 		if job.workingDir != "" {
 			sshInstance.WorkDir = job.workingDir
 			/*err := sshInstance.Run(context.Background(), fmt.Sprintf(`mkdir -p %s`, job.workingDir))
@@ -511,7 +552,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 					return fmt.Errorf("upload_files error %s section %s dest file %s", key, job.name, remoteFile)
 				}
 				remoteFile = etlx.ReplaceQueryStringDate(remoteFile, dateRef)
-				err := sshInstance.Upload(context.Background(), localPath, fmt.Sprintf(`%s/%s`, job.workingDir, remoteFile))
+				err := sshInstance.Upload(ctx, localPath, fmt.Sprintf(`%s/%s`, job.workingDir, remoteFile))
 				if err != nil {
 					return fmt.Errorf("SSH Err upload file in %s section %s %s %s", key, job.name, err.Error(), remoteFile)
 				}
@@ -519,7 +560,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 		}
 		if len(job.commands) > 0 {
 			for _, _cmd := range job.commands {
-				err := sshInstance.Run(context.Background(), etlx.ReplaceQueryStringDate(_cmd.(string), dateRef))
+				err := sshInstance.Run(ctx, etlx.ReplaceQueryStringDate(_cmd.(string), dateRef))
 				if err != nil {
 					return fmt.Errorf("SSH Err runnig command %s in %s section %s %s", _cmd, key, job.name, err.Error())
 				}
@@ -537,7 +578,7 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 					return fmt.Errorf("download_files error %s section %s source file", key, job.name)
 				}
 				remoteFile = etlx.ReplaceQueryStringDate(remoteFile, dateRef)
-				err := sshInstance.Download(context.Background(), localPath, fmt.Sprintf(`%s/%s`, job.workingDir, remoteFile))
+				err := sshInstance.Download(ctx, localPath, fmt.Sprintf(`%s/%s`, job.workingDir, remoteFile))
 				if err != nil {
 					return fmt.Errorf("SSH Err download file in %s section %s %s %s", key, job.name, err.Error(), remoteFile)
 				}
@@ -549,6 +590,9 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 	if err != nil {
 		return nil, err
 	}
+	for _, job := range jobs {
+		processLogs = append(processLogs, job.logs...)
+	}
 	mem_alloc2, mem_total_alloc2, mem_sys2, num_gc2 := etlx.RuntimeMemStats()
 	processLogs[0] = map[string]any{
 		"process":               process,
@@ -576,11 +620,12 @@ func (etlx *ETLX) RunREMOTE(dateRef []time.Time, conf map[string]any, extraConf
 	}
 	delete(etlx.Config, key)
 	logs, _, err := etlx.RunETLX(extraConf, dateRef)
-	if err != nil {
+	var runErr *RunError
+	if err != nil && !errors.As(err, &runErr) {
 		return nil, err
 	}
 	for _, l := range logs {
 		processLogs = append(processLogs, l)
 	}
-	return processLogs, nil
+	return processLogs, err
 }
@@ -14,6 +14,10 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 	if len(keys) > 0 && keys[0] != "" {
 		key = keys[0]
 	}
+	// MALFORMED METADATA IS REPORTED HERE INSTEAD OF PANICKING MID RUN
+	if err := etlx.validateUpFront(conf, key, "SCRIPTS"); err != nil {
+		return nil, err
+	}
 	//fmt.Println(key, dateRef)
 	var processLogs []map[string]any
 	start := time.Now().In(etlx.TimeZone)
@@ -30,12 +34,14 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 	})
 	mainDescription := ""
 	// Define the runner as a simple function
-	SCRIPTSRunner := func(metadata map[string]any, itemKey string, item map[string]any) error {
+	SCRIPTSRunner := func(itemLogs *[]map[string]any, metadata map[string]any, itemKey string, item map[string]any) error {
+		// each item works on its own date ref, items may run in parallel
+		dateRef := dateRef
 		//fmt.Println(metadata, itemKey, item)
 		// ACTIVE
 		if active, okActive := metadata["active"]; okActive {
 			if !active.(bool) {
-				processLogs = append(processLogs, map[string]any{
+				*itemLogs = append(*itemLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("KEY %s", key),
 					"description": metadata["description"].(string),
@@ -62,13 +68,13 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 
 		}
 		mainConn, _ := metadata["connection"].(string)
-		mainDescription = metadata["description"].(string)
 		itemMetadata, ok := item["metadata"].(map[string]any)
 		if !ok {
-			processLogs = append(processLogs, map[string]any{
+			description, _ := itemMetadata["description"].(string)
+			*itemLogs = append(*itemLogs, map[string]any{
 				"process":     process,
 				"name":        fmt.Sprintf("%s->%s", key, itemKey),
-				"description": itemMetadata["description"].(string),
+				"description": description,
 				"key":         key, "item_key": itemKey, "start_at": time.Now().In(etlx.TimeZone),
 				"end_at":  time.Now().In(etlx.TimeZone),
 				"success": true,
@@ -76,10 +82,11 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 			})
 			return nil
 		}
+		retry := etlx.RetryPolicy(itemLogs, process, key, itemKey, metadata, itemMetadata)
 		// ACTIVE
 		if active, okActive := itemMetadata["active"]; okActive {
 			if !active.(bool) {
-				processLogs = append(processLogs, map[string]any{
+				*itemLogs = append(*itemLogs, map[string]any{
 					"process":     process,
 					"name":        fmt.Sprintf("%s->%s", key, itemKey),
 					"description": itemMetadata["description"].(string),
@@ -96,10 +103,7 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 		afterSQL, okAfter := itemMetadata["after_sql"]
 		errPatt, okErrPatt := itemMetadata["on_err_patt"]
 		errSQL, okErrSQL := itemMetadata["on_err_sql"]
-		conn, okCon := itemMetadata["connection"]
-		if !okCon {
-			conn = mainConn
-		}
+		conn := itemConnection(itemMetadata, mainConn)
 		dtRef, okDtRef := itemMetadata["date_ref"]
 		if okDtRef && dtRef != "" {
 			_dt, err := time.Parse("2006-01-02", dtRef.(string))
@@ -111,9 +115,6 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				dtRef = dateRef[0].Format("2006-01-02")
 			}
 		}
-		if processLogs[0]["ref"] == nil {
-			processLogs[0]["ref"] = dtRef
-		}
 		start3 := time.Now().In(etlx.TimeZone)
 		mem_alloc, mem_total_alloc, mem_sys, num_gc := etlx.RuntimeMemStats()
 		_log2 := map[string]any{
@@ -127,7 +128,7 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 			"mem_sys_start":         mem_sys,
 			"num_gc_start":          num_gc,
 		}
-		dbConn, err := etlx.GetDB(conn.(string))
+		dbConn, err := retry.GetDB(conn)
 		mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 		if err != nil {
 			_log2["success"] = false
@@ -138,8 +139,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 			_log2["mem_total_alloc_end"] = mem_total_alloc
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 			return nil
 		}
 		defer dbConn.Close()
@@ -151,8 +152,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 		_log2["mem_total_alloc_end"] = mem_total_alloc
 		_log2["mem_sys_end"] = mem_sys
 		_log2["num_gc_end"] = num_gc
-		processLogs = append(processLogs, _log2)
-		formatProcessLogEntry(_log2)
+		*itemLogs = append(*itemLogs, _log2)
+		etlx.formatProcessLogEntry(_log2)
 		// FILE
 		table := itemMetadata["name"].(string)
 		path, okPath := itemMetadata["path"].(string)
@@ -188,7 +189,7 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				"mem_sys_start":         mem_sys,
 				"num_gc_start":          num_gc,
 			}
-			err = etlx.ExecuteQuery(dbConn, beforeSQL, item, fname, "", dateRef)
+			err = retry.ExecuteQuery(dbConn, beforeSQL, item, fname, "", dateRef)
 			mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 			if err != nil {
 				_log2["success"] = false
@@ -205,8 +206,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 			_log2["mem_total_alloc_end"] = mem_total_alloc
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		}
 		// CHECK CONDITION
 		condition, okCondition := itemMetadata["condition"].(string)
@@ -224,8 +225,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["mem_total_alloc_end"] = mem_total_alloc
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
-				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				*itemLogs = append(*itemLogs, _log2)
+				etlx.formatProcessLogEntry(_log2)
 				//return fmt.Errorf("%s", _log2["msg"])
 				failedCondition = true
 			} else if !cond {
@@ -240,8 +241,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				if okCondMsg && condMsg != "" {
 					_log2["msg"] = fmt.Sprintf("%s -> %s COND: failed %s", key, itemKey, etlx.SetQueryPlaceholders(condMsg, table, fname, dateRef))
 				}
-				processLogs = append(processLogs, _log2)
-				formatProcessLogEntry(_log2)
+				*itemLogs = append(*itemLogs, _log2)
+				etlx.formatProcessLogEntry(_log2)
 				// return fmt.Errorf("%s", _log2["msg"])
 				failedCondition = true
 			}
@@ -261,7 +262,7 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				"mem_sys_start":         mem_sys,
 				"num_gc_start":          num_gc,
 			}
-			err = etlx.ExecuteQuery(dbConn, scriptSQL, item, fname, "", dateRef)
+			err = retry.ExecuteQuery(dbConn, scriptSQL, item, fname, "", dateRef)
 			if err != nil {
 				_err_by_pass := false
 				if okErrPatt && errPatt != nil && okErrSQL && errSQL != nil {
@@ -273,7 +274,7 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 						_log2["end_at"] = time.Now().In(etlx.TimeZone)
 						_log2["duration"] = time.Since(start3).Seconds()
 					} else if re.MatchString(string(err.Error())) {
-						err = etlx.ExecuteQuery(dbConn, errSQL, item, fname, "", dateRef)
+						err = retry.ExecuteQuery(dbConn, errSQL, item, fname, "", dateRef)
 						if err != nil {
 							_log2["success"] = false
 							_log2["msg"] = fmt.Errorf("%s ERR: main: %s", key, err)
@@ -311,8 +312,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				_log2["mem_sys_end"] = mem_sys
 				_log2["num_gc_end"] = num_gc
 			}
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		}
 		// QUERIES TO RUN AT THE END
 		if okAfter {
@@ -329,7 +330,7 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 				"mem_sys_start":         mem_sys,
 				"num_gc_start":          num_gc,
 			}
-			err = etlx.ExecuteQuery(dbConn, afterSQL, item, fname, "", dateRef)
+			err = retry.ExecuteCleanup(dbConn, afterSQL, item, fname, "", dateRef)
 			if err != nil {
 				_log2["success"] = false
 				_log2["msg"] = fmt.Sprintf("%s -> %s After error: %s", key, itemKey, err)
@@ -346,8 +347,8 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 			_log2["mem_total_alloc_end"] = mem_total_alloc
 			_log2["mem_sys_end"] = mem_sys
 			_log2["num_gc_end"] = num_gc
-			processLogs = append(processLogs, _log2)
-			formatProcessLogEntry(_log2)
+			*itemLogs = append(*itemLogs, _log2)
+			etlx.formatProcessLogEntry(_log2)
 		}
 		return nil
 	}
@@ -356,7 +357,9 @@ func (etlx *ETLX) RunSCRIPTS(dateRef []time.Time, conf map[string]any, extraConf
 		conf = etlx.Config
 	}
 	// Process the MD KEY
-	err := etlx.ProcessMDKey(key, conf, SCRIPTSRunner)
+	err := etlx.ProcessMDKeyParallel(key, conf, &processLogs, SCRIPTSRunner)
+	setHeadRef(processLogs)
+	mainDescription = mdKeyDescription(conf, key)
 	mem_alloc, mem_total_alloc, mem_sys, num_gc = etlx.RuntimeMemStats()
 	if err != nil {
 		return processLogs, fmt.Errorf("%s failed: %v", key, err)
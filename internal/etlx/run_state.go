@@ -0,0 +1,231 @@
+package etlxlib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/realdatadriven/etlx/internal/db"
+)
+
+// RunState persists the outcome of every key/item/step of a run in a small
+// SQLite file, so a failed run can be resumed re-executing only what failed
+// or did not run (-resume <run_id>)
+type RunState struct {
+	Path       string
+	conn       db.DBInterface
+	resumeID   string
+	done       map[string]bool
+	failed     map[string]bool
+	seen       map[string]bool
+	resumeRefs []string
+	dateRef    string
+}
+
+const runStateTableSQL = `CREATE TABLE IF NOT EXISTS "etlx_run_state" (
+	"run_id" TEXT NOT NULL,
+	"date_ref" TEXT NOT NULL DEFAULT '',
+	"key" TEXT NOT NULL,
+	"item_key" TEXT NOT NULL DEFAULT '',
+	"step" TEXT NOT NULL DEFAULT '',
+	"success" BOOLEAN NOT NULL,
+	"msg" TEXT,
+	"start_at" TIMESTAMP,
+	"end_at" TIMESTAMP,
+	"updated_at" TIMESTAMP,
+	PRIMARY KEY ("run_id", "date_ref", "key", "item_key", "step")
+)`
+
+const runStateUpsertSQL = `INSERT INTO "etlx_run_state" ("run_id", "date_ref", "key", "item_key", "step", "success", "msg", "start_at", "end_at", "updated_at")
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT ("run_id", "date_ref", "key", "item_key", "step") DO UPDATE SET
+	"success" = excluded."success",
+	"msg" = excluded."msg",
+	"start_at" = excluded."start_at",
+	"end_at" = excluded."end_at",
+	"updated_at" = excluded."updated_at"`
+
+// DefaultRunStatePath is the state file next to the config, pipeline.md -> pipeline.state.db
+func DefaultRunStatePath(configPath string) string {
+	ext := filepath.Ext(configPath)
+	return strings.TrimSuffix(configPath, ext) + ".state.db"
+}
+
+// NewRunID returns a sortable run id, e.g. 20060102T150405-1a2b3c
+func NewRunID() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%s", time.Now().Format("20060102T150405"), hex.EncodeToString(b))
+}
+
+func runStateKey(dateRef string, key string, itemKey string, step string) string {
+	return fmt.Sprintf("%s|%s|%s|%s", dateRef, key, itemKey, step)
+}
+
+// stepFromLogName gets the ETL step from log names like KEY->item->extract:Main
+func stepFromLogName(name string) string {
+	parts := strings.Split(name, "->")
+	if len(parts) < 3 {
+		return ""
+	}
+	return strings.SplitN(parts[2], ":", 2)[0]
+}
+
+// OpenRunState opens (creating if needed) the run state store
+func (etlx *ETLX) OpenRunState(path string) error {
+	conn, err := etlx.GetDB(fmt.Sprintf("sqlite3:%s", path))
+	if err != nil {
+		return fmt.Errorf("run state %s: %s", path, err)
+	}
+	if _, err := conn.ExecuteQuery(runStateTableSQL); err != nil {
+		conn.Close()
+		return fmt.Errorf("run state %s: %s", path, err)
+	}
+	etlx.State = &RunState{Path: path, conn: conn}
+	if etlx.RunID == "" {
+		etlx.RunID = NewRunID()
+	}
+	return nil
+}
+
+// ResumeRun loads the state of a previous run and reuses its run id, the
+// items and steps that succeeded in it are skipped, returns its date refs
+func (etlx *ETLX) ResumeRun(runID string) ([]string, error) {
+	if etlx.State == nil {
+		return nil, fmt.Errorf("resume %s: the run state store is not open", runID)
+	}
+	s := etlx.State
+	rows, _, err := s.conn.QueryMultiRows(`SELECT "date_ref", "key", "item_key", "step", "success" FROM "etlx_run_state" WHERE "run_id" = ? ORDER BY "date_ref"`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("resume %s: %s", runID, err)
+	}
+	if rows == nil || len(*rows) == 0 {
+		return nil, fmt.Errorf("resume %s: run not found in %s", runID, s.Path)
+	}
+	s.resumeID = runID
+	s.done = map[string]bool{}
+	s.failed = map[string]bool{}
+	s.seen = map[string]bool{}
+	s.resumeRefs = []string{}
+	for _, row := range *rows {
+		dateRef := fmt.Sprintf("%v", row["date_ref"])
+		if len(s.resumeRefs) == 0 || s.resumeRefs[len(s.resumeRefs)-1] != dateRef {
+			s.resumeRefs = append(s.resumeRefs, dateRef)
+		}
+		key := fmt.Sprintf("%v", row["key"])
+		itemKey := fmt.Sprintf("%v", row["item_key"])
+		step := fmt.Sprintf("%v", row["step"])
+		success := false
+		switch v := row["success"].(type) {
+		case bool:
+			success = v
+		case int64:
+			success = v != 0
+		default:
+			success = fmt.Sprintf("%v", v) == "1" || fmt.Sprintf("%v", v) == "true"
+		}
+		s.seen[runStateKey(dateRef, key, itemKey, "")] = true
+		if success {
+			s.done[runStateKey(dateRef, key, itemKey, step)] = true
+		} else {
+			s.failed[runStateKey(dateRef, key, itemKey, "")] = true
+			delete(s.done, runStateKey(dateRef, key, itemKey, step))
+		}
+	}
+	etlx.RunID = runID
+	return s.resumeRefs, nil
+}
+
+// resumeDone tells if the item (step "") or ETL step already succeeded for
+// the current date ref in the run being resumed
+func (s *RunState) resumeDone(key string, itemKey string, step string) bool {
+	if s == nil || s.resumeID == "" {
+		return false
+	}
+	if step == "" {
+		_key := runStateKey(s.dateRef, key, itemKey, "")
+		return s.seen[_key] && !s.failed[_key]
+	}
+	return s.done[runStateKey(s.dateRef, key, itemKey, step)]
+}
+
+// setDateRef sets the date ref the run is working on
+func (s *RunState) setDateRef(dateRef []time.Time) {
+	if s == nil {
+		return
+	}
+	s.dateRef = ""
+	if len(dateRef) > 0 {
+		s.dateRef = dateRef[0].Format("2006-01-02")
+	}
+}
+
+// Close closes the state store
+func (s *RunState) Close() error {
+	if s == nil || s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+// saveRunState records the outcome of each key/item/step found in the logs
+func (etlx *ETLX) saveRunState(dateRef []time.Time, logs []map[string]any) {
+	if etlx.State == nil || etlx.State.conn == nil {
+		return
+	}
+	_dateRef := ""
+	if len(dateRef) > 0 {
+		_dateRef = dateRef[0].Format("2006-01-02")
+	}
+	type outcome struct {
+		key, itemKey, step, msg string
+		success                 bool
+		startAt, endAt          any
+	}
+	order := []string{}
+	outcomes := map[string]*outcome{}
+	for _, _log := range logs {
+		key, _ := _log["key"].(string)
+		success, okSuccess := _log["success"].(bool)
+		if key == "" || !okSuccess {
+			continue
+		}
+		if retrying, _ := _log["retrying"].(bool); retrying {
+			continue
+		}
+		msg, _ := _log["msg"].(string)
+		// NOT RUN, SO IT CAN RUN ON RESUME
+		if strings.Contains(msg, "Excluded from the process") || msg == "Deactivated" {
+			continue
+		}
+		itemKey, _ := _log["item_key"].(string)
+		name, _ := _log["name"].(string)
+		step := stepFromLogName(name)
+		_key := runStateKey(_dateRef, key, itemKey, step)
+		o, ok := outcomes[_key]
+		if !ok {
+			o = &outcome{key: key, itemKey: itemKey, step: step, success: true, startAt: _log["start_at"]}
+			outcomes[_key] = o
+			order = append(order, _key)
+		}
+		o.endAt = _log["end_at"]
+		if !success && o.success {
+			o.success = false
+			o.msg = msg
+		} else if o.success {
+			o.msg = msg
+		}
+	}
+	now := time.Now().In(etlx.TimeZone)
+	for _, _key := range order {
+		o := outcomes[_key]
+		_, err := etlx.State.conn.ExecuteQuery(runStateUpsertSQL, etlx.RunID, _dateRef, o.key, o.itemKey, o.step, o.success, o.msg, o.startAt, o.endAt, now)
+		if err != nil {
+			etlx.logger().Error("saving the run state failed", "err", err)
+			return
+		}
+	}
+}
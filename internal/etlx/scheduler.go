@@ -0,0 +1,234 @@
+package etlxlib
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ScheduledKey is a Level 1 key with a `schedule` cron expression
+type ScheduledKey struct {
+	Key           string
+	Schedule      *CronSchedule
+	DateRefOffset int
+	Next          time.Time
+}
+
+// Scheduler runs the Level 1 keys that have a `schedule` in their metadata,
+// a key never overlaps with a previous run of itself, and the config is
+// reloaded when the file changes
+type Scheduler struct {
+	ConfigPath   string
+	ExtraConf    map[string]any
+	TimeZone     *time.Location
+	PollInterval time.Duration
+	State        *RunState
+	// OnRun is called at the end of every triggered run
+	OnRun func(key string, runID string, logs []map[string]any, err error)
+	// Logger is the Logger of the runs, the one of SetLogger when nil
+	Logger *slog.Logger
+	// Metrics gets the outcome of the runs, see RunMetrics
+	Metrics  *RunMetrics
+	mu       sync.Mutex
+	template *ETLX
+	modTime  time.Time
+	entries  []*ScheduledKey
+	running  map[string]bool
+	wg       sync.WaitGroup
+}
+
+// NewScheduler creates a scheduler for the config file, extraConf is passed to every run
+func NewScheduler(configPath string, extraConf map[string]any) *Scheduler {
+	if extraConf == nil {
+		extraConf = map[string]any{"clean": false, "drop": false, "rows": false, "file": ""}
+	}
+	return &Scheduler{
+		ConfigPath:   configPath,
+		ExtraConf:    extraConf,
+		TimeZone:     time.Local,
+		PollInterval: 5 * time.Second,
+		running:      map[string]bool{},
+	}
+}
+
+// Load parses the config file and (re)builds the schedules, the next run of
+// the keys whose schedule did not change is kept
+func (s *Scheduler) Load() error {
+	info, err := os.Stat(s.ConfigPath)
+	if err != nil {
+		return err
+	}
+	_etlx := &ETLX{Config: map[string]any{}, Params: map[string]any{}, TimeZone: s.TimeZone, MetadataOrder: true, Logger: s.Logger, Metrics: s.Metrics}
+	if err := _etlx.ConfigFromFile(s.ConfigPath); err != nil {
+		return err
+	}
+	if _, ok := _etlx.Config["REQUIRES"]; ok {
+		if _, err := _etlx.LoadREQUIRES(nil); err != nil {
+			_etlx.logger("key", "REQUIRES").Error("loading the requirements failed", "err", err)
+		}
+	}
+	order, _ := _etlx.Config["__order"].([]any)
+	entries := []*ScheduledKey{}
+	now := time.Now().In(s.TimeZone)
+	for _, _key := range order {
+		key, _ := _key.(string)
+		data, _ := _etlx.Config[key].(map[string]any)
+		metadata, _ := data["metadata"].(map[string]any)
+		expr, ok := metadata["schedule"].(string)
+		if !ok || expr == "" {
+			continue
+		}
+		if active, okActive := metadata["active"].(bool); okActive && !active {
+			continue
+		}
+		cron, err := ParseCron(expr)
+		if err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+		entry := &ScheduledKey{Key: key, Schedule: cron, DateRefOffset: -1}
+		if v, ok := metadata["date_ref_offset"]; ok {
+			j, err := strconv.Atoi(fmt.Sprintf("%v", v))
+			if err != nil {
+				return fmt.Errorf("%s: invalid date_ref_offset %v", key, v)
+			}
+			entry.DateRefOffset = j
+		}
+		entry.Next = cron.Next(now)
+		entries = append(entries, entry)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		for _, old := range s.entries {
+			if old.Key == entry.Key && old.Schedule.Expr == entry.Schedule.Expr {
+				entry.Next = old.Next
+			}
+		}
+	}
+	s.template = _etlx
+	s.modTime = info.ModTime()
+	s.entries = entries
+	return nil
+}
+
+// Entries returns the scheduled keys and their next run
+func (s *Scheduler) Entries() []ScheduledKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := []ScheduledKey{}
+	for _, entry := range s.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// Run loads the config and triggers the scheduled keys until ctx is done,
+// then cancels the runs in progress and waits for them
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := s.Load(); err != nil {
+		return err
+	}
+	for _, entry := range s.Entries() {
+		s.logger().Info("scheduled", "key", entry.Key, "schedule", entry.Schedule.Expr, "next_run", entry.Next)
+	}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	lastPoll := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			s.wg.Wait()
+			return nil
+		case now := <-tick.C:
+			if now.Sub(lastPoll) >= s.PollInterval {
+				lastPoll = now
+				s.reloadIfChanged()
+			}
+			s.triggerDue(ctx, now.In(s.TimeZone))
+		}
+	}
+}
+
+// reloadIfChanged reloads the config when the file modification time changes,
+// on error the current schedules are kept
+func (s *Scheduler) reloadIfChanged() {
+	info, err := os.Stat(s.ConfigPath)
+	if err != nil {
+		s.logger().Error("scheduler reload failed", "err", err)
+		return
+	}
+	s.mu.Lock()
+	changed := !info.ModTime().Equal(s.modTime)
+	s.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := s.Load(); err != nil {
+		s.logger().Error("scheduler reload failed, keeping the previous config", "err", err)
+		s.mu.Lock()
+		s.modTime = info.ModTime()
+		s.mu.Unlock()
+		return
+	}
+	s.logger().Info("scheduler reloaded", "config", s.ConfigPath)
+}
+
+func (s *Scheduler) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return Logger()
+}
+
+// triggerDue starts the keys whose next run is due
+func (s *Scheduler) triggerDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if entry.Next.IsZero() || now.Before(entry.Next) {
+			continue
+		}
+		scheduledAt := entry.Next
+		entry.Next = entry.Schedule.Next(now)
+		if s.running[entry.Key] {
+			s.logger().Warn("run skipped, the previous run is still running", "key", entry.Key, "scheduled_at", scheduledAt)
+			continue
+		}
+		s.running[entry.Key] = true
+		dateRef := time.Date(scheduledAt.Year(), scheduledAt.Month(), scheduledAt.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, entry.DateRefOffset)
+		s.wg.Add(1)
+		go s.runKey(ctx, s.template.Clone(), entry.Key, dateRef)
+	}
+}
+
+// runKey runs a single Level 1 key on its own copy of the config
+func (s *Scheduler) runKey(ctx context.Context, _etlx *ETLX, key string, dateRef time.Time) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, key)
+		s.mu.Unlock()
+	}()
+	_etlx.RunID = NewRunID()
+	if s.State != nil {
+		state := *s.State
+		_etlx.State = &state
+	}
+	extraConf := map[string]any{}
+	for k, v := range s.ExtraConf {
+		extraConf[k] = v
+	}
+	extraConf["keys"] = []string{key}
+	_etlx.logger("key", key).Info("scheduled run", "date_ref", dateRef.Format("2006-01-02"))
+	logs, _, err := _etlx.RunETLXContext(ctx, extraConf, []time.Time{dateRef})
+	if err != nil {
+		_etlx.logger("key", key).Error("scheduled run failed", "err", err)
+	}
+	if s.OnRun != nil {
+		s.OnRun(key, _etlx.RunID, logs, err)
+	}
+}
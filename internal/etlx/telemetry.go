@@ -0,0 +1,393 @@
+package etlxlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/realdatadriven/etlx/internal/db"
+	"github.com/realdatadriven/etlx/internal/secrets"
+)
+
+// instrumentationName is the name of the tracer and the meter of the runs
+const instrumentationName = "github.com/realdatadriven/etlx"
+
+// telemetry traces a run (etlx.run -> etlx.section -> etlx.item -> etlx.step
+// -> etlx.query) and records its metrics. The run, the sections and the items
+// are spans open while they run, the steps and the queries are only known
+// once they are done (from the process log entries and the queries that
+// returned), so their spans are recorded with their start / end times
+type telemetry struct {
+	tracer        trace.Tracer
+	runDuration   metric.Float64Histogram
+	stepDuration  metric.Float64Histogram
+	queryDuration metric.Float64Histogram
+	runFailures   metric.Int64Counter
+	stepFailures  metric.Int64Counter
+	queryFailures metric.Int64Counter
+	rows          metric.Int64Counter
+	// shutdown flushes and stops the providers built from the frontmatter
+	shutdown func(context.Context) error
+	mu       sync.Mutex
+	// items are the running items by key.item, and by their item map for
+	// the queries, that only get the item
+	items  map[string]*itemScope
+	byItem map[uintptr]*itemScope
+}
+
+// itemScope is a running item, with the queries that ran in it not yet
+// attached to one of its steps
+type itemScope struct {
+	ctx     context.Context
+	span    trace.Span
+	item    uintptr
+	failed  bool
+	queries []queryRecord
+}
+
+// queryRecord is a query that returned, rows is -1 when unknown
+type queryRecord struct {
+	name   string
+	driver string
+	step   string
+	start  time.Time
+	end    time.Time
+	rows   int64
+	err    error
+}
+
+// newTelemetry uses the TracerProvider / MeterProvider of the ETLX, the OTLP
+// exporters of the `telemetry` of the frontmatter or the otel globals (no-op
+// until set), in this order
+func (etlx *ETLX) newTelemetry() *telemetry {
+	tp, mp := etlx.TracerProvider, etlx.MeterProvider
+	t := &telemetry{
+		items:  map[string]*itemScope{},
+		byItem: map[uintptr]*itemScope{},
+	}
+	if tp == nil || mp == nil {
+		frontmatter, _ := etlx.Config["__frontmatter"].(map[string]any)
+		conf, err := TelemetryConfigFrom(frontmatter["telemetry"])
+		if err == nil && conf != nil {
+			var _tp trace.TracerProvider
+			var _mp metric.MeterProvider
+			_tp, _mp, t.shutdown, err = conf.Providers(etlx.Context(), etlx.EnvExpand)
+			// THE EXPORT ERRORS GO TO THE LOGS OF THE RUN INSTEAD OF THE STD LOG
+			l := etlx.logger("key", "telemetry")
+			otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+				l.Warn("telemetry export failed", "err", err)
+			}))
+			if tp == nil {
+				tp = _tp
+			}
+			if mp == nil {
+				mp = _mp
+			}
+		}
+		if err != nil {
+			etlx.logger("key", "telemetry").Warn("telemetry export disabled", "err", err)
+		}
+	}
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	t.tracer = tp.Tracer(instrumentationName)
+	meter := mp.Meter(instrumentationName)
+	var errs [7]error
+	t.runDuration, errs[0] = meter.Float64Histogram("etlx.run.duration", metric.WithUnit("s"), metric.WithDescription("Duration of the runs"))
+	t.stepDuration, errs[1] = meter.Float64Histogram("etlx.step.duration", metric.WithUnit("s"), metric.WithDescription("Duration of the steps of the items"))
+	t.queryDuration, errs[2] = meter.Float64Histogram("etlx.query.duration", metric.WithUnit("s"), metric.WithDescription("Duration of the queries"))
+	t.runFailures, errs[3] = meter.Int64Counter("etlx.run.failures", metric.WithDescription("Runs with an error or a failed step"))
+	t.stepFailures, errs[4] = meter.Int64Counter("etlx.step.failures", metric.WithDescription("Failed steps, the retried attempts included"))
+	t.queryFailures, errs[5] = meter.Int64Counter("etlx.query.failures", metric.WithDescription("Failed queries"))
+	t.rows, errs[6] = meter.Int64Counter("etlx.rows", metric.WithDescription("Rows of the steps that report them"))
+	if err := errors.Join(errs[:]...); err != nil {
+		etlx.logger("key", "telemetry").Warn("telemetry instruments", "err", err)
+	}
+	return t
+}
+
+// close flushes the providers built from the frontmatter
+func (t *telemetry) close(etlx *ETLX) {
+	if t == nil || t.shutdown == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(etlx.Context()), 10*time.Second)
+	defer cancel()
+	if err := t.shutdown(ctx); err != nil {
+		etlx.logger("key", "telemetry").Warn("telemetry export failed", "err", err)
+	}
+}
+
+// startRun starts the span of a run, ended with its logs and error
+func (t *telemetry) startRun(ctx context.Context, runID string) (context.Context, func(logs []map[string]any, err error)) {
+	start := time.Now()
+	attrs := []attribute.KeyValue{}
+	if runID != "" {
+		attrs = append(attrs, attribute.String("etlx.run_id", runID))
+	}
+	ctx, span := t.tracer.Start(ctx, "etlx.run", trace.WithAttributes(attrs...))
+	return ctx, func(logs []map[string]any, err error) {
+		failed := err != nil || anyFailed(logs)
+		t.runDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.Bool("success", !failed)))
+		if failed {
+			t.runFailures.Add(ctx, 1)
+			setSpanError(span, err, "run with failed steps")
+		}
+		span.End()
+	}
+}
+
+// startSection starts the span of a Level 1 key
+func (t *telemetry) startSection(ctx context.Context, key string, runsAs string) (context.Context, func(logs []map[string]any, err error)) {
+	ctx, span := t.tracer.Start(ctx, "etlx.section", trace.WithAttributes(
+		attribute.String("etlx.key", key),
+		attribute.String("etlx.runs_as", runsAs),
+	))
+	return ctx, func(logs []map[string]any, err error) {
+		if err != nil && (strings.Contains(err.Error(), "deactivated") || strings.Contains(err.Error(), "dectivated")) {
+			span.SetAttributes(attribute.Bool("etlx.deactivated", true))
+		} else if err != nil || anyFailed(logs) {
+			setSpanError(span, err, "section with failed steps")
+		}
+		span.End()
+	}
+}
+
+// startItem starts the span of an item, its steps and queries are recorded
+// under it until it ends
+func (t *telemetry) startItem(ctx context.Context, key string, itemKey string, item map[string]any) func(err error) {
+	ctx, span := t.tracer.Start(ctx, "etlx.item", trace.WithAttributes(
+		attribute.String("etlx.key", key),
+		attribute.String("etlx.item", itemKey),
+	))
+	scope := &itemScope{ctx: ctx, span: span, item: mapID(item)}
+	t.mu.Lock()
+	t.items[key+"."+itemKey] = scope
+	t.byItem[scope.item] = scope
+	t.mu.Unlock()
+	return func(err error) {
+		t.mu.Lock()
+		delete(t.items, key+"."+itemKey)
+		if t.byItem[scope.item] == scope {
+			delete(t.byItem, scope.item)
+		}
+		queries := scope.queries
+		scope.queries = nil
+		failed := scope.failed
+		t.mu.Unlock()
+		// THE QUERIES OUTSIDE OF ANY STEP
+		for _, q := range queries {
+			t.querySpan(ctx, q)
+		}
+		if err != nil || failed {
+			setSpanError(span, err, "item with failed steps")
+		}
+		span.End()
+	}
+}
+
+// observeEntry records a process log entry of an item as a step span, with
+// the queries that ran in it, and its metrics
+func (t *telemetry) observeEntry(ctx context.Context, entry map[string]any) {
+	if t == nil {
+		return
+	}
+	key, _ := entry["key"].(string)
+	itemKey, _ := entry["item_key"].(string)
+	success, hasSuccess := entry["success"].(bool)
+	skipped, _ := entry["skipped"].(bool)
+	if itemKey == "" || (!hasSuccess && !skipped) {
+		// THE KEY ENTRIES ARE THE SECTION SPAN AND THE ITEM ONES THE ITEM SPAN
+		return
+	}
+	start, ok := entry["start_at"].(time.Time)
+	if !ok {
+		return
+	}
+	end, ok := entry["end_at"].(time.Time)
+	if !ok || end.Before(start) {
+		end = start
+	}
+	retrying, _ := entry["retrying"].(bool)
+	process, _ := entry["process"].(string)
+	name, _ := entry["name"].(string)
+	rows, hasRows := entryRows(entry["rows"])
+	failed := hasSuccess && !success && !skipped
+	t.mu.Lock()
+	var queries []queryRecord
+	parent := ctx
+	if scope, ok := t.items[key+"."+itemKey]; ok {
+		parent = scope.ctx
+		if failed && !retrying {
+			scope.failed = true
+		}
+		left := scope.queries[:0]
+		for _, q := range scope.queries {
+			if !q.start.Before(start) && !q.end.After(end) {
+				queries = append(queries, q)
+			} else {
+				left = append(left, q)
+			}
+		}
+		scope.queries = left
+	}
+	t.mu.Unlock()
+	attrs := []attribute.KeyValue{
+		attribute.String("etlx.key", key),
+		attribute.String("etlx.item", itemKey),
+		attribute.String("etlx.process", process),
+	}
+	if !skipped {
+		_attrs := append(attrs, attribute.Bool("success", !failed))
+		t.stepDuration.Record(ctx, end.Sub(start).Seconds(), metric.WithAttributes(_attrs...))
+		if failed {
+			t.stepFailures.Add(ctx, 1, metric.WithAttributes(attrs...))
+		}
+		if hasRows && rows > 0 {
+			t.rows.Add(ctx, rows, metric.WithAttributes(attrs...))
+		}
+	}
+	attrs = append(attrs, attribute.String("etlx.step", name))
+	if hasSuccess {
+		attrs = append(attrs, attribute.Bool("etlx.success", success))
+	}
+	if hasRows {
+		attrs = append(attrs, attribute.Int64("etlx.rows", rows))
+	}
+	if skipped {
+		attrs = append(attrs, attribute.Bool("etlx.skipped", true))
+	}
+	if retrying {
+		attrs = append(attrs, attribute.Bool("etlx.retrying", true))
+	}
+	stepCtx, span := t.tracer.Start(parent, "etlx.step", trace.WithTimestamp(start), trace.WithAttributes(attrs...))
+	for _, q := range queries {
+		t.querySpan(stepCtx, q)
+	}
+	if failed {
+		msg, _ := entry["msg"].(string)
+		span.SetStatus(codes.Error, msg)
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// recordQuery records a query that returned, under the step of the item it
+// ran in when the item is running, under ctx otherwise
+func (t *telemetry) recordQuery(ctx context.Context, item map[string]any, q queryRecord) {
+	if t == nil {
+		return
+	}
+	attrs := metric.WithAttributes(attribute.String("db.system.name", q.driver), attribute.Bool("success", q.err == nil))
+	t.queryDuration.Record(ctx, q.end.Sub(q.start).Seconds(), attrs)
+	if q.err != nil {
+		t.queryFailures.Add(ctx, 1, metric.WithAttributes(attribute.String("db.system.name", q.driver)))
+	}
+	t.mu.Lock()
+	scope, ok := t.byItem[mapID(item)]
+	if ok {
+		scope.queries = append(scope.queries, q)
+	}
+	t.mu.Unlock()
+	if !ok {
+		t.querySpan(ctx, q)
+	}
+}
+
+func (t *telemetry) querySpan(ctx context.Context, q queryRecord) {
+	attrs := []attribute.KeyValue{attribute.String("db.system.name", q.driver)}
+	if q.name != "" {
+		attrs = append(attrs, attribute.String("etlx.query", q.name))
+	}
+	if q.step != "" {
+		attrs = append(attrs, attribute.String("etlx.step", q.step))
+	}
+	if q.rows >= 0 {
+		attrs = append(attrs, attribute.Int64("etlx.rows", q.rows))
+	}
+	_, span := t.tracer.Start(ctx, "etlx.query", trace.WithTimestamp(q.start), trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	if q.err != nil {
+		setSpanError(span, q.err, "")
+	}
+	span.End(trace.WithTimestamp(q.end))
+}
+
+// traceItem starts the span of an item when the run is traced
+func (etlx *ETLX) traceItem(key string, itemKey string, item map[string]any) func(err error) {
+	if etlx.tel == nil {
+		return func(error) {}
+	}
+	return etlx.tel.startItem(etlx.Context(), key, itemKey, item)
+}
+
+// traceQuery records a query of item that ran since start, rows -1 when unknown
+func (etlx *ETLX) traceQuery(ctx context.Context, conn db.DBInterface, item map[string]any, name string, step string, start time.Time, rows int64, err error) {
+	if etlx.tel == nil {
+		return
+	}
+	if _, ok := item[name].(string); !ok && etlx.Config[name] == nil {
+		// INLINE SQL, NOT THE NAME OF A QUERY
+		name = ""
+	}
+	etlx.tel.recordQuery(ctx, item, queryRecord{
+		name:   name,
+		driver: conn.GetDriverName(),
+		step:   step,
+		start:  start,
+		end:    time.Now(),
+		rows:   rows,
+		err:    secrets.MaskErr(err),
+	})
+}
+
+// mapID identifies an item map, the runners pass the item of the config on
+func mapID(m map[string]any) uintptr {
+	if m == nil {
+		return 0
+	}
+	return reflect.ValueOf(m).Pointer()
+}
+
+// anyFailed tells if a step failed, the retried attempts apart
+func anyFailed(logs []map[string]any) bool {
+	for _, _log := range logs {
+		success, ok := _log["success"].(bool)
+		if retrying, _ := _log["retrying"].(bool); ok && !success && !retrying {
+			return true
+		}
+	}
+	return false
+}
+
+func entryRows(v any) (int64, bool) {
+	if v == nil {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+	if err != nil {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func setSpanError(span trace.Span, err error, msg string) {
+	if err != nil {
+		span.RecordError(err)
+		msg = err.Error()
+	}
+	span.SetStatus(codes.Error, msg)
+}
@@ -0,0 +1,239 @@
+package etlxlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	noopmetric "go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	nooptrace "go.opentelemetry.io/otel/trace/noop"
+)
+
+// TelemetryConfig is the `telemetry` of the frontmatter, the OTLP export of
+// the traces and the metrics of the runs:
+//
+//	---
+//	telemetry:
+//	  service_name: nightly
+//	  endpoint: http://otel-collector:4318
+//	  protocol: http/protobuf
+//	  headers:
+//	    authorization: Bearer $OTLP_TOKEN
+//	---
+//
+// `telemetry: true` exports with the OTEL_EXPORTER_OTLP_* environment variables
+type TelemetryConfig struct {
+	ServiceName string
+	// Endpoint is a host:port or a URL, the OTLP default when empty
+	Endpoint string
+	// Protocol is http/protobuf (default) or grpc
+	Protocol string
+	Insecure bool
+	Headers  map[string]string
+	Traces   bool
+	Metrics  bool
+	// MetricsInterval is the time between the metrics exports, the metrics
+	// are also exported at the end of the run
+	MetricsInterval time.Duration
+}
+
+// TelemetryConfigFrom reads the `telemetry` of the frontmatter, nil when
+// missing or false
+func TelemetryConfigFrom(value any) (*TelemetryConfig, error) {
+	conf := &TelemetryConfig{Traces: true, Metrics: true}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if !v {
+			return nil, nil
+		}
+		return conf, nil
+	case map[string]any:
+		if active, ok := v["active"].(bool); ok && !active {
+			return nil, nil
+		}
+		conf.ServiceName, _ = v["service_name"].(string)
+		conf.Endpoint, _ = v["endpoint"].(string)
+		conf.Protocol, _ = v["protocol"].(string)
+		for key, target := range map[string]*bool{"insecure": &conf.Insecure, "traces": &conf.Traces, "metrics": &conf.Metrics} {
+			if b, ok := v[key]; ok {
+				_b, err := strconv.ParseBool(fmt.Sprintf("%v", b))
+				if err != nil {
+					return nil, fmt.Errorf("telemetry: %s must be a bool, got %v", key, b)
+				}
+				*target = _b
+			}
+		}
+		if headers, ok := v["headers"].(map[string]any); ok {
+			conf.Headers = map[string]string{}
+			for name, value := range headers {
+				conf.Headers[name] = fmt.Sprintf("%v", value)
+			}
+		}
+		if interval, ok := v["metrics_interval"]; ok {
+			d, err := parseRetryDelay(interval)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("telemetry: invalid metrics_interval %v", interval)
+			}
+			conf.MetricsInterval = d
+		}
+		return conf, nil
+	}
+	return nil, fmt.Errorf("telemetry must be a bool or a map, got %T", value)
+}
+
+// Providers builds the tracer and the meter providers exporting over OTLP,
+// expand resolves the $VAR of the endpoint and the headers. shutdown
+// exports what is left and stops them
+func (c *TelemetryConfig) Providers(ctx context.Context, expand func(string) string) (trace.TracerProvider, metric.MeterProvider, func(context.Context) error, error) {
+	if expand == nil {
+		expand = os.ExpandEnv
+	}
+	protocol := c.Protocol
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+	protocol = strings.ToLower(strings.TrimSpace(protocol))
+	grpc := false
+	switch protocol {
+	case "", "http", "http/protobuf":
+	case "grpc":
+		grpc = true
+	default:
+		return nil, nil, nil, fmt.Errorf("telemetry: unknown protocol %q (http/protobuf or grpc)", c.Protocol)
+	}
+	endpoint := expand(c.Endpoint)
+	headers := map[string]string{}
+	for name, value := range c.Headers {
+		headers[name] = expand(value)
+	}
+	res, err := c.resource()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var tp trace.TracerProvider = nooptrace.NewTracerProvider()
+	var mp metric.MeterProvider = noopmetric.NewMeterProvider()
+	shutdown := []func(context.Context) error{}
+	if c.Traces {
+		var exporter sdktrace.SpanExporter
+		if grpc {
+			opts := []otlptracegrpc.Option{}
+			if strings.Contains(endpoint, "://") {
+				opts = append(opts, otlptracegrpc.WithEndpointURL(endpoint))
+			} else if endpoint != "" {
+				opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+			}
+			if c.Insecure {
+				opts = append(opts, otlptracegrpc.WithInsecure())
+			}
+			if len(headers) > 0 {
+				opts = append(opts, otlptracegrpc.WithHeaders(headers))
+			}
+			exporter, err = otlptracegrpc.New(ctx, opts...)
+		} else {
+			opts := []otlptracehttp.Option{}
+			if strings.Contains(endpoint, "://") {
+				opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+			} else if endpoint != "" {
+				opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+			}
+			if c.Insecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+			if len(headers) > 0 {
+				opts = append(opts, otlptracehttp.WithHeaders(headers))
+			}
+			exporter, err = otlptracehttp.New(ctx, opts...)
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("telemetry traces: %w", err)
+		}
+		_tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+		tp = _tp
+		shutdown = append(shutdown, _tp.Shutdown)
+	}
+	if c.Metrics {
+		var exporter sdkmetric.Exporter
+		if grpc {
+			opts := []otlpmetricgrpc.Option{}
+			if strings.Contains(endpoint, "://") {
+				opts = append(opts, otlpmetricgrpc.WithEndpointURL(endpoint))
+			} else if endpoint != "" {
+				opts = append(opts, otlpmetricgrpc.WithEndpoint(endpoint))
+			}
+			if c.Insecure {
+				opts = append(opts, otlpmetricgrpc.WithInsecure())
+			}
+			if len(headers) > 0 {
+				opts = append(opts, otlpmetricgrpc.WithHeaders(headers))
+			}
+			exporter, err = otlpmetricgrpc.New(ctx, opts...)
+		} else {
+			opts := []otlpmetrichttp.Option{}
+			if strings.Contains(endpoint, "://") {
+				opts = append(opts, otlpmetrichttp.WithEndpointURL(endpoint))
+			} else if endpoint != "" {
+				opts = append(opts, otlpmetrichttp.WithEndpoint(endpoint))
+			}
+			if c.Insecure {
+				opts = append(opts, otlpmetrichttp.WithInsecure())
+			}
+			if len(headers) > 0 {
+				opts = append(opts, otlpmetrichttp.WithHeaders(headers))
+			}
+			exporter, err = otlpmetrichttp.New(ctx, opts...)
+		}
+		if err != nil {
+			for _, fn := range shutdown {
+				_ = fn(ctx)
+			}
+			return nil, nil, nil, fmt.Errorf("telemetry metrics: %w", err)
+		}
+		readerOpts := []sdkmetric.PeriodicReaderOption{}
+		if c.MetricsInterval > 0 {
+			readerOpts = append(readerOpts, sdkmetric.WithInterval(c.MetricsInterval))
+		}
+		_mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, readerOpts...)), sdkmetric.WithResource(res))
+		mp = _mp
+		shutdown = append(shutdown, _mp.Shutdown)
+	}
+	return tp, mp, func(ctx context.Context) error {
+		errs := []error{}
+		for _, fn := range shutdown {
+			errs = append(errs, fn(ctx))
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// resource is the OTEL_RESOURCE_ATTRIBUTES / OTEL_SERVICE_NAME one, with
+// service_name, etlx when none is set
+func (c *TelemetryConfig) resource() (*resource.Resource, error) {
+	name := c.ServiceName
+	if name == "" && os.Getenv("OTEL_SERVICE_NAME") == "" {
+		name = "etlx"
+	}
+	if name == "" {
+		return resource.Default(), nil
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", name)))
+	if err != nil {
+		return nil, fmt.Errorf("telemetry resource: %w", err)
+	}
+	return res, nil
+}
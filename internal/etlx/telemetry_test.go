@@ -0,0 +1,229 @@
+package etlxlib
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// telemetryMD loads orders (3 rows) and fails on broken, <db> is a DuckDB file
+const telemetryMD = "# ETL\n\n" +
+	"```yaml metadata\nname: ETL\ndescription: telemetry test\nruns_as: ETL\nconnection: \"duckdb:<db>\"\nactive: true\n```\n\n" +
+	"## orders\n\n" +
+	"```yaml metadata\nname: orders\ndescription: loads the orders\ntable: orders\nload_sql: load_orders\nactive: true\n```\n\n" +
+	"```sql\n-- load_orders\nCREATE OR REPLACE TABLE orders AS SELECT range AS id FROM range(3)\n```\n\n" +
+	"## broken\n\n" +
+	"```yaml metadata\nname: broken\ndescription: reads a missing table\ntable: missing_table\nload_sql: SELECT * FROM missing_table\nactive: true\n```\n"
+
+// runTraced runs telemetryMD on db, only counting the rows of the tables when
+// rows is true, with in-memory exporters
+func runTraced(t *testing.T, db string, rows bool) ([]sdktrace.ReadOnlySpan, metricdata.ResourceMetrics) {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	etlx := &ETLX{
+		TimeZone:         time.UTC,
+		TracerProvider:   sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:    sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+		autoLogsDisabled: true,
+	}
+	if err := etlx.ConfigFromMDText(strings.ReplaceAll(telemetryMD, "<db>", db)); err != nil {
+		t.Fatal(err)
+	}
+	extraConf := map[string]any{"clean": false, "drop": false, "rows": rows, "file": ""}
+	etlx.RunETLX(extraConf, []time.Time{time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	var metrics metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatal(err)
+	}
+	return spans.Ended(), metrics
+}
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTelemetrySpans(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "telemetry.duckdb")
+	ended, _ := runTraced(t, db, false)
+	byID := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range ended {
+		byID[span.SpanContext().SpanID().String()] = span
+	}
+	parentName := func(span sdktrace.ReadOnlySpan) string {
+		if parent, ok := byID[span.Parent().SpanID().String()]; ok {
+			return parent.Name()
+		}
+		return ""
+	}
+	wantParent := map[string]string{
+		"etlx.run":     "",
+		"etlx.section": "etlx.run",
+		"etlx.item":    "etlx.section",
+		"etlx.step":    "etlx.item",
+		"etlx.query":   "etlx.step",
+	}
+	count := map[string]int{}
+	for _, span := range ended {
+		want, ok := wantParent[span.Name()]
+		if !ok {
+			t.Errorf("unexpected span %s", span.Name())
+			continue
+		}
+		count[span.Name()]++
+		if got := parentName(span); got != want {
+			t.Errorf("%s is under %q, want %q", span.Name(), got, want)
+		}
+	}
+	for name := range wantParent {
+		if count[name] == 0 {
+			t.Errorf("no %s span", name)
+		}
+	}
+	if count["etlx.run"] != 1 || count["etlx.section"] != 1 || count["etlx.item"] != 2 {
+		t.Errorf("spans = %v, want 1 run, 1 section, 2 items", count)
+	}
+	failed := map[string]bool{}
+	for _, span := range ended {
+		item, _ := spanAttr(span, "etlx.item")
+		switch span.Name() {
+		case "etlx.run":
+			failed["run"] = span.Status().Code == codes.Error
+		case "etlx.section":
+			if key, _ := spanAttr(span, "etlx.key"); key.AsString() != "ETL" {
+				t.Errorf("section etlx.key = %q", key.AsString())
+			}
+			if runsAs, _ := spanAttr(span, "etlx.runs_as"); runsAs.AsString() != "ETL" {
+				t.Errorf("section etlx.runs_as = %q", runsAs.AsString())
+			}
+		case "etlx.item":
+			failed[item.AsString()] = span.Status().Code == codes.Error
+		case "etlx.query":
+			if driver, _ := spanAttr(span, "db.system.name"); driver.AsString() != "duckdb" {
+				t.Errorf("query db.system.name = %q, want duckdb", driver.AsString())
+			}
+			if span.Status().Code == codes.Error {
+				failed["query"] = true
+			}
+		}
+	}
+	want := map[string]bool{"run": true, "orders": false, "broken": true, "query": true}
+	for name, w := range want {
+		if failed[name] != w {
+			t.Errorf("%s span failed = %v, want %v", name, failed[name], w)
+		}
+	}
+	// THE ROWS OF THE TABLES, ON THE STEP AND ON THE QUERY THAT COUNTED THEM
+	ended, _ = runTraced(t, db, true)
+	var rowsStep, rowsQuery bool
+	for _, span := range ended {
+		rows, ok := spanAttr(span, "etlx.rows")
+		if !ok {
+			continue
+		}
+		item, _ := spanAttr(span, "etlx.item")
+		switch {
+		case span.Name() == "etlx.step" && item.AsString() == "orders":
+			rowsStep = rows.AsInt64() == 3
+		case span.Name() == "etlx.query" && rows.AsInt64() == 1:
+			rowsQuery = true
+		}
+	}
+	if !rowsStep {
+		t.Error("no step of orders with etlx.rows = 3")
+	}
+	if !rowsQuery {
+		t.Error("no query with etlx.rows = 1 (the row of the count)")
+	}
+}
+
+func TestTelemetryMetrics(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "telemetry.duckdb")
+	collect := func(rows bool) map[string]metricdata.Aggregation {
+		_, metrics := runTraced(t, db, rows)
+		found := map[string]metricdata.Aggregation{}
+		for _, scope := range metrics.ScopeMetrics {
+			if scope.Scope.Name != instrumentationName {
+				continue
+			}
+			for _, m := range scope.Metrics {
+				found[m.Name] = m.Data
+			}
+		}
+		return found
+	}
+	sum := func(found map[string]metricdata.Aggregation, name string, match func(attribute.Set) bool) int64 {
+		data, ok := found[name].(metricdata.Sum[int64])
+		if !ok {
+			t.Errorf("%s is not an int64 counter: %T", name, found[name])
+			return 0
+		}
+		total := int64(0)
+		for _, dp := range data.DataPoints {
+			if match == nil || match(dp.Attributes) {
+				total += dp.Value
+			}
+		}
+		return total
+	}
+	histCount := func(found map[string]metricdata.Aggregation, name string, match func(attribute.Set) bool) uint64 {
+		data, ok := found[name].(metricdata.Histogram[float64])
+		if !ok {
+			t.Errorf("%s is not a float64 histogram: %T", name, found[name])
+			return 0
+		}
+		count := uint64(0)
+		for _, dp := range data.DataPoints {
+			if match == nil || match(dp.Attributes) {
+				count += dp.Count
+			}
+		}
+		return count
+	}
+	is := func(key string, value string) func(attribute.Set) bool {
+		return func(set attribute.Set) bool {
+			v, ok := set.Value(attribute.Key(key))
+			return ok && v.Emit() == value
+		}
+	}
+	found := collect(false)
+	if n := histCount(found, "etlx.run.duration", is("success", "false")); n != 1 {
+		t.Errorf("etlx.run.duration{success=false} count = %d, want 1", n)
+	}
+	if n := sum(found, "etlx.run.failures", nil); n != 1 {
+		t.Errorf("etlx.run.failures = %d, want 1", n)
+	}
+	if n := histCount(found, "etlx.step.duration", is("etlx.item", "orders")); n == 0 {
+		t.Error("no etlx.step.duration for orders")
+	}
+	if n := sum(found, "etlx.step.failures", is("etlx.item", "broken")); n == 0 {
+		t.Error("no etlx.step.failures for broken")
+	}
+	if n := sum(found, "etlx.step.failures", is("etlx.item", "orders")); n != 0 {
+		t.Errorf("etlx.step.failures for orders = %d, want 0", n)
+	}
+	if n := histCount(found, "etlx.query.duration", is("db.system.name", "duckdb")); n == 0 {
+		t.Error("no etlx.query.duration for duckdb")
+	}
+	if n := sum(found, "etlx.query.failures", is("db.system.name", "duckdb")); n == 0 {
+		t.Error("no etlx.query.failures for duckdb")
+	}
+	found = collect(true)
+	if n := sum(found, "etlx.rows", is("etlx.item", "orders")); n != 3 {
+		t.Errorf("etlx.rows for orders = %d, want 3", n)
+	}
+}
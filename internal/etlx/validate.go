@@ -0,0 +1,665 @@
+package etlxlib
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Field types of the metadata schema
+const (
+	FieldString   = "string"
+	FieldBool     = "bool"
+	FieldInt      = "int"
+	FieldNumber   = "number"
+	FieldMap      = "map"
+	FieldList     = "list"
+	FieldSQL      = "sql"      // a query, a query name or a list of them
+	FieldStrList  = "str_list" // a string (comma separated) or a list of strings
+	FieldBoolStr  = "bool_str" // a bool or a string that parses as bool
+	FieldDuration = "duration" // a go duration or a number of seconds
+	FieldAny      = "any"
+)
+
+// FieldSpec is the schema of a metadata field
+type FieldSpec struct {
+	Type     string
+	Required bool
+	// RequiredIfInactive is required only with `active: false`, read when logging the deactivation
+	RequiredIfInactive bool
+}
+
+// KindSchema is the schema of the key and items metadata of a runs_as kind
+type KindSchema struct {
+	Key  map[string]FieldSpec
+	Item map[string]FieldSpec
+	// ItemPattern matches the item fields whose names are built at runtime (e.g. extract_sql)
+	ItemPattern *regexp.Regexp
+	// Lenient kinds only check the known fields, unknown fields are not reported
+	Lenient bool
+	// NoItems kinds do not run their level 2 sections as items
+	NoItems bool
+}
+
+// ValidationError is a problem found in the config, Level is error or warning
+type ValidationError struct {
+	Line  int    `json:"line"`
+	Level string `json:"level"`
+	Key   string `json:"key"`
+	Item  string `json:"item,omitempty"`
+	Field string `json:"field,omitempty"`
+	Msg   string `json:"msg"`
+}
+
+func (e ValidationError) Error() string {
+	where := e.Key
+	if e.Item != "" {
+		where += " -> " + e.Item
+	}
+	if e.Field != "" {
+		where += fmt.Sprintf(" (%s)", e.Field)
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, where, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", where, e.Msg)
+}
+
+// commonKeyFields are accepted in the metadata of every Level 1 key
+var commonKeyFields = map[string]FieldSpec{
+	"timeout":           {Type: FieldDuration},
+	"database":          {Type: FieldString},
+	"schema":            {Type: FieldString},
+	"name":              {Type: FieldString},
+	"description":       {Type: FieldString},
+	"runs_as":           {Type: FieldString},
+	"active":            {Type: FieldBool},
+	"connection":        {Type: FieldString},
+	"depends_on":        {Type: FieldStrList},
+	"date_ref":          {Type: FieldString},
+	"schedule":          {Type: FieldString},
+	"date_ref_offset":   {Type: FieldInt},
+	"parallel":          {Type: FieldBoolStr},
+	"max_workers":       {Type: FieldInt},
+	"retries":           {Type: FieldInt},
+	"retry_delay":       {Type: FieldDuration},
+	"retry_backoff":     {Type: FieldNumber},
+	"retry_on_err_patt": {Type: FieldString},
+	"before_sql":        {Type: FieldSQL},
+	"after_sql":         {Type: FieldSQL},
+	"has_placeholders":  {Type: FieldBool},
+	"critical":          {Type: FieldBool},
+	"on_error":          {Type: FieldString},
+	"on_success":        {Type: FieldStrList},
+	"on_failure":        {Type: FieldStrList},
+}
+
+// commonItemFields are accepted in the metadata of every item
+var commonItemFields = map[string]FieldSpec{
+	"timeout":           {Type: FieldDuration},
+	"database":          {Type: FieldString},
+	"schema":            {Type: FieldString},
+	"name":              {Type: FieldString},
+	"description":       {Type: FieldString},
+	"active":            {Type: FieldBool},
+	"connection":        {Type: FieldString},
+	"depends_on":        {Type: FieldStrList},
+	"date_ref":          {Type: FieldString},
+	"retries":           {Type: FieldInt},
+	"retry_delay":       {Type: FieldDuration},
+	"retry_backoff":     {Type: FieldNumber},
+	"retry_on_err_patt": {Type: FieldString},
+	"before_sql":        {Type: FieldSQL},
+	"after_sql":         {Type: FieldSQL},
+	"table":             {Type: FieldString},
+	"has_placeholders":  {Type: FieldBool},
+	"for_each":          {Type: FieldAny},
+}
+
+var etlStepFieldRe = regexp.MustCompile(`^(extract|transform|load)(|_sql|_query|_main|_before_sql|_before|_start|_startup|_setup|_after_sql|_after|_end|_cleanup|_conn|_from_file|_validation|_condition|_condition_msg|_on_err_match_patt|_on_err_match_sql|_before_on_err_match_patt|_before_on_err_match_sql|_after_on_err_match_patt|_after_on_err_match_sql)$`)
+
+// conditionFields are the `condition` options of the items
+var conditionFields = map[string]FieldSpec{
+	"condition":     {Type: FieldString},
+	"condition_msg": {Type: FieldString},
+}
+
+// modelFields are the fields of the model / workflow / role kinds
+var modelFields = map[string]FieldSpec{
+	"admin_conn":            {Type: FieldString},
+	"admin_connection":      {Type: FieldString},
+	"conn":                  {Type: FieldString},
+	"database":              {Type: FieldString},
+	"cs_app":                {Type: FieldMap},
+	"create_all":            {Type: FieldString},
+	"drop_all":              {Type: FieldString},
+	"update_table_metadata": {Type: FieldBool},
+	"version":               {Type: FieldString},
+	"table":                 {Type: FieldString},
+}
+
+func mergeFields(fields ...map[string]FieldSpec) map[string]FieldSpec {
+	res := map[string]FieldSpec{}
+	for _, _fields := range fields {
+		for k, v := range _fields {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// Schemas is the metadata schema of each runs_as kind
+var Schemas = map[string]KindSchema{
+	"ETL": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, RequiredIfInactive: true},
+		}),
+		Item: mergeFields(commonItemFields, map[string]FieldSpec{
+			"file":            {Type: FieldString},
+			"tmp":             {Type: FieldBool},
+			"odbc_to_csv":     {Type: FieldBool},
+			"to_csv":          {Type: FieldBool},
+			"csv_options":     {Type: FieldMap},
+			"to_parquet":      {Type: FieldBool},
+			"parquet_options": {Type: FieldMap},
+			"to_arrow":        {Type: FieldBool},
+			"arrow_options":   {Type: FieldMap},
+			"clean_sql":       {Type: FieldSQL},
+			"drop_sql":        {Type: FieldSQL},
+			"rows_sql":        {Type: FieldSQL},
+		}),
+		ItemPattern: etlStepFieldRe,
+	},
+	"SCRIPTS": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, RequiredIfInactive: true},
+		}),
+		Item: mergeFields(commonItemFields, conditionFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+			"script_sql":  {Type: FieldSQL},
+			"on_err_patt": {Type: FieldString},
+			"on_err_sql":  {Type: FieldSQL},
+			"file":        {Type: FieldString},
+			"fname":       {Type: FieldString},
+			"path":        {Type: FieldString},
+		}),
+	},
+	"EXPORTS": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, RequiredIfInactive: true},
+			"path":        {Type: FieldString},
+		}),
+		Item: mergeFields(commonItemFields, conditionFields, map[string]FieldSpec{
+			"description":     {Type: FieldString, Required: true},
+			"export_sql":      {Type: FieldSQL},
+			"data_sql":        {Type: FieldSQL},
+			"data":            {Type: FieldMap},
+			"mapping":         {Type: FieldAny},
+			"template":        {Type: FieldString},
+			"text_template":   {Type: FieldBool},
+			"pdf":             {Type: FieldMap},
+			"return_content":  {Type: FieldBool},
+			"path":            {Type: FieldString},
+			"file":            {Type: FieldString},
+			"fname":           {Type: FieldString},
+			"tmp_prefix":      {Type: FieldString},
+			"to_csv":          {Type: FieldBool},
+			"csv_options":     {Type: FieldMap},
+			"to_parquet":      {Type: FieldBool},
+			"parquet_options": {Type: FieldMap},
+			"to_arrow":        {Type: FieldBool},
+			"arrow_options":   {Type: FieldMap},
+		}),
+	},
+	"NOTIFY": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+			"path":        {Type: FieldString},
+		}),
+		Item: mergeFields(commonItemFields, conditionFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+			"data_sql":    {Type: FieldSQL},
+			"data":        {Type: FieldMap},
+			"attachments": {Type: FieldList},
+			"body":        {Type: FieldString},
+			"subject":     {Type: FieldString},
+			"path":        {Type: FieldString},
+		}),
+		Lenient: true,
+	},
+	"ACTIONS": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+			"path":        {Type: FieldString},
+		}),
+		Item: mergeFields(commonItemFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+			"type":        {Type: FieldString},
+			"params":      {Type: FieldMap},
+			"path":        {Type: FieldString},
+		}),
+	},
+	"DATA_QUALITY": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+		}),
+		Item: mergeFields(commonItemFields, conditionFields, map[string]FieldSpec{
+			"description":     {Type: FieldString, Required: true},
+			"query":           {Type: FieldSQL},
+			"fix_quality_err": {Type: FieldSQL},
+			"column":          {Type: FieldString},
+			"check_only":      {Type: FieldBool},
+			"fix_only":        {Type: FieldBool},
+		}),
+	},
+	"MULTI_QUERIES": {
+		Key: mergeFields(commonKeyFields, conditionFields, map[string]FieldSpec{
+			"description":      {Type: FieldString, Required: true},
+			"union_key":        {Type: FieldString},
+			"save_sql":         {Type: FieldSQL},
+			"save_on_err_patt": {Type: FieldString},
+			"save_on_err_sql":  {Type: FieldSQL},
+		}),
+		Item: mergeFields(commonItemFields, conditionFields, map[string]FieldSpec{
+			"query": {Type: FieldSQL},
+		}),
+		Lenient: true,
+	},
+	"LOGS": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"table":            {Type: FieldString},
+			"save_log_sql":     {Type: FieldSQL},
+			"save_on_err_patt": {Type: FieldString},
+			"save_on_err_sql":  {Type: FieldSQL},
+			"tmp_dir":          {Type: FieldString},
+		}),
+		NoItems: true,
+	},
+	"REQUIRES": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+		}),
+		Item: mergeFields(commonItemFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+			"path":        {Type: FieldString},
+			"query":       {Type: FieldSQL},
+			"column":      {Type: FieldString},
+		}),
+	},
+	"REMOTE": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString, RequiredIfInactive: true},
+		}),
+		Item:    commonItemFields,
+		Lenient: true,
+	},
+	"CONNECTIONS": {
+		Key: mergeFields(commonKeyFields, map[string]FieldSpec{
+			"description": {Type: FieldString},
+		}),
+		Item: map[string]FieldSpec{
+			"name":           {Type: FieldString},
+			"description":    {Type: FieldString},
+			"active":         {Type: FieldBool},
+			"connection":     {Type: FieldString, Required: true},
+			"before_sql":     {Type: FieldSQL},
+			"after_sql":      {Type: FieldSQL},
+			"max_open_conns": {Type: FieldInt},
+			"max_idle_conns": {Type: FieldInt},
+		},
+	},
+	"MODEL": {
+		Key: mergeFields(commonKeyFields, modelFields, map[string]FieldSpec{
+			"description": {Type: FieldString, Required: true},
+		}),
+		Item:    mergeFields(commonItemFields, modelFields),
+		Lenient: true,
+	},
+}
+
+// schemaAliases maps the runs_as aliases to their schema
+var schemaAliases = map[string]string{
+	"ELT":             "ETL",
+	"MODEL_SQL":       "SCRIPTS",
+	"NOTIFICATION":    "NOTIFY",
+	"DATAQUALITY":     "DATA_QUALITY",
+	"QUALITY":         "DATA_QUALITY",
+	"STACKED_QUERIES": "MULTI_QUERIES",
+	"OBSERVABILITY":   "LOGS",
+	"AUTO_LOGS":       "LOGS",
+	"IMPORTS":         "REQUIRES",
+	"REMOTE_EXEC":     "REMOTE",
+	"CSMODEL":         "MODEL",
+	"C7MODEL":         "MODEL",
+	"MODEL_DATA":      "MODEL",
+	"CSDATA":          "MODEL",
+	"C7DATA":          "MODEL",
+	"WORKFLOW":        "MODEL",
+	"C7WORKFLOW":      "MODEL",
+	"CSWORKFLOW":      "MODEL",
+	"C7ROLE":          "MODEL",
+	"CSROLE":          "MODEL",
+	"ROLE":            "MODEL",
+	"C7ROLE_USERS":    "MODEL",
+	"CSROLE_USERS":    "MODEL",
+	"ROLE_USERS":      "MODEL",
+}
+
+// SchemaFor returns the schema of a runs_as kind
+func SchemaFor(runsAs string) (KindSchema, bool) {
+	runsAs = strings.ToUpper(runsAs)
+	if alias, ok := schemaAliases[runsAs]; ok {
+		runsAs = alias
+	}
+	schema, ok := Schemas[runsAs]
+	return schema, ok
+}
+
+// checkFieldType tells if a metadata value matches the field type
+func checkFieldType(fieldType string, v any) bool {
+	switch fieldType {
+	case FieldString:
+		_, ok := v.(string)
+		return ok
+	case FieldBool:
+		_, ok := v.(bool)
+		return ok
+	case FieldInt:
+		switch _v := v.(type) {
+		case int, int32, int64, uint, uint32, uint64:
+			return true
+		case float64:
+			return _v == float64(int64(_v))
+		case string:
+			_, err := strconv.Atoi(_v)
+			return err == nil
+		}
+		return false
+	case FieldNumber:
+		switch _v := v.(type) {
+		case int, int32, int64, uint, uint32, uint64, float32, float64:
+			return true
+		case string:
+			_, err := strconv.ParseFloat(_v, 64)
+			return err == nil
+		}
+		return false
+	case FieldMap:
+		_, ok := v.(map[string]any)
+		return ok
+	case FieldList:
+		_, ok := v.([]any)
+		return ok
+	case FieldSQL, FieldStrList:
+		switch _v := v.(type) {
+		case string:
+			return true
+		case []any:
+			for _, s := range _v {
+				if _, ok := s.(string); !ok {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case FieldBoolStr:
+		switch _v := v.(type) {
+		case bool:
+			return true
+		case string:
+			_, err := strconv.ParseBool(_v)
+			return err == nil
+		}
+		return false
+	case FieldDuration:
+		_, err := parseRetryDelay(v)
+		return err == nil
+	}
+	return true
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case map[string]any:
+		return "map"
+	case []any:
+		return "list"
+	case int, int32, int64, uint, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validateMetadata checks a metadata map against the fields of a schema
+func validateMetadata(metadata map[string]any, fields map[string]FieldSpec, pattern *regexp.Regexp, lenient bool, key string, item string) []ValidationError {
+	errs := []ValidationError{}
+	inactive := false
+	if active, ok := metadata["active"].(bool); ok && !active {
+		inactive = true
+	}
+	names := []string{}
+	for field := range fields {
+		names = append(names, field)
+	}
+	sort.Strings(names)
+	for _, field := range names {
+		spec := fields[field]
+		v, ok := metadata[field]
+		if !ok || v == nil {
+			if spec.Required || (spec.RequiredIfInactive && inactive) {
+				errs = append(errs, ValidationError{Level: "error", Key: key, Item: item, Field: field, Msg: fmt.Sprintf("missing required field %s (%s)", field, spec.Type)})
+			}
+			continue
+		}
+		if !checkFieldType(spec.Type, v) {
+			errs = append(errs, ValidationError{Level: "error", Key: key, Item: item, Field: field, Msg: fmt.Sprintf("field %s must be %s, got %s", field, spec.Type, typeName(v))})
+		}
+	}
+	if lenient {
+		return errs
+	}
+	unknown := []string{}
+	for field := range metadata {
+		if _, ok := fields[field]; ok || strings.HasPrefix(field, "_") {
+			continue
+		}
+		if pattern != nil && pattern.MatchString(field) {
+			continue
+		}
+		unknown = append(unknown, field)
+	}
+	sort.Strings(unknown)
+	for _, field := range unknown {
+		errs = append(errs, ValidationError{Level: "warning", Key: key, Item: item, Field: field, Msg: fmt.Sprintf("unknown field %s", field)})
+	}
+	return errs
+}
+
+// ValidateKey checks the metadata of a Level 1 key and its items against the
+// schema of its runs_as, conf defaults to etlx.Config
+func (etlx *ETLX) ValidateKey(conf map[string]any, key string) []ValidationError {
+	return etlx.validateKey(conf, key, strings.ToUpper(key))
+}
+
+// validateKey uses defaultRunsAs for the keys without runs_as
+func (etlx *ETLX) validateKey(conf map[string]any, key string, defaultRunsAs string) []ValidationError {
+	if conf == nil {
+		conf = etlx.Config
+	}
+	data, ok := conf[key].(map[string]any)
+	if !ok {
+		return nil
+	}
+	metadata, ok := data["metadata"].(map[string]any)
+	if !ok {
+		// NOT A RUNNABLE KEY (E.G. A QUERY DOC)
+		return nil
+	}
+	runsAs, ok := metadata["runs_as"].(string)
+	if _, exists := metadata["runs_as"]; exists && !ok {
+		return []ValidationError{{Level: "error", Key: key, Field: "runs_as", Msg: fmt.Sprintf("field runs_as must be string, got %s", typeName(metadata["runs_as"]))}}
+	}
+	if !ok {
+		runsAs = defaultRunsAs
+	}
+	schema, ok := SchemaFor(runsAs)
+	if !ok {
+		return nil
+	}
+	errs := validateMetadata(metadata, schema.Key, nil, schema.Lenient, key, "")
+	if schema.NoItems {
+		return errs
+	}
+	for _, itemKey := range mdKeyItems(data) {
+		item, ok := data[itemKey].(map[string]any)
+		if !ok {
+			continue
+		}
+		itemMetadata, ok := item["metadata"].(map[string]any)
+		if !ok {
+			// THE RUNNERS SKIP IT, BUT IT IS MOST LIKELY A MISSING OR MISPLACED yaml metadata BLOCK
+			msg := "missing metadata (yaml metadata block)"
+			if _, exists := item["metadata"]; exists {
+				msg = fmt.Sprintf("field metadata must be map, got %s", typeName(item["metadata"]))
+			}
+			errs = append(errs, ValidationError{Level: "error", Key: key, Item: itemKey, Field: "metadata", Msg: msg})
+			continue
+		}
+		errs = append(errs, validateMetadata(itemMetadata, schema.Item, schema.ItemPattern, schema.Lenient, key, itemKey)...)
+		errs = append(errs, etlx.validateSessionSQL(metadata, item, key, itemKey)...)
+	}
+	return errs
+}
+
+// Validate checks every Level 1 key of the config, with the line numbers of
+// the problems in etlx.MD
+func (etlx *ETLX) Validate() []ValidationError {
+	errs := []ValidationError{}
+	order := []string{}
+	if _order, ok := etlx.Config["__order"].([]any); ok {
+		for _, key := range _order {
+			order = append(order, fmt.Sprintf("%v", key))
+		}
+	} else if _order, ok := etlx.Config["__order"].([]string); ok {
+		order = _order
+	}
+	for _, key := range order {
+		errs = append(errs, etlx.ValidateKey(nil, key)...)
+		errs = append(errs, etlx.validateFlow(key)...)
+		errs = append(errs, etlx.validateForEach(key)...)
+	}
+	if _, err := etlx.BuildDAG(order); err != nil {
+		var notFound *depsNotFoundError
+		if errors.As(err, &notFound) {
+			for _, dep := range notFound.deps {
+				errs = append(errs, ValidationError{Level: "error", Key: dep.Key, Item: dep.Item, Field: "depends_on", Msg: fmt.Sprintf("depends_on %s not found", dep.DependsOn)})
+			}
+		} else {
+			errs = append(errs, ValidationError{Level: "error", Key: "depends_on", Msg: err.Error()})
+		}
+	}
+	frontmatter, _ := etlx.Config["__frontmatter"].(map[string]any)
+	if _, err := ParamSpecsFrom(frontmatter["params"]); err != nil {
+		errs = append(errs, ValidationError{Level: "error", Key: "params", Msg: err.Error()})
+	}
+	lines := mdLineIndex(etlx.MD)
+	for i := range errs {
+		errs[i].Line = lines.find(errs[i].Key, errs[i].Item, errs[i].Field)
+	}
+	return errs
+}
+
+// validateUpFront is called by the runners before running a key, so a
+// malformed metadata is reported as an error instead of a panic
+func (etlx *ETLX) validateUpFront(conf map[string]any, key string, process string) error {
+	msgs := []string{}
+	for _, err := range etlx.validateKey(conf, key, process) {
+		if err.Level == "error" {
+			msgs = append(msgs, err.Error())
+		}
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("invalid config: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// mdLines maps the keys, items and metadata fields to their line in the md
+type mdLines map[string]int
+
+var (
+	mdHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdFenceRe   = regexp.MustCompile("^\\s*(```+|~~~+)\\s*(.*)$")
+	mdFieldRe   = regexp.MustCompile(`^([A-Za-z_][\w\-]*)\s*:`)
+)
+
+// mdLineIndex indexes the headings (level 1 keys, level 2 items) and the top
+// level fields of their metadata blocks
+func mdLineIndex(md string) mdLines {
+	lines := mdLines{}
+	key, item := "", ""
+	inFence, inMetadata := false, false
+	fence := ""
+	for i, line := range strings.Split(md, "\n") {
+		n := i + 1
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil {
+			if !inFence {
+				inFence, fence = true, m[1][:3]
+				info := strings.TrimSpace(m[2])
+				inMetadata = strings.HasPrefix(info, "yaml") && (strings.TrimSpace(strings.TrimPrefix(info, "yaml")) == "metadata" || strings.TrimSpace(strings.TrimPrefix(info, "yaml")) == "")
+				continue
+			} else if strings.HasPrefix(strings.TrimSpace(line), fence) && strings.TrimSpace(m[2]) == "" {
+				inFence, inMetadata = false, false
+				continue
+			}
+		}
+		if inFence {
+			if inMetadata {
+				if m := mdFieldRe.FindStringSubmatch(line); m != nil {
+					_key := fmt.Sprintf("%s|%s|%s", key, item, m[1])
+					if _, ok := lines[_key]; !ok {
+						lines[_key] = n
+					}
+				}
+			}
+			continue
+		}
+		if m := mdHeadingRe.FindStringSubmatch(line); m != nil {
+			switch len(m[1]) {
+			case 1:
+				key, item = m[2], ""
+			case 2:
+				item = m[2]
+			default:
+				continue
+			}
+			_key := fmt.Sprintf("%s|%s|", key, item)
+			if _, ok := lines[_key]; !ok {
+				lines[_key] = n
+			}
+		}
+	}
+	return lines
+}
+
+// find returns the line of the field, falling back to the item and key headings
+func (lines mdLines) find(key string, item string, field string) int {
+	for _, _key := range []string{fmt.Sprintf("%s|%s|%s", key, item, field), fmt.Sprintf("%s|%s|", key, item), fmt.Sprintf("%s||", key)} {
+		if n, ok := lines[_key]; ok {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// MaskHandler is a slog.Handler masking the registered secrets in the
+// message and the attributes of the records before passing them on
+type MaskHandler struct {
+	slog.Handler
+}
+
+// NewMaskHandler wraps h, a MaskHandler is returned as it is
+func NewMaskHandler(h slog.Handler) slog.Handler {
+	if _, ok := h.(*MaskHandler); ok {
+		return h
+	}
+	return &MaskHandler{Handler: h}
+}
+
+func (h *MaskHandler) Handle(ctx context.Context, r slog.Record) error {
+	masked := slog.NewRecord(r.Time, r.Level, Mask(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		masked.AddAttrs(maskAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, masked)
+}
+
+func (h *MaskHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	_attrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		_attrs[i] = maskAttr(a)
+	}
+	return &MaskHandler{Handler: h.Handler.WithAttrs(_attrs)}
+}
+
+func (h *MaskHandler) WithGroup(name string) slog.Handler {
+	return &MaskHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+func maskAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Mask(v.String()))
+	case slog.KindGroup:
+		attrs := v.Group()
+		_attrs := make([]any, len(attrs))
+		for i, _a := range attrs {
+			_attrs[i] = maskAttr(_a)
+		}
+		return slog.Group(a.Key, _attrs...)
+	case slog.KindAny:
+		switch _v := v.Any().(type) {
+		case error:
+			return slog.Any(a.Key, MaskErr(_v))
+		case fmt.Stringer:
+			return slog.String(a.Key, Mask(_v.String()))
+		case []byte:
+			return slog.String(a.Key, Mask(string(_v)))
+		case map[string]any, []any:
+			return slog.String(a.Key, Mask(fmt.Sprint(_v)))
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+var logger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger the provider failures are reported to, nil
+// reports them on stderr
+func SetLogger(l *slog.Logger) {
+	logger.Store(l)
+}
+
+func log() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return slog.New(NewMaskHandler(slog.NewTextHandler(os.Stderr, nil)))
+}
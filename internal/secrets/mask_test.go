@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	Register("s3cr3t p@ss")
+	Register("s3cr3t")
+	Register("abc")
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"password is s3cr3t p@ss", "password is ****"},
+		{"token s3cr3t", "token ****"},
+		{"dsn sqlserver://db?password=s3cr3t+p%40ss", "dsn sqlserver://db?password=****"},
+		{"short abc stays", "short abc stays"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Mask(tt.in); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMaskErr(t *testing.T) {
+	Register("hunter22")
+	if MaskErr(nil) != nil {
+		t.Error("MaskErr(nil) != nil")
+	}
+	plain := errors.New("nothing to hide")
+	if MaskErr(plain) != plain {
+		t.Error("an error without secrets is not returned as it is")
+	}
+	err := MaskErr(fmt.Errorf("login with hunter22: %w", fs.ErrPermission))
+	if err.Error() != "login with ****: permission denied" {
+		t.Errorf("MaskErr = %q", err)
+	}
+	if !errors.Is(err, fs.ErrPermission) {
+		t.Error("the masked error does not unwrap to the original one")
+	}
+}
+
+func TestRegisterDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"postgres://etl:pg%2Fpass1@db:5432/x?sslmode=disable", "postgres://etl:****@db:5432/x?sslmode=disable"},
+		{"etl:mysqlpass@tcp(db:3306)/x", "etl:****@tcp(db:3306)/x"},
+		{"host=db user=etl password='kv pass' dbname=x", "host=db user=etl password='****' dbname=x"},
+		{"Server=db;Uid=etl;Pwd={odbc;pass};Database=x", "Server=db;Uid=etl;Pwd={****};Database=x"},
+		{"sqlserver://db?database=x&password=querypass", "sqlserver://db?database=x&password=****"},
+		{"http://host:8080/x@y", "http://host:8080/x@y"},
+		{"duckdb:lake.db", "duckdb:lake.db"},
+	}
+	for _, tt := range tests {
+		RegisterDSN(tt.dsn)
+		if got := Mask(tt.dsn); got != tt.want {
+			t.Errorf("Mask(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+	// THE DECODED FORM OF AN URL PASSWORD IS MASKED TOO
+	if got := Mask("pg/pass1"); got != MaskText {
+		t.Errorf("Mask(pg/pass1) = %q", got)
+	}
+}
+
+func TestResolverMasksEnvDSN(t *testing.T) {
+	t.Setenv("ETLX_TEST_DSN", "postgres://etl:envdsnpass@db/x")
+	t.Setenv("ETLX_TEST_HOST", "db.internal")
+	t.Setenv("ETLX_TEST_API_KEY", "key-by-name")
+	r := NewResolver().Add(Env{}, false)
+	for _, key := range []string{"ETLX_TEST_DSN", "ETLX_TEST_HOST", "ETLX_TEST_API_KEY"} {
+		if _, ok := r.Lookup(key); !ok {
+			t.Fatalf("Lookup(%s) not found", key)
+		}
+	}
+	if got := Mask("postgres://etl:envdsnpass@db/x db.internal key-by-name"); got != "postgres://etl:****@db/x db.internal ****" {
+		t.Errorf("Mask = %q", got)
+	}
+}
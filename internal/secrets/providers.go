@@ -0,0 +1,160 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// keyRe are the names a file based provider looks up, no paths
+var keyRe = regexp.MustCompile(`^[\w.\-]+$`)
+
+// Env resolves the secrets from the process environment (and the .env
+// loaded into it)
+type Env struct{}
+
+func (Env) Name() string { return "env" }
+
+func (Env) Lookup(key string) (string, bool, error) {
+	value, ok := os.LookupEnv(key)
+	return value, ok, nil
+}
+
+// Dir resolves each secret from the file with its name in Path, as mounted
+// by Docker (/run/secrets) and Kubernetes secret volumes. The exact name is
+// tried first and then lower case, the trailing new line is dropped
+type Dir struct {
+	Path string
+}
+
+func (d *Dir) Name() string { return "dir" }
+
+func (d *Dir) Lookup(key string) (string, bool, error) {
+	if !keyRe.MatchString(key) || strings.HasPrefix(key, ".") {
+		return "", false, nil
+	}
+	for _, name := range []string{key, strings.ToLower(key)} {
+		data, err := os.ReadFile(filepath.Join(d.Path, name))
+		if err == nil {
+			return strings.TrimRight(string(data), "\r\n"), true, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", false, err
+		}
+	}
+	return "", false, nil
+}
+
+// File resolves the secrets from an age encrypted file (binary or armored),
+// decrypted once with the Identity file (ETLX_SECRETS_AGE_IDENTITY) or the
+// Passphrase (ETLX_SECRETS_PASSPHRASE). Decrypted, it is a .env file or, when
+// named *.yaml.age / *.yml.age / *.json.age, a map of names to values:
+//
+//	age -p -o secrets.env.age secrets.env
+//	age -r age1... -o secrets.yaml.age secrets.yaml
+type File struct {
+	Path       string
+	Identity   string
+	Passphrase string
+	once       sync.Once
+	values     map[string]string
+	err        error
+}
+
+func (f *File) Name() string { return "file" }
+
+func (f *File) Lookup(key string) (string, bool, error) {
+	f.once.Do(func() { f.values, f.err = f.load() })
+	if f.err != nil {
+		return "", false, f.err
+	}
+	value, ok := f.values[key]
+	return value, ok, nil
+}
+
+func (f *File) identities() ([]age.Identity, error) {
+	identity := f.Identity
+	if identity == "" {
+		identity = os.Getenv("ETLX_SECRETS_AGE_IDENTITY")
+	}
+	passphrase := f.Passphrase
+	if passphrase == "" {
+		passphrase = os.Getenv("ETLX_SECRETS_PASSPHRASE")
+	}
+	identities := []age.Identity{}
+	if identity != "" {
+		data, err := os.ReadFile(identity)
+		if err != nil {
+			return nil, fmt.Errorf("reading the age identity: %w", err)
+		}
+		ids, err := age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parsing the age identity %s: %w", identity, err)
+		}
+		identities = append(identities, ids...)
+	}
+	if passphrase != "" {
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, id)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%s: no age identity nor passphrase (ETLX_SECRETS_AGE_IDENTITY / ETLX_SECRETS_PASSPHRASE)", f.Path)
+	}
+	return identities, nil
+}
+
+func (f *File) load() (map[string]string, error) {
+	identities, err := f.identities()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	var in io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		in = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", f.Path, err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting %s: %w", f.Path, err)
+	}
+	name := strings.TrimSuffix(strings.ToLower(f.Path), ".age")
+	switch filepath.Ext(name) {
+	case ".yaml", ".yml", ".json":
+		m := map[string]any{}
+		if err := yaml.Unmarshal(plain, &m); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", f.Path, err)
+		}
+		values := map[string]string{}
+		for k, v := range m {
+			if v != nil {
+				values[k] = fmt.Sprintf("%v", v)
+			}
+		}
+		return values, nil
+	}
+	values, err := godotenv.UnmarshalBytes(plain)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", f.Path, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "PG_PASS"), []byte("exact\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "api_token"), []byte("lower\r\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, ".hidden"), []byte("hidden"), 0o600)
+	d := &Dir{Path: dir}
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{"PG_PASS", "exact", true},
+		{"API_TOKEN", "lower", true},
+		{"MISSING", "", false},
+		{".hidden", "", false},
+		{"../PG_PASS", "", false},
+	}
+	for _, tt := range tests {
+		value, ok, err := d.Lookup(tt.key)
+		if err != nil || ok != tt.ok || value != tt.value {
+			t.Errorf("Lookup(%q) = %q, %v, %v, want %q, %v", tt.key, value, ok, err, tt.value, tt.ok)
+		}
+	}
+}
+
+// encrypt writes plain to name in dir, encrypted to the recipient
+func encrypt(t *testing.T, dir string, name string, plain string, recipient age.Recipient, armored bool) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	var out io.WriteCloser = nopCloser{buf}
+	if armored {
+		out = armor.NewWriter(buf)
+	}
+	w, err := age.Encrypt(out, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, plain)
+	w.Close()
+	out.Close()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := filepath.Join(dir, "age.key")
+	os.WriteFile(identity, []byte(id.String()+"\n"), 0o600)
+	scrypt, err := age.NewScryptRecipient("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrypt.SetWorkFactor(10)
+	t.Setenv("ETLX_SECRETS_AGE_IDENTITY", "")
+	t.Setenv("ETLX_SECRETS_PASSPHRASE", "")
+	tests := []struct {
+		name string
+		file *File
+	}{
+		{"env identity", &File{Path: encrypt(t, dir, "a.env.age", "PG_PASS=env-value\nPORT=5432\n", id.Recipient(), false), Identity: identity}},
+		{"armored", &File{Path: encrypt(t, dir, "b.env.age", "PG_PASS=env-value\nPORT=5432\n", id.Recipient(), true), Identity: identity}},
+		{"yaml passphrase", &File{Path: encrypt(t, dir, "c.yaml.age", "PG_PASS: env-value\nPORT: 5432\n", scrypt, false), Passphrase: "correct horse"}},
+		{"json", &File{Path: encrypt(t, dir, "d.json.age", `{"PG_PASS": "env-value", "PORT": 5432}`, id.Recipient(), false), Identity: identity}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if value, ok, err := tt.file.Lookup("PG_PASS"); err != nil || !ok || value != "env-value" {
+				t.Fatalf("Lookup(PG_PASS) = %q, %v, %v", value, ok, err)
+			}
+			if value, ok, _ := tt.file.Lookup("PORT"); !ok || value != "5432" {
+				t.Errorf("Lookup(PORT) = %q, %v", value, ok)
+			}
+			if _, ok, err := tt.file.Lookup("MISSING"); ok || err != nil {
+				t.Errorf("Lookup(MISSING) = %v, %v", ok, err)
+			}
+		})
+	}
+	errs := []struct {
+		name string
+		file *File
+		want string
+	}{
+		{"no identity", &File{Path: filepath.Join(dir, "a.env.age")}, "no age identity"},
+		{"wrong passphrase", &File{Path: filepath.Join(dir, "c.yaml.age"), Passphrase: "wrong"}, "decrypting"},
+		{"missing file", &File{Path: filepath.Join(dir, "none.age"), Identity: identity}, "no such file"},
+	}
+	for _, tt := range errs {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok, err := tt.file.Lookup("PG_PASS"); ok || err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Lookup = %v, %v, want an error with %q", ok, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Package secrets resolves the @VAR / $VAR references of the configs through
+// a chain of providers (environment, key-per-file directory, age encrypted
+// file, HashiCorp Vault KV) and masks the resolved values in the logs.
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider resolves a secret by its name, ok is false when it does not have it
+type Provider interface {
+	Name() string
+	Lookup(key string) (value string, ok bool, err error)
+}
+
+// secretNameRe matches the environment variables masked by default, the
+// other ones (hosts, ports, paths) are left readable in the logs
+var secretNameRe = regexp.MustCompile(`(?i)(PASS|PWD|SECRET|TOKEN|KEY|CREDENTIAL|AUTH)`)
+
+type source struct {
+	Provider
+	// mask tells if the value of key is masked
+	mask func(key string) bool
+}
+
+// Resolver looks a secret up in its providers, in order, the first one that
+// has it wins
+type Resolver struct {
+	sources []source
+	mu      sync.Mutex
+	failed  map[string]bool
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{failed: map[string]bool{}}
+}
+
+// Add appends a provider to the chain, its values are always masked when
+// mask is true, only the ones with a secret like name (PASS, TOKEN, KEY, ...)
+// and the passwords of the DSNs otherwise
+func (r *Resolver) Add(p Provider, mask bool) *Resolver {
+	s := source{Provider: p, mask: secretNameRe.MatchString}
+	if mask {
+		s.mask = func(string) bool { return true }
+	}
+	r.sources = append(r.sources, s)
+	return r
+}
+
+// Providers returns the names of the providers, in order
+func (r *Resolver) Providers() []string {
+	names := []string{}
+	for _, s := range r.sources {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+// Lookup resolves key, registering the value to be masked. A provider that
+// fails is reported once and skipped
+func (r *Resolver) Lookup(key string) (string, bool) {
+	for _, s := range r.sources {
+		value, ok, err := s.Lookup(key)
+		if err != nil {
+			r.report(s.Name(), err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if s.mask(key) {
+			Register(value)
+		} else {
+			RegisterDSN(value)
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// Getenv is os.Getenv through the resolver, empty when not found
+func (r *Resolver) Getenv(key string) string {
+	value, _ := r.Lookup(key)
+	return value
+}
+
+func (r *Resolver) report(provider string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed[provider] {
+		return
+	}
+	r.failed[provider] = true
+	log().Warn("secrets provider failed, skipped", "provider", provider, "err", err)
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultResolver *Resolver
+)
+
+// Default is the resolver of the configs without a secrets section: the
+// environment, followed by the providers set up by the environment variables
+//
+//	ETLX_SECRETS_DIR                a key-per-file directory (e.g. /run/secrets)
+//	ETLX_SECRETS_FILE               an age encrypted file, with
+//	ETLX_SECRETS_AGE_IDENTITY       the age identity file or
+//	ETLX_SECRETS_PASSPHRASE         the passphrase it was encrypted with
+//	ETLX_VAULT_PATH                 a Vault KV secret, with VAULT_ADDR,
+//	                                VAULT_TOKEN, VAULT_NAMESPACE,
+//	                                ETLX_VAULT_MOUNT (default secret) and
+//	                                ETLX_VAULT_TTL (default 5m)
+func Default() *Resolver {
+	defaultOnce.Do(func() {
+		defaultResolver = NewResolver().Add(Env{}, false)
+		if dir := os.Getenv("ETLX_SECRETS_DIR"); dir != "" {
+			defaultResolver.Add(&Dir{Path: dir}, true)
+		}
+		if file := os.Getenv("ETLX_SECRETS_FILE"); file != "" {
+			defaultResolver.Add(&File{Path: file}, true)
+		}
+		if path := os.Getenv("ETLX_VAULT_PATH"); path != "" {
+			vault := &Vault{Path: path}
+			if ttl, err := time.ParseDuration(os.Getenv("ETLX_VAULT_TTL")); err == nil {
+				vault.TTL = ttl
+			}
+			defaultResolver.Add(vault, true)
+		}
+	})
+	return defaultResolver
+}
+
+// FromConfig builds a resolver from the `secrets` list of the frontmatter:
+//
+//	secrets:
+//	  - provider: env
+//	  - provider: dir
+//	    path: /run/secrets
+//	  - provider: file
+//	    path: secrets.env.age
+//	    identity: $HOME/.config/etlx/age.key
+//	  - provider: vault
+//	    addr: https://vault.example.com
+//	    mount: secret
+//	    path: etlx/prod
+//
+// The options take $VAR from the environment, mask overrides the default
+// masking of each provider (false for env, true for the others)
+func FromConfig(conf any) (*Resolver, error) {
+	list, ok := conf.([]any)
+	if !ok {
+		return nil, fmt.Errorf("secrets must be a list of providers, got %T", conf)
+	}
+	r := NewResolver()
+	for i, item := range list {
+		opts := map[string]string{}
+		mask := true
+		switch v := item.(type) {
+		case string:
+			opts["provider"] = v
+		case map[string]any:
+			for k, _v := range v {
+				if k == "mask" {
+					if b, ok := _v.(bool); ok {
+						mask = b
+						continue
+					}
+				}
+				opts[k] = os.ExpandEnv(fmt.Sprintf("%v", _v))
+			}
+		default:
+			return nil, fmt.Errorf("secrets[%d] must be a provider name or a map, got %T", i, item)
+		}
+		if m, ok := item.(map[string]any); !ok || m["mask"] == nil {
+			mask = opts["provider"] != "env"
+		}
+		switch strings.ToLower(opts["provider"]) {
+		case "env":
+			r.Add(Env{}, mask)
+		case "dir":
+			if opts["path"] == "" {
+				return nil, fmt.Errorf("secrets[%d]: dir provider without path", i)
+			}
+			r.Add(&Dir{Path: opts["path"]}, mask)
+		case "file":
+			if opts["path"] == "" {
+				return nil, fmt.Errorf("secrets[%d]: file provider without path", i)
+			}
+			r.Add(&File{Path: opts["path"], Identity: opts["identity"], Passphrase: opts["passphrase"]}, mask)
+		case "vault":
+			if opts["path"] == "" {
+				return nil, fmt.Errorf("secrets[%d]: vault provider without path", i)
+			}
+			vault := &Vault{Addr: opts["addr"], Token: opts["token"], Namespace: opts["namespace"], Mount: opts["mount"], Path: opts["path"]}
+			if version, ok := opts["kv_version"]; ok {
+				if _, err := fmt.Sscanf(version, "%d", &vault.KVVersion); err != nil {
+					return nil, fmt.Errorf("secrets[%d]: kv_version must be 1 or 2, got %s", i, version)
+				}
+			}
+			if ttl, ok := opts["ttl"]; ok {
+				d, err := time.ParseDuration(ttl)
+				if err != nil {
+					return nil, fmt.Errorf("secrets[%d]: ttl must be a duration (e.g. 5m), got %s", i, ttl)
+				}
+				vault.TTL = d
+			}
+			r.Add(vault, mask)
+		default:
+			return nil, fmt.Errorf("secrets[%d]: unknown provider %q (env, dir, file or vault)", i, opts["provider"])
+		}
+	}
+	return r, nil
+}
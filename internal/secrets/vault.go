@@ -0,0 +1,154 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultVaultTTL is how long a Vault secret is cached before it is read again
+const DefaultVaultTTL = 5 * time.Minute
+
+// vaultRetryDelay is how long a failed read is reported before Vault is asked
+// again, so a Vault down is not called for every reference
+const vaultRetryDelay = 10 * time.Second
+
+// Vault resolves the secrets from the fields of a HashiCorp Vault KV secret,
+// read over the HTTP API and cached for TTL. Addr, Token and Namespace default
+// to VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE, Mount to ETLX_VAULT_MOUNT or
+// secret, KVVersion to 2, TTL to DefaultVaultTTL
+type Vault struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Mount     string
+	Path      string
+	KVVersion int
+	TTL       time.Duration
+	// Client defaults to a client with a 30s timeout
+	Client *http.Client
+	mu     sync.Mutex
+	values map[string]string
+	err    error
+	// next is when the secret is read again
+	next time.Time
+}
+
+func (v *Vault) Name() string { return "vault" }
+
+func (v *Vault) Lookup(key string) (string, bool, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now := time.Now(); !now.Before(v.next) {
+		values, err := v.read()
+		v.err = err
+		if err != nil {
+			v.next = now.Add(vaultRetryDelay)
+		} else {
+			v.values = values
+			ttl := v.TTL
+			if ttl <= 0 {
+				ttl = DefaultVaultTTL
+			}
+			v.next = now.Add(ttl)
+		}
+	}
+	// THE LAST VALUES READ ARE KEPT WHILE VAULT FAILS
+	if v.err != nil && v.values == nil {
+		return "", false, v.err
+	}
+	value, ok := v.values[key]
+	if !ok {
+		value, ok = v.values[strings.ToLower(key)]
+	}
+	return value, ok, nil
+}
+
+// url is the API path of the secret, /v1/<mount>/data/<path> on KV v2
+func (v *Vault) url() string {
+	addr := v.Addr
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:8200"
+	}
+	mount := v.Mount
+	if mount == "" {
+		mount = os.Getenv("ETLX_VAULT_MOUNT")
+	}
+	if mount == "" {
+		mount = "secret"
+	}
+	mount = strings.Trim(mount, "/")
+	path := strings.Trim(v.Path, "/")
+	if v.KVVersion == 1 {
+		return fmt.Sprintf("%s/v1/%s/%s", strings.TrimRight(addr, "/"), mount, path)
+	}
+	return fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(addr, "/"), mount, path)
+}
+
+func (v *Vault) read() (map[string]string, error) {
+	token := v.Token
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no token (VAULT_TOKEN) to read %s", v.Path)
+	}
+	Register(token)
+	namespace := v.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	req, err := http.NewRequest(http.MethodGet, v.url(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(body, &vaultErr)
+		return nil, fmt.Errorf("reading %s: %s %s", v.Path, res.Status, strings.Join(vaultErr.Errors, "; "))
+	}
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", v.Path, err)
+	}
+	data := secret.Data
+	if v.KVVersion != 1 {
+		data, _ = secret.Data["data"].(map[string]any)
+	}
+	values := map[string]string{}
+	for k, value := range data {
+		if value != nil {
+			values[k] = fmt.Sprintf("%v", value)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,156 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// vaultServer serves body with status on path, counting the reads
+func vaultServer(t *testing.T, path string, status *atomic.Int32, body *atomic.Value) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	reads := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reads.Add(1)
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if ns := r.Header.Get("X-Vault-Namespace"); ns != "" && ns != "team" {
+			t.Errorf("namespace = %q", ns)
+		}
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(body.Load().(string)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, reads
+}
+
+func TestVaultKV(t *testing.T) {
+	tests := []struct {
+		name      string
+		kvVersion int
+		path      string
+		body      string
+	}{
+		{"v2", 0, "/v1/secret/data/etlx/prod", `{"data":{"data":{"PG_PASS":"v2-password","port":5432},"metadata":{"version":3}}}`},
+		{"v1", 1, "/v1/secret/etlx/prod", `{"data":{"PG_PASS":"v1-password","port":5432}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &atomic.Int32{}
+			status.Store(http.StatusOK)
+			body := &atomic.Value{}
+			body.Store(tt.body)
+			srv, reads := vaultServer(t, tt.path, status, body)
+			v := &Vault{Addr: srv.URL, Token: "test-token", Namespace: "team", Path: "/etlx/prod/", KVVersion: tt.kvVersion}
+			value, ok, err := v.Lookup("PG_PASS")
+			if err != nil || !ok || value != tt.name+"-password" {
+				t.Fatalf("Lookup(PG_PASS) = %q, %v, %v", value, ok, err)
+			}
+			if value, ok, _ := v.Lookup("port"); !ok || value != "5432" {
+				t.Errorf("Lookup(port) = %q, %v", value, ok)
+			}
+			if _, ok, err := v.Lookup("MISSING"); ok || err != nil {
+				t.Errorf("Lookup(MISSING) = %v, %v", ok, err)
+			}
+			if n := reads.Load(); n != 1 {
+				t.Errorf("read %d times, want 1 within the ttl", n)
+			}
+		})
+	}
+}
+
+func TestVaultErrors(t *testing.T) {
+	status := &atomic.Int32{}
+	status.Store(http.StatusOK)
+	body := &atomic.Value{}
+	body.Store(`{"data":{"data":{}}}`)
+	srv, _ := vaultServer(t, "/v1/secret/data/etlx/prod", status, body)
+	tests := []struct {
+		name  string
+		vault *Vault
+		want  string
+	}{
+		{"forbidden", &Vault{Addr: srv.URL, Token: "wrong", Path: "etlx/prod"}, "403 Forbidden permission denied"},
+		{"not found", &Vault{Addr: srv.URL, Token: "test-token", Path: "etlx/other"}, "404 Not Found"},
+		{"no token", &Vault{Addr: srv.URL, Path: "etlx/prod"}, "no token"},
+		{"unreachable", &Vault{Addr: "http://127.0.0.1:1", Token: "test-token", Path: "etlx/prod"}, "connection refused"},
+	}
+	t.Setenv("VAULT_TOKEN", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok, err := tt.vault.Lookup("PG_PASS")
+			if ok || err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Lookup = %v, %v, want an error with %q", ok, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultRefresh(t *testing.T) {
+	status := &atomic.Int32{}
+	status.Store(http.StatusOK)
+	body := &atomic.Value{}
+	body.Store(`{"data":{"data":{"PG_PASS":"first"}}}`)
+	srv, reads := vaultServer(t, "/v1/secret/data/etlx/prod", status, body)
+	v := &Vault{Addr: srv.URL, Token: "test-token", Path: "etlx/prod", TTL: time.Millisecond}
+	if value, _, _ := v.Lookup("PG_PASS"); value != "first" {
+		t.Fatalf("Lookup = %q, want first", value)
+	}
+	// ROTATED, READ AGAIN ONCE THE TTL IS OVER
+	body.Store(`{"data":{"data":{"PG_PASS":"second"}}}`)
+	time.Sleep(5 * time.Millisecond)
+	if value, _, _ := v.Lookup("PG_PASS"); value != "second" {
+		t.Fatalf("Lookup after the ttl = %q, want second", value)
+	}
+	// VAULT DOWN, THE LAST VALUES ARE KEPT AND IT IS NOT CALLED AGAIN RIGHT AWAY
+	status.Store(http.StatusServiceUnavailable)
+	body.Store(`{"errors":["Vault is sealed"]}`)
+	time.Sleep(5 * time.Millisecond)
+	if value, ok, err := v.Lookup("PG_PASS"); value != "second" || !ok || err != nil {
+		t.Fatalf("Lookup while failing = %q, %v, %v, want the last value", value, ok, err)
+	}
+	n := reads.Load()
+	v.Lookup("PG_PASS")
+	if reads.Load() != n {
+		t.Errorf("read again before the retry delay")
+	}
+	// BACK UP, READ AGAIN AFTER THE RETRY DELAY
+	status.Store(http.StatusOK)
+	body.Store(`{"data":{"data":{"PG_PASS":"third"}}}`)
+	v.mu.Lock()
+	v.next = time.Now()
+	v.mu.Unlock()
+	if value, _, _ := v.Lookup("PG_PASS"); value != "third" {
+		t.Fatalf("Lookup after the retry delay = %q, want third", value)
+	}
+}
+
+func TestVaultRetryAfterError(t *testing.T) {
+	status := &atomic.Int32{}
+	status.Store(http.StatusInternalServerError)
+	body := &atomic.Value{}
+	body.Store(`{"errors":["internal error"]}`)
+	srv, _ := vaultServer(t, "/v1/secret/data/etlx/prod", status, body)
+	v := &Vault{Addr: srv.URL, Token: "test-token", Path: "etlx/prod"}
+	if _, _, err := v.Lookup("PG_PASS"); err == nil {
+		t.Fatal("Lookup did not fail")
+	}
+	status.Store(http.StatusOK)
+	body.Store(`{"data":{"data":{"PG_PASS":"recovered"}}}`)
+	v.mu.Lock()
+	v.next = time.Now()
+	v.mu.Unlock()
+	if value, ok, err := v.Lookup("PG_PASS"); value != "recovered" || !ok || err != nil {
+		t.Fatalf("Lookup after the error = %q, %v, %v", value, ok, err)
+	}
+}